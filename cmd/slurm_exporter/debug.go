@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// redacted replaces what a --web.debug-commands.redact pattern matches.
+const redacted = "[redacted]"
+
+// debugCommands serves /debug/commands: the last execution of every Slurm
+// command, as collector.CommandRuns keeps it, next to the CommandRegistry
+// entry it belongs to, and a POST that runs one of them once more.
+//
+// What the commands print names users and jobs, so the page is only served
+// behind the authentication of --web.config.file (checkDebugAuth), and every
+// argv, error and output it shows goes through the redact patterns first.
+type debugCommands struct {
+	log    *logger.Logger
+	redact []*regexp.Regexp
+	// rerun lets one re-run go at a time: the button is not a way to load
+	// slurmctld.
+	rerun sync.Mutex
+}
+
+func newDebugCommands(log *logger.Logger, patterns []string) (*debugCommands, error) {
+	d := &debugCommands{log: log}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		d.redact = append(d.redact, re)
+	}
+	return d, nil
+}
+
+// checkDebugAuth returns an error unless the web configuration file makes
+// every request authenticate, with basic_auth_users or with a client
+// certificate.
+func checkDebugAuth(webConfigFile string) error {
+	const how = "set basic_auth_users or client_auth_type: RequireAndVerifyClientCert in --web.config.file"
+	if webConfigFile == "" {
+		return errors.New("/debug/commands shows raw Slurm output and must be authenticated: " + how)
+	}
+	data, err := os.ReadFile(webConfigFile)
+	if err != nil {
+		return err
+	}
+	var cfg web.Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %w", webConfigFile, err)
+	}
+	if len(cfg.Users) == 0 && cfg.TLSConfig.ClientAuth != "RequireAndVerifyClientCert" {
+		return fmt.Errorf("/debug/commands shows raw Slurm output and must be authenticated, and %s does not: %s", webConfigFile, how)
+	}
+	return nil
+}
+
+// Handler returns the page, guarded against cross-site POSTs: a browser
+// holding the credentials would otherwise re-run commands for any site that
+// asked it to.
+func (d *debugCommands) Handler() http.Handler {
+	return http.NewCrossOriginProtection().Handler(d)
+}
+
+func (d *debugCommands) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		d.render(w)
+	case http.MethodPost:
+		d.rerunOnce(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "This endpoint accepts GET and POST requests.", http.StatusMethodNotAllowed)
+	}
+}
+
+// rerunOnce runs the command named by the form's name field once more, then
+// sends the browser back to its row.
+func (d *debugCommands) rerunOnce(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if !d.rerun.TryLock() {
+		http.Error(w, "Another command is being re-run.", http.StatusConflict)
+		return
+	}
+	defer d.rerun.Unlock()
+	d.log.Info("Re-running a Slurm command from /debug/commands", "name", name, "remote", r.RemoteAddr)
+	// Not bound to the request: a client that gives up does not leave a
+	// half-recorded run behind. Execute's own timeout bounds it.
+	if _, err := collector.RerunCommand(context.WithoutCancel(r.Context()), d.log, name); err != nil {
+		http.Error(w, d.redactString(err.Error()), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, r.URL.Path+"#"+name, http.StatusSeeOther)
+}
+
+// debugRow is one command on the page.
+type debugRow struct {
+	Name     string
+	Template string
+	Source   string
+	OptIn    string
+	// Rerunnable is false for a call that has neither run yet nor fixed
+	// arguments.
+	Rerunnable bool
+	Run        *debugRun
+}
+
+type debugRun struct {
+	CommandLine string
+	Source      string
+	Started     string
+	Ago         string
+	Duration    string
+	ExitCode    int
+	Err         string
+	Stdout      string
+	StdoutBytes int
+	StdoutCut   bool
+	Stderr      string
+	StderrBytes int
+	StderrCut   bool
+}
+
+// rows lists every registered call, then the calls the registry does not
+// declare that ran anyway.
+func (d *debugCommands) rows(now time.Time) []debugRow {
+	runs := make(map[string]collector.CommandRun)
+	for _, r := range collector.CommandRuns() {
+		runs[r.Name] = r
+	}
+	var rows []debugRow
+	for _, call := range collector.RegisteredCalls() {
+		row := debugRow{
+			Name:     call.Name,
+			Template: strings.Join(append([]string{call.Binary}, call.Args...), " "),
+			Source:   call.Command.Source,
+			OptIn:    call.Command.OptIn,
+		}
+		if call.JSON != nil {
+			var optIn []string
+			for _, c := range collector.CommandRegistry {
+				if c.JSON == call.JSON {
+					optIn = append(optIn, "--slurm.json="+c.Name)
+				}
+			}
+			row.OptIn = strings.Join(optIn, " or ")
+		}
+		row.Rerunnable = call.JSON != nil || len(call.Command.Placeholders) == 0
+		if run, ok := runs[call.Name]; ok {
+			row.Run = d.view(run, now)
+			row.Rerunnable = true
+			delete(runs, call.Name)
+		}
+		rows = append(rows, row)
+	}
+	for _, run := range collector.CommandRuns() {
+		if _, ok := runs[run.Name]; ok {
+			rows = append(rows, debugRow{
+				Name:       run.Name,
+				Template:   run.Binary + " (not in the command registry)",
+				Rerunnable: true,
+				Run:        d.view(run, now),
+			})
+		}
+	}
+	return rows
+}
+
+func (d *debugCommands) view(run collector.CommandRun, now time.Time) *debugRun {
+	return &debugRun{
+		CommandLine: d.redactString(run.CommandLine()),
+		Source:      run.Source,
+		Started:     run.Started.UTC().Format(time.RFC3339),
+		Ago:         now.Sub(run.Started).Truncate(time.Second).String(),
+		Duration:    run.Duration.Round(time.Millisecond).String(),
+		ExitCode:    run.ExitCode,
+		Err:         d.redactString(run.Err),
+		Stdout:      d.redactString(string(run.Stdout)),
+		StdoutBytes: run.StdoutBytes,
+		StdoutCut:   run.StdoutBytes > len(run.Stdout),
+		Stderr:      d.redactString(string(run.Stderr)),
+		StderrBytes: run.StderrBytes,
+		StderrCut:   run.StderrBytes > len(run.Stderr),
+	}
+}
+
+// redactString applies every redact pattern to s. A pattern with capture
+// groups hides what its groups match, and keeps the rest of the match as
+// context: UserId=(\S+) turns UserId=alice(1000) into UserId=[redacted].
+// A pattern without groups hides the whole match.
+func (d *debugCommands) redactString(s string) string {
+	for _, re := range d.redact {
+		matches := re.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			spans := m[:2]
+			if len(m) > 2 {
+				spans = m[2:]
+			}
+			for i := 0; i < len(spans); i += 2 {
+				start, end := spans[i], spans[i+1]
+				if start < last || start == end {
+					continue
+				}
+				b.WriteString(s[last:start])
+				b.WriteString(redacted)
+				last = end
+			}
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+func (d *debugCommands) render(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	data := struct {
+		Rows   []debugRow
+		Redact int
+		Limit  int
+	}{d.rows(time.Now()), len(d.redact), collector.CommandOutputLimit}
+	if err := debugCommandsTemplate.Execute(w, data); err != nil {
+		d.log.Warn("Cannot render /debug/commands", "err", err)
+	}
+}
+
+var debugCommandsTemplate = template.Must(template.New("debug").Parse(`<html>
+	<head>
+		<title>Slurm Exporter — commands</title>
+		<style>
+			body { font-family: sans-serif; margin: 1em 2em; }
+			section { border-top: 1px solid #ccc; padding: 0.5em 0; }
+			pre { background: #f5f5f5; padding: 0.5em; overflow-x: auto; max-height: 30em; }
+			.failed { color: #b00; }
+			.meta { color: #555; }
+		</style>
+	</head>
+	<body>
+		<h1>Slurm commands</h1>
+		<p class="meta">The last execution of every command the collectors run.
+		Output is cut at {{.Limit}} bytes per stream.
+		{{if .Redact}}{{.Redact}} redact pattern(s) applied.{{else}}No redact pattern is configured.{{end}}</p>
+		{{range .Rows}}
+		<section id="{{.Name}}">
+			<h2>{{.Name}}</h2>
+			<p class="meta"><code>{{.Template}}</code>{{if .Source}} — {{.Source}}{{end}}{{if .OptIn}} — needs {{.OptIn}}{{end}}</p>
+			{{with .Run}}
+			<p><code>{{.CommandLine}}</code></p>
+			<p class="meta">Started {{.Started}} ({{.Ago}} ago) from the {{.Source}} source, ran {{.Duration}},
+				exit status <span{{if ne .ExitCode 0}} class="failed"{{end}}>{{.ExitCode}}</span>.</p>
+			{{if .Err}}<p class="failed">{{.Err}}</p>{{end}}
+			<details{{if .Err}} open{{end}}><summary>stdout, {{.StdoutBytes}} bytes{{if .StdoutCut}}, cut{{end}}</summary><pre>{{.Stdout}}</pre></details>
+			{{if .StderrBytes}}<details open><summary>stderr, {{.StderrBytes}} bytes{{if .StderrCut}}, cut{{end}}</summary><pre>{{.Stderr}}</pre></details>{{end}}
+			{{else}}
+			<p class="meta">Not run since the exporter started.</p>
+			{{end}}
+			{{if .Rerunnable}}
+			<form method="post"><input type="hidden" name="name" value="{{.Name}}"><button type="submit">Run once now</button></form>
+			{{end}}
+		</section>
+		{{end}}
+	</body>
+</html>`))
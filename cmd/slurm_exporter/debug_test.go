@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// fixedSource answers every command with the same scontrol-like line.
+type fixedSource struct{}
+
+func (fixedSource) Name() string { return "fixed" }
+
+func (fixedSource) Run(context.Context, string, []string) ([]byte, error) {
+	return []byte("JobId=42 JobName=secret-project UserId=alice(1000) <b>\n"), nil
+}
+
+func withCommandLog(t *testing.T) {
+	t.Helper()
+	old := collector.ActiveDataSource()
+	t.Cleanup(func() { collector.SetDataSource(old) })
+	collector.SetDataSource(fixedSource{})
+	collector.EnableCommandLog()
+}
+
+func TestCheckDebugAuth(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	assert.ErrorContains(t, checkDebugAuth(""), "must be authenticated")
+	assert.ErrorContains(t, checkDebugAuth(write("tls.yml", "tls_server_config:\n  cert_file: c\n  key_file: k\n")), "does not")
+	assert.NoError(t, checkDebugAuth(write("basic.yml", "basic_auth_users:\n  admin: $2y$10$abc\n")))
+	assert.NoError(t, checkDebugAuth(write("mtls.yml", "tls_server_config:\n  client_auth_type: RequireAndVerifyClientCert\n")))
+	assert.Error(t, checkDebugAuth(filepath.Join(dir, "absent.yml")))
+}
+
+func TestDebugCommands_Redact(t *testing.T) {
+	d, err := newDebugCommands(logger.NewTextLogger("error"), []string{`UserId=([^(\s]+)`, `JobName=(\S+)`, `secret`})
+	require.NoError(t, err)
+	// Groups hide only what they match; a pattern without groups hides it all.
+	assert.Equal(t,
+		"JobId=42 JobName=[redacted] UserId=[redacted](1000) a [redacted] b",
+		d.redactString("JobId=42 JobName=secret-project UserId=alice(1000) a secret b"),
+	)
+	assert.Equal(t, "no match", d.redactString("no match"))
+
+	_, err = newDebugCommands(logger.NewTextLogger("error"), []string{"("})
+	assert.ErrorContains(t, err, `redact pattern "("`)
+}
+
+func TestDebugCommands_Page(t *testing.T) {
+	withCommandLog(t)
+	log := logger.NewTextLogger("error")
+	_, err := collector.Execute(context.Background(), log, "scontrol", []string{"show", "nodes", "-o"})
+	require.NoError(t, err)
+
+	d, err := newDebugCommands(log, []string{`UserId=([^(\s]+)`})
+	require.NoError(t, err)
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	body := readBody(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `<section id="scontrol_nodes">`)
+	assert.Contains(t, body, "<code>scontrol show nodes -o</code>", "the exact argv")
+	assert.Contains(t, body, "UserId=[redacted](1000)")
+	assert.NotContains(t, body, "alice")
+	assert.Contains(t, body, "&lt;b&gt;", "output is escaped")
+	assert.Contains(t, body, "Not run since the exporter started.")
+	// sacct's window is computed when it runs: no button before then.
+	sacct := body[strings.Index(body, `<section id="sacct_efficiency">`):]
+	sacct = sacct[:strings.Index(sacct, "</section>")]
+	assert.NotContains(t, sacct, "<form")
+}
+
+func TestDebugCommands_Rerun(t *testing.T) {
+	withCommandLog(t)
+	d, err := newDebugCommands(logger.NewTextLogger("error"), nil)
+	require.NoError(t, err)
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.PostForm(srv.URL+"/debug/commands", url.Values{"name": {"scheduler"}})
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "/debug/commands#scheduler", resp.Header.Get("Location"))
+	var names []string
+	for _, r := range collector.CommandRuns() {
+		names = append(names, r.Name)
+	}
+	assert.Contains(t, names, "scheduler")
+
+	resp, err = client.PostForm(srv.URL+"/debug/commands", url.Values{"name": {"sacct_efficiency"}})
+	require.NoError(t, err)
+	assert.Contains(t, readBody(t, resp), "has not run yet")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Another site's form cannot make the browser re-run anything.
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/debug/commands", strings.NewReader("name=scheduler"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodDelete, srv.URL+"/debug/commands", nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
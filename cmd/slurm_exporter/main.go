@@ -18,9 +18,14 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,19 +33,63 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	promconfig "github.com/prometheus/common/config"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
 
 	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/config"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/otlp"
+	"github.com/sckyzo/slurm_exporter/internal/push"
+	"github.com/sckyzo/slurm_exporter/internal/relabel"
+	"github.com/sckyzo/slurm_exporter/internal/simulator"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
+// setByUser records, per flag name, whether the flag was given on the command
+// line. A flag given explicitly wins over the configuration file; one left at
+// its default yields to it. Only flags registered through trackedFlag are
+// recorded.
+var setByUser = make(map[string]*bool)
+
+// trackedFlag registers a flag that the configuration file can also set, and
+// records whether the user gave it explicitly.
+func trackedFlag(name, help string) *kingpin.FlagClause {
+	set := new(bool)
+	setByUser[name] = set
+	return kingpin.Flag(name, help).IsSetByUser(set)
+}
+
 var (
-	commandTimeout = kingpin.Flag("command.timeout", "Timeout for executing Slurm commands.").Default("5s").Duration()
-	logLevel       = kingpin.Flag("log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error]").Default("info").Enum("debug", "info", "warn", "error")
-	logFormat      = kingpin.Flag("log.format", "Log format. One of: [json, text]").Default("text").Enum("json", "text")
-	toolkitFlags   = webflag.AddFlags(kingpin.CommandLine, ":9341")
+	// configFile is the optional YAML file covering collector enablement,
+	// per-collector options, the command timeout and cache TTLs. It is
+	// re-read on SIGHUP and, with --web.enable-lifecycle, on POST /-/reload.
+	configFile = kingpin.Flag(
+		"config.file",
+		"Path to a YAML configuration file for collectors, their options, timeouts and cache TTLs. "+
+			"Reloaded on SIGHUP, or on POST /-/reload with --web.enable-lifecycle. Flags given on the "+
+			"command line override it.",
+	).Default("").String()
+
+	commandTimeout = trackedFlag("command.timeout", "Timeout for executing Slurm commands.").Default("5s").Duration()
+
+	// circuitThreshold and circuitBackoff configure the per-binary circuit
+	// breaker that stops calling an unresponsive slurmctld.
+	circuitThreshold = trackedFlag(
+		"command.circuit-breaker.threshold",
+		"Consecutive timeouts or 'Unable to contact slurm controller' errors after which a binary's "+
+			"commands are refused for --command.circuit-breaker.backoff. 0 disables the breaker.",
+	).Default("5").Int()
+	circuitBackoff = trackedFlag(
+		"command.circuit-breaker.backoff",
+		"How long a binary's commands are refused once its circuit breaker opens, before one is let through as a probe.",
+	).Default("1m").Duration()
+	logLevel     = kingpin.Flag("log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error]").Default("info").Enum("debug", "info", "warn", "error")
+	logFormat    = kingpin.Flag("log.format", "Log format. One of: [json, text]").Default("text").Enum("json", "text")
+	toolkitFlags = webflag.AddFlags(kingpin.CommandLine, ":9341")
 
 	// disableExporterMetrics removes Go runtime and process metrics from /metrics.
 	// Useful when scraping with a dedicated Go runtime exporter.
@@ -49,15 +98,58 @@ var (
 		"Exclude Go runtime and process metrics from /metrics endpoint.",
 	).Default("false").Bool()
 
+	// enableLifecycle serves POST /-/reload. Off by default, as in Prometheus:
+	// the endpoint has no authentication of its own, and SIGHUP needs none.
+	enableLifecycle = kingpin.Flag(
+		"web.enable-lifecycle",
+		"Serve POST /-/reload, which re-reads --config.file like SIGHUP. Anyone who can reach the "+
+			"listener can call it unless --web.config.file requires authentication.",
+	).Default("false").Bool()
+
+	// debugCommandsEnabled serves /debug/commands. Not reloadable: the
+	// command log is enabled once, before any collector runs.
+	debugCommandsEnabled = kingpin.Flag(
+		"web.debug-commands",
+		"Serve /debug/commands: the argv, exit status, stderr, duration and start of stdout of the last "+
+			"execution of every Slurm command, with a button to run one again. Requires authentication in "+
+			"--web.config.file.",
+	).Default("false").Bool()
+
+	debugCommandsRedact = kingpin.Flag(
+		"web.debug-commands.redact",
+		"Regular expression whose matches /debug/commands hides, in argv, errors and output; with capture "+
+			"groups, only what the groups match. Repeatable. For example 'UserId=([^(\\s]+)'.",
+	).Strings()
+
+	// readinessPingInterval, readinessPingFailures and readinessFailedScrapes
+	// tune /readyz. Not reloadable: the ping loop starts once, with the
+	// server.
+	readinessPingInterval = kingpin.Flag(
+		"readiness.ping-interval",
+		"Time between two scontrol ping runs for /readyz, in the background. 0 pings when /readyz is requested, "+
+			"at most once every 5s.",
+	).Default("0s").Duration()
+
+	readinessPingFailures = kingpin.Flag(
+		"readiness.ping-failures",
+		"Pings in a row that must fail before /readyz reports slurmctld unreachable. 0 disables the ping, "+
+			"and /readyz only looks at the scrapes.",
+	).Default("2").Int()
+
+	readinessFailedScrapes = kingpin.Flag(
+		"readiness.failed-scrapes",
+		"Collections in a row every collector must fail before /readyz reports not ready. 0 disables the check.",
+	).Default("3").Int()
+
 	// nodesFeatureSet controls whether active_feature_set label is included in nodes metrics
-	nodesFeatureSet = kingpin.Flag(
+	nodesFeatureSet = trackedFlag(
 		"collector.nodes.feature-set",
 		"Include active_feature_set label in slurm_nodes_* metrics. "+
 			"Disable on homogeneous clusters to reduce cardinality.",
 	).Default("true").Bool()
 
 	// nodeGRES controls whether the per-node GRES metrics are exposed.
-	nodeGRES = kingpin.Flag(
+	nodeGRES = trackedFlag(
 		"collector.node.gres",
 		"Expose slurm_node_gres_total and slurm_node_gres_used, broken down by "+
 			"gres_type. Disable on clusters with many GPU models or MIG profiles "+
@@ -65,7 +157,7 @@ var (
 	).Default("true").Bool()
 
 	// queueUserLabel controls whether the user label is included in queue metrics.
-	queueUserLabel = kingpin.Flag(
+	queueUserLabel = trackedFlag(
 		"collector.queue.user-label",
 		"Include user label in slurm_queue_* and slurm_cores_* metrics. "+
 			"Disable on clusters with many users to reduce cardinality.",
@@ -74,7 +166,7 @@ var (
 	// queueTerminalStates controls whether squeue is asked for every job state.
 	// Without it squeue reports pending and running jobs only, and the failure,
 	// timeout, cancellation and completion metrics all stay at zero (issue #27).
-	queueTerminalStates = kingpin.Flag(
+	queueTerminalStates = trackedFlag(
 		"collector.queue.terminal-states",
 		"Ask squeue for terminal job states (FAILED, TIMEOUT, CANCELLED, COMPLETED, ...) "+
 			"in addition to pending and running ones. Disable to restore the pre-1.9 query "+
@@ -82,7 +174,7 @@ var (
 	).Default("true").Bool()
 
 	// fairshareUserMetrics controls whether per-user fairshare metrics are collected.
-	fairshareUserMetrics = kingpin.Flag(
+	fairshareUserMetrics = trackedFlag(
 		"collector.fairshare.user-metrics",
 		"Collect per-user fairshare metrics (slurm_user_fairshare_*). "+
 			"Disable on clusters with many users to reduce cardinality "+
@@ -91,21 +183,67 @@ var (
 
 	// sacctEfficiencyInterval controls how often the sacct_efficiency collector
 	// refreshes its cache in the background. Set to a high value on busy clusters.
-	sacctEfficiencyInterval = kingpin.Flag(
+	sacctEfficiencyInterval = trackedFlag(
 		"collector.sacct.interval",
 		"Background refresh interval for the sacct_efficiency collector. "+
 			"sacct is never called more frequently than this regardless of scrape interval.",
 	).Default("5m").Duration()
 
 	// sacctEfficiencyLookback controls the time window for sacct queries.
-	sacctEfficiencyLookback = kingpin.Flag(
+	sacctEfficiencyLookback = trackedFlag(
 		"collector.sacct.lookback",
 		"Time window for sacct_efficiency queries (how far back to look for completed jobs). "+
 			"Shorter windows reduce DB load; longer windows give better statistics.",
 	).Default("1h").Duration()
 
+	// jobsLabels and jobsMaxJobs shape the per-job series of the jobs
+	// collector: which job fields slurm_job_info carries, and how many jobs a
+	// scrape may report at most.
+	jobsLabels = trackedFlag(
+		"collector.jobs.labels",
+		"Job field to add as a label to slurm_job_info, on top of job_id, user, account and partition. "+
+			"Repeatable. One of: ["+strings.Join(config.JobLabels, ", ")+"].",
+	).Strings()
+
+	jobsMaxJobs = trackedFlag(
+		"collector.jobs.max-jobs",
+		"Most running jobs the jobs collector reports per scrape. Beyond it the jobs holding the most "+
+			"GPUs, then CPUs, are kept and the rest counted in slurm_jobs_dropped.",
+	).Default("1000").Int()
+
+	// jobWaitBuckets and jobWaitStateFile configure the job_wait histogram and
+	// where it remembers the jobs it has observed.
+	jobWaitBuckets = trackedFlag(
+		"collector.job_wait.buckets",
+		"Upper bound, in seconds, of a slurm_job_wait_seconds bucket. Repeatable. "+
+			"Defaults to a minute, 5m, 15m, 30m, 1h, 2h, 4h, 12h, a day, 3 days and a week.",
+	).Float64List()
+
+	jobWaitStateFile = trackedFlag(
+		"collector.job_wait.state-file",
+		"File where the job_wait collector keeps the jobs it has observed, so a restart neither observes "+
+			"them again nor misses the jobs that started meanwhile. Empty keeps them in memory only.",
+	).Default("").String()
+
+	// maxConcurrency bounds how many collectors a scrape runs at once. Not
+	// reloadable: it belongs to the tracker, which a reload keeps.
+	maxConcurrency = kingpin.Flag(
+		"collector.max-concurrency",
+		"Maximum number of collectors run at the same time during a scrape. "+
+			"1 runs them one after another, as before 2.0.",
+	).Default(strconv.Itoa(collector.DefaultMaxConcurrency)).Int()
+
+	// coalesceWindow lets concurrent scrapes share one collection. Not
+	// reloadable, for the same reason as maxConcurrency.
+	coalesceWindow = kingpin.Flag(
+		"web.coalesce-window",
+		"Serve a scrape arriving while another scrape's collection runs, or less than this long after it "+
+			"started, from that collection instead of running the collectors again. 0 disables coalescing.",
+	).Default("0s").Duration()
+
 	// slurmBinPath is the directory where Slurm binaries are looked up.
 	// Empty string (default) means binaries must be on the system $PATH.
+	// Not reloadable: the binaries are validated once, at startup.
 	slurmBinPath = kingpin.Flag(
 		"slurm.bin-path",
 		"Directory containing Slurm binaries (sinfo, squeue, sdiag, ...). "+
@@ -113,68 +251,299 @@ var (
 			"where Slurm binaries are mounted from the host.",
 	).Default("").String()
 
+	// slurmCommandWrapper runs every Slurm command through another program.
+	// Not reloadable, like slurmBinPath: the binaries are validated through it
+	// at startup.
+	slurmCommandWrapper = kingpin.Flag(
+		"slurm.command-wrapper",
+		"Run every Slurm command through this command, for example 'ssh -o BatchMode=yes head --', "+
+			"'sudo -n -u slurm' or 'podman exec slurm-client'. Split into words like a shell would; the Slurm "+
+			"command and its arguments are appended, quoted for the remote shell with ssh, or substituted for "+
+			"{{command}} as one quoted string. --slurm.bin-path then names a directory on the other side.",
+	).Default("").String()
+
+	slurmCommandWrapperExitCodes = kingpin.Flag(
+		"slurm.command-wrapper.exit-codes",
+		"Exit statuses that mean the command wrapper failed rather than the Slurm command, "+
+			"counted under origin=\"wrapper\" in slurm_exporter_command_errors_total.",
+	).Default(wrapperExitCodesDefault()...).Ints()
+
+	// slurmSource selects where the collectors' data comes from: the Slurm
+	// binaries, or slurmrestd. Not reloadable: it decides what is validated at
+	// startup.
+	slurmSource = kingpin.Flag(
+		"slurm.source",
+		"Where to read Slurm data from. One of: [cli, rest]. "+
+			"rest queries slurmrestd and needs no Slurm client, munge key or slurm.conf on the exporter host.",
+	).Default("cli").Enum("cli", "rest")
+
+	slurmRESTURL = kingpin.Flag(
+		"slurm.rest.url",
+		"slurmrestd base URL, for example http://slurmrestd:6820. Required with --slurm.source=rest.",
+	).Default("").String()
+
+	slurmRESTTokenFile = kingpin.Flag(
+		"slurm.rest.token-file",
+		"File holding the JWT sent as X-SLURM-USER-TOKEN. Re-read on every request, "+
+			"so a token rotated on disk is picked up without a restart.",
+	).Default("").String()
+
+	slurmRESTUser = kingpin.Flag(
+		"slurm.rest.user",
+		"User name sent as X-SLURM-USER-NAME alongside the token.",
+	).Default("").String()
+
+	slurmRESTVersion = kingpin.Flag(
+		"slurm.rest.api-version",
+		"slurmrestd API version to request.",
+	).Default(slurmrest.DefaultVersion).String()
+
+	slurmJSON = kingpin.Flag(
+		"slurm.json",
+		"Read this command through its --json form where the installed Slurm supports it (21.08 and later), "+
+			"falling back to its text parser otherwise: "+strings.Join(collector.JSONCommands(), ", ")+
+			", or "+collector.JSONAll+" of them. Repeatable. Ignored with --slurm.source=rest.",
+	).PlaceHolder("COMMAND").Strings()
+
+	// slurmRecordDir and slurmReplayDir capture and serve back the Slurm
+	// output the collectors read. Not reloadable: they decide the data source.
+	slurmRecordDir = kingpin.Flag(
+		"slurm.record-dir",
+		"Save the output, arguments and timing of every Slurm command the collectors run into this directory, "+
+			"named after the command registry. Each command keeps its latest output.",
+	).Default("").String()
+
+	slurmReplayDir = kingpin.Flag(
+		"slurm.replay-dir",
+		"Serve Slurm data from a directory written by --slurm.record-dir instead of running any command "+
+			"or querying slurmrestd.",
+	).Default("").String()
+
+	// slurmSimulate serves Slurm data from a simulated cluster. Not
+	// reloadable: it decides the data source.
+	slurmSimulate = kingpin.Flag(
+		"slurm.simulate",
+		"Serve Slurm data from a simulated cluster described by this YAML model instead of running any command "+
+			"or querying slurmrestd. For developing dashboards and alerts; see docs/simulate-cluster.yaml.",
+	).Default("").String()
+
+	// The push flags send the metrics to Prometheus instead of waiting to be
+	// scraped. Not reloadable: the push loop starts once, at startup.
+	pushURL = kingpin.Flag(
+		"push.url",
+		"Push the metrics to this URL on --push.interval, in addition to serving /metrics: a remote_write "+
+			"endpoint such as https://prometheus:9090/api/v1/write, or a Pushgateway. Empty disables pushing.",
+	).Default("").String()
+
+	pushProtocol = kingpin.Flag(
+		"push.protocol",
+		"How to push. One of: [remote_write, pushgateway].",
+	).Default(string(push.RemoteWrite)).Enum(string(push.RemoteWrite), string(push.Pushgateway))
+
+	pushInterval = kingpin.Flag(
+		"push.interval",
+		"Time between two pushes. Each one runs the enabled collectors, like a scrape.",
+	).Default(push.DefaultInterval.String()).Duration()
+
+	pushTimeout = kingpin.Flag(
+		"push.timeout",
+		"Timeout of each push request.",
+	).Default(push.DefaultTimeout.String()).Duration()
+
+	pushLabels = kingpin.Flag(
+		"push.label",
+		"Label added to every pushed series that does not carry it, as name=value. Repeatable. "+
+			"job defaults to slurm_exporter and instance to the host name; with the Pushgateway they are the grouping key.",
+	).StringMap()
+
+	pushHTTPConfigFile = kingpin.Flag(
+		"push.http-config.file",
+		"Prometheus HTTP client configuration file for the push requests: basic_auth, authorization "+
+			"(bearer token), tls_config, proxy_url and the like, as in a remote_write section of prometheus.yml.",
+	).Default("").String()
+
+	pushRetries = kingpin.Flag(
+		"push.retries",
+		"Times a push failing with a network error, a 5xx or a 429 is tried again before it is queued or dropped.",
+	).Default("3").Int()
+
+	pushRetryBackoff = kingpin.Flag(
+		"push.retry-backoff",
+		"Wait before the first retry, doubled for each one after it, up to --push.interval.",
+	).Default(push.DefaultRetryBackoff.String()).Duration()
+
+	pushQueueDir = kingpin.Flag(
+		"push.queue.dir",
+		"Keep the remote_write pushes that failed in this directory, and send them, oldest first, once the "+
+			"receiver is back. Survives a restart. Empty drops them.",
+	).Default("").String()
+
+	pushQueueMaxSize = kingpin.Flag(
+		"push.queue.max-size",
+		"Size of --push.queue.dir past which the oldest pushes are dropped.",
+	).Default("256MB").Bytes()
+
+	// The otlp flags send the metrics to an OpenTelemetry collector, beside
+	// /metrics. Not reloadable: the export loop starts once, at startup.
+	otlpEndpoint = kingpin.Flag(
+		"otlp.endpoint",
+		"Export the metrics over OTLP to this collector on --otlp.interval, in addition to serving /metrics: "+
+			"http(s)://host:4318 (or the full /v1/metrics URL) with http/protobuf, http(s)://host:4317 with grpc. "+
+			"Empty disables the export.",
+	).Default("").String()
+
+	otlpProtocol = kingpin.Flag(
+		"otlp.protocol",
+		"OTLP transport. One of: [http/protobuf, grpc]. grpc over http:// is HTTP/2 without TLS.",
+	).Default(string(otlp.HTTPProtobuf)).Enum(string(otlp.HTTPProtobuf), string(otlp.GRPC))
+
+	otlpInterval = kingpin.Flag(
+		"otlp.interval",
+		"Time between two OTLP exports. Each one runs the enabled collectors, like a scrape.",
+	).Default(otlp.DefaultInterval.String()).Duration()
+
+	otlpTimeout = kingpin.Flag(
+		"otlp.timeout",
+		"Timeout of each OTLP export.",
+	).Default(otlp.DefaultTimeout.String()).Duration()
+
+	otlpHeaders = kingpin.Flag(
+		"otlp.header",
+		"Header sent with every OTLP export, as name=value, typically for authentication. Repeatable.",
+	).StringMap()
+
+	otlpResourceAttributes = kingpin.Flag(
+		"otlp.resource-attribute",
+		"Resource attribute describing the exporter and its cluster, as key=value, for example "+
+			"slurm.cluster.name=hpc. Repeatable; overrides OTEL_RESOURCE_ATTRIBUTES. service.name defaults to "+
+			"OTEL_SERVICE_NAME or slurm_exporter, host.name and service.instance.id to the host name.",
+	).StringMap()
+
+	otlpHTTPConfigFile = kingpin.Flag(
+		"otlp.http-config.file",
+		"Prometheus HTTP client configuration file for the OTLP exports: basic_auth, authorization, tls_config, "+
+			"proxy_url and the like. Not usable with grpc over http://.",
+	).Default("").String()
+
 	// collectorState stores the enabled/disabled state of each collector
 	collectorState = make(map[string]*bool)
+
+	// collectorTimeouts stores each collector's --collector.<name>.timeout.
+	collectorTimeouts = make(map[string]*time.Duration)
+
+	// collectorRefreshIntervals stores each collector's
+	// --collector.<name>.refresh-interval.
+	collectorRefreshIntervals = make(map[string]*time.Duration)
+
+	// collectorStaleMaxAges stores each collector's
+	// --collector.<name>.stale-max-age.
+	collectorStaleMaxAges = make(map[string]*time.Duration)
+
+	// collectorTopN stores --collector.<name>.top-n, for the collectors in
+	// config.TopNCollectors only.
+	collectorTopN = make(map[string]*int)
 )
 
+// collectorOptions carries the per-collector settings the constructors read,
+// resolved from the flags and the configuration file by resolveSettings.
+type collectorOptions struct {
+	nodesFeatureSet      bool
+	nodeGRES             bool
+	queueUserLabel       bool
+	queueTerminalStates  bool
+	fairshareUserMetrics bool
+	sacctInterval        time.Duration
+	sacctLookback        time.Duration
+	jobsLabels           []string
+	jobsMaxJobs          int
+	jobWaitBuckets       []float64
+	jobWaitStateFile     string
+	// topN holds the top-N limit of each collector in config.TopNCollectors.
+	// A collector absent from it keeps every user or account.
+	topN map[string]int
+}
+
+// collectorConstructor builds one collector. ctx lives as long as the
+// collector set the collector belongs to: it is cancelled on SIGTERM/SIGINT
+// and when a configuration reload replaces the set, so a collector running a
+// background goroutine stops with it (see issue #18).
+type collectorConstructor func(ctx context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector
+
 // collectorConstructors maps collector names to their constructor functions
-var collectorConstructors = map[string]func(logger *logger.Logger) prometheus.Collector{
-	"accounts":     func(l *logger.Logger) prometheus.Collector { return collector.NewAccountsCollector(l) },
-	"cpus":         func(l *logger.Logger) prometheus.Collector { return collector.NewCPUsCollector(l) },
-	"nodes":        func(l *logger.Logger) prometheus.Collector { return collector.NewNodesCollector(l, *nodesFeatureSet) },
-	"node":         func(l *logger.Logger) prometheus.Collector { return collector.NewNodeCollector(l, *nodeGRES) },
-	"drain_reason": func(l *logger.Logger) prometheus.Collector { return collector.NewDrainReasonCollector(l) },
-	"partitions":   func(l *logger.Logger) prometheus.Collector { return collector.NewPartitionsCollector(l) },
-	"queue": func(l *logger.Logger) prometheus.Collector {
-		return collector.NewQueueCollector(l, *queueUserLabel, *queueTerminalStates)
+var collectorConstructors = map[string]collectorConstructor{
+	"accounts": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewAccountsCollector(l, o.topN["accounts"])
 	},
-	"scheduler": func(l *logger.Logger) prometheus.Collector { return collector.NewSchedulerCollector(l) },
-	"fairshare": func(l *logger.Logger) prometheus.Collector {
-		return collector.NewFairShareCollector(l, *fairshareUserMetrics)
+	"cpus": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewCPUsCollector(l)
+	},
+	"controller": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewControllerCollector(l)
+	},
+	"nodes": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewNodesCollector(l, o.nodesFeatureSet)
+	},
+	"node": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewNodeCollector(l, o.nodeGRES)
+	},
+	"drain_reason": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewDrainReasonCollector(l)
+	},
+	"partitions": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewPartitionsCollector(l)
+	},
+	"queue": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewQueueCollector(l, o.queueUserLabel, o.queueTerminalStates, o.topN["queue"])
+	},
+	"scheduler": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewSchedulerCollector(l, o.topN["scheduler"])
+	},
+	"fairshare": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewFairShareCollector(l, o.fairshareUserMetrics, o.topN["fairshare"])
+	},
+	"users": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewUsersCollector(l, o.topN["users"])
+	},
+	"info": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewSlurmInfoCollector(l)
+	},
+	"gpus": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewGPUsCollector(l)
+	},
+	"reservations": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewReservationsCollector(l)
+	},
+	"reservation_nodes": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewReservationNodesCollector(l)
+	},
+	"job_wait": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewJobWaitCollector(l, o.jobWaitBuckets, o.jobWaitStateFile)
+	},
+	"licenses": func(_ context.Context, l *logger.Logger, _ *collectorOptions) prometheus.Collector {
+		return collector.NewLicensesCollector(l)
+	},
+	"jobs": func(_ context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		return collector.NewJobsCollector(l, o.jobsLabels, o.jobsMaxJobs)
+	},
+	// The only constructor using ctx: the background refresh goroutine is
+	// started here and exits when the collector set is replaced or the process
+	// is signalled. The reloader waits on its Done() channel at shutdown.
+	"sacct_efficiency": func(ctx context.Context, l *logger.Logger, o *collectorOptions) prometheus.Collector {
+		c := collector.NewSacctEfficiencyCollector(l, o.sacctInterval, o.sacctLookback)
+		c.Start(ctx)
+		return c
 	},
-	"users":             func(l *logger.Logger) prometheus.Collector { return collector.NewUsersCollector(l) },
-	"info":              func(l *logger.Logger) prometheus.Collector { return collector.NewSlurmInfoCollector(l) },
-	"gpus":              func(l *logger.Logger) prometheus.Collector { return collector.NewGPUsCollector(l) },
-	"reservations":      func(l *logger.Logger) prometheus.Collector { return collector.NewReservationsCollector(l) },
-	"reservation_nodes": func(l *logger.Logger) prometheus.Collector { return collector.NewReservationNodesCollector(l) },
-	"licenses":          func(l *logger.Logger) prometheus.Collector { return collector.NewLicensesCollector(l) },
-	// Nil because the signal context does not exist yet at package-init time.
-	// main() replaces this entry with a signal-aware constructor before
-	// registerCollectors ranges over the map, so the goroutine is cancelled
-	// cleanly on SIGTERM/SIGINT (see issue #18).
-	"sacct_efficiency": nil,
-}
-
-// indexHTML is the HTML content displayed on the root page
-const indexHTML = `<html>
-	<head><title>Slurm Exporter</title></head>
-	<body>
-		<h1>Slurm Exporter</h1>
-		<p>Welcome to the Slurm Exporter. Click <a href='/metrics'>here</a> to see the metrics.</p>
-	</body>
-</html>`
-
-// registerCollectors registers enabled collectors with the Prometheus registry.
-// All enabled collectors are wrapped by a single StatusTracker that emits
-// per-collector health metrics (success, duration) without desc conflicts.
-func registerCollectors(reg *prometheus.Registry, log *logger.Logger) {
-	tracker := collector.NewStatusTracker(log)
-	for name, constructor := range collectorConstructors {
-		if *collectorState[name] {
-			tracker.Add(name, constructor(log))
-			log.Info("Collector enabled", "collector", name)
-		} else {
-			log.Info("Collector disabled", "collector", name)
-		}
-	}
-	reg.MustRegister(tracker)
 }
 
 func main() {
+	started := time.Now()
+
 	// Collectors that are disabled by default (opt-in) because they are expensive
 	// or have side effects that require explicit configuration.
 	disabledByDefault := map[string]bool{
 		"sacct_efficiency": true,
+		"jobs":             true,
+		"job_wait":         true,
 	}
 
 	for name := range collectorConstructors {
@@ -186,7 +555,34 @@ func main() {
 		if name == "sacct_efficiency" {
 			help = "Enable the sacct_efficiency collector (disabled by default — sacct queries SlurmDBD, use --collector.sacct.interval and --collector.sacct.lookback to tune)."
 		}
-		collectorState[name] = kingpin.Flag("collector."+name, help).Default(defaultVal).Bool()
+		if name == "job_wait" {
+			help = "Enable the job_wait collector (disabled by default — one histogram per partition and account, use --collector.job_wait.buckets to size it)."
+		}
+		if name == "jobs" {
+			help = "Enable the jobs collector (disabled by default — one series set per running job, use --collector.jobs.max-jobs to cap them)."
+		}
+		collectorState[name] = trackedFlag("collector."+name, help).Default(defaultVal).Bool()
+		collectorTimeouts[name] = trackedFlag(
+			"collector."+name+".timeout",
+			"Timeout for the Slurm commands of the "+name+" collector. 0 uses --command.timeout.",
+		).Default("0s").Duration()
+		collectorRefreshIntervals[name] = trackedFlag(
+			"collector."+name+".refresh-interval",
+			"Run the "+name+" collector in the background at this interval and serve its last result, "+
+				"instead of running it on every scrape. 0 runs it on every scrape.",
+		).Default("0s").Duration()
+		collectorStaleMaxAges[name] = trackedFlag(
+			"collector."+name+".stale-max-age",
+			"While the "+name+" collector fails, keep serving its last successful metrics for up to this long. "+
+				"0 lets its series disappear on the first failure.",
+		).Default("0s").Duration()
+		if slices.Contains(config.TopNCollectors, name) {
+			collectorTopN[name] = trackedFlag(
+				"collector."+name+".top-n",
+				"Keep the N users or accounts with the largest values in each per-user or per-account "+
+					"family of the "+name+" collector, and fold the rest into a single \"__other__\" series. 0 keeps them all.",
+			).Default("0").Int()
+		}
 	}
 
 	kingpin.Version(version.Print("slurm_exporter"))
@@ -200,18 +596,112 @@ func main() {
 		log = logger.NewTextLogger(*logLevel)
 	}
 
-	collector.SetCommandTimeout(*commandTimeout)
+	// The file's counterparts of these are checked by config.Validate.
+	if err := config.CheckJobLabels(*jobsLabels); err != nil {
+		log.Error("Invalid --collector.jobs.labels", "err", err)
+		os.Exit(1)
+	}
+	if *jobsMaxJobs <= 0 {
+		log.Error("Invalid --collector.jobs.max-jobs: must be positive", "value", *jobsMaxJobs)
+		os.Exit(1)
+	}
+	if err := config.CheckBuckets(*jobWaitBuckets); err != nil {
+		log.Error("Invalid --collector.job_wait.buckets", "err", err)
+		os.Exit(1)
+	}
+
+	if err := collector.SetJSONOutput(*slurmJSON); err != nil {
+		log.Error("Invalid --slurm.json", "err", err)
+		os.Exit(1)
+	}
 
-	// Configure Slurm binary path and validate at startup.
+	// Configure Slurm binary path and validate at startup. The binaries are
+	// not used with the REST source, on replay or in simulation, so there is
+	// nothing to validate.
 	collector.SetBinPath(*slurmBinPath)
-	if *slurmBinPath != "" {
-		log.Info("Using custom Slurm binary path", "path", *slurmBinPath)
-		if errs := collector.ValidateBinaries(log, collector.SlurmBinaries); len(errs) > 0 {
-			for _, err := range errs {
-				log.Error("Slurm binary validation failed", "err", err)
+	if *slurmRecordDir != "" && *slurmReplayDir != "" {
+		log.Error("--slurm.record-dir and --slurm.replay-dir cannot be used together")
+		os.Exit(1)
+	}
+	if *slurmSimulate != "" && *slurmReplayDir != "" {
+		log.Error("--slurm.simulate and --slurm.replay-dir cannot be used together")
+		os.Exit(1)
+	}
+	if *slurmSimulate != "" {
+		model, err := simulator.Load(*slurmSimulate)
+		if err != nil {
+			log.Error("Cannot load the simulated cluster", "err", err)
+			os.Exit(1)
+		}
+		collector.SetDataSource(collector.NewSimulatedSource(simulator.New(model)))
+		log.Info("Serving a simulated Slurm cluster: no command is run", "model", *slurmSimulate,
+			"cluster", model.Cluster, "seed", model.Seed)
+		if *slurmSource == "rest" {
+			log.Warn("--slurm.source=rest has no effect with --slurm.simulate")
+		}
+	} else if *slurmReplayDir != "" {
+		src, err := collector.NewReplaySource(*slurmReplayDir)
+		if err != nil {
+			log.Error("Cannot replay Slurm data", "err", err)
+			os.Exit(1)
+		}
+		collector.SetDataSource(src)
+		log.Info("Replaying recorded Slurm data: no command is run", "dir", *slurmReplayDir)
+		if *slurmSource == "rest" {
+			log.Warn("--slurm.source=rest has no effect with --slurm.replay-dir")
+		}
+	} else if *slurmSource == "rest" {
+		if err := useRESTSource(log); err != nil {
+			log.Error("Cannot use slurmrestd as the data source", "err", err)
+			os.Exit(1)
+		}
+		if len(*slurmJSON) > 0 {
+			log.Warn("--slurm.json has no effect with --slurm.source=rest: slurmrestd already answers in JSON")
+			_ = collector.SetJSONOutput(nil)
+		}
+	} else {
+		if err := collector.SetCommandWrapper(*slurmCommandWrapper, *slurmCommandWrapperExitCodes); err != nil {
+			log.Error("Invalid --slurm.command-wrapper", "err", err)
+			os.Exit(1)
+		}
+		if w := collector.CommandWrapper(); w != nil {
+			log.Info("Running Slurm commands through a wrapper", "wrapper", w)
+		}
+		if *slurmBinPath != "" || *slurmCommandWrapper != "" {
+			if *slurmBinPath != "" {
+				log.Info("Using custom Slurm binary path", "path", *slurmBinPath)
+			}
+			if errs := collector.ValidateBinaries(log, collector.SlurmBinaries); len(errs) > 0 {
+				for _, err := range errs {
+					log.Error("Slurm binary validation failed", "err", err)
+				}
+				os.Exit(1)
 			}
+		}
+	}
+	if *slurmRecordDir != "" {
+		src, err := collector.NewRecordingSource(log, collector.ActiveDataSource(), *slurmRecordDir)
+		if err != nil {
+			log.Error("Cannot record Slurm data", "err", err)
+			os.Exit(1)
+		}
+		collector.SetDataSource(src)
+		log.Info("Recording Slurm command output", "dir", *slurmRecordDir)
+	}
+
+	var debug *debugCommands
+	if *debugCommandsEnabled {
+		if err := checkDebugAuth(*toolkitFlags.WebConfigFile); err != nil {
+			log.Error("Cannot serve /debug/commands", "err", err)
+			os.Exit(1)
+		}
+		var err error
+		if debug, err = newDebugCommands(log, *debugCommandsRedact); err != nil {
+			log.Error("Invalid --web.debug-commands.redact", "err", err)
 			os.Exit(1)
 		}
+		collector.EnableCommandLog()
+		log.Info("Serving /debug/commands", "redact_patterns", len(*debugCommandsRedact))
 	}
 
 	// Create a signal-aware context so background goroutines (e.g. sacct_efficiency)
@@ -220,21 +710,6 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer stop()
 
-	// sacctDone captures the Done() channel of the sacct_efficiency collector
-	// (if enabled) so we can wait for its background goroutine to fully exit
-	// after the HTTP server has shut down. Stays nil if the collector is
-	// disabled — the post-server wait below is a no-op in that case.
-	var sacctDone <-chan struct{}
-
-	// Wire the signal context into the sacct_efficiency collector constructor
-	// and capture its Done() channel for graceful shutdown.
-	collectorConstructors["sacct_efficiency"] = func(l *logger.Logger) prometheus.Collector {
-		c := collector.NewSacctEfficiencyCollector(l, *sacctEfficiencyInterval, *sacctEfficiencyLookback)
-		c.Start(ctx)
-		sacctDone = c.Done()
-		return c
-	}
-
 	// Create a custom registry to avoid global state and third-party metric pollution
 	reg := prometheus.NewRegistry()
 
@@ -244,6 +719,9 @@ func main() {
 	// Register internal cache age metrics
 	collector.RegisterCacheMetrics(reg)
 
+	// Register the count of series relabeling made collide
+	relabel.RegisterMetrics(reg)
+
 	// Always register build info; Go runtime and process collectors are optional.
 	reg.MustRegister(collectors.NewBuildInfoCollector())
 	if !*disableExporterMetrics {
@@ -253,17 +731,61 @@ func main() {
 		)
 	}
 
-	registerCollectors(reg, log)
+	// The reloader owns the collector set: it builds it now from the flags and
+	// --config.file, and rebuilds it on SIGHUP or POST /-/reload. The tracker
+	// outlives every reload, so the listener is never touched. It is not in reg:
+	// scrapeHandler binds it to each request's context.
+	tracker := collector.NewStatusTracker(log)
+	tracker.SetMaxConcurrency(*maxConcurrency)
+	tracker.SetCoalesceWindow(*coalesceWindow)
+	rl := newReloader(ctx, *configFile, tracker, log)
+	reg.MustRegister(rl.lastReloadSuccess, rl.lastReloadSuccessTime)
+	if err := rl.reload(); err != nil {
+		log.Error("Invalid configuration", "file", *configFile, "err", err)
+		stop()     // release signal handler explicitly before bypassing defer via os.Exit
+		os.Exit(1) //nolint:gocritic // stop() called explicitly above
+	}
+	go rl.watchSIGHUP(ctx)
+
+	// The push loop, when configured, gathers what /metrics serves and stops
+	// with ctx.
+	if *pushURL != "" {
+		pusher, err := newPusher(reg, tracker, &rl.relabel, log)
+		if err != nil {
+			log.Error("Cannot push metrics", "err", err)
+			stop()     // release signal handler explicitly before bypassing defer via os.Exit
+			os.Exit(1) //nolint:gocritic // stop() called explicitly above
+		}
+		log.Info("Pushing metrics", "url", *pushURL, "protocol", *pushProtocol, "interval", *pushInterval)
+		go pusher.Run(ctx)
+	}
+
+	// Likewise the OTLP export loop, side by side with /metrics and the push
+	// loop.
+	if *otlpEndpoint != "" {
+		exporter, err := newOTLPExporter(reg, tracker, &rl.relabel, log)
+		if err != nil {
+			log.Error("Cannot export metrics over OTLP", "err", err)
+			stop()     // release signal handler explicitly before bypassing defer via os.Exit
+			os.Exit(1) //nolint:gocritic // stop() called explicitly above
+		}
+		log.Info("Exporting metrics over OTLP", "endpoint", *otlpEndpoint, "protocol", *otlpProtocol, "interval", *otlpInterval)
+		go exporter.Run(ctx)
+	}
+
+	ready := newReadiness(tracker, *readinessPingInterval, *readinessPingFailures, *readinessFailedScrapes, log)
+	go ready.Run(ctx)
 
 	log.Info("Starting Slurm Exporter server...")
-	log.Info("Command timeout configured", "timeout", *commandTimeout)
+	log.Info("Command timeout configured", "timeout", collector.CommandTimeout())
 
 	// Configure HTTP routes
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(indexHTML))
-	})
-	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+	// The index page and /api/v1/status show the same report: per collector,
+	// its last collection, last error, commands and caches.
+	status := newStatusPage(tracker, started, *configFile, debug != nil, log)
+	http.Handle("/", status.Index())
+	http.Handle("/api/v1/status", status.API())
+	http.Handle("/metrics", scrapeHandler(reg, tracker, &rl.relabel, promhttp.HandlerOpts{
 		EnableOpenMetrics: true,
 	}))
 	// /healthz returns 200 OK as long as the HTTP server is up.
@@ -273,6 +795,17 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	// /readyz returns 503 once Slurm is out of reach: see readiness.
+	http.Handle("/readyz", ready)
+	// /-/reload re-reads --config.file, like SIGHUP. Opt-in and POST only,
+	// as in Prometheus and blackbox_exporter, so neither an unauthenticated
+	// client nor a crawler following links can trigger it by default.
+	if *enableLifecycle {
+		http.Handle("/-/reload", rl)
+	}
+	if debug != nil {
+		http.Handle("/debug/commands", debug.Handler())
+	}
 
 	// Start HTTP server with exporter toolkit (supports TLS, Basic Auth, etc.).
 	// serve is the blocking listen call; injecting it keeps runServer testable
@@ -281,20 +814,188 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second, // Mitigate Slowloris attack (G112)
 	}
 	serve := func() error { return web.ListenAndServe(server, toolkitFlags, log.Logger) }
-	if err := runServer(ctx, server, serve, sacctDone, log); err != nil {
+	if err := runServer(ctx, server, serve, rl.backgroundDone(), log); err != nil {
 		log.Error("Failed to start HTTP server", "err", err)
 		stop()     // release signal handler explicitly before bypassing defer via os.Exit
 		os.Exit(1) //nolint:gocritic // stop() called explicitly above
 	}
 }
 
+// wrapperExitCodesDefault returns collector.DefaultWrapperExitCodes as the
+// flag defaults.
+func wrapperExitCodesDefault() []string {
+	codes := make([]string, len(collector.DefaultWrapperExitCodes))
+	for i, c := range collector.DefaultWrapperExitCodes {
+		codes[i] = strconv.Itoa(c)
+	}
+	return codes
+}
+
+// useRESTSource points every collector at slurmrestd, and warns about the
+// enabled collectors it has no data for.
+func useRESTSource(log *logger.Logger) error {
+	client, err := slurmrest.NewClient(slurmrest.Options{
+		URL:       *slurmRESTURL,
+		Version:   *slurmRESTVersion,
+		User:      *slurmRESTUser,
+		TokenFile: *slurmRESTTokenFile,
+	})
+	if err != nil {
+		return err
+	}
+	collector.SetDataSource(collector.NewRESTSource(client))
+	log.Info("Reading Slurm data from slurmrestd", "url", *slurmRESTURL, "api_version", client.Version())
+
+	for name, enabled := range collectorState {
+		if reason, unsupported := collector.RESTUnsupported(name); unsupported && *enabled {
+			log.Warn("Collector has no slurmrestd equivalent and will fail on every scrape",
+				"collector", name, "reason", reason)
+		}
+	}
+	return nil
+}
+
+// scrapeHandler serves /metrics with the tracker bound to the request's
+// context, so the Slurm commands of a scrape Prometheus gave up on are killed
+// instead of running to completion for nobody.
+//
+// The collect[] and exclude[] query parameters restrict the scrape to some
+// collectors, as with node_exporter: /metrics?collect[]=nodes&collect[]=queue.
+// rules rewrites the output of both the tracker and reg before it is encoded.
+func scrapeHandler(reg prometheus.Gatherer, tracker *collector.StatusTracker, rules *relabel.Relabeler, opts promhttp.HandlerOpts) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		bound, err := tracker.BindSelection(r.Context(), collector.Selection{
+			Collect: query["collect[]"],
+			Exclude: query["exclude[]"],
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid collector selection: %s", err), http.StatusBadRequest)
+			return
+		}
+		g, err := scrapeGatherer(reg, bound, rules)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(g, opts).ServeHTTP(w, r)
+	})
+}
+
+// scrapeGatherer returns what one scrape serves: reg, and the collectors bound
+// to it, relabelled.
+func scrapeGatherer(reg prometheus.Gatherer, bound prometheus.Collector, rules *relabel.Relabeler) (prometheus.Gatherer, error) {
+	scrape := prometheus.NewRegistry()
+	if err := scrape.Register(bound); err != nil {
+		return nil, fmt.Errorf("registering collectors: %w", err)
+	}
+	return rules.Wrap(prometheus.Gatherers{reg, scrape}), nil
+}
+
+// newPusher builds the push loop from the --push flags. Each push gathers
+// what a scrape of /metrics with no collector selection would serve.
+func newPusher(reg *prometheus.Registry, tracker *collector.StatusTracker, rules *relabel.Relabeler, log *logger.Logger) (*push.Pusher, error) {
+	labels := map[string]string{"job": "slurm_exporter"}
+	if host, err := os.Hostname(); err == nil {
+		labels["instance"] = host
+	}
+	maps.Copy(labels, *pushLabels)
+
+	var client *http.Client
+	if *pushHTTPConfigFile != "" {
+		cfg, _, err := promconfig.LoadHTTPConfigFile(*pushHTTPConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", *pushHTTPConfigFile, err)
+		}
+		if client, err = promconfig.NewClientFromConfig(*cfg, "push"); err != nil {
+			return nil, fmt.Errorf("%s: %w", *pushHTTPConfigFile, err)
+		}
+	}
+	return push.New(log, push.Options{
+		URL:           *pushURL,
+		Protocol:      push.Protocol(*pushProtocol),
+		Interval:      *pushInterval,
+		Timeout:       *pushTimeout,
+		Labels:        labels,
+		HTTPClient:    client,
+		Retries:       *pushRetries,
+		RetryBackoff:  *pushRetryBackoff,
+		QueueDir:      *pushQueueDir,
+		QueueMaxBytes: int64(*pushQueueMaxSize),
+		Registerer:    reg,
+		Gather:        gatherAll(reg, tracker, rules),
+	})
+}
+
+// newOTLPExporter builds the OTLP export loop from the --otlp flags and the
+// standard OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES variables. Each
+// export gathers what a scrape of /metrics with no collector selection would
+// serve.
+func newOTLPExporter(reg *prometheus.Registry, tracker *collector.StatusTracker, rules *relabel.Relabeler, log *logger.Logger) (*otlp.Exporter, error) {
+	resource := map[string]string{}
+	if host, err := os.Hostname(); err == nil {
+		resource["host.name"] = host
+		resource["service.instance.id"] = host
+	}
+	env, err := otlp.ParseAttributes(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	maps.Copy(resource, env)
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+	maps.Copy(resource, *otlpResourceAttributes)
+
+	var client *http.Client
+	if *otlpHTTPConfigFile != "" {
+		cfg, _, err := promconfig.LoadHTTPConfigFile(*otlpHTTPConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", *otlpHTTPConfigFile, err)
+		}
+		// gRPC only speaks HTTP/2.
+		cfg.EnableHTTP2 = cfg.EnableHTTP2 || *otlpProtocol == string(otlp.GRPC)
+		if client, err = promconfig.NewClientFromConfig(*cfg, "otlp"); err != nil {
+			return nil, fmt.Errorf("%s: %w", *otlpHTTPConfigFile, err)
+		}
+	}
+	return otlp.New(log, otlp.Options{
+		Endpoint:   *otlpEndpoint,
+		Protocol:   otlp.Protocol(*otlpProtocol),
+		Interval:   *otlpInterval,
+		Timeout:    *otlpTimeout,
+		Headers:    *otlpHeaders,
+		Resource:   resource,
+		HTTPClient: client,
+		Registerer: reg,
+		Gather:     gatherAll(reg, tracker, rules),
+	})
+}
+
+// gatherAll returns a Gather for the push and OTLP loops: what a scrape of
+// /metrics with no collector selection would serve.
+func gatherAll(reg *prometheus.Registry, tracker *collector.StatusTracker, rules *relabel.Relabeler) func(context.Context) ([]*dto.MetricFamily, error) {
+	return func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		bound, err := tracker.BindSelection(ctx, collector.Selection{})
+		if err != nil {
+			return nil, err
+		}
+		g, err := scrapeGatherer(reg, bound, rules)
+		if err != nil {
+			return nil, err
+		}
+		return g.Gather()
+	}
+}
+
 // runServer runs the HTTP server until ctx is cancelled (SIGTERM/SIGINT) or the
 // server stops on its own. serve is the blocking listen call (web.ListenAndServe
 // in production). On cancellation the server is shut down gracefully and the
-// sacct_efficiency goroutine, if running, is given a bounded window to exit.
-// Returns a non-nil error only when the server fails to start; a clean shutdown
-// returns nil.
-func runServer(ctx context.Context, server *http.Server, serve func() error, sacctDone <-chan struct{}, log *logger.Logger) error {
+// collectors' background goroutines (sacct_efficiency), if any, are given a
+// bounded window to exit: backgroundDone closes once they have. Returns a
+// non-nil error only when the server fails to start; a clean shutdown returns
+// nil.
+func runServer(ctx context.Context, server *http.Server, serve func() error, backgroundDone <-chan struct{}, log *logger.Logger) error {
 	errCh := make(chan error, 1)
 	go func() { errCh <- serve() }()
 
@@ -315,16 +1016,16 @@ func runServer(ctx context.Context, server *http.Server, serve func() error, sac
 			log.Error("HTTP server shutdown failed", "err", err)
 		}
 
-		// Graceful shutdown: wait for the sacct_efficiency background goroutine
-		// to finish (if it was started). Bounded so we don't hang when sacct is
+		// Graceful shutdown: wait for the background goroutines (sacct_efficiency)
+		// to finish, if any were started. Bounded so we don't hang when sacct is
 		// genuinely stuck.
-		if sacctDone != nil {
-			log.Info("Waiting for sacct_efficiency background goroutine to finish...")
+		if backgroundDone != nil {
+			log.Info("Waiting for background collector goroutines to finish...")
 			select {
-			case <-sacctDone:
-				log.Info("sacct_efficiency stopped cleanly")
+			case <-backgroundDone:
+				log.Info("Background collector goroutines stopped cleanly")
 			case <-time.After(5 * time.Second):
-				log.Warn("sacct_efficiency did not stop within 5s, exiting anyway")
+				log.Warn("Background collector goroutines did not stop within 5s, exiting anyway")
 			}
 		}
 		return nil
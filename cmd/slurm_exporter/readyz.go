@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// readiness serves /readyz. Where /healthz only says the process is up,
+// /readyz says whether it can reach Slurm, so a load balancer or Kubernetes
+// can take an exporter cut off from slurmctld out of rotation.
+//
+// Two checks, each disabled by a zero setting: scontrol ping, and the outcome
+// of the last scrapes, which costs nothing. The ping runs when a probe asks,
+// at most once per lazyPingMaxAge, so an exporter nobody probes sends
+// slurmctld nothing; with a pingInterval it runs in the background instead,
+// and a probe never waits on slurmctld.
+type readiness struct {
+	tracker *collector.StatusTracker
+	log     *logger.Logger
+	// pingInterval is the time between two background pings, 0 to ping
+	// when a probe asks.
+	pingInterval time.Duration
+	// pingFailures is how many pings in a row must fail before the
+	// controller counts as unreachable, 0 for no ping.
+	pingFailures int
+	// failedScrapes is how many collections in a row every collector must
+	// fail before the exporter is not ready, 0 for no such check.
+	failedScrapes int
+
+	// probing is held through a ping a probe asked for, so that concurrent
+	// probes wait for its result rather than each sending one.
+	probing sync.Mutex
+	mu      sync.Mutex
+	ping    pingStatus
+}
+
+// lazyPingMaxAge is how long the result of a ping a probe asked for answers
+// the probes that follow, so that a burst of them sends a single ping.
+const lazyPingMaxAge = 5 * time.Second
+
+// pingStatus is the outcome of the last ping.
+type pingStatus struct {
+	At                  time.Time                   `json:"at,omitzero"`
+	Controllers         []collector.ControllerState `json:"controllers"`
+	Error               string                      `json:"error,omitempty"`
+	ConsecutiveFailures int                         `json:"consecutive_failures"`
+}
+
+// readyzResponse is the body of /readyz.
+type readyzResponse struct {
+	Status string `json:"status"`
+	// Reasons say why the exporter is not ready, empty when it is.
+	Reasons    []string    `json:"reasons,omitempty"`
+	Controller *pingStatus `json:"controller,omitempty"`
+	// FailingCollectors are the collectors behind a failed-scrapes reason.
+	FailingCollectors []failingCollector `json:"failing_collectors,omitempty"`
+}
+
+type failingCollector struct {
+	Name                string `json:"name"`
+	LastError           string `json:"last_error"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+func newReadiness(tracker *collector.StatusTracker, pingInterval time.Duration, pingFailures, failedScrapes int, log *logger.Logger) *readiness {
+	return &readiness{
+		tracker:       tracker,
+		log:           log,
+		pingInterval:  pingInterval,
+		pingFailures:  max(pingFailures, 0),
+		failedScrapes: failedScrapes,
+	}
+}
+
+// Run pings the controller at once, then every pingInterval until ctx is
+// cancelled. It returns straight away when the ping is disabled or left to
+// the probes.
+func (r *readiness) Run(ctx context.Context) {
+	if r.pingFailures == 0 || r.pingInterval <= 0 {
+		return
+	}
+	r.probe(ctx)
+	ticker := time.NewTicker(r.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.probe(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *readiness) probe(ctx context.Context) {
+	states, err := collector.PingController(ctx, r.log)
+	if ctx.Err() != nil {
+		return // shutting down: not the controller's failure
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := pingStatus{At: time.Now(), Controllers: states}
+	if err != nil {
+		p.Error = err.Error()
+		p.ConsecutiveFailures = r.ping.ConsecutiveFailures + 1
+	}
+	wasDown, isDown := r.ping.ConsecutiveFailures >= r.pingFailures, p.ConsecutiveFailures >= r.pingFailures
+	switch {
+	case isDown && !wasDown:
+		r.log.Warn("Slurm controller unreachable, /readyz now fails", "failed_pings", p.ConsecutiveFailures, "err", err)
+	case wasDown && !isDown:
+		r.log.Info("Slurm controller reachable again")
+	}
+	r.ping = p
+}
+
+// probeIfStale pings the controller, under ctx, unless the last ping is
+// younger than lazyPingMaxAge.
+func (r *readiness) probeIfStale(ctx context.Context) {
+	r.probing.Lock()
+	defer r.probing.Unlock()
+	r.mu.Lock()
+	at := r.ping.At
+	r.mu.Unlock()
+	if !at.IsZero() && time.Since(at) < lazyPingMaxAge {
+		return
+	}
+	r.probe(ctx)
+}
+
+// check returns the state of the exporter as /readyz reports it. ctx is the
+// probe's, under which a ping it asks for runs.
+func (r *readiness) check(ctx context.Context) (resp readyzResponse, ready bool) {
+	resp.Status = "ready"
+	if r.pingFailures > 0 {
+		if r.pingInterval <= 0 {
+			r.probeIfStale(ctx)
+		}
+		r.mu.Lock()
+		p := r.ping
+		r.mu.Unlock()
+		resp.Controller = &p
+		switch {
+		case p.At.IsZero():
+			resp.Reasons = append(resp.Reasons, "no controller ping has completed yet")
+		case p.ConsecutiveFailures >= r.pingFailures:
+			resp.Reasons = append(resp.Reasons, fmt.Sprintf("slurmctld unreachable: %d pings in a row failed, the last with: %s",
+				p.ConsecutiveFailures, p.Error))
+		}
+	}
+	if failing := r.tracker.Failing(r.failedScrapes); failing != nil {
+		resp.Reasons = append(resp.Reasons, fmt.Sprintf("every collector failed its last %d collections", r.failedScrapes))
+		for _, c := range failing {
+			resp.FailingCollectors = append(resp.FailingCollectors, failingCollector{
+				Name:                c.Name,
+				LastError:           c.LastError,
+				ConsecutiveFailures: c.ConsecutiveFailures,
+			})
+		}
+	}
+	if len(resp.Reasons) > 0 {
+		resp.Status = "not ready"
+		return resp, false
+	}
+	return resp, true
+}
+
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resp, ready := r.check(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		r.log.Warn("Cannot write /readyz", "err", err)
+	}
+}
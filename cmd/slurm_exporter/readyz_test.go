@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// pingSource answers scontrol ping with a primary that is UP, or with the
+// error scontrol gives when no controller answers once down is set. It counts
+// the pings.
+type pingSource struct {
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (*pingSource) Name() string { return "ping" }
+
+func (s *pingSource) Run(context.Context, string, []string) ([]byte, error) {
+	s.calls.Add(1)
+	if s.down.Load() {
+		return []byte("Slurmctld(primary) at ctl1 is DOWN\n"), errors.New("exit status 1")
+	}
+	return []byte("Slurmctld(primary) at ctl1 is UP\nSlurmctld(backup) at ctl2 is DOWN\n"), errors.New("exit status 1")
+}
+
+func withPingSource(t *testing.T) *pingSource {
+	t.Helper()
+	oldSource, oldTimeout := collector.ActiveDataSource(), collector.CommandTimeout()
+	t.Cleanup(func() {
+		collector.SetDataSource(oldSource)
+		collector.SetCommandTimeout(oldTimeout)
+	})
+	s := &pingSource{}
+	collector.SetDataSource(s)
+	collector.SetCommandTimeout(5 * time.Second)
+	return s
+}
+
+func getReadyz(t *testing.T, r *readiness) (int, readyzResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp readyzResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	return rec.Code, resp
+}
+
+func TestReadiness_Ping(t *testing.T) {
+	src := withPingSource(t)
+	log := logger.NewTextLogger("error")
+	r := newReadiness(collector.NewStatusTracker(log), time.Minute, 2, 3, log)
+
+	code, resp := getReadyz(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"no controller ping has completed yet"}, resp.Reasons)
+
+	r.probe(context.Background())
+	code, resp = getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "a down backup beside an UP primary is ready")
+	assert.Equal(t, "ready", resp.Status)
+	require.NotNil(t, resp.Controller)
+	assert.Len(t, resp.Controller.Controllers, 2)
+
+	src.down.Store(true)
+	r.probe(context.Background())
+	code, resp = getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "one failed ping is below the threshold")
+	assert.Equal(t, 1, resp.Controller.ConsecutiveFailures)
+
+	r.probe(context.Background())
+	code, resp = getReadyz(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", resp.Status)
+	require.Len(t, resp.Reasons, 1)
+	assert.Contains(t, resp.Reasons[0], "slurmctld unreachable: 2 pings in a row failed")
+
+	src.down.Store(false)
+	r.probe(context.Background())
+	code, _ = getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "one good ping is enough to recover")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src.down.Store(true)
+	r.probe(ctx)
+	_, resp = getReadyz(t, r)
+	assert.Zero(t, resp.Controller.ConsecutiveFailures, "a cancelled ping is not a failure")
+}
+
+func TestReadiness_LazyPing(t *testing.T) {
+	src := withPingSource(t)
+	log := logger.NewTextLogger("error")
+	r := newReadiness(collector.NewStatusTracker(log), 0, 1, 0, log)
+
+	code, _ := getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "the probe pings and waits for the result")
+	assert.EqualValues(t, 1, src.calls.Load())
+
+	src.down.Store(true)
+	code, _ = getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "a recent ping answers the next probe")
+	assert.EqualValues(t, 1, src.calls.Load())
+
+	r.mu.Lock()
+	r.ping.At = r.ping.At.Add(-lazyPingMaxAge)
+	r.mu.Unlock()
+	code, resp := getReadyz(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "an older one is renewed")
+	assert.EqualValues(t, 2, src.calls.Load())
+	assert.Contains(t, resp.Reasons[0], "slurmctld unreachable")
+
+	r.Run(context.Background())
+	assert.EqualValues(t, 2, src.calls.Load(), "there is no background ping to run")
+}
+
+func TestReadiness_NoPing(t *testing.T) {
+	src := withPingSource(t)
+	log := logger.NewTextLogger("error")
+	r := newReadiness(collector.NewStatusTracker(log), time.Minute, 0, 0, log)
+	r.Run(context.Background())
+
+	code, resp := getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, resp.Controller)
+	assert.Zero(t, src.calls.Load(), "a ping-failures of 0 disables the ping, background or not")
+}
+
+func TestReadiness_FailedScrapes(t *testing.T) {
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	tracker.Add("partitions", panickingCollector{})
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(tracker))
+	r := newReadiness(tracker, 0, 0, 2, log)
+
+	code, resp := getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "nothing has run, and the ping is disabled")
+	assert.Nil(t, resp.Controller)
+
+	for range 2 {
+		_, err := reg.Gather()
+		require.NoError(t, err)
+	}
+	code, resp = getReadyz(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"every collector failed its last 2 collections"}, resp.Reasons)
+	assert.Equal(t, []failingCollector{{
+		Name:                "partitions",
+		LastError:           "panic: sinfo: error: slurm_load_partitions",
+		ConsecutiveFailures: 2,
+	}}, resp.FailingCollectors)
+
+	r.failedScrapes = 0
+	code, _ = getReadyz(t, r)
+	assert.Equal(t, http.StatusOK, code, "the check is disabled")
+}
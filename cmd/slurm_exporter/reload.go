@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/config"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/relabel"
+)
+
+// settings is everything a reload applies, resolved from the flags and the
+// configuration file.
+type settings struct {
+	commandTimeout   time.Duration
+	circuitThreshold int
+	circuitBackoff   time.Duration
+	cacheTTL         map[string]time.Duration
+	enabled          map[string]bool
+	// timeouts holds the per-collector command timeouts. A collector absent
+	// from it uses commandTimeout.
+	timeouts map[string]time.Duration
+	// refreshIntervals holds the collectors refreshed in the background and
+	// their intervals. A collector absent from it runs at scrape time.
+	refreshIntervals map[string]time.Duration
+	// staleMaxAges holds the collectors served stale while they fail, and for
+	// how long.
+	staleMaxAges map[string]time.Duration
+	options      collectorOptions
+}
+
+// setting picks the value of one setting: the flag when the user gave it on
+// the command line or when the file does not set it, the file otherwise.
+func setting[T any](flagName string, flagValue T, fileValue *T) T {
+	if set, ok := setByUser[flagName]; (ok && *set) || fileValue == nil {
+		return flagValue
+	}
+	return *fileValue
+}
+
+// resolveSettings merges the configuration file into the flag values. Flags
+// given explicitly override the file, so an existing deployment that adds a
+// file keeps every behaviour its unit file pins.
+func resolveSettings(cfg *config.Config) settings {
+	s := settings{
+		commandTimeout:   setting("command.timeout", *commandTimeout, cfg.Command.Timeout),
+		circuitThreshold: setting("command.circuit-breaker.threshold", *circuitThreshold, cfg.Command.CircuitBreaker.Threshold),
+		circuitBackoff:   setting("command.circuit-breaker.backoff", *circuitBackoff, cfg.Command.CircuitBreaker.Backoff),
+		cacheTTL:         make(map[string]time.Duration),
+		enabled:          make(map[string]bool, len(collectorState)),
+		timeouts:         make(map[string]time.Duration),
+		refreshIntervals: make(map[string]time.Duration),
+		staleMaxAges:     make(map[string]time.Duration),
+		options: collectorOptions{
+			nodesFeatureSet:      setting("collector.nodes.feature-set", *nodesFeatureSet, cfg.Collector("nodes").FeatureSet),
+			nodeGRES:             setting("collector.node.gres", *nodeGRES, cfg.Collector("node").GRES),
+			queueUserLabel:       setting("collector.queue.user-label", *queueUserLabel, cfg.Collector("queue").UserLabel),
+			queueTerminalStates:  setting("collector.queue.terminal-states", *queueTerminalStates, cfg.Collector("queue").TerminalStates),
+			fairshareUserMetrics: setting("collector.fairshare.user-metrics", *fairshareUserMetrics, cfg.Collector("fairshare").UserMetrics),
+			sacctInterval:        setting("collector.sacct.interval", *sacctEfficiencyInterval, cfg.Collector("sacct_efficiency").Interval),
+			sacctLookback:        setting("collector.sacct.lookback", *sacctEfficiencyLookback, cfg.Collector("sacct_efficiency").Lookback),
+			jobsLabels:           setting("collector.jobs.labels", *jobsLabels, cfg.Collector("jobs").Labels),
+			jobsMaxJobs:          setting("collector.jobs.max-jobs", *jobsMaxJobs, cfg.Collector("jobs").MaxJobs),
+			jobWaitBuckets:       setting("collector.job_wait.buckets", *jobWaitBuckets, cfg.Collector("job_wait").Buckets),
+			jobWaitStateFile:     setting("collector.job_wait.state-file", *jobWaitStateFile, cfg.Collector("job_wait").StateFile),
+			topN:                 make(map[string]int),
+		},
+	}
+	for name, flagValue := range collectorState {
+		s.enabled[name] = setting("collector."+name, *flagValue, cfg.Collector(name).Enabled)
+	}
+	for name, flagValue := range collectorTimeouts {
+		if t := setting("collector."+name+".timeout", *flagValue, cfg.Collector(name).Timeout); t > 0 {
+			s.timeouts[name] = t
+		}
+	}
+	for name, flagValue := range collectorRefreshIntervals {
+		if iv := setting("collector."+name+".refresh-interval", *flagValue, cfg.Collector(name).RefreshInterval); iv > 0 {
+			s.refreshIntervals[name] = iv
+		}
+	}
+	for name, flagValue := range collectorStaleMaxAges {
+		if age := setting("collector."+name+".stale-max-age", *flagValue, cfg.Collector(name).StaleMaxAge); age > 0 {
+			s.staleMaxAges[name] = age
+		}
+	}
+	for name, flagValue := range collectorTopN {
+		if n := setting("collector."+name+".top-n", *flagValue, cfg.Collector(name).TopN); n > 0 {
+			s.options.topN[name] = n
+		}
+	}
+	// Cache TTLs have no flag: the file is the only way to change them.
+	for name, c := range cfg.Cache {
+		if c.TTL != nil {
+			s.cacheTTL[name] = *c.TTL
+		}
+	}
+	return s
+}
+
+// collectorNames returns every collector name, sorted, so the tracker runs
+// them in a stable order from one reload to the next.
+func collectorNames() []string {
+	names := make([]string, 0, len(collectorConstructors))
+	for name := range collectorConstructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reloader owns the collector set. It builds it at startup and rebuilds it on
+// SIGHUP or POST /-/reload, replacing the StatusTracker entries in place so the
+// HTTP listener and the registry are never touched.
+type reloader struct {
+	// mu serialises reloads, and guards cancel, background and closed.
+	mu      sync.Mutex
+	path    string
+	tracker *collector.StatusTracker
+	ctx     context.Context
+	log     *logger.Logger
+	// relabel holds the relabeling rules scrapeHandler applies to every
+	// scrape's output.
+	relabel relabel.Relabeler
+
+	// cancel stops the background goroutines of the current collector set.
+	cancel context.CancelFunc
+	// background holds the Done() channel of every collector started with a
+	// background goroutine, across all sets, so shutdown can wait for all of
+	// them rather than only the latest.
+	background []<-chan struct{}
+	// closed is set once ctx is cancelled; a reload after that would start
+	// goroutines nobody waits for.
+	closed bool
+	// built holds the collectors of the current set by name, as their
+	// constructors returned them, for the next set to inherit their state.
+	built map[string]prometheus.Collector
+
+	lastReloadSuccess     prometheus.Gauge
+	lastReloadSuccessTime prometheus.Gauge
+}
+
+// newReloader creates a reloader for the file at path (empty for none). ctx is
+// the process lifetime: every collector set's context derives from it.
+func newReloader(ctx context.Context, path string, tracker *collector.StatusTracker, log *logger.Logger) *reloader {
+	r := &reloader{
+		path:    path,
+		tracker: tracker,
+		ctx:     ctx,
+		log:     log,
+		lastReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload succeeded (1=success, 0=failure).",
+		}),
+		lastReloadSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful configuration reload.",
+		}),
+	}
+	r.relabel.Log = log
+	return r
+}
+
+// reload reads the configuration file, validates it and, only if it is valid,
+// applies it: command timeout, cache TTLs, relabeling rules, and a freshly
+// built collector set swapped into the tracker, each collector inheriting the
+// state of the one it replaces. A rejected file leaves the running
+// configuration untouched.
+func (r *reloader) reload() error {
+	err := r.apply()
+	if err != nil {
+		r.lastReloadSuccess.Set(0)
+		return err
+	}
+	r.lastReloadSuccess.Set(1)
+	r.lastReloadSuccessTime.SetToCurrentTime()
+	return nil
+}
+
+func (r *reloader) apply() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.New("exporter is shutting down")
+	}
+
+	cfg := &config.Config{}
+	if r.path != "" {
+		var err error
+		if cfg, err = config.Load(r.path); err != nil {
+			return err
+		}
+		if err := cfg.Validate(collectorNames(), collector.CacheNames()); err != nil {
+			return fmt.Errorf("validating %s: %w", r.path, err)
+		}
+	}
+	s := resolveSettings(cfg)
+	rules, err := relabel.Compile(cfg.Relabel)
+	if err != nil {
+		// Unreachable after Validate, which compiles them too.
+		return err
+	}
+
+	collector.SetCommandTimeout(s.commandTimeout)
+	collector.SetCircuitBreaker(s.circuitThreshold, s.circuitBackoff)
+	// Every cache is set, not only those the file names: a TTL removed from
+	// the file goes back to the default instead of outliving it.
+	for _, name := range collector.CacheNames() {
+		ttl, ok := s.cacheTTL[name]
+		if !ok {
+			ttl = collector.DefaultCacheTTL
+		}
+		if err := collector.SetCacheTTL(name, ttl); err != nil {
+			return err
+		}
+	}
+
+	r.pruneBackground()
+	ctx, cancel := context.WithCancel(r.ctx)
+	next := collector.NewStatusTracker(r.log)
+	built := make(map[string]prometheus.Collector, len(collectorConstructors))
+	for _, name := range collectorNames() {
+		if !s.enabled[name] {
+			r.log.Info("Collector disabled", "collector", name)
+			continue
+		}
+		// The timeout rides on the context too, for the commands a collector
+		// runs in the background rather than during a scrape.
+		cctx := ctx
+		timeout := s.timeouts[name]
+		if timeout > 0 {
+			cctx = collector.WithCommandTimeout(ctx, timeout)
+		}
+		c := collectorConstructors[name](cctx, r.log, &s.options)
+		// Counters accumulated since the exporter started, like
+		// slurm_controller_failovers_total, must outlive the instance.
+		collector.InheritState(c, r.built[name])
+		built[name] = c
+		if iv := s.refreshIntervals[name]; iv > 0 {
+			c = r.inBackground(cctx, name, c, iv)
+		}
+		if bg, ok := c.(interface{ Done() <-chan struct{} }); ok {
+			r.background = append(r.background, bg.Done())
+		}
+		opts := collector.EntryOptions{Timeout: timeout, StaleMaxAge: s.staleMaxAges[name]}
+		next.AddWithOptions(name, c, opts)
+		attrs := []any{"collector", name}
+		if opts.Timeout > 0 {
+			attrs = append(attrs, "timeout", opts.Timeout)
+		}
+		if opts.StaleMaxAge > 0 {
+			attrs = append(attrs, "stale_max_age", opts.StaleMaxAge)
+		}
+		r.log.Info("Collector enabled", attrs...)
+	}
+	r.tracker.Replace(next)
+	r.built = built
+	r.relabel.Set(rules)
+	if len(cfg.Relabel) > 0 {
+		r.log.Info("Relabeling rules loaded", "rules", len(cfg.Relabel))
+	}
+
+	// Stop the previous set's background goroutines only once the new set is
+	// serving, so a reload never opens a window with nothing to scrape.
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.cancel = cancel
+
+	if r.path != "" {
+		r.log.Info("Configuration loaded", "file", r.path)
+	}
+	return nil
+}
+
+// inBackground wraps c so that it refreshes every interval instead of at scrape
+// time. A collector that already refreshes in the background, like
+// sacct_efficiency, is returned as it is: wrapping it would only serve a copy
+// of its cache. Called with mu held.
+func (r *reloader) inBackground(ctx context.Context, name string, c prometheus.Collector, interval time.Duration) prometheus.Collector {
+	if _, ok := c.(interface{ Done() <-chan struct{} }); ok {
+		r.log.Warn("Collector already refreshes in the background, ignoring its refresh interval", "collector", name)
+		return c
+	}
+	bc := collector.NewBackgroundCollector(r.log, name, c, interval)
+	bc.Start(ctx)
+	r.log.Info("Collector refreshed in the background", "collector", name, "interval", interval)
+	return bc
+}
+
+// pruneBackground drops the Done() channels of goroutines that have already
+// exited, so the list does not grow with every reload. Called with mu held.
+func (r *reloader) pruneBackground() {
+	live := r.background[:0]
+	for _, ch := range r.background {
+		select {
+		case <-ch:
+		default:
+			live = append(live, ch)
+		}
+	}
+	r.background = live
+}
+
+// watchSIGHUP reloads the configuration on every SIGHUP until ctx ends.
+func (r *reloader) watchSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			if err := r.reload(); err != nil {
+				r.log.Error("Configuration reload failed, keeping the running configuration", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ServeHTTP handles POST /-/reload.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This endpoint requires a POST request.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		r.log.Error("Configuration reload failed, keeping the running configuration", "err", err)
+		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// backgroundDone returns a channel closed once the process context is
+// cancelled and every background goroutine started by any collector set has
+// exited. runServer waits on it, bounded, during graceful shutdown.
+func (r *reloader) backgroundDone() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-r.ctx.Done()
+		r.mu.Lock()
+		r.closed = true
+		pending := r.background
+		r.mu.Unlock()
+		for _, ch := range pending {
+			<-ch
+		}
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/config"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/otlp"
+	"github.com/sckyzo/slurm_exporter/internal/relabel"
+)
+
+// withCollectorFlags stands in for the collector.<name> flags main() registers,
+// which do not exist when the package is under test.
+func withCollectorFlags(t *testing.T, enabled map[string]bool) {
+	t.Helper()
+	oldState, oldTimeouts, oldIntervals, oldStale := collectorState, collectorTimeouts, collectorRefreshIntervals, collectorStaleMaxAges
+	oldTopN := collectorTopN
+	t.Cleanup(func() {
+		collectorState, collectorTimeouts, collectorRefreshIntervals, collectorStaleMaxAges = oldState, oldTimeouts, oldIntervals, oldStale
+		collectorTopN = oldTopN
+	})
+	collectorState = make(map[string]*bool, len(enabled))
+	collectorTimeouts = make(map[string]*time.Duration, len(enabled))
+	collectorRefreshIntervals = make(map[string]*time.Duration, len(enabled))
+	collectorStaleMaxAges = make(map[string]*time.Duration, len(enabled))
+	collectorTopN = make(map[string]*int)
+	for name, on := range enabled {
+		collectorState[name] = &on
+		collectorTimeouts[name] = new(time.Duration)
+		collectorRefreshIntervals[name] = new(time.Duration)
+		collectorStaleMaxAges[name] = new(time.Duration)
+		if slices.Contains(config.TopNCollectors, name) {
+			collectorTopN[name] = new(int)
+		}
+	}
+}
+
+// markSetByUser pretends the named flag was given on the command line.
+func markSetByUser(t *testing.T, name string) {
+	t.Helper()
+	old, had := setByUser[name]
+	t.Cleanup(func() {
+		if had {
+			setByUser[name] = old
+		} else {
+			delete(setByUser, name)
+		}
+	})
+	set := true
+	setByUser[name] = &set
+}
+
+// describedNames lists the metric names the tracker's inner collectors describe,
+// which is how a test outside the collector package sees the current set.
+func describedNames(tracker *collector.StatusTracker) string {
+	ch := make(chan *prometheus.Desc, 200)
+	tracker.Describe(ch)
+	close(ch)
+	var b strings.Builder
+	for d := range ch {
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+// TestResolveSettings_FlagOverridesFile pins the precedence existing deployments
+// depend on: adding a configuration file must not change anything their unit
+// file sets explicitly.
+func TestResolveSettings_FlagOverridesFile(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"cpus": true})
+	markSetByUser(t, "collector.queue.user-label")
+	// kingpin.Parse never runs under test, so the flag holds its zero value
+	// until set here.
+	oldUserLabel := *queueUserLabel
+	t.Cleanup(func() { *queueUserLabel = oldUserLabel })
+	*queueUserLabel = true
+
+	cfg, err := config.Parse([]byte(`
+collectors:
+  cpus:
+    enabled: false
+  queue:
+    user_label: false
+  fairshare:
+    user_metrics: false
+`))
+	require.NoError(t, err)
+
+	s := resolveSettings(cfg)
+	assert.True(t, s.options.queueUserLabel, "a flag given on the command line wins over the file")
+	assert.False(t, s.options.fairshareUserMetrics, "a flag left at its default yields to the file")
+	assert.False(t, s.enabled["cpus"], "collector enablement follows the same rule")
+	assert.Equal(t, *commandTimeout, s.commandTimeout, "a setting absent from the file keeps the flag value")
+}
+
+// TestResolveSettings_CollectorTimeouts checks that a per-collector timeout
+// follows the same precedence as every other setting, and that a collector
+// with none is left out so it keeps --command.timeout.
+func TestResolveSettings_CollectorTimeouts(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"fairshare": true, "queue": true, "sacct_efficiency": true})
+	markSetByUser(t, "collector.fairshare.timeout")
+	*collectorTimeouts["fairshare"] = 20 * time.Second
+
+	cfg, err := config.Parse([]byte(`
+collectors:
+  fairshare:
+    timeout: 40s
+  sacct_efficiency:
+    timeout: 2m
+`))
+	require.NoError(t, err)
+
+	s := resolveSettings(cfg)
+	assert.Equal(t, map[string]time.Duration{
+		"fairshare":        20 * time.Second,
+		"sacct_efficiency": 2 * time.Minute,
+	}, s.timeouts)
+}
+
+// TestResolveSettings_CircuitBreaker checks that the breaker settings reach the
+// reloader, with the same precedence as the command timeout.
+func TestResolveSettings_CircuitBreaker(t *testing.T) {
+	withCollectorFlags(t, nil)
+	markSetByUser(t, "command.circuit-breaker.threshold")
+	oldThreshold, oldBackoff := *circuitThreshold, *circuitBackoff
+	t.Cleanup(func() { *circuitThreshold, *circuitBackoff = oldThreshold, oldBackoff })
+	*circuitThreshold, *circuitBackoff = 3, time.Minute
+
+	cfg, err := config.Parse([]byte(`
+command:
+  circuit_breaker:
+    threshold: 10
+    backoff: 30s
+`))
+	require.NoError(t, err)
+
+	s := resolveSettings(cfg)
+	assert.Equal(t, 3, s.circuitThreshold, "a flag given on the command line wins over the file")
+	assert.Equal(t, 30*time.Second, s.circuitBackoff, "a flag left at its default yields to the file")
+}
+
+// TestResolveSettings_TopN checks that the top-N limits follow the usual
+// precedence, and that a collector left at 0 is absent from the options.
+func TestResolveSettings_TopN(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"queue": true, "users": true, "fairshare": true, "cpus": true})
+	markSetByUser(t, "collector.users.top-n")
+	*collectorTopN["users"] = 100
+
+	cfg, err := config.Parse([]byte(`
+collectors:
+  users:
+    top_n: 10
+  queue:
+    top_n: 50
+`))
+	require.NoError(t, err)
+
+	s := resolveSettings(cfg)
+	assert.Equal(t, map[string]int{"users": 100, "queue": 50}, s.options.topN)
+	assert.NotContains(t, collectorTopN, "cpus", "only the collectors with per-user series have the flag")
+}
+
+func TestReloader_AppliesValidFileAndKeepsRunningSetOnInvalidOne(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"cpus": false, "licenses": true})
+	oldTimeout := collector.CommandTimeout()
+	t.Cleanup(func() { collector.SetCommandTimeout(oldTimeout) })
+
+	path := filepath.Join(t.TempDir(), "slurm_exporter.yml")
+	writeConfig(t, path, `
+command:
+  timeout: 12s
+collectors:
+  cpus:
+    enabled: true
+  licenses:
+    enabled: false
+`)
+
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	rl := newReloader(context.Background(), path, tracker, log)
+
+	require.NoError(t, rl.reload())
+	assert.Equal(t, 12*time.Second, collector.CommandTimeout())
+	assert.Contains(t, describedNames(tracker), "slurm_cpus_alloc")
+	assert.NotContains(t, describedNames(tracker), "slurm_license_total")
+	assert.Equal(t, 1.0, testutil.ToFloat64(rl.lastReloadSuccess))
+
+	// A file that fails validation must leave the running set untouched.
+	writeConfig(t, path, "collectors:\n  cpus:\n    gres: true\n")
+	require.Error(t, rl.reload())
+	assert.Equal(t, 0.0, testutil.ToFloat64(rl.lastReloadSuccess))
+	assert.Contains(t, describedNames(tracker), "slurm_cpus_alloc")
+	assert.Equal(t, 12*time.Second, collector.CommandTimeout())
+}
+
+// TestReloader_CacheTTLBackToDefault checks that a cache TTL removed from the
+// file goes back to the default at the next reload rather than staying at the
+// value the file last set.
+func TestReloader_CacheTTLBackToDefault(t *testing.T) {
+	withCollectorFlags(t, nil)
+	t.Cleanup(func() {
+		for _, name := range collector.CacheNames() {
+			require.NoError(t, collector.SetCacheTTL(name, collector.DefaultCacheTTL))
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), "slurm_exporter.yml")
+	writeConfig(t, path, "cache:\n  scontrol_nodes:\n    ttl: 55s\n")
+	log := logger.NewTextLogger("error")
+	rl := newReloader(context.Background(), path, collector.NewStatusTracker(log), log)
+
+	require.NoError(t, rl.reload())
+	assert.Equal(t, 55*time.Second, collector.CacheTTL("scontrol_nodes"))
+	assert.Equal(t, collector.DefaultCacheTTL, collector.CacheTTL("squeue_jobs"))
+
+	writeConfig(t, path, "command:\n  timeout: 5s\n")
+	require.NoError(t, rl.reload())
+	assert.Equal(t, collector.DefaultCacheTTL, collector.CacheTTL("scontrol_nodes"))
+}
+
+// TestReloader_KeepsCounters checks that a reload does not restart a counter
+// a collector accumulates since the exporter started.
+func TestReloader_KeepsCounters(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"controller": true})
+	ping := "Slurmctld(primary) at ctl-a is UP\nSlurmctld(backup) at ctl-b is UP\n"
+	oldExecute := collector.Execute
+	t.Cleanup(func() { collector.Execute = oldExecute })
+	collector.Execute = func(context.Context, *logger.Logger, string, []string) ([]byte, error) {
+		return []byte(ping), nil
+	}
+	failovers := func(n int) *strings.Reader {
+		return strings.NewReader(fmt.Sprintf(`
+# HELP slurm_controller_failovers_total Changes of the serving slurmctld seen between two scrapes since the exporter started
+# TYPE slurm_controller_failovers_total counter
+slurm_controller_failovers_total %d
+`, n))
+	}
+
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	rl := newReloader(context.Background(), "", tracker, log)
+	require.NoError(t, rl.reload())
+	require.NoError(t, testutil.CollectAndCompare(tracker, failovers(0), "slurm_controller_failovers_total"))
+	ping = "Slurmctld(primary) at ctl-a is DOWN\nSlurmctld(backup) at ctl-b is UP\n"
+	require.NoError(t, testutil.CollectAndCompare(tracker, failovers(1), "slurm_controller_failovers_total"))
+
+	require.NoError(t, rl.reload())
+	assert.NoError(t, testutil.CollectAndCompare(tracker, failovers(1), "slurm_controller_failovers_total"),
+		"the failover counted before the reload is kept")
+	ping = "Slurmctld(primary) at ctl-a is UP\nSlurmctld(backup) at ctl-b is UP\n"
+	assert.NoError(t, testutil.CollectAndCompare(tracker, failovers(2), "slurm_controller_failovers_total"),
+		"the serving host is kept too, so the failback is seen")
+}
+
+// TestReloader_RefreshInterval checks that a collector given a refresh interval
+// is run in the background, and stopped with its collector set.
+func TestReloader_RefreshInterval(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"licenses": true, "cpus": true})
+	oldExecute := collector.Execute
+	t.Cleanup(func() { collector.Execute = oldExecute })
+	collector.Execute = func(context.Context, *logger.Logger, string, []string) ([]byte, error) {
+		return nil, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "slurm_exporter.yml")
+	writeConfig(t, path, "collectors:\n  licenses:\n    refresh_interval: 1m\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	log := logger.NewTextLogger("error")
+	rl := newReloader(ctx, path, collector.NewStatusTracker(log), log)
+	require.NoError(t, rl.reload())
+	assert.Len(t, rl.background, 1, "only licenses runs in the background")
+
+	done := rl.backgroundDone()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the background collector did not stop with its set")
+	}
+}
+
+func TestReloader_ServeHTTP(t *testing.T) {
+	withCollectorFlags(t, nil)
+	log := logger.NewTextLogger("error")
+	rl := newReloader(context.Background(), "", collector.NewStatusTracker(log), log)
+
+	rec := httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, "a reload must not be triggerable by a GET")
+
+	rec = httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// TestReloader_BackgroundDone checks that shutdown waits for the background
+// goroutine of every collector set, including one replaced by a reload.
+func TestReloader_BackgroundDone(t *testing.T) {
+	withCollectorFlags(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	log := logger.NewTextLogger("error")
+	rl := newReloader(ctx, "", collector.NewStatusTracker(log), log)
+	require.NoError(t, rl.reload())
+
+	done := rl.backgroundDone()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("backgroundDone did not close after the context was cancelled")
+	}
+	require.Error(t, rl.reload(), "a reload after shutdown must be refused")
+}
+
+// TestScrapeHandler_CancelsWithRequest checks that /metrics hands the request's
+// context to the collectors: a client that goes away must stop the Slurm
+// commands its scrape started.
+func TestScrapeHandler_CancelsWithRequest(t *testing.T) {
+	oldExecute := collector.Execute
+	t.Cleanup(func() { collector.Execute = oldExecute })
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	collector.Execute = func(ctx context.Context, _ *logger.Logger, _ string, _ []string) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	tracker.Add("licenses", collector.NewLicensesCollector(log))
+	handler := scrapeHandler(prometheus.NewRegistry(), tracker, &relabel.Relabeler{}, promhttp.HandlerOpts{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-cancelled:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the command did not see the request being cancelled")
+	}
+	<-done
+}
+
+func TestScrapeHandler_CollectorSelection(t *testing.T) {
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	tracker.Add("cpus", prometheus.NewGauge(prometheus.GaugeOpts{Name: "slurm_cpus_total"}))
+	tracker.Add("licenses", prometheus.NewGauge(prometheus.GaugeOpts{Name: "slurm_license_total"}))
+	handler := scrapeHandler(prometheus.NewRegistry(), tracker, &relabel.Relabeler{}, promhttp.HandlerOpts{})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil))
+		return rec
+	}
+
+	rec := get("collect[]=cpus")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "slurm_cpus_total")
+	assert.NotContains(t, rec.Body.String(), "slurm_license_total")
+	assert.NotContains(t, rec.Body.String(), `collector="licenses"`, "an unselected collector reports no status either")
+
+	rec = get("exclude[]=cpus")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "slurm_cpus_total")
+	assert.Contains(t, rec.Body.String(), "slurm_license_total")
+
+	rec = get("")
+	assert.Contains(t, rec.Body.String(), "slurm_cpus_total")
+	assert.Contains(t, rec.Body.String(), "slurm_license_total")
+
+	assert.Equal(t, http.StatusBadRequest, get("collect[]=sacct_efficiency").Code, "a disabled collector is an error")
+	assert.Equal(t, http.StatusBadRequest, get("collect[]=cpus&exclude[]=licenses").Code)
+}
+
+// TestScrapeHandler_Relabel checks that the rules of the configuration file
+// reach /metrics, cover the exporter's own metrics too, and survive a rejected
+// reload.
+func TestScrapeHandler_Relabel(t *testing.T) {
+	withCollectorFlags(t, nil)
+	path := filepath.Join(t.TempDir(), "slurm_exporter.yml")
+	writeConfig(t, path, `
+relabel:
+  - action: drop
+    source_labels: [__name__]
+    regex: slurm_exporter_config_.*
+`)
+
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	rl := newReloader(context.Background(), path, tracker, log)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(rl.lastReloadSuccess)
+	require.NoError(t, rl.reload())
+	handler := scrapeHandler(reg, tracker, &rl.relabel, promhttp.HandlerOpts{})
+
+	body := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+	assert.NotContains(t, body(), "slurm_exporter_config_last_reload_successful")
+
+	writeConfig(t, path, "relabel:\n  - action: drop\n")
+	require.Error(t, rl.reload())
+	assert.NotContains(t, body(), "slurm_exporter_config_last_reload_successful", "a rejected file keeps the running rules")
+
+	writeConfig(t, path, "")
+	require.NoError(t, rl.reload())
+	assert.Contains(t, body(), "slurm_exporter_config_last_reload_successful")
+}
+
+// TestReloader_OTLPStartTime checks that a reload leaves the start time of the
+// OTLP cumulative points alone: the counters it carries over would otherwise
+// be read as grown by their whole value since the reload.
+func TestReloader_OTLPStartTime(t *testing.T) {
+	withCollectorFlags(t, map[string]bool{"controller": true})
+	oldExecute := collector.Execute
+	t.Cleanup(func() { collector.Execute = oldExecute })
+	collector.Execute = func(context.Context, *logger.Logger, string, []string) ([]byte, error) {
+		return []byte("Slurmctld(primary) at ctl-a is UP\n"), nil
+	}
+	var mu sync.Mutex
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	// start waits for an export made after the first n, and returns the start
+	// time of slurm_controller_failovers_total in it.
+	start := func(n int) uint64 {
+		t.Helper()
+		var body []byte
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(bodies) <= n {
+				return false
+			}
+			body = bodies[len(bodies)-1]
+			return true
+		}, 5*time.Second, 5*time.Millisecond)
+		starts := otlpSumStarts(t, body, "slurm_controller_failovers_total")
+		require.Len(t, starts, 1)
+		return starts[0]
+	}
+
+	log := logger.NewTextLogger("error")
+	tracker := collector.NewStatusTracker(log)
+	rl := newReloader(context.Background(), "", tracker, log)
+	require.NoError(t, rl.reload())
+	exporter, err := otlp.New(log, otlp.Options{
+		Endpoint: srv.URL,
+		Protocol: otlp.HTTPProtobuf,
+		Interval: 10 * time.Millisecond,
+		Gather:   gatherAll(prometheus.NewRegistry(), tracker, &rl.relabel),
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Run(ctx)
+
+	before := start(0)
+	require.NoError(t, rl.reload())
+	mu.Lock()
+	n := len(bodies)
+	mu.Unlock()
+	assert.Equal(t, before, start(n), "the counter carried over keeps its start time")
+}
+
+// otlpSumStarts returns the start time of each point of the Sum named name in
+// an OTLP ExportMetricsServiceRequest.
+func otlpSumStarts(t *testing.T, body []byte, name string) []uint64 {
+	t.Helper()
+	var starts []uint64
+	// ResourceMetrics, ScopeMetrics, Metric.
+	protoFields(t, body, 1, func(b []byte) {
+		protoFields(t, b, 2, func(b []byte) {
+			protoFields(t, b, 2, func(b []byte) {
+				var metricName string
+				protoFields(t, b, 1, func(b []byte) { metricName = string(b) })
+				if metricName != name {
+					return
+				}
+				// Sum, NumberDataPoint, start_time_unix_nano.
+				protoFields(t, b, 7, func(b []byte) {
+					protoFields(t, b, 1, func(b []byte) {
+						protoFields(t, b, 2, func(b []byte) {
+							starts = append(starts, binary.LittleEndian.Uint64(b))
+						})
+					})
+				})
+			})
+		})
+	})
+	return starts
+}
+
+// protoFields calls f with the raw value of each field numbered num in msg,
+// the bytes of a length-delimited field or the eight of a fixed64 one.
+func protoFields(t *testing.T, msg []byte, num protowire.Number, f func([]byte)) {
+	t.Helper()
+	for len(msg) > 0 {
+		n, typ, l := protowire.ConsumeTag(msg)
+		require.GreaterOrEqual(t, l, 0, "malformed tag")
+		msg = msg[l:]
+		l = protowire.ConsumeFieldValue(n, typ, msg)
+		require.GreaterOrEqual(t, l, 0, "malformed field %d", n)
+		if n == num {
+			switch typ {
+			case protowire.BytesType:
+				v, _ := protowire.ConsumeBytes(msg)
+				f(v)
+			case protowire.Fixed64Type:
+				f(msg[:8])
+			}
+		}
+		msg = msg[l:]
+	}
+}
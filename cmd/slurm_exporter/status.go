@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/version"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// statusPage serves the status report twice: as JSON on /api/v1/status for
+// tooling, and as HTML on the index page for whoever opens the exporter in a
+// browser. Both read the tracker on every request, so they follow reloads.
+type statusPage struct {
+	tracker *collector.StatusTracker
+	// names are every collector the exporter knows, enabled or not, sorted.
+	names      []string
+	started    time.Time
+	configFile string
+	// debugCommands links /debug/commands from the index when it is served.
+	debugCommands bool
+	log           *logger.Logger
+}
+
+func newStatusPage(tracker *collector.StatusTracker, started time.Time, configFile string, debugCommands bool, log *logger.Logger) *statusPage {
+	names := make([]string, 0, len(collectorConstructors))
+	for name := range collectorConstructors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return &statusPage{
+		tracker:       tracker,
+		names:         names,
+		started:       started,
+		configFile:    configFile,
+		debugCommands: debugCommands,
+		log:           log,
+	}
+}
+
+// statusReport is the document /api/v1/status returns.
+type statusReport struct {
+	Exporter exporterStatus `json:"exporter"`
+	// Slurm is null until the info collector has run, and while it is
+	// disabled.
+	Slurm      *collector.SlurmVersions    `json:"slurm"`
+	Collectors []collector.CollectorStatus `json:"collectors"`
+}
+
+type exporterStatus struct {
+	Version               string    `json:"version"`
+	Revision              string    `json:"revision"`
+	GoVersion             string    `json:"go_version"`
+	StartTime             time.Time `json:"start_time"`
+	UptimeSeconds         float64   `json:"uptime_seconds"`
+	DataSource            string    `json:"data_source"`
+	CommandTimeoutSeconds float64   `json:"command_timeout_seconds"`
+	ConfigFile            string    `json:"config_file,omitempty"`
+}
+
+func (p *statusPage) report(now time.Time) statusReport {
+	return statusReport{
+		Exporter: exporterStatus{
+			Version:               version.Version,
+			Revision:              version.Revision,
+			GoVersion:             runtime.Version(),
+			StartTime:             p.started.UTC(),
+			UptimeSeconds:         now.Sub(p.started).Seconds(),
+			DataSource:            collector.ActiveDataSource().Name(),
+			CommandTimeoutSeconds: collector.CommandTimeout().Seconds(),
+			ConfigFile:            p.configFile,
+		},
+		Slurm:      p.tracker.SlurmVersions(),
+		Collectors: p.tracker.Status(p.names),
+	}
+}
+
+// API serves /api/v1/status.
+func (p *statusPage) API() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "This endpoint requires a GET request.", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.report(time.Now())); err != nil {
+			p.log.Warn("Cannot write /api/v1/status", "err", err)
+		}
+	})
+}
+
+// Index serves the index page.
+func (p *statusPage) Index() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		now := time.Now()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		data := struct {
+			statusReport
+			Uptime        string
+			Rows          []statusRow
+			DebugCommands bool
+		}{p.report(now), now.Sub(p.started).Truncate(time.Second).String(), nil, p.debugCommands}
+		for _, c := range data.Collectors {
+			data.Rows = append(data.Rows, newStatusRow(c, now))
+		}
+		if err := indexTemplate.Execute(w, data); err != nil {
+			p.log.Warn("Cannot render the index page", "err", err)
+		}
+	})
+}
+
+// statusRow is one collector on the index page, its times made readable.
+type statusRow struct {
+	collector.CollectorStatus
+	LastCollection string
+	LastSuccess    string
+	Duration       string
+	Caches         []string
+}
+
+func newStatusRow(c collector.CollectorStatus, now time.Time) statusRow {
+	row := statusRow{CollectorStatus: c, LastCollection: "never", LastSuccess: "never"}
+	if !c.LastCollection.IsZero() {
+		row.LastCollection = ago(now, c.LastCollection)
+		row.Duration = strconv.FormatFloat(c.LastDurationSeconds, 'f', 3, 64) + "s"
+	}
+	if !c.LastSuccess.IsZero() {
+		row.LastSuccess = ago(now, c.LastSuccess)
+	}
+	for _, cache := range c.Caches {
+		age := "empty"
+		if cache.AgeSeconds != nil {
+			age = (time.Duration(*cache.AgeSeconds * float64(time.Second))).Truncate(time.Second).String() + " old"
+		}
+		row.Caches = append(row.Caches, cache.Name+": "+age)
+	}
+	return row
+}
+
+func ago(now, t time.Time) string {
+	return now.Sub(t).Truncate(time.Second).String() + " ago"
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<html>
+	<head>
+		<title>Slurm Exporter</title>
+		<style>
+			body { font-family: sans-serif; margin: 1em 2em; }
+			table { border-collapse: collapse; }
+			th, td { border-bottom: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+			.failed { color: #b00; }
+			.meta { color: #555; }
+		</style>
+	</head>
+	<body>
+		<h1>Slurm Exporter</h1>
+		<p><a href="/metrics">Metrics</a> · <a href="/api/v1/status">Status as JSON</a> · <a href="/healthz">Health</a>{{if .DebugCommands}} · <a href="/debug/commands">Slurm commands</a>{{end}}</p>
+		<p class="meta">Version {{.Exporter.Version}} ({{.Exporter.Revision}}, {{.Exporter.GoVersion}}), up {{.Uptime}},
+			reading Slurm from the {{.Exporter.DataSource}} source with a {{.Exporter.CommandTimeoutSeconds}}s command timeout.
+			{{with .Exporter.ConfigFile}}Configuration file {{.}}.{{end}}</p>
+		<h2>Slurm</h2>
+		{{with .Slurm}}
+		<p>Slurm {{.Version}}</p>
+		<table>
+			<tr><th>Binary</th><th>Version</th></tr>
+			{{range .Binaries}}<tr><td>{{.Binary}}</td><td{{if not .Found}} class="failed"{{end}}>{{.Version}}</td></tr>{{end}}
+		</table>
+		{{else}}
+		<p class="meta">Not known yet: the info collector resolves the versions on its first scrape, when it is enabled.</p>
+		{{end}}
+		<h2>Collectors</h2>
+		<table>
+			<tr><th>Collector</th><th>Last collection</th><th>Duration</th><th>Last success</th><th>Status</th><th>Commands</th><th>Caches</th></tr>
+			{{range .Rows}}
+			<tr{{if not .Enabled}} class="meta"{{end}}>
+				<td>{{.Name}}{{if not .Enabled}} (disabled){{end}}</td>
+				<td>{{.LastCollection}}</td>
+				<td>{{.Duration}}</td>
+				<td>{{.LastSuccess}}</td>
+				<td>{{if .LastError}}<span class="failed">{{.LastError}}</span>{{else if .Duration}}ok{{end}}</td>
+				<td>{{range .Commands}}<code title="{{.Command}}">{{.Name}}</code>{{with .OptIn}} <span class="meta">({{.}})</span>{{end}}<br>{{end}}</td>
+				<td>{{range .Caches}}{{.}}<br>{{end}}</td>
+			</tr>
+			{{end}}
+		</table>
+	</body>
+</html>`))
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// panickingCollector panics, which is how a plain prometheus.Collector fails
+// under the tracker.
+type panickingCollector struct{}
+
+func (panickingCollector) Describe(chan<- *prometheus.Desc) {}
+func (panickingCollector) Collect(chan<- prometheus.Metric) { panic("sinfo: error: slurm_load_partitions") }
+
+func newTestStatusPage(t *testing.T) *statusPage {
+	t.Helper()
+	tracker := collector.NewStatusTracker(logger.NewTextLogger("error"))
+	tracker.Add("partitions", panickingCollector{})
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(tracker))
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	return newStatusPage(tracker, time.Now().Add(-time.Minute), "/etc/slurm_exporter.yml", false, logger.NewTextLogger("error"))
+}
+
+func TestStatusAPI(t *testing.T) {
+	srv := httptest.NewServer(newTestStatusPage(t).API())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var report statusReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+	assert.Equal(t, "/etc/slurm_exporter.yml", report.Exporter.ConfigFile)
+	assert.InDelta(t, 60, report.Exporter.UptimeSeconds, 5)
+	assert.Nil(t, report.Slurm, "the info collector is not running")
+	require.Len(t, report.Collectors, len(collectorConstructors), "every collector, enabled or not")
+	for _, c := range report.Collectors {
+		assert.NotEmpty(t, c.Commands, "%s lists no commands: add it to collectorFiles", c.Name)
+		if c.Name != "partitions" {
+			assert.False(t, c.Enabled, c.Name)
+			continue
+		}
+		assert.True(t, c.Enabled)
+		assert.Equal(t, "panic: sinfo: error: slurm_load_partitions", c.LastError)
+		assert.False(t, c.LastCollection.IsZero())
+		assert.True(t, c.LastSuccess.IsZero())
+	}
+
+	resp, err = http.Post(srv.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestStatusIndex(t *testing.T) {
+	srv := httptest.NewServer(newTestStatusPage(t).Index())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	body := readBody(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `<a href="/api/v1/status">`)
+	assert.Contains(t, body, "panic: sinfo: error: slurm_load_partitions")
+	assert.Contains(t, body, "sacct_efficiency (disabled)")
+	assert.Contains(t, body, "squeue_jobs: empty", "the cache partitions reads")
+	assert.NotContains(t, body, "/debug/commands")
+}
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -36,8 +37,8 @@ func parseGPUsFromTRES(tres string) float64 {
 // share a single controller query per scrape (issue #144). The projection emits
 // the exact layout ParseAccountsMetrics consumes:
 // "JobID|Account|State|NumNodes|NumCPUs|tres-alloc".
-func AccountsData(logger *logger.Logger) ([]byte, error) {
-	data, err := SqueueJobsData(logger)
+func AccountsData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	data, err := SqueueJobsData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -90,10 +91,15 @@ type AccountsCollector struct {
 	runningCpus *prometheus.Desc
 	runningGPUs *prometheus.Desc
 	suspended   *prometheus.Desc
-	logger      *logger.Logger
+	// topN limits the accounts of each family. 0 keeps them all.
+	topN   int
+	logger *logger.Logger
 }
 
-func NewAccountsCollector(logger *logger.Logger) *AccountsCollector {
+// NewAccountsCollector creates an accounts metrics collector. topN, when
+// positive, keeps the topN accounts of each metric family and folds the rest
+// into account="__other__".
+func NewAccountsCollector(logger *logger.Logger, topN int) *AccountsCollector {
 	labels := []string{"account"}
 	return &AccountsCollector{
 		pending:     prometheus.NewDesc("slurm_account_jobs_pending", "Pending jobs for account", labels, nil),
@@ -101,6 +107,7 @@ func NewAccountsCollector(logger *logger.Logger) *AccountsCollector {
 		runningCpus: prometheus.NewDesc("slurm_account_cpus_running", "Running CPUs for account", labels, nil),
 		runningGPUs: prometheus.NewDesc("slurm_account_gpus_running", "Running GPUs for account", labels, nil),
 		suspended:   prometheus.NewDesc("slurm_account_jobs_suspended", "Suspended jobs for account", labels, nil),
+		topN:        topN,
 		logger:      logger,
 	}
 }
@@ -113,32 +120,33 @@ func (ac *AccountsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ac.suspended
 }
 
-func (ac *AccountsCollector) Collect(ch chan<- prometheus.Metric) { _ = ac.tryCollect(ch) }
+func (ac *AccountsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = ac.tryCollect(context.Background(), ch)
+}
 
-func (ac *AccountsCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	data, err := AccountsData(ac.logger)
+func (ac *AccountsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	data, err := AccountsData(ctx, ac.logger)
 	if err != nil {
 		ac.logger.Error("Failed to get accounts data", "err", err)
 		return err
 	}
 	am := ParseAccountsMetrics(data)
-	for a := range am {
-		if am[a].pending > 0 {
-			ch <- prometheus.MustNewConstMetric(ac.pending, prometheus.GaugeValue, am[a].pending, a)
-		}
-		if am[a].running > 0 {
-			ch <- prometheus.MustNewConstMetric(ac.running, prometheus.GaugeValue, am[a].running, a)
-		}
-		if am[a].runningCpus > 0 {
-			ch <- prometheus.MustNewConstMetric(ac.runningCpus, prometheus.GaugeValue, am[a].runningCpus, a)
-		}
-		if am[a].runningGPUs > 0 {
-			ch <- prometheus.MustNewConstMetric(ac.runningGPUs, prometheus.GaugeValue, am[a].runningGPUs, a)
+	emit := func(desc *prometheus.Desc, value func(*JobMetrics) float64) {
+		values := make(map[string]float64, len(am))
+		for a, m := range am {
+			if v := value(m); v > 0 {
+				values[a] = v
+			}
 		}
-		if am[a].suspended > 0 {
-			ch <- prometheus.MustNewConstMetric(ac.suspended, prometheus.GaugeValue, am[a].suspended, a)
+		for a, v := range limitTopN(values, ac.topN) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, a)
 		}
 	}
+	emit(ac.pending, func(m *JobMetrics) float64 { return m.pending })
+	emit(ac.running, func(m *JobMetrics) float64 { return m.running })
+	emit(ac.runningCpus, func(m *JobMetrics) float64 { return m.runningCpus })
+	emit(ac.runningGPUs, func(m *JobMetrics) float64 { return m.runningGPUs })
+	emit(ac.suspended, func(m *JobMetrics) float64 { return m.suspended })
 
 	return nil
 }
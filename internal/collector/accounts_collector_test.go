@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,7 +16,7 @@ func TestAccountsCollector_Collect(t *testing.T) {
 	defer func() { Execute = oldExecute }()
 	resetSqueueJobsCache() // accounts reads through the shared squeue cache (#144)
 	// Wide shared-snapshot layout: JobID|Account|UserName|Partition|State|NumNodes|NumCPUs|tres-alloc.
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`1|hpc_team|user|cpu|RUNNING|1|4|N/A
 2|hpc_team|user|cpu|RUNNING|1|8|N/A
 3|ml_group|user|cpu|PENDING|1|2|N/A
@@ -23,7 +24,7 @@ func TestAccountsCollector_Collect(t *testing.T) {
 	}
 
 	log := logger.NewLogger("error")
-	c := NewAccountsCollector(log)
+	c := NewAccountsCollector(log, 0)
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -42,7 +43,7 @@ func TestAccountsCollector_Collect(t *testing.T) {
 
 func TestAccountsCollector_Describe(t *testing.T) {
 	log := logger.NewLogger("error")
-	c := NewAccountsCollector(log)
+	c := NewAccountsCollector(log, 0)
 	ch := make(chan *prometheus.Desc, 10)
 	c.Describe(ch)
 	close(ch)
@@ -57,12 +58,12 @@ func TestAccountsCollector_ErrorHandling(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
 	resetSqueueJobsCache() // a warm shared cache would hide the injected failure (#144)
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
 	log := logger.NewLogger("error")
-	c := NewAccountsCollector(log)
+	c := NewAccountsCollector(log, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 	mfs, err := reg.Gather()
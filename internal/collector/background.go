@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// BackgroundCollector runs an inner collector on its own interval and serves
+// the metrics of its last run from memory.
+//
+// Collected at scrape time, the load on slurmctld follows the number of
+// scrapers: two Prometheus replicas send every squeue, sinfo and sdiag twice.
+// Wrapped, a collector sends its commands once per interval however many
+// scrapers there are and however often they come. The price is data up to one
+// interval old, which slurm_exporter_collector_staleness_seconds makes
+// visible.
+//
+// A run is what a scrape would have been: the same metrics, and the same
+// error when the inner collector is a failableCollector. tryCollect replays
+// both, so slurm_exporter_collector_success reports the last run rather than
+// the act of serving it.
+type BackgroundCollector struct {
+	name     string
+	inner    prometheus.Collector
+	interval time.Duration
+
+	mu       sync.RWMutex
+	metrics  []prometheus.Metric
+	err      error
+	ranAt    time.Time
+	lastGood time.Time
+
+	// ready is closed once the first run has completed, so a scrape that
+	// arrives before it waits instead of reporting an empty collector.
+	ready chan struct{}
+	// done is closed when the goroutine started by Start exits.
+	done chan struct{}
+
+	logger *logger.Logger
+}
+
+// errNoRunYet is returned to a scrape that gave up waiting for the first run.
+var errNoRunYet = errors.New("background collector has not completed a run yet")
+
+// NewBackgroundCollector wraps inner, registered under name, so that it runs
+// every interval. Call Start to begin.
+func NewBackgroundCollector(log *logger.Logger, name string, inner prometheus.Collector, interval time.Duration) *BackgroundCollector {
+	return &BackgroundCollector{
+		name:     name,
+		inner:    inner,
+		interval: interval,
+		err:      errNoRunYet,
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+		logger:   log,
+	}
+}
+
+// Start launches the refresh goroutine: one run straight away, then one every
+// interval until ctx is cancelled. ctx is also the one every run's Slurm
+// commands get, so it carries the collector's timeout override.
+func (c *BackgroundCollector) Start(ctx context.Context) {
+	go func() {
+		defer close(c.done)
+		c.refresh(ctx)
+		close(c.ready)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.refresh(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Done returns a channel closed once the goroutine started by Start has
+// exited. The reloader waits on it at shutdown.
+func (c *BackgroundCollector) Done() <-chan struct{} {
+	return c.done
+}
+
+// refresh runs the inner collector once and keeps what it emitted. A failed
+// run replaces the previous one like a failed scrape would: its series
+// disappear and the error is reported.
+func (c *BackgroundCollector) refresh(ctx context.Context) {
+	ch := make(chan prometheus.Metric)
+	var metrics []prometheus.Metric
+	collected := make(chan struct{})
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(collected)
+	}()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("collector panicked: %v", r)
+			}
+		}()
+		if fc, ok := c.inner.(failableCollector); ok {
+			return fc.tryCollect(ctx, ch)
+		}
+		c.inner.Collect(ch)
+		return nil
+	}()
+	close(ch)
+	<-collected
+
+	if ctx.Err() != nil {
+		// Stopped by a reload or shutdown: the run is incomplete, and nobody
+		// will serve it.
+		return
+	}
+	if err != nil {
+		c.logger.Error("Background refresh failed", "collector", c.name, "err", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.metrics, c.err, c.ranAt = metrics, err, now
+	if err == nil {
+		c.lastGood = now
+	}
+}
+
+// Describe delegates to the inner collector.
+func (c *BackgroundCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.inner.Describe(ch)
+}
+
+// Collect serves the last run.
+func (c *BackgroundCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = c.tryCollect(context.Background(), ch)
+}
+
+// tryCollect serves the last run and returns its error. Before the first run
+// has completed it waits for it, for as long as the scrape does.
+func (c *BackgroundCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		return errNoRunYet
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, m := range c.metrics {
+		ch <- m
+	}
+	return c.err
+}
+
+// lastSuccess returns when the last successful run completed, or the zero time
+// if none has.
+func (c *BackgroundCollector) lastSuccess() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastGood
+}
+
+// lastRun returns when the run being served completed, or the zero time if
+// none has.
+func (c *BackgroundCollector) lastRun() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ranAt
+}
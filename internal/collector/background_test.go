@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// countingMock is a failableCollector that counts its runs.
+type countingMock struct {
+	failingMock
+	runs atomic.Int32
+}
+
+func (c *countingMock) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.runs.Add(1)
+	return c.failingMock.tryCollect(ctx, ch)
+}
+
+func startBackground(t *testing.T, inner prometheus.Collector, interval time.Duration) *BackgroundCollector {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	bc := NewBackgroundCollector(logger.NewLogger("error"), "test", inner, interval)
+	bc.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-bc.Done()
+	})
+	return bc
+}
+
+// TestBackgroundCollector_ScrapesDoNotRun checks the point of the wrapper:
+// however many scrapes arrive, the inner collector runs once per interval.
+func TestBackgroundCollector_ScrapesDoNotRun(t *testing.T) {
+	inner := &countingMock{failingMock: failingMock{mockCollector: *newMockCollector("slurm_bg_metric", 7)}}
+	bc := startBackground(t, inner, time.Hour)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(bc))
+	for range 5 {
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		v, ok := gatheredValue(mfs, "slurm_bg_metric", nil)
+		require.True(t, ok, "the first scrape waits for the first run")
+		assert.Equal(t, 7.0, v)
+	}
+	assert.Equal(t, int32(1), inner.runs.Load())
+}
+
+// TestBackgroundCollector_ReportsLastRun checks that a failed run is reported
+// as one, and that its last success stays at the previous run.
+func TestBackgroundCollector_ReportsLastRun(t *testing.T) {
+	inner := &countingMock{failingMock: failingMock{mockCollector: *newMockCollector("slurm_bg_metric", 7)}}
+	bc := startBackground(t, inner, 20*time.Millisecond)
+
+	ch := make(chan prometheus.Metric, 10)
+	require.NoError(t, bc.tryCollect(context.Background(), ch))
+	good := bc.lastSuccess()
+	require.False(t, good.IsZero())
+
+	inner.fail.Store(true)
+	assert.Eventually(t, func() bool {
+		return bc.tryCollect(context.Background(), make(chan prometheus.Metric, 10)) != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, good, bc.lastSuccess())
+}
+
+// TestBackgroundCollector_FirstRunWaitIsBounded checks that a scrape arriving
+// before the first run gives up with its own context.
+func TestBackgroundCollector_FirstRunWaitIsBounded(t *testing.T) {
+	bc := NewBackgroundCollector(logger.NewLogger("error"), "test", newMockCollector("slurm_bg_metric", 1), time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, bc.tryCollect(ctx, make(chan prometheus.Metric, 1)), errNoRunYet)
+}
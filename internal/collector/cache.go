@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -60,21 +62,33 @@ func (c *timedCache) AgeSeconds() float64 {
 	return time.Since(c.fetchAt).Seconds()
 }
 
+// SetTTL changes how long a fetched value stays fresh. It takes the write
+// lock, so a reload never races a scrape reading the TTL.
+func (c *timedCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
 // ── Shared caches ─────────────────────────────────────────────────────────────
 
+// DefaultCacheTTL is the TTL of every shared cache the configuration file does
+// not set one for.
+const DefaultCacheTTL = 25 * time.Second
+
 // scontrolNodesCache is shared between NodesCollector (SlurmGetTotal) and
 // ReservationNodesCollector (ReservationNodesData). Both need the full
 // scontrol show nodes -o output but there is no reason to fetch it twice.
 // TTL is set just below the scrape interval (default 30s) so a single
 // scrape always gets fresh data without double-fetching.
-var scontrolNodesCache = &timedCache{ttl: 25 * time.Second}
+var scontrolNodesCache = &timedCache{ttl: DefaultCacheTTL}
 
 // squeueJobsCache holds one consolidated squeue snapshot of the whole job queue
 // (SqueueJobsData). The accounts, users and partitions collectors each used to
 // dump the full queue from slurmctld on every scrape — up to five separate
 // squeue calls; they now share this single snapshot. Same 25s TTL rationale as
 // scontrolNodesCache: one fetch per scrape, always fresh. See issue #144.
-var squeueJobsCache = &timedCache{ttl: 25 * time.Second}
+var squeueJobsCache = &timedCache{ttl: DefaultCacheTTL}
 
 // cacheRegistry maps each shared cache's slurm_exporter_cache_age_seconds label
 // to a getter returning the live instance. updateCacheAge iterates it, so
@@ -86,6 +100,43 @@ var cacheRegistry = map[string]func() *timedCache{
 	"squeue_jobs":    func() *timedCache { return squeueJobsCache },
 }
 
+// CacheNames returns the names of the shared caches, sorted. They are the
+// values of the cache label on slurm_exporter_cache_age_seconds, and the keys
+// the configuration file accepts under cache:.
+func CacheNames() []string {
+	names := make([]string, 0, len(cacheRegistry))
+	for name := range cacheRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetCacheTTL changes the TTL of the named shared cache. The default of 25s
+// assumes the recommended 30s scrape interval; a site scraping less often
+// raises it so that one scrape still maps to one fetch.
+func SetCacheTTL(name string, ttl time.Duration) error {
+	get, ok := cacheRegistry[name]
+	if !ok {
+		return fmt.Errorf("unknown cache %q", name)
+	}
+	get().SetTTL(ttl)
+	return nil
+}
+
+// CacheTTL returns the TTL currently applied to the named shared cache, zero
+// for an unknown name.
+func CacheTTL(name string) time.Duration {
+	get, ok := cacheRegistry[name]
+	if !ok {
+		return 0
+	}
+	c := get()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl
+}
+
 // ── Cache age metric ──────────────────────────────────────────────────────────
 
 var cacheAgeGauge = prometheus.NewGaugeVec(
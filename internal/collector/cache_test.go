@@ -98,3 +98,18 @@ func TestTimedCache_ConcurrentAccess(t *testing.T) {
 	// the 100ms TTL expire mid-test and trigger a legitimate re-fetch.
 	assert.LessOrEqual(t, calls.Load(), int32(3), "concurrent callers must not all re-fetch")
 }
+
+func TestSetCacheTTL(t *testing.T) {
+	old := squeueJobsCache
+	t.Cleanup(func() { squeueJobsCache = old })
+	squeueJobsCache = &timedCache{ttl: 25 * time.Second}
+
+	require.NoError(t, SetCacheTTL("squeue_jobs", 55*time.Second))
+	assert.Equal(t, 55*time.Second, squeueJobsCache.ttl)
+
+	require.Error(t, SetCacheTTL("sinfo", time.Second), "an unknown cache name must be rejected")
+}
+
+func TestCacheNames(t *testing.T) {
+	assert.Equal(t, []string{"scontrol_nodes", "squeue_jobs"}, CacheNames())
+}
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Circuit breaker around Execute, one per binary.
+//
+// An overloaded slurmctld answers late or not at all, and every scrape keeps
+// sending it squeue, sinfo and scontrol regardless. Each of those waits out
+// the command timeout and joins the RPC backlog the controller is trying to
+// drain. After threshold consecutive calls that failed because of the
+// controller, the binary's circuit opens: its calls fail at once, without
+// running, for the back-off period. Then one call is let through as a probe.
+// If it succeeds the circuit closes; if it fails the same way the circuit
+// opens for another period.
+//
+// Only failures that say the controller is struggling count: a timeout, or
+// Slurm reporting it cannot reach slurmctld. Any other outcome, success or
+// not, shows the controller answered and resets the count. A command the
+// scrape abandoned says nothing either way and is ignored.
+
+type noCircuitBreakerKey struct{}
+
+// withoutCircuitBreaker returns a context under which Execute runs commands
+// outside their breaker: neither refused while it is open nor counted
+// towards opening it. For a check that must report on slurmctld itself, and
+// whose failures are no reason to back the collectors off.
+func withoutCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCircuitBreakerKey{}, true)
+}
+
+// circuitState is the value of slurm_exporter_circuit_state.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// errCircuitOpen is returned, wrapped, for a call the breaker refused to run.
+var errCircuitOpen = errors.New("circuit open")
+
+// controllerUnreachable is what every Slurm client prints when slurmctld does
+// not answer its RPC.
+var controllerUnreachable = []byte("Unable to contact slurm controller")
+
+type breaker struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+	// probe identifies the half-open probe while it runs, so concurrent
+	// callers are refused rather than all becoming probes. Zero when none
+	// runs.
+	probe uint64
+}
+
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	backoff   time.Duration
+	byBinary  map[string]*breaker
+	now       func() time.Time
+	// probes numbers the probes allow lets through, from 1.
+	probes uint64
+}
+
+// circuits is disabled until SetCircuitBreaker is called, so tests that run
+// Execute for real are not refused because an earlier one timed out.
+var circuits = &circuitBreakers{byBinary: make(map[string]*breaker), now: time.Now}
+
+var circuitStateGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "slurm_exporter_circuit_state",
+		Help: "State of the circuit breaker of each Slurm binary (0=closed, 1=open, 2=half-open).",
+	},
+	[]string{"binary"},
+)
+
+// SetCircuitBreaker configures the breaker: threshold consecutive controller
+// failures open a binary's circuit for backoff. A threshold of 0 disables it.
+// Every circuit is closed again, so a reload starts from a clean slate.
+func SetCircuitBreaker(threshold int, backoff time.Duration) {
+	circuits.mu.Lock()
+	defer circuits.mu.Unlock()
+	circuits.threshold = threshold
+	circuits.backoff = backoff
+	for binary := range circuits.byBinary {
+		circuitStateGauge.WithLabelValues(binary).Set(float64(circuitClosed))
+	}
+	clear(circuits.byBinary)
+}
+
+// allow reports whether a call to binary may run, and returns errCircuitOpen
+// if not. A call allowed on a half-open circuit is its probe: allow returns
+// the probe's token, to hand back to record, and zero for any other call.
+func (c *circuitBreakers) allow(binary string) (probe uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.threshold <= 0 {
+		return 0, nil
+	}
+	b := c.get(binary)
+	switch b.state {
+	case circuitOpen:
+		if c.now().Sub(b.openedAt) < c.backoff {
+			break
+		}
+		c.set(binary, b, circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		if b.probe != 0 {
+			break
+		}
+		c.probes++
+		b.probe = c.probes
+		return b.probe, nil
+	default:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w for %s after %d consecutive controller failures", errCircuitOpen, binary, b.failures)
+}
+
+// record updates the circuit of binary with the outcome of a call: probe is
+// the token allow returned for it, ctxErr the call's context error, out and
+// err what it returned. Only the probe itself lets another one through: a
+// call allowed before the circuit opened can finish while the probe runs.
+func (c *circuitBreakers) record(log *logger.Logger, binary string, probe uint64, ctxErr error, out []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.threshold <= 0 {
+		return
+	}
+	b := c.get(binary)
+	if probe != 0 && b.probe == probe {
+		b.probe = 0
+	}
+
+	switch {
+	case err == nil:
+		c.reset(log, binary, b)
+	case errors.Is(ctxErr, context.Canceled):
+		return
+	case errors.Is(ctxErr, context.DeadlineExceeded), bytes.Contains(out, controllerUnreachable):
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= c.threshold {
+			if b.state != circuitOpen {
+				log.Warn("Circuit opened: calls are refused until the back-off ends",
+					"binary", binary, "consecutive_failures", b.failures, "backoff", c.backoff)
+			}
+			b.openedAt = c.now()
+			c.set(binary, b, circuitOpen)
+		}
+	default:
+		c.reset(log, binary, b)
+	}
+}
+
+// reset closes the circuit of binary after a call the controller answered.
+func (c *circuitBreakers) reset(log *logger.Logger, binary string, b *breaker) {
+	if b.state != circuitClosed {
+		log.Info("Circuit closed: the controller answered", "binary", binary)
+	}
+	b.failures = 0
+	c.set(binary, b, circuitClosed)
+}
+
+func (c *circuitBreakers) get(binary string) *breaker {
+	b, ok := c.byBinary[binary]
+	if !ok {
+		b = &breaker{}
+		c.byBinary[binary] = b
+		circuitStateGauge.WithLabelValues(binary).Set(float64(circuitClosed))
+	}
+	return b
+}
+
+func (c *circuitBreakers) set(binary string, b *breaker, s circuitState) {
+	b.state = s
+	circuitStateGauge.WithLabelValues(binary).Set(float64(s))
+}
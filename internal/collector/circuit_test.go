@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// scriptedSource answers every command with the same output and error, and
+// counts the calls that reached it.
+type scriptedSource struct {
+	out   []byte
+	err   error
+	calls int
+}
+
+func (*scriptedSource) Name() string { return "scripted" }
+
+func (s *scriptedSource) Run(context.Context, string, []string) ([]byte, error) {
+	s.calls++
+	return s.out, s.err
+}
+
+var errUnreachable = errors.New("exit status 1")
+
+const unreachableOutput = "squeue: error: Unable to contact slurm controller (connect failure)"
+
+// withCircuitBreaker enables the breaker with a clock the test moves.
+func withCircuitBreaker(t *testing.T, threshold int, backoff time.Duration) *time.Time {
+	t.Helper()
+	now := time.Now()
+	oldNow := circuits.now
+	circuits.now = func() time.Time { return now }
+	oldTimeout := CommandTimeout()
+	SetCommandTimeout(5 * time.Second)
+	SetCircuitBreaker(threshold, backoff)
+	t.Cleanup(func() {
+		SetCircuitBreaker(0, 0)
+		SetCommandTimeout(oldTimeout)
+		circuits.now = oldNow
+	})
+	return &now
+}
+
+func TestCircuitBreaker_OpensAndShortCircuits(t *testing.T) {
+	src := &scriptedSource{out: []byte(unreachableOutput), err: errUnreachable}
+	withDataSource(t, src)
+	withCircuitBreaker(t, 3, time.Minute)
+	log := logger.NewLogger("error")
+
+	errorsBefore := testutil.ToFloat64(execErrors.WithLabelValues("squeue", "slurm"))
+	shortBefore := testutil.ToFloat64(execErrors.WithLabelValues("squeue", "circuit_breaker"))
+	for range 3 {
+		_, err := Execute(context.Background(), log, "squeue", nil)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, errCircuitOpen)
+	}
+	assert.Equal(t, float64(circuitOpen), testutil.ToFloat64(circuitStateGauge.WithLabelValues("squeue")))
+
+	for range 2 {
+		_, err := Execute(context.Background(), log, "squeue", nil)
+		require.ErrorIs(t, err, errCircuitOpen)
+	}
+	assert.Equal(t, 3, src.calls, "an open circuit does not run the command")
+	assert.Equal(t, 3.0, testutil.ToFloat64(execErrors.WithLabelValues("squeue", "slurm"))-errorsBefore)
+	assert.Equal(t, 2.0, testutil.ToFloat64(execErrors.WithLabelValues("squeue", "circuit_breaker"))-shortBefore,
+		"refused calls are errors of their own origin")
+
+	_, err := Execute(context.Background(), log, "sinfo", nil)
+	require.NotErrorIs(t, err, errCircuitOpen, "each binary has its own circuit")
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	src := &scriptedSource{out: []byte(unreachableOutput), err: errUnreachable}
+	withDataSource(t, src)
+	now := withCircuitBreaker(t, 1, time.Minute)
+	log := logger.NewLogger("error")
+
+	_, _ = Execute(context.Background(), log, "sdiag", nil)
+	require.Equal(t, circuitOpen, circuits.byBinary["sdiag"].state)
+
+	// A failed probe opens the circuit for another back-off.
+	*now = now.Add(time.Minute)
+	_, err := Execute(context.Background(), log, "sdiag", nil)
+	require.NotErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, 2, src.calls)
+	_, err = Execute(context.Background(), log, "sdiag", nil)
+	require.ErrorIs(t, err, errCircuitOpen)
+
+	// Only one caller probes at a time.
+	*now = now.Add(time.Minute)
+	probe, err := circuits.allow("sdiag")
+	require.NoError(t, err)
+	assert.NotZero(t, probe)
+	assert.Equal(t, circuitHalfOpen, circuits.byBinary["sdiag"].state)
+	_, err = circuits.allow("sdiag")
+	require.ErrorIs(t, err, errCircuitOpen)
+
+	// A successful probe closes it.
+	circuits.record(log, "sdiag", probe, nil, []byte("ok"), nil)
+	assert.Equal(t, float64(circuitClosed), testutil.ToFloat64(circuitStateGauge.WithLabelValues("sdiag")))
+	src.out, src.err = []byte("ok"), nil
+	_, err = Execute(context.Background(), log, "sdiag", nil)
+	require.NoError(t, err)
+}
+
+// TestCircuitBreaker_OnlyControllerFailuresCount checks that an error the
+// controller answered resets the count, and that an abandoned scrape is
+// ignored.
+func TestCircuitBreaker_OnlyControllerFailuresCount(t *testing.T) {
+	withCircuitBreaker(t, 2, time.Minute)
+	log := logger.NewLogger("error")
+	unreachable := []byte(unreachableOutput)
+
+	circuits.record(log, "scontrol", 0, nil, unreachable, errUnreachable)
+	circuits.record(log, "scontrol", 0, nil, []byte("scontrol: error: Invalid node name specified"), errUnreachable)
+	circuits.record(log, "scontrol", 0, nil, unreachable, errUnreachable)
+	assert.Equal(t, circuitClosed, circuits.byBinary["scontrol"].state)
+
+	circuits.record(log, "scontrol", 0, context.Canceled, nil, context.Canceled)
+	assert.Equal(t, 1, circuits.byBinary["scontrol"].failures)
+
+	circuits.record(log, "scontrol", 0, context.DeadlineExceeded, nil, context.DeadlineExceeded)
+	assert.Equal(t, circuitOpen, circuits.byBinary["scontrol"].state)
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	src := &scriptedSource{out: []byte(unreachableOutput), err: errUnreachable}
+	withDataSource(t, src)
+	withCircuitBreaker(t, 0, time.Minute)
+
+	for range 10 {
+		_, err := Execute(context.Background(), logger.NewLogger("error"), "squeue", nil)
+		require.NotErrorIs(t, err, errCircuitOpen)
+	}
+	assert.Equal(t, 10, src.calls)
+}
+
+// TestCircuitBreaker_LateCallKeepsProbe checks that a call allowed before the
+// circuit opened, finishing while the probe runs, does not let a second probe
+// through.
+func TestCircuitBreaker_LateCallKeepsProbe(t *testing.T) {
+	src := &heldSource{result: make(chan []byte)}
+	withDataSource(t, src)
+	now := withCircuitBreaker(t, 1, time.Minute)
+	log := logger.NewLogger("error")
+
+	// The late call starts while the circuit is closed, and blocks.
+	lateCtx, abandon := context.WithCancel(context.Background())
+	late := make(chan struct{})
+	go func() {
+		defer close(late)
+		_, _ = Execute(lateCtx, log, "squeue", nil)
+	}()
+	require.Eventually(t, func() bool { return src.started.Load() == 1 }, 5*time.Second, time.Millisecond)
+
+	// Another call opens the circuit, and the back-off ends.
+	circuits.record(log, "squeue", 0, context.DeadlineExceeded, nil, context.DeadlineExceeded)
+	*now = now.Add(time.Minute)
+
+	// The probe starts and blocks too.
+	probed := make(chan struct{})
+	go func() {
+		defer close(probed)
+		_, _ = Execute(context.Background(), log, "squeue", nil)
+	}()
+	require.Eventually(t, func() bool { return src.started.Load() == 2 }, 5*time.Second, time.Millisecond)
+
+	// The late call's scrape is abandoned while the probe runs.
+	abandon()
+	<-late
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 4 {
+		wg.Go(func() {
+			if _, err := circuits.allow("squeue"); err == nil {
+				allowed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	assert.Zero(t, allowed.Load(), "the probe still runs: no second one goes through")
+
+	src.result <- []byte("ok")
+	<-probed
+	assert.Equal(t, circuitClosed, circuits.byBinary["squeue"].state, "the probe's success closes the circuit")
+}
+
+// heldSource holds each call until an output is sent for it, or its
+// context ends.
+type heldSource struct {
+	started atomic.Int32
+	result  chan []byte
+}
+
+func (*heldSource) Name() string { return "held" }
+
+func (s *heldSource) Run(ctx context.Context, _ string, _ []string) ([]byte, error) {
+	s.started.Add(1)
+	select {
+	case out := <-s.result:
+		return out, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scrape coalescing.
+//
+// Two Prometheus HA replicas and a Grafana Agent scrape the exporter at nearly
+// the same moment, and each scrape ran every collector: three sets of RPCs per
+// interval where one would do. Only the scontrol nodes and squeue job caches
+// were shared. With a coalescing window, a scrape that arrives while another
+// scrape's collection is running, or less than the window after it started,
+// is served that collection's metrics instead of starting its own. Only
+// scrapes selecting the same collectors share a collection.
+//
+// The shared collection runs under a context of its own, cancelled once every
+// scrape waiting on it has gone away: the first scraper giving up must not
+// fail the others, and the last one giving up must still stop the commands.
+//
+// A finished collection is forgotten once the window has passed, metrics and
+// all: a client cycling through collect[] and exclude[] combinations would
+// otherwise keep one per combination for the life of the process.
+
+// flight is one collection shared by the scrapes that joined it.
+type flight struct {
+	started time.Time
+	done    chan struct{}
+	metrics []prometheus.Metric
+
+	// mu guards waiters and abandoned.
+	mu        sync.Mutex
+	waiters   int
+	abandoned bool
+	cancel    context.CancelFunc
+}
+
+// SetCoalesceWindow sets how long after a collection starts a new scrape may
+// still be served its result. 0 disables coalescing: every scrape collects.
+func (st *StatusTracker) SetCoalesceWindow(d time.Duration) {
+	st.flightMu.Lock()
+	defer st.flightMu.Unlock()
+	st.coalesceWindow = d
+}
+
+// collectShared serves ch from a collection shared with concurrent scrapes,
+// when a coalescing window is set, and runs its own otherwise.
+func (st *StatusTracker) collectShared(ctx context.Context, sel Selection, ch chan<- prometheus.Metric) {
+	f, leader, ok := st.join(ctx, sel)
+	if !ok {
+		st.collect(ctx, sel, ch)
+		return
+	}
+	if !leader {
+		st.coalesced.Inc()
+	}
+
+	select {
+	case <-f.done:
+		for _, m := range f.metrics {
+			ch <- m
+		}
+	case <-ctx.Done():
+		f.leave()
+	}
+}
+
+// join returns the flight the scrape should be served from, starting one if
+// there is none it can join. leader reports whether it started it. ok is false
+// when coalescing is disabled.
+func (st *StatusTracker) join(ctx context.Context, sel Selection) (f *flight, leader, ok bool) {
+	st.flightMu.Lock()
+	defer st.flightMu.Unlock()
+	if st.coalesceWindow <= 0 {
+		return nil, false, false
+	}
+
+	now, window := time.Now(), st.coalesceWindow
+	key := sel.key()
+	if f := st.flights[key]; f != nil {
+		f.mu.Lock()
+		joinable := !f.abandoned && (!isDone(f.done) || now.Sub(f.started) < window)
+		if joinable {
+			f.waiters++
+		}
+		f.mu.Unlock()
+		if joinable {
+			return f, false, true
+		}
+	}
+
+	// Detached from the scrape's own cancellation; leave cancels it once the
+	// last waiter is gone.
+	fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f = &flight{started: now, done: make(chan struct{}), waiters: 1, cancel: cancel}
+	st.flights[key] = f
+	go func() {
+		defer cancel()
+		buffer := newMetricBuffer()
+		st.collect(fctx, sel, buffer.ch)
+		f.metrics = buffer.close()
+		close(f.done)
+		time.AfterFunc(window-time.Since(now), func() { st.forget(key, f) })
+	}()
+	return f, true, true
+}
+
+// forget removes f from the flights, unless another has taken its key since.
+func (st *StatusTracker) forget(key string, f *flight) {
+	st.flightMu.Lock()
+	defer st.flightMu.Unlock()
+	if st.flights[key] == f {
+		delete(st.flights, key)
+	}
+}
+
+// leave is called by a scrape that stopped waiting. The last one out cancels
+// the collection, and nobody joins it after that.
+func (f *flight) leave() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waiters--
+	if f.waiters == 0 && !isDone(f.done) {
+		f.abandoned = true
+		f.cancel()
+	}
+}
+
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
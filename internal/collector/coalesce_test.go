@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// gateCollector blocks each run until released, counts its runs, and records
+// whether the context it ran under was cancelled.
+type gateCollector struct {
+	mockCollector
+	runs      atomic.Int32
+	started   chan struct{}
+	release   chan struct{}
+	cancelled atomic.Bool
+}
+
+func newGateCollector() *gateCollector {
+	return &gateCollector{
+		mockCollector: *newMockCollector("slurm_gate_metric", 1),
+		started:       make(chan struct{}, 10),
+		release:       make(chan struct{}),
+	}
+}
+
+func (g *gateCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	g.runs.Add(1)
+	g.started <- struct{}{}
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		g.cancelled.Store(true)
+		return ctx.Err()
+	}
+	g.Collect(ch)
+	return nil
+}
+
+// scrape gathers the tracker bound to ctx, as the /metrics handler does, and
+// reports whether the inner collector's metric was served.
+func scrape(t *testing.T, st *StatusTracker, ctx context.Context) bool {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st.Bind(ctx)))
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	_, ok := gatheredValue(mfs, "slurm_gate_metric", nil)
+	return ok
+}
+
+func TestStatusTracker_CoalescesConcurrentScrapes(t *testing.T) {
+	g := newGateCollector()
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.SetCoalesceWindow(time.Minute)
+	st.Add("gate", g)
+
+	var wg sync.WaitGroup
+	served := make([]bool, 3)
+	wg.Go(func() { served[0] = scrape(t, st, context.Background()) })
+	<-g.started
+	for i := 1; i < 3; i++ {
+		wg.Go(func() { served[i] = scrape(t, st, context.Background()) })
+	}
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(st.coalesced) == 2 }, 3*time.Second, 5*time.Millisecond)
+	close(g.release)
+	wg.Wait()
+
+	assert.Equal(t, []bool{true, true, true}, served)
+	assert.Equal(t, int32(1), g.runs.Load(), "three scrapes, one collection")
+
+	// Within the window, a later scrape is served the finished collection too.
+	assert.True(t, scrape(t, st, context.Background()))
+	assert.Equal(t, int32(1), g.runs.Load())
+}
+
+func TestStatusTracker_CoalescingDisabled(t *testing.T) {
+	g := newGateCollector()
+	close(g.release)
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.Add("gate", g)
+
+	for range 3 {
+		scrape(t, st, context.Background())
+	}
+	assert.Equal(t, int32(3), g.runs.Load())
+	assert.Zero(t, testutil.ToFloat64(st.coalesced))
+}
+
+// TestStatusTracker_CoalescedCancellation checks that the scrape that started
+// a shared collection going away does not fail the others, and that the
+// collection stops once all of them have gone.
+func TestStatusTracker_CoalescedCancellation(t *testing.T) {
+	g := newGateCollector()
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.SetCoalesceWindow(time.Minute)
+	st.Add("gate", g)
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	followerCtx, cancelFollower := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { scrape(t, st, leaderCtx) })
+	<-g.started
+	wg.Go(func() { scrape(t, st, followerCtx) })
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(st.coalesced) == 1 }, 3*time.Second, 5*time.Millisecond)
+
+	cancelLeader()
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, g.cancelled.Load(), "a scrape is still waiting on the collection")
+
+	cancelFollower()
+	wg.Wait()
+	assert.Eventually(t, g.cancelled.Load, 3*time.Second, 5*time.Millisecond,
+		"the collection stops once nobody waits for it")
+
+	// An abandoned collection is not joined: the next scrape starts its own.
+	close(g.release)
+	assert.True(t, scrape(t, st, context.Background()))
+	assert.Equal(t, int32(2), g.runs.Load())
+}
+
+// TestStatusTracker_CoalesceForgetsFlights checks that a finished collection
+// is dropped once the window has passed, whatever the selection it was for.
+func TestStatusTracker_CoalesceForgetsFlights(t *testing.T) {
+	g := newGateCollector()
+	close(g.release)
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.SetCoalesceWindow(200 * time.Millisecond)
+	st.Add("gate", g)
+	st.Add("other", newMockCollector("slurm_other_metric", 1))
+
+	for _, sel := range []Selection{{}, {Collect: []string{"gate"}}, {Exclude: []string{"other"}}} {
+		bound, err := st.BindSelection(context.Background(), sel)
+		require.NoError(t, err)
+		reg := prometheus.NewRegistry()
+		require.NoError(t, reg.Register(bound))
+		_, err = reg.Gather()
+		require.NoError(t, err)
+	}
+	flights := func() int {
+		st.flightMu.Lock()
+		defer st.flightMu.Unlock()
+		return len(st.flights)
+	}
+	assert.Equal(t, 3, flights(), "each selection has its own collection")
+	assert.Eventually(t, func() bool { return flights() == 0 }, 3*time.Second, 5*time.Millisecond,
+		"finished collections are forgotten once the window has passed")
+}
@@ -0,0 +1,305 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// The command log.
+//
+// When a metric looks wrong, the first question is what Slurm printed, and
+// answering it used to mean logging in to the host and rebuilding the
+// invocation from this file by hand. With the log enabled, Execute keeps the
+// last execution of every command, argv, exit status, stderr, duration and
+// the start of stdout included, for /debug/commands to show. It is off unless
+// asked for: the output it keeps names users and jobs.
+
+// CommandOutputLimit is how much of a command's stdout and stderr the log
+// keeps. squeue on a busy cluster prints megabytes; the start is what a
+// reader looks at.
+const CommandOutputLimit = 64 << 10
+
+// CommandRun is one execution of a Slurm command, as the command log keeps it.
+type CommandRun struct {
+	// Name identifies the call as its recording file does, without the .txt
+	// of a text command: squeue_jobs, squeue.json, binary_version-sinfo.
+	Name string
+	// Binary and Args are what the collector asked Execute for.
+	Binary string
+	Args   []string
+	// Argv is what actually ran: the binary resolved against
+	// --slurm.bin-path, behind the command wrapper. For a source that runs
+	// nothing, it is the binary and its arguments.
+	Argv   []string
+	Source string
+	// Started is when the command started, and Duration how long it ran.
+	Started  time.Time
+	Duration time.Duration
+	// ExitCode is the command's exit status, 0 on success and -1 when it did
+	// not exit on its own: killed on timeout, never started, or not a
+	// command at all.
+	ExitCode int
+	// Err is the error Execute returned, empty on success.
+	Err string
+	// Stdout and Stderr are the start of each stream, up to
+	// CommandOutputLimit. A source that runs nothing has no stderr.
+	Stdout, Stderr []byte
+	// StdoutBytes and StderrBytes are the full sizes, so a reader can tell
+	// when Stdout or Stderr was cut.
+	StdoutBytes, StderrBytes int
+}
+
+// commandLog holds the last run of each call, by Name.
+type commandLog struct {
+	mu   sync.Mutex
+	runs map[string]CommandRun
+	// name is CallName. Execute cannot refer to it directly: CallName reads
+	// the registry, whose entries refer to Execute.
+	name func(binary string, args []string) string
+}
+
+// cmdLog is set once at startup by EnableCommandLog, before any collector
+// runs. nil keeps nothing.
+var cmdLog *commandLog
+
+// EnableCommandLog makes Execute keep the last execution of every command for
+// CommandRuns. Not safe to call while collectors are running.
+func EnableCommandLog() {
+	cmdLog = &commandLog{runs: make(map[string]CommandRun), name: CallName}
+}
+
+// CommandRuns returns the last execution of every command run since
+// EnableCommandLog, sorted by name. It is empty when the log is not enabled.
+func CommandRuns() []CommandRun {
+	l := cmdLog
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	runs := make([]CommandRun, 0, len(l.runs))
+	for _, r := range l.runs {
+		runs = append(runs, r)
+	}
+	slices.SortFunc(runs, func(a, b CommandRun) int { return strings.Compare(a.Name, b.Name) })
+	return runs
+}
+
+// CallName names the call of binary with args the way the command log and the
+// recordings do.
+func CallName(binary string, args []string) string {
+	return strings.TrimSuffix(recordingName(binary, args), ".txt")
+}
+
+// CommandLine returns Argv as a shell would take it, each word quoted as
+// needed, ready to paste into a terminal.
+func (r CommandRun) CommandLine() string {
+	words := make([]string, len(r.Argv))
+	for i, w := range r.Argv {
+		words[i] = shellQuote(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// RegisteredCall is one call the CommandRegistry declares, named as the
+// command log names it.
+type RegisteredCall struct {
+	Name   string
+	Binary string
+	// Args are the registry's, placeholders included.
+	Args []string
+	// Command is the registry entry, shared by the text calls of each binary
+	// of an EachBinary entry, and by the text calls a JSONForm stands in for.
+	Command *Command
+	// JSON is set for the --json form of Command.
+	JSON *JSONForm
+}
+
+// RegisteredCalls returns every call the registry declares: each binary of
+// each entry, in registry order, followed by the --json forms.
+func RegisteredCalls() []RegisteredCall {
+	var calls []RegisteredCall
+	for i := range CommandRegistry {
+		c := &CommandRegistry[i]
+		for _, bin := range c.binaries() {
+			calls = append(calls, RegisteredCall{Name: c.callName(bin), Binary: bin, Args: c.Args, Command: c})
+		}
+	}
+	for _, f := range JSONForms() {
+		call := RegisteredCall{Name: f.Name + ".json", Binary: f.Binary, Args: f.Args, JSON: f}
+		for i := range CommandRegistry {
+			if CommandRegistry[i].JSON == f {
+				call.Command = &CommandRegistry[i]
+				break
+			}
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// callName names the call of the entry for binary, one of its binaries.
+func (c *Command) callName(binary string) string {
+	if len(c.EachBinary) > 0 {
+		return c.Name + "-" + binary
+	}
+	return c.Name
+}
+
+// RerunCommand runs the call the log knows as name once more, with the
+// arguments it last ran with, through Execute: the run is timed out, counted
+// and logged like a collector's, and replaces the logged one. A call that has
+// not run yet can be run when its arguments are all known in advance, which
+// excludes the ones with placeholders such as sacct's time window.
+func RerunCommand(ctx context.Context, log *logger.Logger, name string) (CommandRun, error) {
+	l := cmdLog
+	if l == nil {
+		return CommandRun{}, errors.New("the command log is not enabled")
+	}
+	l.mu.Lock()
+	last, ok := l.runs[name]
+	l.mu.Unlock()
+	binary, args := last.Binary, last.Args
+	if !ok {
+		var found bool
+		if binary, args, found = staticCall(name); !found {
+			return CommandRun{}, fmt.Errorf("%s has not run yet, and its arguments are only known once it does", name)
+		}
+	}
+	before := time.Now()
+	_, _ = Execute(ctx, log, binary, args)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	run, ok := l.runs[name]
+	if !ok || run.Started.Before(before) {
+		// Short-circuited by an open circuit breaker: nothing ran.
+		return CommandRun{}, fmt.Errorf("%s did not run: its circuit breaker is open", name)
+	}
+	return run, nil
+}
+
+// staticCall returns the binary and arguments of the registry call named
+// name, when they hold no placeholder.
+func staticCall(name string) (binary string, args []string, ok bool) {
+	for _, call := range RegisteredCalls() {
+		if call.Name != name {
+			continue
+		}
+		if call.JSON == nil && len(call.Command.Placeholders) > 0 {
+			return "", nil, false
+		}
+		return call.Binary, call.Args, true
+	}
+	return "", nil, false
+}
+
+// record keeps run as the last of its call.
+func (l *commandLog) record(run CommandRun) {
+	run.Name = l.name(run.Binary, run.Args)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runs[run.Name] = run
+}
+
+// runCapture is where cliSource reports, for the command log, what a run
+// looked like from the inside. Execute puts one in the context it passes to
+// the source when the log is enabled.
+type runCapture struct {
+	argv     []string
+	stdout   limitedBuffer
+	stderr   limitedBuffer
+	exitCode int
+	captured bool
+}
+
+type runCaptureKey struct{}
+
+func captureFrom(ctx context.Context) *runCapture {
+	c, _ := ctx.Value(runCaptureKey{}).(*runCapture)
+	return c
+}
+
+// newCommandRun builds the log entry of one Execute call from what the source
+// returned and, for the CLI source, what it captured. record names it.
+func newCommandRun(src DataSource, command string, args []string, start time.Time, elapsed time.Duration, out []byte, err error, c *runCapture) CommandRun {
+	run := CommandRun{
+		Binary:   command,
+		Args:     slices.Clone(args),
+		Argv:     append([]string{command}, args...),
+		Source:   src.Name(),
+		Started:  start,
+		Duration: elapsed,
+	}
+	if err != nil {
+		run.Err = err.Error()
+	}
+	if c.captured {
+		run.Argv = c.argv
+		run.ExitCode = c.exitCode
+		run.Stdout, run.StdoutBytes = c.stdout.Bytes(), c.stdout.n
+		run.Stderr, run.StderrBytes = c.stderr.Bytes(), c.stderr.n
+		return run
+	}
+	if err != nil {
+		run.ExitCode = -1
+	}
+	run.StdoutBytes = len(out)
+	run.Stdout = bytes.Clone(out[:min(len(out), CommandOutputLimit)])
+	return run
+}
+
+// runCaptured runs cmd for the command log: stdout and stderr are kept apart,
+// up to CommandOutputLimit each, while the caller still gets both together, as
+// CombinedOutput would have given them.
+func runCaptured(cmd *exec.Cmd, c *runCapture) ([]byte, error) {
+	var combined bytes.Buffer
+	var mu sync.Mutex
+	cmd.Stdout = &lockedWriter{mu: &mu, w: io.MultiWriter(&combined, &c.stdout)}
+	cmd.Stderr = &lockedWriter{mu: &mu, w: io.MultiWriter(&combined, &c.stderr)}
+	err := cmd.Run()
+	c.argv = slices.Clone(cmd.Args)
+	c.exitCode = -1
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		c.exitCode = cmd.ProcessState.ExitCode()
+	}
+	c.captured = true
+	return combined.Bytes(), err
+}
+
+// lockedWriter serialises the writes of stdout and stderr into the combined
+// output, which exec copies from two goroutines.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// limitedBuffer keeps the first CommandOutputLimit bytes written to it, and
+// counts them all.
+type limitedBuffer struct {
+	bytes.Buffer
+	n int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.n += len(p)
+	if room := CommandOutputLimit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
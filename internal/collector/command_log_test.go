@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func withCommandLog(t *testing.T) {
+	t.Helper()
+	old := cmdLog
+	t.Cleanup(func() { cmdLog = old })
+	EnableCommandLog()
+}
+
+// runNamed returns the logged run of the call named name.
+func runNamed(t *testing.T, name string) CommandRun {
+	t.Helper()
+	for _, r := range CommandRuns() {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("no run of %s in the command log", name)
+	return CommandRun{}
+}
+
+func TestCommandLog_Source(t *testing.T) {
+	withCommandLog(t)
+	withDataSource(t, echoSource{fail: map[string]bool{"sdiag": true}})
+	log := logger.NewLogger("error")
+	ctx := context.Background()
+
+	_, err := Execute(ctx, log, "squeue", registryEntry("squeue_jobs").Args)
+	require.NoError(t, err)
+	_, err = Execute(ctx, log, "sdiag", nil)
+	require.Error(t, err)
+
+	run := runNamed(t, "squeue_jobs")
+	assert.Equal(t, "squeue", run.Binary)
+	assert.Equal(t, append([]string{"squeue"}, registryEntry("squeue_jobs").Args...), run.Argv)
+	assert.Equal(t, "echo", run.Source)
+	assert.Zero(t, run.ExitCode)
+	assert.Empty(t, run.Err)
+	assert.Equal(t, "squeue "+strings.Join(run.Args, " ")+"\n", string(run.Stdout))
+	assert.Equal(t, len(run.Stdout), run.StdoutBytes)
+	assert.WithinDuration(t, time.Now(), run.Started, time.Minute)
+
+	failed := CommandRuns()
+	require.Len(t, failed, 2)
+	assert.Equal(t, "sdiag", failed[0].Binary, "sorted by name")
+	assert.Equal(t, -1, failed[0].ExitCode)
+	assert.Equal(t, "exit status 1", failed[0].Err)
+}
+
+// TestCommandLog_CLI runs a real process, and checks that what ran, its exit
+// status and its two streams are logged apart while the collector still gets
+// them together.
+func TestCommandLog_CLI(t *testing.T) {
+	withCommandLog(t)
+	withDataSource(t, cliSource{})
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sdiag"), []byte("#!/bin/sh\necho out\necho 'sdiag: error' >&2\nexit 3\n"), 0o755))
+	oldBinPath, oldTimeout := binPath, CommandTimeout()
+	SetBinPath(bin)
+	SetCommandTimeout(5 * time.Second)
+	t.Cleanup(func() {
+		SetBinPath(oldBinPath)
+		SetCommandTimeout(oldTimeout)
+	})
+
+	out, err := cliSource{}.Run(context.WithValue(context.Background(), runCaptureKey{}, &runCapture{}), "sdiag", nil)
+	require.Error(t, err)
+	assert.Contains(t, string(out), "out\n")
+	assert.Contains(t, string(out), "sdiag: error\n", "the collector still gets stderr too")
+
+	_, err = Execute(context.Background(), logger.NewLogger("error"), "sdiag", []string{"-a"})
+	require.Error(t, err)
+	run := runNamed(t, CallName("sdiag", []string{"-a"}))
+	assert.Equal(t, []string{filepath.Join(bin, "sdiag"), "-a"}, run.Argv)
+	assert.Equal(t, 3, run.ExitCode)
+	assert.Equal(t, "out\n", string(run.Stdout))
+	assert.Equal(t, "sdiag: error\n", string(run.Stderr))
+	assert.Equal(t, "exit status 3", run.Err)
+	assert.Equal(t, "cli", run.Source)
+}
+
+func TestCommandLog_Disabled(t *testing.T) {
+	old := cmdLog
+	t.Cleanup(func() { cmdLog = old })
+	cmdLog = nil
+	withDataSource(t, echoSource{})
+
+	_, err := Execute(context.Background(), logger.NewLogger("error"), "squeue", nil)
+	require.NoError(t, err)
+	assert.Empty(t, CommandRuns())
+	_, err = RerunCommand(context.Background(), logger.NewLogger("error"), "squeue_jobs")
+	assert.ErrorContains(t, err, "not enabled")
+}
+
+func TestRerunCommand(t *testing.T) {
+	withCommandLog(t)
+	withDataSource(t, echoSource{})
+	log := logger.NewLogger("error")
+	ctx := context.Background()
+
+	// Never run, but its arguments are fixed.
+	run, err := RerunCommand(ctx, log, "scheduler")
+	require.NoError(t, err)
+	assert.Equal(t, registryEntry("scheduler").Args, run.Args)
+
+	_, err = RerunCommand(ctx, log, "scontrol_nodes.json")
+	require.NoError(t, err, "a --json form has fixed arguments too")
+
+	// sacct's window is only known once it runs, then it is rerun as is.
+	_, err = RerunCommand(ctx, log, "sacct_efficiency")
+	assert.ErrorContains(t, err, "has not run yet")
+	window := sacctArgs(time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local))
+	_, err = Execute(ctx, log, "sacct", window)
+	require.NoError(t, err)
+	run, err = RerunCommand(ctx, log, "sacct_efficiency")
+	require.NoError(t, err)
+	assert.Equal(t, window, run.Args)
+
+	_, err = RerunCommand(ctx, log, "nonexistent")
+	assert.Error(t, err)
+}
+
+func TestRegisteredCalls(t *testing.T) {
+	seen := map[string]bool{}
+	for _, call := range RegisteredCalls() {
+		assert.False(t, seen[call.Name], "duplicate call name %s", call.Name)
+		seen[call.Name] = true
+		assert.NotNil(t, call.Command, call.Name)
+		if call.JSON == nil && len(call.Command.Placeholders) == 0 {
+			assert.Equal(t, call.Name, CallName(call.Binary, call.Args), "the log names a run as the registry does")
+		}
+	}
+	assert.True(t, seen["binary_version-sinfo"])
+	assert.True(t, seen["squeue.json"])
+	assert.True(t, seen["sacct_efficiency"])
+}
+
+func TestCommandRunCommandLine(t *testing.T) {
+	run := CommandRun{Argv: []string{"/usr/bin/sinfo", "-h", "-o", "%P|%T", "it's"}}
+	assert.Equal(t, `/usr/bin/sinfo -h -o '%P|%T' 'it'\''s'`, run.CommandLine())
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	var b limitedBuffer
+	chunk := strings.Repeat("x", CommandOutputLimit/2+1)
+	for range 3 {
+		n, err := b.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n, "a short write would make exec fail the command")
+	}
+	assert.Equal(t, CommandOutputLimit, b.Len())
+	assert.Equal(t, 3*len(chunk), b.n)
+}
@@ -1,7 +1,9 @@
 package collector
 
 import (
+	"context"
 	"regexp"
+	"slices"
 	"time"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
@@ -105,9 +107,97 @@ type Command struct {
 	// the collector genuinely passes to Execute, rather than a copy of it.
 	// Unexported: only the in-package test needs it, and it keeps the table
 	// consumable by tools/ without exporting a way to shell out.
-	invoke func(log *logger.Logger, binary string)
+	invoke func(ctx context.Context, log *logger.Logger, binary string)
+	// JSON is the --json command read in place of this one when
+	// --slurm.json names it, or nil when the command has none.
+	JSON *JSONForm
 }
 
+// JSONForm is a --json invocation standing in for one or more text commands
+// under --slurm.json, which selects them one by one. Several commands can
+// share one: squeue ignores its filtering options alongside --json, and
+// scontrol show nodes --json holds everything node_detail and gpus_snapshot
+// read from sinfo.
+//
+// The text command stays the reference. It is what runs by default, and what
+// the collector falls back to when the installed Slurm cannot answer in JSON.
+//
+// sinfo has no form of its own. sinfo --json ignores -o and -O and prints
+// node groups, one per partition and node state, with their CPU counts per
+// group: the cluster totals cpus and nodes_global read count a node once, and
+// cannot be rebuilt from groups that repeat it in each of its partitions. The
+// per-partition commands could be summed from them, but there is no capture
+// of sinfo --json to back a form with, and none to derive from the slurmrestd
+// ones: slurmrestd has no sinfo endpoint.
+type JSONForm struct {
+	// Name is the capture step name and the fixture basename, $Name.json.
+	Name string
+	// Binary is the Slurm executable. Its version decides whether the form is
+	// tried at all: --json first appeared in 21.08.
+	Binary string
+	// Args are the exact arguments passed to Execute.
+	Args []string
+	// Fixtures are the captures under test_data/ that back this form.
+	Fixtures []Fixture
+	// invoke calls the real production path, as Command.invoke does.
+	invoke func(ctx context.Context, log *logger.Logger)
+}
+
+var (
+	squeueJSONForm = &JSONForm{
+		Name:   "squeue",
+		Binary: "squeue",
+		Args:   []string{"--json"},
+		Fixtures: []Fixture{
+			{
+				File: "slurm-24.11.7/squeue.json",
+				Why: "Hand-built from slurmrestd-v0.0.41/jobs.json, which holds the same " +
+					"jobs as queue_all_states.txt, with the meta block squeue writes. " +
+					"TestQueueJSONMatchesText compares the two parsers on it.",
+				Slurm: "24.11.7",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger) { _, _ = SqueueJSONData(ctx, log) },
+	}
+	scontrolNodesJSONForm = &JSONForm{
+		Name:   "scontrol_nodes",
+		Binary: "scontrol",
+		Args:   []string{"show", "nodes", "--json"},
+		Fixtures: []Fixture{
+			{
+				File: "slurm-24.11.7/scontrol_nodes.json",
+				Why: "Hand-built from slurmrestd-v0.0.41/nodes.json, the same nodes as " +
+					"node_detail.txt and gpus_snapshot.txt, with the meta block scontrol " +
+					"writes.",
+				Slurm: "24.11.7",
+			},
+			{
+				File: "slurm-21.08.5/scontrol_nodes.json",
+				Why: "Hand-built in the first schema --json shipped with: the state in " +
+					"lower case with its flags in state_flags, bare integers, and " +
+					"\"Slurm\" capitalised in the meta block. Pins the GPU counts the " +
+					"sinfo captures of the same release give.",
+				Slurm: "21.08.5",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger) { _, _ = ScontrolNodesJSONData(ctx, log) },
+	}
+	sdiagJSONForm = &JSONForm{
+		Name:   "sdiag",
+		Binary: "sdiag",
+		Args:   []string{"--json"},
+		Fixtures: []Fixture{
+			{
+				File: "slurm-24.11.7/sdiag.json",
+				Why: "Hand-built from slurmrestd-v0.0.41/diag.json, the same counters and " +
+					"RPC tables as the scheduler.txt capture of that release.",
+				Slurm: "24.11.7",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger) { _, _ = SdiagJSONData(ctx, log) },
+	}
+)
+
 // slurmTimestamp is the layout Slurm accepts for --starttime / --endtime, and
 // the one sacct_efficiency.go formats with.
 var slurmTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}$`)
@@ -169,7 +259,113 @@ var CommandRegistry = []Command{
 					"(ParseUsersMetrics).",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = SqueueJobsData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = SqueueJobsData(ctx, log) },
+	},
+	{
+		Name:   "running_jobs",
+		Binary: "squeue",
+		Args:   []string{"-a", "-r", "-h", "--states=running", "-O", runningJobsColumns},
+		Source: "jobs.go",
+		OptIn:  "--collector.jobs",
+		Doc: "One line per running job, array tasks included, for the per-job series of " +
+			"the jobs collector: its allocation, start time, time limit, node list and " +
+			"the fields --collector.jobs.labels can turn into labels. A query of its own " +
+			"rather than a projection of squeue_jobs, which would otherwise carry these " +
+			"columns for every collector on every scrape.",
+		Notes: []string{
+			"Comment is the last column: a pipe inside it stays in the field. A pipe in " +
+				"the job name still shifts the columns after it.",
+			"Unset string fields, WCKey and Comment for most jobs, print as \"(null)\" " +
+				"and are reported as empty labels.",
+			"--collector.jobs.max-jobs caps the jobs reported; the jobs holding the most " +
+				"GPUs, then CPUs, are kept.",
+		},
+		Fixtures: []Fixture{
+			{
+				File: "running_jobs.txt",
+				Why: "Hand-built in the runningJobsColumns layout: a multi-node GPU job with " +
+					"a pipe in its comment, two tasks of one array, an UNLIMITED time limit, " +
+					"a job with no memory in tres-alloc, and \"(null)\" WCKey and Comment.",
+				Slurm: "25.11",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = RunningJobsData(ctx, log) },
+	},
+	{
+		Name:   "job_wait",
+		Binary: "squeue",
+		Args:   []string{"-a", "-r", "-h", "--states=running", "-O", jobWaitColumns},
+		Source: "job_wait.go",
+		OptIn:  "--collector.job_wait",
+		Doc: "The submit and start time of every running job, array tasks included. The " +
+			"job_wait collector observes the difference once per job ID, the first time " +
+			"the job is seen running, into slurm_job_wait_seconds (issue #118).",
+		Notes: []string{
+			"A job that starts and ends between two scrapes is never seen running: " +
+				"job_wait_started finds it in sacct.",
+			"The first scrape after a start without --collector.job_wait.state-file only " +
+				"records the running jobs: when they started relative to the exporter is unknown.",
+		},
+		Fixtures: []Fixture{
+			{
+				File: "job_wait.txt",
+				Why: "Hand-built in the jobWaitColumns layout, the jobs of running_jobs.txt: " +
+					"waits from none to twenty minutes, and two tasks of one array that share " +
+					"a submit time and are observed separately.",
+				Slurm: "25.11",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = JobWaitData(ctx, log) },
+	},
+	{
+		Name:   "job_wait_started",
+		Binary: "sacct",
+		Args: []string{
+			"-a", "-X", "-P", "-n",
+			"--starttime", "{{starttime}}",
+			"--endtime", "{{endtime}}",
+			"--format", jobWaitFormat,
+			"--state", "RUNNING",
+		},
+		Placeholders: []Placeholder{
+			{
+				Token: "{{starttime}}",
+				Match: slurmTimestamp,
+				Shell: `$(date -d "-1 minute" +%Y-%m-%dT%H:%M:%S)`,
+			},
+			{
+				Token: "{{endtime}}",
+				Match: slurmTimestamp,
+				Shell: `$(date +%Y-%m-%dT%H:%M:%S)`,
+			},
+		},
+		Source: "job_wait.go",
+		OptIn:  "--collector.job_wait",
+		Doc: "The jobs that ran at some point since the previous job_wait collection, in " +
+			"the job_wait layout. Among them is every job that started in the window, " +
+			"including one that ended before the collection could see it running in " +
+			"squeue; the collector keeps those whose start falls in the window.",
+		Notes: []string{
+			"--state RUNNING selects the jobs that were running during the window, not " +
+				"the ones running now; --endtime is mandatory with it, as for sacct_efficiency.",
+			"A failed sacct, SlurmDBD down for example, does not fail the collection: " +
+				"the jobs that ended within that window go unobserved.",
+			"With the REST source, /jobs stands in for it: the jobs slurmctld still " +
+				"holds, those that ended less than MinJobAge ago included.",
+		},
+		Fixtures: []Fixture{
+			{
+				File: "job_wait_started.txt",
+				Why: "Hand-built in the sacct layout of jobWaitFormat: a job running since " +
+					"before the window, one started in it and still running, and two that " +
+					"started and ended between two collections, one of them an array task.",
+				Slurm: "25.11",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) {
+			now := time.Now()
+			_, _ = JobWaitStartedData(ctx, log, now.Add(-time.Minute), now)
+		},
 	},
 	{
 		Name:   "queue_all_states",
@@ -200,7 +396,8 @@ var CommandRegistry = []Command{
 				Slurm: "25.11.2",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = QueueData(log, true) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = QueueData(ctx, log, true) },
+		JSON:   squeueJSONForm,
 	},
 	{
 		Name:   "queue_default_states",
@@ -213,7 +410,8 @@ var CommandRegistry = []Command{
 		NoFixtureReason: "Deliberate: the output is a subset of queue_all_states.txt and the parser is the " +
 			"same one, so a second capture would protect nothing. What the flag changes is " +
 			"the query itself, which the contract test pins.",
-		invoke: func(log *logger.Logger, _ string) { _, _ = QueueData(log, false) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = QueueData(ctx, log, false) },
+		JSON:   squeueJSONForm,
 	},
 	{
 		Name:   "cpus",
@@ -224,7 +422,7 @@ var CommandRegistry = []Command{
 		Fixtures: []Fixture{
 			{File: "cpus.txt", Why: "The single A/I/O/T line the parser splits on slashes."},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = CPUsData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = CPUsData(ctx, log) },
 	},
 	{
 		Name:   "fairshare",
@@ -246,7 +444,7 @@ var CommandRegistry = []Command{
 					"user rows that must not.",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = FairShareData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = FairShareData(ctx, log) },
 	},
 	{
 		Name:   "gpus_snapshot",
@@ -282,7 +480,8 @@ var CommandRegistry = []Command{
 					"which is what the trailing colons exist to prevent (issue #10).",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = GPUsSnapshotData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = GPUsSnapshotData(ctx, log) },
+		JSON:   scontrolNodesJSONForm,
 	},
 	{
 		Name:   "node_detail",
@@ -333,7 +532,8 @@ var CommandRegistry = []Command{
 					"map; the regression net for issue #10.",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = NodeData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = NodeData(ctx, log) },
+		JSON:   scontrolNodesJSONForm,
 	},
 	{
 		Name:   "nodes_global",
@@ -348,7 +548,7 @@ var CommandRegistry = []Command{
 			"d52d93f (#100, v1.8.4) deleted it, and nodes_test.go has worked on inline strings " +
 			"ever since. The most central command of the nodes collector has no captured " +
 			"cluster output at all. Capturing one is the first job of tools/fixture-capture.",
-		invoke: func(log *logger.Logger, _ string) { _, _ = NodesDataGlobal(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = NodesDataGlobal(ctx, log) },
 	},
 	{
 		Name:      "scontrol_nodes",
@@ -367,7 +567,7 @@ var CommandRegistry = []Command{
 					"case that decides whether a reserved node counts as healthy.",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = ReservationNodesData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = ReservationNodesData(ctx, log) },
 	},
 	{
 		Name:   "partitions_cpu",
@@ -382,7 +582,7 @@ var CommandRegistry = []Command{
 				Slurm: "25.11.1-1",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = PartitionsData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = PartitionsData(ctx, log) },
 	},
 	{
 		Name:   "partitions_gpu",
@@ -403,7 +603,7 @@ var CommandRegistry = []Command{
 					"per-partition counterpart of the issue #10 trap.",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = PartitionsGpuData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = PartitionsGpuData(ctx, log) },
 	},
 	{
 		Name:   "drain_reason",
@@ -415,7 +615,7 @@ var CommandRegistry = []Command{
 			"when the capture is taken, so a capture would document one cluster's bad day " +
 			"rather than a format. The tests use inline inputs that pin the timestamp and " +
 			"reason shapes instead.",
-		invoke: func(log *logger.Logger, _ string) { _, _ = DrainReasonData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = DrainReasonData(ctx, log) },
 	},
 	{
 		Name:   "reservations",
@@ -438,8 +638,8 @@ var CommandRegistry = []Command{
 					"reservations, which the absolute-layout parser must not silently accept.",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) {
-			_, _ = NewReservationsCollector(log).reservationsData()
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) {
+			_, _ = NewReservationsCollector(log).reservationsData(ctx)
 		},
 	},
 	{
@@ -451,7 +651,7 @@ var CommandRegistry = []Command{
 		Fixtures: []Fixture{
 			{File: "licenses.txt", Why: "Several licenses with distinct total/used/free splits."},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = LicenseData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = LicenseData(ctx, log) },
 	},
 	{
 		Name:   "scheduler",
@@ -463,14 +663,62 @@ var CommandRegistry = []Command{
 			{
 				File: "scheduler.txt",
 				Why: "The header counters (jobs submitted/started/completed/canceled/failed), " +
-					"the main schedule statistics block and the backfill block. It stops there: " +
-					"the Remote Procedure Call tables that scheduler.go also parses, per " +
-					"operation and per user, are absent from this capture, so the RPC metrics " +
-					"rest on TestSchedulerRPCLineRe_HyphenatedUsername alone: one inline line " +
-					"against one regexp, with no captured report behind them.",
+					"the main schedule statistics block and the backfill block, as an older " +
+					"sdiag printed them: a header date with no epoch, no job states, no exit " +
+					"blocks and untabbed indentation. It stops before the RPC tables, which " +
+					"scheduler_full.txt covers.",
+			},
+			{
+				File: "scheduler_full.txt",
+				Why: "Hand-built in the 24.11 layout for a busy cluster, every block sdiag " +
+					"prints: agent queue and threads, job " +
+					"states, nonzero main and backfill exit counters, backfill means (printed " +
+					"only once a backfill cycle ran), both RPC tables with a hyphenated user, " +
+					"and a non-empty Pending RPC statistics table followed by the Pending RPCs " +
+					"hostlists that the parser must not read as counts.",
+				Slurm: "24.11.7",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) { _, _ = SchedulerData(log) },
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = SchedulerData(ctx, log) },
+		JSON:   sdiagJSONForm,
+	},
+	{
+		Name:      "controller_ping",
+		Binary:    "scontrol",
+		Args:      []string{"ping"},
+		Source:    "controller.go",
+		Consumers: []string{"readiness.go"},
+		Doc: "Whether each configured slurmctld answers, one line per controller in " +
+			"slurm.conf order. Read by the controller collector on the scrape path, and " +
+			"by /readyz when probed, or on --readiness.ping-interval. One RPC per controller, " +
+			"answered without reading any job or node.",
+		Notes: []string{
+			"scontrol exits non-zero when any controller is DOWN, backups included, and " +
+				"still prints the others: the output is read whatever the exit status, and " +
+				"the cluster counts as reachable while one controller is UP.",
+			"The serving controller is not printed. It is the first UP in slurm.conf " +
+				"order, since a backup hands control back once the controllers above it return.",
+		},
+		Fixtures: []Fixture{
+			{
+				File:  "controller_ping.txt",
+				Why:   "A single controller, the line format with no backup configured.",
+				Slurm: "24.11.7",
+			},
+			{
+				File:  "controller_ping_ha.txt",
+				Why:   "A primary and a backup both UP: the primary serves, the backup does not.",
+				Slurm: "24.11.7",
+			},
+			{
+				File: "controller_ping_backup_down.txt",
+				Why: "A backup DOWN beside an UP primary, with the RESTORE SLURMCTLD banner " +
+					"scontrol prints below the lines when run as root: the banner must not " +
+					"parse as a controller, and the cluster must stay reachable.",
+				Slurm: "24.11.7",
+			},
+		},
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) { _, _ = ControllerPingData(ctx, log) },
 	},
 	{
 		Name:       "binary_version",
@@ -491,7 +739,9 @@ var CommandRegistry = []Command{
 		NoFixtureReason: "Deliberate: the parser reads one field of a one-line output, and the value " +
 			"it reads is the Slurm version of whichever host runs the capture. A fixture " +
 			"would pin that host's version, not a format.",
-		invoke: func(log *logger.Logger, binary string) { _, _ = GetBinaryVersion(log, binary) },
+		invoke: func(ctx context.Context, log *logger.Logger, binary string) {
+			_, _ = GetBinaryVersion(ctx, log, binary)
+		},
 	},
 	{
 		Name:   "sacct_efficiency",
@@ -544,12 +794,74 @@ var CommandRegistry = []Command{
 				Slurm: "25.11",
 			},
 		},
-		invoke: func(log *logger.Logger, _ string) {
-			NewSacctEfficiencyCollector(log, time.Hour, time.Hour).refresh()
+		invoke: func(ctx context.Context, log *logger.Logger, _ string) {
+			NewSacctEfficiencyCollector(log, time.Hour, time.Hour).refresh(ctx)
 		},
 	},
 }
 
+// binaries returns the executables the entry runs: Binary, or each of
+// EachBinary.
+func (c *Command) binaries() []string {
+	if len(c.EachBinary) > 0 {
+		return c.EachBinary
+	}
+	return []string{c.Binary}
+}
+
+// matches reports whether running binary with args is this entry, accepting
+// any value in a placeholder position that has the declared shape.
+func (c *Command) matches(binary string, args []string) bool {
+	if !slices.Contains(c.binaries(), binary) || len(args) != len(c.Args) {
+		return false
+	}
+	for i, want := range c.Args {
+		if p := c.placeholder(want); p != nil {
+			if !p.Match.MatchString(args[i]) {
+				return false
+			}
+			continue
+		}
+		if args[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Command) placeholder(token string) *Placeholder {
+	for i := range c.Placeholders {
+		if c.Placeholders[i].Token == token {
+			return &c.Placeholders[i]
+		}
+	}
+	return nil
+}
+
+// JSONForms returns every JSONForm the registry declares, once each, in
+// registry order.
+func JSONForms() []*JSONForm {
+	var forms []*JSONForm
+	for i := range CommandRegistry {
+		if f := CommandRegistry[i].JSON; f != nil && !slices.Contains(forms, f) {
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+// lookupCommand returns the registry entry a collector's Execute call
+// corresponds to, or nil for a command the registry does not declare. It is
+// how a DataSource that does not run the binaries tells the calls apart.
+func lookupCommand(binary string, args []string) *Command {
+	for i := range CommandRegistry {
+		if CommandRegistry[i].matches(binary, args) {
+			return &CommandRegistry[i]
+		}
+	}
+	return nil
+}
+
 // ── Fixture directories ──────────────────────────────────────────────────────
 
 // FixtureDir is one versioned subdirectory of test_data/.
@@ -647,4 +959,14 @@ var FixtureDirs = []FixtureDir{
 		Supported: true,
 		Notes:     "Also carries the per-partition CPU and GPU captures.",
 	},
+	{
+		Path:      "slurmrestd-v0.0.41",
+		Slurm:     "24.11.7",
+		Supported: true,
+		Notes: "Not a capture: the slurmrestd v0.0.41 JSON counterpart of slurm-24.11.7, " +
+			"built by hand from those files so the same cluster can be read through both " +
+			"sources. rest_source_test.go serves it from an httptest stand-in and checks " +
+			"that every parser reads the same thing as from the CLI capture. The " +
+			"reservations and licenses files mirror the top-level fixtures instead.",
+	},
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -47,14 +48,14 @@ func observeCommand(t *testing.T, cmd Command, binary string) (string, []string)
 	)
 	old := Execute
 	t.Cleanup(func() { Execute = old })
-	Execute = func(_ *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, _ *logger.Logger, command string, args []string) ([]byte, error) {
 		calls++
 		gotBin, gotArgs = command, args
 		return nil, nil
 	}
 
 	log, _ := bufferLogger()
-	cmd.invoke(log, binary)
+	cmd.invoke(context.Background(), log, binary)
 
 	require.Equalf(t, 1, calls,
 		"%s reached Execute %d times, expected exactly once — a registry entry maps to "+
@@ -112,6 +113,31 @@ func TestRegistryMatchesCollectors(t *testing.T) {
 	}
 }
 
+// TestJSONFormsMatchCollectors is the same contract for the --json forms, and
+// checks that json_output.go runs each form against the binary whose version
+// it probes.
+func TestJSONFormsMatchCollectors(t *testing.T) {
+	queries := map[string]jsonQuery{}
+	for _, q := range []jsonQuery{squeueJSON, scontrolNodesJSON, sdiagJSON} {
+		queries[q.name] = q
+	}
+	for _, form := range JSONForms() {
+		t.Run(form.Name, func(t *testing.T) {
+			require.NotNilf(t, form.invoke, "%s declares no invoke func, so nothing checks it", form.Name)
+			gotBin, gotArgs := observeCommand(t, Command{
+				Name:   form.Name,
+				invoke: func(ctx context.Context, log *logger.Logger, _ string) { form.invoke(ctx, log) },
+			}, form.Binary)
+			require.Equalf(t, form.Binary, gotBin, "%s ran the wrong binary", form.Name)
+			require.Equalf(t, form.Args, gotArgs, "%s arguments drifted", form.Name)
+
+			q, ok := queries[form.Name]
+			require.Truef(t, ok, "%s has no jsonQuery in json_output.go", form.Name)
+			require.Equal(t, form.Binary, q.binary)
+		})
+	}
+}
+
 // TestRegistryEntriesAreWellFormed pins the invariants the doc and capture
 // generators rely on, so a malformed entry fails here rather than producing a
 // broken readme or an unrunnable capture script.
@@ -162,6 +188,17 @@ func TestRegistryEntriesAreWellFormed(t *testing.T) {
 				require.NotEmptyf(t, f.Why, "%s fixture %s must say what it protects", cmd.Name, f.File)
 			}
 
+			if f := cmd.JSON; f != nil {
+				require.Regexpf(t, `^[a-z0-9_]+$`, f.Name,
+					"%s JSON form name %q must be lowercase words joined by underscores", cmd.Name, f.Name)
+				require.NotEmptyf(t, f.Binary, "%s JSON form must set Binary", cmd.Name)
+				require.Containsf(t, f.Args, "--json", "%s JSON form does not ask for --json", cmd.Name)
+				require.NotEmptyf(t, f.Fixtures, "%s JSON form has no fixture", cmd.Name)
+				for _, fx := range f.Fixtures {
+					require.NotEmptyf(t, fx.Why, "%s fixture %s must say what it protects", f.Name, fx.File)
+				}
+			}
+
 			// A command with no capture behind it is a coverage gap. Requiring
 			// the reason in the table is what stops the gap from reading as
 			// coverage in the generated readme.
@@ -182,25 +219,38 @@ func TestRegistryEntriesAreWellFormed(t *testing.T) {
 // deleted two releases earlier: test_data/sinfo.txt was removed by d52d93f
 // (#100) and the documentation kept pointing at it (issue #195, drift 2).
 func TestRegistryFixturesExist(t *testing.T) {
-	for _, cmd := range CommandRegistry {
-		for _, f := range cmd.Fixtures {
+	for name, files := range declaredFixtures() {
+		for _, f := range files {
 			path := filepath.Join(testDataDir, f.File)
 			_, err := os.Stat(path)
 			require.NoErrorf(t, err,
 				"%s declares fixture %s, which is not on disk — either capture it or drop the entry",
-				cmd.Name, f.File)
+				name, f.File)
 		}
 	}
 }
 
+// declaredFixtures returns the fixtures of every command and JSON form, keyed
+// by name.
+func declaredFixtures() map[string][]Fixture {
+	out := make(map[string][]Fixture)
+	for _, cmd := range CommandRegistry {
+		out[cmd.Name] = cmd.Fixtures
+	}
+	for _, f := range JSONForms() {
+		out[f.Name+" --json"] = f.Fixtures
+	}
+	return out
+}
+
 // TestEveryFixtureIsClaimed is the other direction. A capture nobody documents
 // cannot be traced back to the bug it protects, and six of the twenty fixtures
 // were in that state (issue #195, drift 7). Adding a file under test_data/ now
 // means saying why it is there.
 func TestEveryFixtureIsClaimed(t *testing.T) {
 	claimed := make(map[string]bool)
-	for _, cmd := range CommandRegistry {
-		for _, f := range cmd.Fixtures {
+	for _, files := range declaredFixtures() {
+		for _, f := range files {
 			claimed[filepath.ToSlash(f.File)] = true
 		}
 	}
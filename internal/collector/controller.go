@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// ControllerState is one slurmctld as scontrol ping reports it.
+type ControllerState struct {
+	// Role is primary, backup, or backup1, backup2... when several backups
+	// are configured.
+	Role string `json:"role"`
+	Host string `json:"host"`
+	Up   bool   `json:"up"`
+}
+
+// pingLineRe matches one controller of scontrol ping:
+//
+//	Slurmctld(primary) at ctl1 is UP
+var pingLineRe = regexp.MustCompile(`^Slurmctld\(([^)]+)\) at (\S+) is (UP|DOWN)`)
+
+// ControllerPingData runs scontrol ping: one cheap RPC per configured
+// controller, answered without reading any job or node.
+func ControllerPingData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "scontrol", []string{"ping"})
+}
+
+// parsePing reads the controller lines of scontrol ping, in the order
+// slurm.conf lists the controllers, skipping the banner printed below them
+// when one is down.
+func parsePing(out []byte) []ControllerState {
+	var states []ControllerState
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		m := pingLineRe.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		states = append(states, ControllerState{Role: m[1], Host: m[2], Up: m[3] == "UP"})
+	}
+	return states
+}
+
+// activeController returns the host of the controller serving the cluster,
+// or "" when none is UP. slurmctld hands control back down the list: a
+// backup serves only while every controller above it is down, so the
+// serving one is the first UP in slurm.conf order.
+func activeController(states []ControllerState) string {
+	for _, s := range states {
+		if s.Up {
+			return s.Host
+		}
+	}
+	return ""
+}
+
+// NewControllerCollector creates a collector for the availability of the
+// primary and backup slurmctld.
+func NewControllerCollector(logger *logger.Logger) *ControllerCollector {
+	return &ControllerCollector{
+		up: prometheus.NewDesc("slurm_controller_up",
+			"Whether the slurmctld answers scontrol ping (1=UP, 0=DOWN)", []string{"host", "role"}, nil),
+		active: prometheus.NewDesc("slurm_controller_active",
+			"Whether the slurmctld is the one serving the cluster: the first UP in slurm.conf order", []string{"host"}, nil),
+		failovers: prometheus.NewDesc("slurm_controller_failovers_total",
+			"Changes of the serving slurmctld seen between two scrapes since the exporter started", nil, nil),
+		logger: logger,
+	}
+}
+
+// ControllerCollector reports each configured slurmctld and which one is
+// serving. It keeps the serving host from one scrape to the next to count
+// failovers, so a failover and its failback inside one scrape interval go
+// unseen.
+type ControllerCollector struct {
+	up        *prometheus.Desc
+	active    *prometheus.Desc
+	failovers *prometheus.Desc
+	logger    *logger.Logger
+
+	mu sync.Mutex
+	// lastActive is the serving host at the last scrape that found one, so
+	// a spell with no controller UP between two hosts still counts.
+	lastActive    string
+	failoverCount float64
+}
+
+// inheritState carries the failover count and the serving host of prev over
+// a reload. A failover prev sees after the copy is counted again by cc, from
+// the serving host copied, so none is lost.
+func (cc *ControllerCollector) inheritState(prev prometheus.Collector) {
+	p, ok := prev.(*ControllerCollector)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.lastActive, cc.failoverCount = p.lastActive, p.failoverCount
+}
+
+func (cc *ControllerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.up
+	ch <- cc.active
+	ch <- cc.failovers
+}
+
+func (cc *ControllerCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = cc.tryCollect(context.Background(), ch)
+}
+
+func (cc *ControllerCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// scontrol exits non-zero as soon as one controller is DOWN, and still
+	// reports every one of them: that is the data, not a failed collection.
+	out, err := ControllerPingData(ctx, cc.logger)
+	states := parsePing(out)
+	if len(states) == 0 {
+		if err == nil {
+			err = errors.New("scontrol ping printed no controller")
+		}
+		cc.logger.Error("Failed to get controller metrics", "err", err)
+		return err
+	}
+
+	active := activeController(states)
+	cc.mu.Lock()
+	if active != "" {
+		if cc.lastActive != "" && active != cc.lastActive {
+			cc.failoverCount++
+			cc.logger.Warn("slurmctld failover", "from", cc.lastActive, "to", active)
+		}
+		cc.lastActive = active
+	}
+	failovers := cc.failoverCount
+	cc.mu.Unlock()
+
+	for _, s := range states {
+		upValue, activeValue := 0.0, 0.0
+		if s.Up {
+			upValue = 1
+		}
+		if s.Host == active {
+			activeValue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(cc.up, prometheus.GaugeValue, upValue, s.Host, s.Role)
+		ch <- prometheus.MustNewConstMetric(cc.active, prometheus.GaugeValue, activeValue, s.Host)
+	}
+	ch <- prometheus.MustNewConstMetric(cc.failovers, prometheus.CounterValue, failovers)
+	return nil
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// stubPing makes scontrol ping print the returned pointer's value, failing
+// with exit status 1 when a controller is DOWN, as scontrol does.
+func stubPing(t *testing.T) *string {
+	t.Helper()
+	out := new(string)
+	old := Execute
+	t.Cleanup(func() { Execute = old })
+	Execute = func(context.Context, *logger.Logger, string, []string) ([]byte, error) {
+		if strings.Contains(*out, "is DOWN") {
+			return []byte(*out), errors.New("exit status 1")
+		}
+		return []byte(*out), nil
+	}
+	return out
+}
+
+func TestControllerCollector_Collect(t *testing.T) {
+	out := stubPing(t)
+	*out = string(readPingFixture(t, "controller_ping_backup_down.txt"))
+	c := NewControllerCollector(logger.NewLogger("error"))
+
+	assert.Equal(t, []string{
+		`slurm_controller_up{host="ctl-a",role="primary"} 1`,
+		`slurm_controller_up{host="ctl-b",role="backup"} 0`,
+	}, gatheredSeries(t, c, "slurm_controller_up"), "a DOWN backup is reported, not a failed collection")
+	assert.Equal(t, []string{
+		`slurm_controller_active{host="ctl-a"} 1`,
+		`slurm_controller_active{host="ctl-b"} 0`,
+	}, gatheredSeries(t, c, "slurm_controller_active"))
+}
+
+func TestControllerCollector_Failovers(t *testing.T) {
+	out := stubPing(t)
+	c := NewControllerCollector(logger.NewLogger("error"))
+	// scrape collects once and returns the failover counter.
+	scrape := func(ping string) float64 {
+		t.Helper()
+		*out = ping
+		ch := make(chan prometheus.Metric, 10)
+		require.NoError(t, c.tryCollect(context.Background(), ch))
+		close(ch)
+		var failovers float64
+		for m := range ch {
+			if m.Desc() == c.failovers {
+				var pb dto.Metric
+				require.NoError(t, m.Write(&pb))
+				failovers = pb.GetCounter().GetValue()
+			}
+		}
+		return failovers
+	}
+
+	ha := string(readPingFixture(t, "controller_ping_ha.txt"))
+	assert.Zero(t, scrape(ha), "the first scrape sets the baseline")
+	assert.Equal(t, 1.0, scrape("Slurmctld(primary) at ctl-a is DOWN\nSlurmctld(backup) at ctl-b is UP\n"), "ctl-a to ctl-b")
+	assert.Equal(t, 1.0, scrape("Slurmctld(primary) at ctl-a is DOWN\nSlurmctld(backup) at ctl-b is DOWN\n"),
+		"no controller UP is no failover")
+	assert.Equal(t, 2.0, scrape(ha), "the failback to ctl-a")
+	assert.Equal(t, 2.0, scrape(ha))
+}
+
+func TestControllerCollector_NoOutput(t *testing.T) {
+	out := stubPing(t)
+	*out = "scontrol: error: slurm_load_ctl_conf error: Unable to contact slurm controller"
+	c := NewControllerCollector(logger.NewLogger("error"))
+	err := c.tryCollect(context.Background(), make(chan prometheus.Metric, 10))
+	assert.EqualError(t, err, "scontrol ping printed no controller")
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPingFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testDataDir, name))
+	require.NoError(t, err)
+	return data
+}
+
+func TestParsePing(t *testing.T) {
+	single := parsePing(readPingFixture(t, "controller_ping.txt"))
+	assert.Equal(t, []ControllerState{{Role: "primary", Host: "slurmctld", Up: true}}, single)
+	assert.Equal(t, "slurmctld", activeController(single))
+
+	ha := parsePing(readPingFixture(t, "controller_ping_ha.txt"))
+	assert.Equal(t, []ControllerState{
+		{Role: "primary", Host: "ctl-a", Up: true},
+		{Role: "backup", Host: "ctl-b", Up: true},
+	}, ha)
+	assert.Equal(t, "ctl-a", activeController(ha), "the primary serves while it is UP")
+
+	backupDown := parsePing(readPingFixture(t, "controller_ping_backup_down.txt"))
+	assert.Equal(t, []ControllerState{
+		{Role: "primary", Host: "ctl-a", Up: true},
+		{Role: "backup", Host: "ctl-b", Up: false},
+	}, backupDown, "the banner is skipped")
+
+	assert.Empty(t, parsePing(nil))
+}
+
+func TestActiveController(t *testing.T) {
+	assert.Equal(t, "ctl-c", activeController([]ControllerState{
+		{Role: "primary", Host: "ctl-a"},
+		{Role: "backup1", Host: "ctl-b"},
+		{Role: "backup2", Host: "ctl-c", Up: true},
+	}))
+	assert.Empty(t, activeController([]ControllerState{{Role: "primary", Host: "ctl-a"}}))
+}
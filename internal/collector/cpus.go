@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"strconv"
 	"strings"
 
@@ -16,8 +17,8 @@ type CPUsMetrics struct {
 	total float64
 }
 
-func CPUsGetMetrics(logger *logger.Logger) (*CPUsMetrics, error) {
-	data, err := CPUsData(logger)
+func CPUsGetMetrics(ctx context.Context, logger *logger.Logger) (*CPUsMetrics, error) {
+	data, err := CPUsData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -47,8 +48,8 @@ func ParseCPUsMetrics(input []byte) *CPUsMetrics {
 CPUsData executes the sinfo command to retrieve CPU information.
 Expected sinfo output format: "%C" (allocated/idle/other/total CPUs).
 */
-func CPUsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "-o", "%C"})
+func CPUsData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	return Execute(ctx, logger, "sinfo", []string{"-h", "-o", "%C"})
 }
 
 func NewCPUsCollector(logger *logger.Logger) *CPUsCollector {
@@ -75,10 +76,12 @@ func (cc *CPUsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.other
 	ch <- cc.total
 }
-func (cc *CPUsCollector) Collect(ch chan<- prometheus.Metric) { _ = cc.tryCollect(ch) }
+func (cc *CPUsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = cc.tryCollect(context.Background(), ch)
+}
 
-func (cc *CPUsCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	cm, err := CPUsGetMetrics(cc.logger)
+func (cc *CPUsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	cm, err := CPUsGetMetrics(ctx, cc.logger)
 	if err != nil {
 		cc.logger.Error("Failed to get CPUs metrics", "err", err)
 		return err
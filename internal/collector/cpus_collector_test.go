@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,7 +14,7 @@ import (
 func TestCPUsCollector_Collect(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte("100/200/50/350\n"), nil
 	}
 
@@ -2,12 +2,14 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,13 +18,39 @@ import (
 )
 
 var (
-	commandTimeout time.Duration
+	// commandTimeout is read by every Execute call and rewritten by a
+	// configuration reload while scrapes may be running, hence atomic.
+	commandTimeout atomic.Int64
 	binPath        string
 )
 
-// SetCommandTimeout sets the timeout for external commands.
+// SetCommandTimeout sets the timeout for external commands. Safe to call while
+// collectors are running: the next command started picks the new value up.
 func SetCommandTimeout(t time.Duration) {
-	commandTimeout = t
+	commandTimeout.Store(int64(t))
+}
+
+// CommandTimeout returns the timeout currently applied to external commands.
+func CommandTimeout() time.Duration {
+	return time.Duration(commandTimeout.Load())
+}
+
+type commandTimeoutKey struct{}
+
+// WithCommandTimeout returns a context under which every command Execute runs
+// gets timeout instead of --command.timeout. StatusTracker applies it for a
+// collector configured with --collector.<name>.timeout: sacct needs far more
+// than the 5s that suits sdiag.
+func WithCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// commandTimeoutFor returns the timeout a command run under ctx gets.
+func commandTimeoutFor(ctx context.Context) time.Duration {
+	if t, ok := ctx.Value(commandTimeoutKey{}).(time.Duration); ok && t > 0 {
+		return t
+	}
+	return CommandTimeout()
 }
 
 // SetBinPath sets the directory in which Slurm binaries are looked up.
@@ -45,7 +73,15 @@ var SlurmBinaries = []string{
 // ValidateBinaries checks that every binary in the given list is accessible
 // at the configured binPath. Returns one error per missing or non-executable
 // binary. When binPath is empty the check is skipped (system $PATH is trusted).
+//
+// With a command wrapper the binaries are on the other side of it, where
+// os.Stat cannot look: the wrapper is looked up locally, then each binary is
+// run through it with --version, so a wrapper that cannot reach the head node
+// or the container is reported as such rather than as six missing binaries.
 func ValidateBinaries(log *logger.Logger, binaries []string) []error {
+	if wrapper != nil {
+		return validateWrapped(log, binaries)
+	}
 	if binPath == "" {
 		return nil
 	}
@@ -66,6 +102,41 @@ func ValidateBinaries(log *logger.Logger, binaries []string) []error {
 	return errs
 }
 
+// wrapperValidateTimeout bounds each --version run by validateWrapped. The
+// check runs before the configuration sets --command.timeout, and an ssh
+// connection alone can take a few seconds.
+const wrapperValidateTimeout = 30 * time.Second
+
+// validateWrapped is ValidateBinaries through the command wrapper. The first
+// failure of the wrapper itself ends the check: the next binaries would fail
+// the same way.
+func validateWrapped(log *logger.Logger, binaries []string) []error {
+	if _, err := exec.LookPath(wrapper.argv[0]); err != nil {
+		return []error{fmt.Errorf("command wrapper not found: %w", err)}
+	}
+	var errs []error
+	for _, bin := range binaries {
+		ctx, cancel := context.WithTimeout(context.Background(), wrapperValidateTimeout)
+		out, err := cliSource{}.Run(ctx, bin, []string{"--version"})
+		timedOut := ctx.Err() != nil
+		cancel()
+		var werr *wrapperError
+		switch {
+		case errors.As(err, &werr):
+			return append(errs, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out))))
+		case timedOut:
+			errs = append(errs, fmt.Errorf("%s --version through the command wrapper: timed out after %s", bin, wrapperValidateTimeout))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("binary not usable through the command wrapper: %s: %w: %s",
+				bin, err, strings.TrimSpace(string(out))))
+		default:
+			log.Debug("Binary validated through the command wrapper", "binary", bin,
+				"version", strings.TrimSpace(string(out)))
+		}
+	}
+	return errs
+}
+
 // ── Internal performance metrics ─────────────────────────────────────────────
 
 var (
@@ -80,12 +151,16 @@ var (
 		[]string{"command"},
 	)
 
+	// execErrors tells the failures of the command wrapper, origin="wrapper",
+	// from those of Slurm itself, origin="slurm": an unreachable head node
+	// is not a slurmctld problem. The calls an open circuit breaker refused
+	// to run are origin="circuit_breaker".
 	execErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "slurm_exporter_command_errors_total",
-			Help: "Total number of Slurm CLI command execution errors.",
+			Help: "Total number of Slurm CLI command execution errors, by whether the command wrapper or Slurm failed, or the circuit breaker refused the call.",
 		},
-		[]string{"command"},
+		[]string{"command", "origin"},
 	)
 )
 
@@ -95,6 +170,7 @@ func RegisterExecMetrics(reg prometheus.Registerer) {
 	execMetricsOnce.Do(func() {
 		reg.MustRegister(execDuration)
 		reg.MustRegister(execErrors)
+		reg.MustRegister(circuitStateGauge)
 	})
 }
 
@@ -114,39 +190,79 @@ func slurmCommandEnv() []string {
 	return append(os.Environ(), "SLURM_TIME_FORMAT=standard")
 }
 
-// Execute is a wrapper around exec.CommandContext providing logging, timeout,
-// and performance instrumentation (duration histogram + error counter).
-// When binPath is set, command is resolved as filepath.Join(binPath, command).
-var Execute = func(log *logger.Logger, command string, args []string) ([]byte, error) {
-	bin := command
-	if binPath != "" {
-		bin = filepath.Join(binPath, command)
+// Execute runs one Slurm command through the configured DataSource, providing
+// logging, timeout, and performance instrumentation (duration histogram + error
+// counter). With the default CLI source the command is executed, resolved
+// against binPath when one is set and run through the command wrapper when
+// one is set.
+//
+// The command runs under ctx, bounded by --command.timeout or the override
+// WithCommandTimeout set on it. A scrape that is abandoned cancels ctx, and the
+// command is killed rather than left running for nobody.
+//
+// While the command's circuit breaker is open, Execute returns an error
+// without running it, unless ctx comes from withoutCircuitBreaker.
+//
+// A command that ran and failed has its output returned with the error, for
+// the caller that still reads it: scontrol ping exits non-zero when any
+// controller is down, and prints which ones are up.
+var Execute = func(ctx context.Context, log *logger.Logger, command string, args []string) ([]byte, error) {
+	src := dataSource
+	guarded := ctx.Value(noCircuitBreakerKey{}) == nil
+	var probe uint64
+	if guarded {
+		var err error
+		if probe, err = circuits.allow(command); err != nil {
+			execErrors.WithLabelValues(command, "circuit_breaker").Inc()
+			log.Debug("Command short-circuited", "command", command, "err", err)
+			return nil, err
+		}
 	}
-
-	log.Debug("Executing command", "command", bin, "args", strings.Join(args, " "))
+	log.Debug("Executing command", "command", command, "args", strings.Join(args, " "), "source", src.Name())
 
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	timeout := commandTimeoutFor(ctx)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	l := cmdLog
+	var capture *runCapture
+	if l != nil {
+		capture = &runCapture{}
+		ctx = context.WithValue(ctx, runCaptureKey{}, capture)
+	}
 
-	cmd := exec.CommandContext(ctx, bin, args...) //nolint:gosec // G204: command is always a controlled Slurm binary, never user input
-	cmd.Env = slurmCommandEnv()
-	out, err := cmd.CombinedOutput()
+	out, err := src.Run(ctx, command, args)
+	if guarded {
+		circuits.record(log, command, probe, ctx.Err(), out, err)
+	}
 
 	elapsed := time.Since(start).Seconds()
 	execDuration.WithLabelValues(command).Observe(elapsed)
+	if l != nil {
+		l.record(newCommandRun(src, command, args, start, time.Since(start), out, err, capture))
+	}
 
 	if err != nil {
-		execErrors.WithLabelValues(command).Inc()
-		if ctx.Err() == context.DeadlineExceeded {
-			log.Error("Command timed out", "command", bin, "timeout", commandTimeout, "elapsed", elapsed)
+		var werr *wrapperError
+		if errors.As(err, &werr) {
+			execErrors.WithLabelValues(command, "wrapper").Inc()
+			log.Error("Command wrapper failed", "command", command, "args", strings.Join(args, " "), "output", string(out), "err", err)
+			return nil, err
+		}
+		execErrors.WithLabelValues(command, "slurm").Inc()
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			log.Error("Command timed out", "command", command, "timeout", timeout, "elapsed", elapsed)
+			return nil, ctx.Err()
+		case context.Canceled:
+			log.Warn("Command cancelled: the scrape was abandoned", "command", command, "elapsed", elapsed)
 			return nil, ctx.Err()
 		}
-		log.Error("Failed to execute command", "command", bin, "args", strings.Join(args, " "), "output", string(out), "err", err)
-		return nil, err
+		log.Error("Failed to execute command", "command", command, "args", strings.Join(args, " "), "output", string(out), "err", err)
+		return out, err
 	}
 
-	log.Debug("Command executed successfully", "command", bin, "elapsed_ms", elapsed*1000)
+	log.Debug("Command executed successfully", "command", command, "elapsed_ms", elapsed*1000)
 	return out, nil
 }
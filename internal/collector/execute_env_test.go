@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,7 +25,7 @@ func echoEnvBinary(t *testing.T, name, variable string) {
 	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$%s\"\n", variable)
 	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755))
 
-	oldBinPath, oldTimeout := binPath, commandTimeout
+	oldBinPath, oldTimeout := binPath, CommandTimeout()
 	SetBinPath(dir)
 	SetCommandTimeout(5 * time.Second)
 	t.Cleanup(func() {
@@ -46,7 +47,7 @@ func TestExecutePinsSlurmTimeFormat(t *testing.T) {
 	t.Setenv("SLURM_TIME_FORMAT", "relative")
 	echoEnvBinary(t, "scontrol", "SLURM_TIME_FORMAT")
 
-	out, err := Execute(logger.NewLogger("error"), "scontrol", []string{"show", "reservation"})
+	out, err := Execute(context.Background(), logger.NewLogger("error"), "scontrol", []string{"show", "reservation"})
 	require.NoError(t, err)
 	assert.Equal(t, "standard", string(out),
 		"the exporter's own environment must not decide how Slurm renders timestamps")
@@ -63,7 +64,7 @@ func TestExecutePinsSlurmTimeFormatWhenUnset(t *testing.T) {
 	require.NoError(t, os.Unsetenv("SLURM_TIME_FORMAT"))
 	echoEnvBinary(t, "sinfo", "SLURM_TIME_FORMAT")
 
-	out, err := Execute(logger.NewLogger("error"), "sinfo", []string{"-h"})
+	out, err := Execute(context.Background(), logger.NewLogger("error"), "sinfo", []string{"-h"})
 	require.NoError(t, err)
 	assert.Equal(t, "standard", string(out))
 }
@@ -76,7 +77,7 @@ func TestExecuteKeepsTheRestOfTheEnvironment(t *testing.T) {
 	t.Setenv("SLURM_CONF", "/etc/slurm/slurm.conf")
 	echoEnvBinary(t, "squeue", "SLURM_CONF")
 
-	out, err := Execute(logger.NewLogger("error"), "squeue", []string{"-h"})
+	out, err := Execute(context.Background(), logger.NewLogger("error"), "squeue", []string{"-h"})
 	require.NoError(t, err)
 	assert.Equal(t, "/etc/slurm/slurm.conf", string(out))
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -29,7 +30,7 @@ func TestExecuteWithBinPath(t *testing.T) {
 	SetCommandTimeout(5 * time.Second)
 
 	log := logger.NewLogger("error")
-	out, err := Execute(log, "sinfo", []string{"-h"})
+	out, err := Execute(context.Background(), log, "sinfo", []string{"-h"})
 	require.NoError(t, err)
 	assert.Equal(t, "fake sinfo output\n", string(out))
 }
@@ -44,7 +45,7 @@ func TestExecuteWithBinPath_MissingBinary(t *testing.T) {
 	SetCommandTimeout(5 * time.Second)
 
 	log := logger.NewLogger("error")
-	_, err := Execute(log, "sinfo", []string{"-h"})
+	_, err := Execute(context.Background(), log, "sinfo", []string{"-h"})
 	assert.Error(t, err, "should fail when binary does not exist in binPath")
 }
 
@@ -136,16 +137,70 @@ func TestExecuteRecordsMetrics(t *testing.T) {
 	// must not panic regardless of which registry was used at registration time.
 	assert.NotPanics(t, func() {
 		execDuration.WithLabelValues("squeue").Observe(0.042)
-		execErrors.WithLabelValues("scontrol").Inc()
+		execErrors.WithLabelValues("scontrol", "slurm").Inc()
 	})
 
 	// Verify the real Execute function records duration and handles success
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte("ok"), nil
 	}
-	out, err := Execute(log, "squeue", []string{"-h"})
+	out, err := Execute(context.Background(), log, "squeue", []string{"-h"})
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("ok"), out)
 }
+
+// blockingSource answers nothing until its context ends, and records the
+// deadline it was given.
+type blockingSource struct {
+	deadline time.Time
+}
+
+func (*blockingSource) Name() string { return "blocking" }
+
+func (b *blockingSource) Run(ctx context.Context, _ string, _ []string) ([]byte, error) {
+	b.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func withDataSource(t *testing.T, s DataSource) {
+	t.Helper()
+	old := dataSource
+	t.Cleanup(func() { SetDataSource(old) })
+	SetDataSource(s)
+}
+
+// TestExecute_ParentCancelled checks that a command stops as soon as the scrape
+// that asked for it is abandoned, rather than running out --command.timeout.
+func TestExecute_ParentCancelled(t *testing.T) {
+	withDataSource(t, &blockingSource{})
+	oldTimeout := CommandTimeout()
+	t.Cleanup(func() { SetCommandTimeout(oldTimeout) })
+	SetCommandTimeout(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := Execute(ctx, logger.NewLogger("error"), "squeue", nil)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecute_CommandTimeoutOverride(t *testing.T) {
+	src := &blockingSource{}
+	withDataSource(t, src)
+	oldTimeout := CommandTimeout()
+	t.Cleanup(func() { SetCommandTimeout(oldTimeout) })
+	SetCommandTimeout(time.Minute)
+
+	start := time.Now()
+	ctx := WithCommandTimeout(context.Background(), 50*time.Millisecond)
+	_, err := Execute(ctx, logger.NewLogger("error"), "sacct", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), src.deadline, time.Second)
+
+	// Zero is "not set", as --collector.<name>.timeout=0 is.
+	assert.Equal(t, time.Minute, commandTimeoutFor(WithCommandTimeout(context.Background(), 0)))
+}
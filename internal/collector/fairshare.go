@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"strconv"
 	"strings"
 
@@ -12,8 +13,8 @@ import (
 // FairShareData executes the sshare command to retrieve fairshare information.
 // Output format: Account|User|RawShares|NormShares|RawUsage|NormUsage|FairShare
 // RawUsage is expressed in CPU-seconds (raw scheduler usage units).
-func FairShareData(log *logger.Logger) ([]byte, error) {
-	return Execute(log, "sshare", []string{"-a", "-P", "-n", "-o", "Account,User,RawShares,NormShares,RawUsage,NormUsage,FairShare"})
+func FairShareData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "sshare", []string{"-a", "-P", "-n", "-o", "Account,User,RawShares,NormShares,RawUsage,NormUsage,FairShare"})
 }
 
 // FairShareMetrics holds parsed fairshare data for a single account or user line.
@@ -73,8 +74,8 @@ func ParseFairShareMetrics(input []byte) []FairShareMetrics {
 }
 
 // FairShareGetMetrics fetches and parses fairshare metrics.
-func FairShareGetMetrics(log *logger.Logger) ([]FairShareMetrics, error) {
-	data, err := FairShareData(log)
+func FairShareGetMetrics(ctx context.Context, log *logger.Logger) ([]FairShareMetrics, error) {
+	data, err := FairShareData(ctx, log)
 	if err != nil {
 		return nil, err
 	}
@@ -100,12 +101,18 @@ type FairShareCollector struct {
 	userNormUsage  *prometheus.Desc
 
 	userMetrics bool
-	logger      *logger.Logger
+	// topN limits the users of each user-level family. 0 keeps them all.
+	topN   int
+	logger *logger.Logger
 }
 
 // NewFairShareCollector creates a new FairShareCollector.
 // Set userMetrics=false to disable per-user metrics on clusters with many users.
-func NewFairShareCollector(log *logger.Logger, userMetrics bool) *FairShareCollector {
+// topN, when positive, keeps the topN users of each user-level family and
+// folds the rest of each account into user="__other__". The fairshare factor
+// cannot be summed: it keeps the users with the largest raw usage, and has no
+// "__other__" series.
+func NewFairShareCollector(log *logger.Logger, userMetrics bool, topN int) *FairShareCollector {
 	accountLabels := []string{"account"}
 	userLabels := []string{"account", "user"}
 
@@ -123,6 +130,7 @@ func NewFairShareCollector(log *logger.Logger, userMetrics bool) *FairShareColle
 		userNormUsage:  prometheus.NewDesc("slurm_user_fairshare_norm_usage", "Normalized usage for user", userLabels, nil),
 
 		userMetrics: userMetrics,
+		topN:        topN,
 		logger:      log,
 	}
 }
@@ -142,10 +150,12 @@ func (fsc *FairShareCollector) Describe(ch chan<- *prometheus.Desc) {
 	}
 }
 
-func (fsc *FairShareCollector) Collect(ch chan<- prometheus.Metric) { _ = fsc.tryCollect(ch) }
+func (fsc *FairShareCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = fsc.tryCollect(context.Background(), ch)
+}
 
-func (fsc *FairShareCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	metrics, err := FairShareGetMetrics(fsc.logger)
+func (fsc *FairShareCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	metrics, err := FairShareGetMetrics(ctx, fsc.logger)
 	if err != nil {
 		fsc.logger.Error("Failed to get fairshare metrics", "err", err)
 		return err
@@ -153,6 +163,10 @@ func (fsc *FairShareCollector) tryCollect(ch chan<- prometheus.Metric) error {
 
 	seenAccounts := make(map[string]bool)
 	seenUsers := make(map[string]bool)
+	// User-level values, user then account, so the top-N limit can rank users
+	// before anything is emitted.
+	fairShare, rawShares, normShares := make(NVal), make(NVal), make(NVal)
+	rawUsage, normUsage := make(NVal), make(NVal)
 
 	for _, m := range metrics {
 		if m.User == "" {
@@ -173,13 +187,26 @@ func (fsc *FairShareCollector) tryCollect(ch chan<- prometheus.Metric) error {
 				continue
 			}
 			seenUsers[key] = true
-			ch <- prometheus.MustNewConstMetric(fsc.userFairShare, prometheus.GaugeValue, m.FairShare, m.Account, m.User)
-			ch <- prometheus.MustNewConstMetric(fsc.userRawShares, prometheus.GaugeValue, m.RawShares, m.Account, m.User)
-			ch <- prometheus.MustNewConstMetric(fsc.userNormShares, prometheus.GaugeValue, m.NormShares, m.Account, m.User)
-			ch <- prometheus.MustNewConstMetric(fsc.userRawUsage, prometheus.GaugeValue, m.RawUsage, m.Account, m.User)
-			ch <- prometheus.MustNewConstMetric(fsc.userNormUsage, prometheus.GaugeValue, m.NormUsage, m.Account, m.User)
+			fairShare.Incr(m.User, m.Account, m.FairShare)
+			rawShares.Incr(m.User, m.Account, m.RawShares)
+			normShares.Incr(m.User, m.Account, m.NormShares)
+			rawUsage.Incr(m.User, m.Account, m.RawUsage)
+			normUsage.Incr(m.User, m.Account, m.NormUsage)
+		}
+	}
+
+	emit := func(desc *prometheus.Desc, values NVal) {
+		for user, accounts := range values {
+			for account, v := range accounts {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, account, user)
+			}
 		}
 	}
+	emit(fsc.userFairShare, keepNVal(fairShare, topNKeys(nvalTotals(rawUsage, nil), fsc.topN)))
+	emit(fsc.userRawShares, limitNVal(rawShares, fsc.topN))
+	emit(fsc.userNormShares, limitNVal(normShares, fsc.topN))
+	emit(fsc.userRawUsage, limitNVal(rawUsage, fsc.topN))
+	emit(fsc.userNormUsage, limitNVal(normUsage, fsc.topN))
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -119,13 +120,13 @@ func TestFairShareGetMetrics_ViaExecuteMock(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		assert.Equal(t, "sshare", command)
 		return data, nil
 	}
 
 	log := logger.NewLogger("error")
-	metrics, err := FairShareGetMetrics(log)
+	metrics, err := FairShareGetMetrics(context.Background(), log)
 	require.NoError(t, err)
 	assert.Len(t, metrics, 8)
 }
@@ -135,13 +136,13 @@ func TestFairShareGetMetrics_ViaExecuteMock(t *testing.T) {
 func TestFairShareCollector_AccountMetrics(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`hpc_team||100|0.4|200000|0.3|0.57
 ml_group||50|0.2|100000|0.15|0.65`), nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewFairShareCollector(log, false) // user metrics disabled
+	c := NewFairShareCollector(log, false, 0) // user metrics disabled
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -167,13 +168,13 @@ ml_group||50|0.2|100000|0.15|0.65`), nil
 func TestFairShareCollector_UserMetricsEnabled(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`hpc_team||100|0.4|200000|0.3|0.57
 hpc_team|alice|50|0.2|80000|0.12|0.72`), nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewFairShareCollector(log, true) // user metrics enabled
+	c := NewFairShareCollector(log, true, 0) // user metrics enabled
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -194,14 +195,14 @@ hpc_team|alice|50|0.2|80000|0.12|0.72`), nil
 func TestFairShareCollector_DeduplicateAccounts(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		// Same account appearing twice (hierarchical sshare output)
 		return []byte(`science||1|0.5|100000|0.2|0.6
 science||1|0.5|100000|0.2|0.6`), nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewFairShareCollector(log, false)
+	c := NewFairShareCollector(log, false, 0)
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -213,14 +214,14 @@ science||1|0.5|100000|0.2|0.6`), nil
 func TestFairShareCollector_DeduplicateUsers(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`science||1|0.5|100000|0.2|0.6
 science|alice|1|0.1|0|0.0|1.0
 science|alice|1|0.1|0|0.0|1.0`), nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewFairShareCollector(log, true)
+	c := NewFairShareCollector(log, true, 0)
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -232,12 +233,12 @@ science|alice|1|0.1|0|0.0|1.0`), nil
 func TestFairShareCollector_ErrorHandling(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
 	log := logger.NewLogger("error")
-	c := NewFairShareCollector(log, true)
+	c := NewFairShareCollector(log, true, 0)
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -252,7 +253,7 @@ func TestFairShareCollector_Describe(t *testing.T) {
 	log := logger.NewLogger("error")
 
 	// With user metrics
-	c := NewFairShareCollector(log, true)
+	c := NewFairShareCollector(log, true, 0)
 	ch := make(chan *prometheus.Desc, 20)
 	c.Describe(ch)
 	close(ch)
@@ -263,7 +264,7 @@ func TestFairShareCollector_Describe(t *testing.T) {
 	assert.Equal(t, 10, count, "should describe 5 account + 5 user descriptors")
 
 	// Without user metrics
-	c2 := NewFairShareCollector(log, false)
+	c2 := NewFairShareCollector(log, false, 0)
 	ch2 := make(chan *prometheus.Desc, 20)
 	c2.Describe(ch2)
 	close(ch2)
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
 // GPUsMetrics holds GPU utilization statistics from Slurm
@@ -20,8 +22,8 @@ type GPUsMetrics struct {
 }
 
 // GPUsGetMetrics retrieves and parses GPU metrics from Slurm
-func GPUsGetMetrics(logger *logger.Logger) (*GPUsMetrics, error) {
-	return ParseGPUsMetrics(logger)
+func GPUsGetMetrics(ctx context.Context, logger *logger.Logger) (*GPUsMetrics, error) {
+	return ParseGPUsMetrics(ctx, logger)
 }
 
 // ParseAllocatedGPUs parses the output of sinfo command to count allocated GPUs
@@ -305,13 +307,45 @@ func computeGPUsFromSnapshot(data []byte) GPUsMetrics {
 }
 
 // ParseGPUsMetrics collects and parses all GPU metrics from a single sinfo
-// snapshot.
-func ParseGPUsMetrics(logger *logger.Logger) (*GPUsMetrics, error) {
-	data, err := GPUsSnapshotData(logger)
+// snapshot, or from scontrol show nodes --json under
+// --slurm.json=gpus_snapshot.
+func ParseGPUsMetrics(ctx context.Context, logger *logger.Logger) (*GPUsMetrics, error) {
+	return withJSONFallback(ctx, logger, "gpus_snapshot", scontrolNodesJSON, ParseGPUsMetricsJSON,
+		func() (*GPUsMetrics, error) {
+			data, err := GPUsSnapshotData(ctx, logger)
+			if err != nil {
+				return nil, err
+			}
+			gm := computeGPUsFromSnapshot(data)
+			return &gm, nil
+		})
+}
+
+// ParseGPUsMetricsJSON derives the GPU metrics from the output of scontrol
+// show nodes --json, with the rules computeGPUsFromSnapshot applies to the
+// sinfo snapshot: every node's GPUs count toward the total, and only the
+// nodes in an available state toward alloc and idle. Each node is one record,
+// so a node in several partitions is counted once.
+func ParseGPUsMetricsJSON(input []byte) (*GPUsMetrics, error) {
+	r, err := decodeSlurmJSON[slurmrest.NodesResponse](input)
 	if err != nil {
 		return nil, err
 	}
-	gm := computeGPUsFromSnapshot(data)
+	var gm GPUsMetrics
+	for i := range r.Nodes {
+		n := &r.Nodes[i]
+		total := parseGPUCount(n.GRES)
+		gm.total += total
+		if isAvailableGPUState(sinfoStateLong(n.States())) {
+			used := parseGPUCount(n.GRESUsed)
+			gm.alloc += used
+			gm.idle += total - used
+		}
+	}
+	gm.other = gm.total - gm.alloc - gm.idle
+	if gm.total > 0 {
+		gm.utilization = gm.alloc / gm.total
+	}
 	return &gm, nil
 }
 
@@ -320,9 +354,9 @@ func ParseGPUsMetrics(logger *logger.Logger) (*GPUsMetrics, error) {
 // one consistent snapshot (issue #145). The trailing ":" on each field forces
 // variable column widths; fixed widths silently truncate rich GRES specs on
 // busy GPU nodes (multi-type GPUs, MIG slices) — see issue #10.
-func GPUsSnapshotData(logger *logger.Logger) ([]byte, error) {
+func GPUsSnapshotData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
 	args := []string{"-a", "-h", "--Format=Nodes: ,StateLong: ,Gres: ,GresUsed:"}
-	return Execute(logger, "sinfo", args)
+	return Execute(ctx, logger, "sinfo", args)
 }
 
 // NewGPUsCollector creates a new GPU metrics collector
@@ -357,10 +391,12 @@ func (cc *GPUsCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect fetches the GPU metrics from Slurm and sends them to Prometheus
-func (cc *GPUsCollector) Collect(ch chan<- prometheus.Metric) { _ = cc.tryCollect(ch) }
+func (cc *GPUsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = cc.tryCollect(context.Background(), ch)
+}
 
-func (cc *GPUsCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	metrics, err := GPUsGetMetrics(cc.logger)
+func (cc *GPUsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	metrics, err := GPUsGetMetrics(ctx, cc.logger)
 	if err != nil {
 		cc.logger.Error("Failed to get GPU metrics", "err", err)
 		return err
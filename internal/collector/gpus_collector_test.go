@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -14,7 +15,7 @@ import (
 func TestGPUsCollector_Collect(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return os.ReadFile("../../test_data/gpus_snapshot.txt")
 	}
 
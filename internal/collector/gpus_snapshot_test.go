@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -30,12 +31,12 @@ func TestGPUsSnapshotSingleCall(t *testing.T) {
 	defer func() { Execute = oldExecute }()
 
 	calls := 0
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		calls++
 		return os.ReadFile("../../test_data/gpus_snapshot.txt")
 	}
 
-	m, err := GPUsGetMetrics(logger.NewLogger("debug"))
+	m, err := GPUsGetMetrics(context.Background(), logger.NewLogger("debug"))
 	require.NoError(t, err)
 
 	assert.Equal(t, 1, calls, "gpus collector must issue exactly one sinfo call (issue #145)")
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"sort"
@@ -21,7 +22,7 @@ func stubExecute(t *testing.T, output string) {
 	t.Helper()
 	old := Execute
 	t.Cleanup(func() { Execute = old })
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(output), nil
 	}
 }
@@ -0,0 +1,26 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// stateInheritor is a collector that keeps state from one scrape to the next,
+// state a reload must not drop: a counter accumulated since the exporter
+// started goes back to zero with the instance holding it.
+type stateInheritor interface {
+	// inheritState takes over the state of prev, the instance of the same
+	// collector that the reload replaces. prev keeps serving until the swap
+	// and may still be scraped, so the state is shared rather than copied
+	// wherever a copy could count an event twice.
+	inheritState(prev prometheus.Collector)
+}
+
+// InheritState hands the state of prev to next, its replacement built by a
+// reload. It does nothing when prev is nil, of another type, or when the
+// collector keeps no state.
+func InheritState(next, prev prometheus.Collector) {
+	if prev == nil {
+		return
+	}
+	if c, ok := next.(stateInheritor); ok {
+		c.inheritState(prev)
+	}
+}
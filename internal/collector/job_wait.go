@@ -0,0 +1,304 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// jobWaitColumns is the squeue layout of the job_wait collector, and
+// jobWaitFormat the sacct one: the same fields, in the same order.
+//
+// Field order, referenced by parseJobStarts:
+//
+//	0 JobID  1 Partition  2 Account  3 SubmitTime  4 StartTime
+const (
+	jobWaitColumns = "JobID:|,Partition:|,Account:|,SubmitTime:|,StartTime:"
+	jobWaitFormat  = "JobID,Partition,Account,Submit,Start"
+)
+
+const jobWaitFieldCount = 5
+
+// DefaultJobWaitBuckets are the slurm_job_wait_seconds buckets when none are
+// configured: from a minute to a week, the range a queue wait spans between
+// an idle partition and a saturated one.
+var DefaultJobWaitBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 43200, 86400, 259200, 604800}
+
+// JobStart is one started job as the job_wait collector reads it.
+type JobStart struct {
+	ID        string
+	Partition string
+	Account   string
+	Start     time.Time
+	// Wait is how long the job queued, from submission to start, in seconds.
+	Wait float64
+}
+
+// JobWaitData runs the job_wait collector's squeue: the running jobs, with
+// the two times their wait is the difference of.
+func JobWaitData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "squeue", []string{"-a", "-r", "-h", "--states=running", "-O", jobWaitColumns})
+}
+
+// JobWaitStartedData runs the job_wait collector's sacct: the jobs that ran
+// at some point between since and until, among them every job that started
+// in between, even one that has already ended. -X keeps the allocation line
+// of each job and leaves its steps out.
+func JobWaitStartedData(ctx context.Context, log *logger.Logger, since, until time.Time) ([]byte, error) {
+	// --endtime is required with --state, as for sacct_efficiency.
+	return Execute(ctx, log, "sacct", []string{
+		"-a", "-X", "-P", "-n",
+		"--starttime", since.Format(slurmTimeLayout),
+		"--endtime", until.Format(slurmTimeLayout),
+		"--format", jobWaitFormat,
+		"--state", "RUNNING",
+	})
+}
+
+// parseJobStarts parses the jobWaitColumns layout, or the jobWaitFormat one
+// sacct prints. A job whose submit or start time does not parse is skipped: it
+// has no wait to observe. A start before the submission, which a clock step on
+// the controller can produce, is a wait of zero.
+func parseJobStarts(data []byte) []JobStart {
+	var jobs []JobStart
+	for line := range strings.SplitSeq(string(data), "\n") {
+		f := squeueFields(line, jobWaitFieldCount)
+		if f == nil {
+			continue
+		}
+		submit, start := parseSlurmTime(f[3]), parseSlurmTime(f[4])
+		if submit.IsZero() || start.IsZero() {
+			continue
+		}
+		jobs = append(jobs, JobStart{
+			ID:        f[0],
+			Partition: f[1],
+			Account:   f[2],
+			Start:     start,
+			Wait:      max(start.Sub(submit).Seconds(), 0),
+		})
+	}
+	return jobs
+}
+
+// jobWaitState is what the job_wait collector keeps between two collections,
+// and writes to its state file: the jobs already observed.
+type jobWaitState struct {
+	// Running holds the IDs of the jobs running at the last collection, and
+	// of those it found in sacct only, all of them observed. A job not in it
+	// has started since.
+	Running []string `json:"running"`
+	// SavedAt is when the collection that wrote the state started: the next
+	// one asks sacct for the jobs started since.
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// loadJobWaitState reads the state file at path. A file that does not exist
+// yet is not an error: it returns nil, as for a first start.
+func loadJobWaitState(path string) (*jobWaitState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st jobWaitState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// saveJobWaitState writes the state file through a temporary file renamed
+// over it, so a crash mid-write leaves the previous state rather than half
+// of one.
+func saveJobWaitState(path string, st *jobWaitState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// JobWaitCollector observes how long each job queued, once, when it is first
+// seen started. The first collection only records the running jobs: they
+// started at some unknown point before the exporter did. Each collection
+// after it reads the running jobs from squeue and, from sacct, the jobs that
+// started since the one before, so that a job that starts and ends between
+// two collections is observed too. A reload hands that record to the new
+// collector; a state file carries it across restarts, so the jobs that
+// started while the exporter was down are observed at the next collection
+// and the others are not observed twice.
+//
+// When sacct fails, SlurmDBD down for one, a collection falls back to squeue
+// alone and misses the jobs that ended before it. Under the REST source,
+// /jobs stands in for sacct and holds the ended jobs for MinJobAge only. A
+// requeued job is observed again when it runs again.
+type JobWaitCollector struct {
+	wait      *prometheus.HistogramVec
+	buckets   []float64
+	stateFile string
+	logger    *logger.Logger
+	seen      *jobWaitSeen
+}
+
+// jobWaitSeen is the record of the jobs already observed. It sits behind a
+// pointer so that a reload hands it to the new collector: a copy would let the
+// old one, still scraped until the swap, observe a job the new one then
+// observes again.
+type jobWaitSeen struct {
+	mu sync.Mutex
+	// running is the set of jobs running at the last collection, or observed
+	// by it, nil until one has succeeded or a state file was loaded.
+	running map[string]bool
+	// since is when the last collection started, the start of the window
+	// the next one asks sacct for.
+	since time.Time
+}
+
+// NewJobWaitCollector creates a collector for the queue wait of the jobs that
+// start. buckets are the histogram's upper bounds, DefaultJobWaitBuckets when
+// empty. stateFile, when not empty, is where the jobs already observed are
+// kept between runs of the exporter.
+func NewJobWaitCollector(logger *logger.Logger, buckets []float64, stateFile string) *JobWaitCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultJobWaitBuckets
+	}
+	jc := &JobWaitCollector{
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_job_wait_seconds",
+			Help:    "Time jobs spent queued, from submission to start, observed once per job when it starts",
+			Buckets: buckets,
+		}, []string{"partition", "account"}),
+		buckets:   buckets,
+		stateFile: stateFile,
+		logger:    logger,
+		seen:      &jobWaitSeen{},
+	}
+	if stateFile != "" {
+		st, err := loadJobWaitState(stateFile)
+		switch {
+		case err != nil:
+			logger.Warn("Cannot read the job wait state file, starting without it", "file", stateFile, "err", err)
+		case st != nil:
+			jc.seen.running = make(map[string]bool, len(st.Running))
+			for _, id := range st.Running {
+				jc.seen.running[id] = true
+			}
+			jc.seen.since = st.SavedAt
+		}
+	}
+	return jc
+}
+
+// inheritState takes over the jobs prev has observed and, when the buckets
+// are the same, its histogram: a reload then neither observes a job twice nor
+// restarts slurm_job_wait_seconds. New buckets start a new histogram.
+func (jc *JobWaitCollector) inheritState(prev prometheus.Collector) {
+	p, ok := prev.(*JobWaitCollector)
+	if !ok {
+		return
+	}
+	jc.seen = p.seen
+	if slices.Equal(jc.buckets, p.buckets) {
+		jc.wait = p.wait
+	}
+}
+
+func (jc *JobWaitCollector) Describe(ch chan<- *prometheus.Desc) {
+	jc.wait.Describe(ch)
+}
+
+func (jc *JobWaitCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = jc.tryCollect(context.Background(), ch)
+}
+
+func (jc *JobWaitCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	now := time.Now()
+	data, err := JobWaitData(ctx, jc.logger)
+	if err != nil {
+		jc.logger.Error("Failed to get job wait times", "err", err)
+		return err
+	}
+	jobs := parseJobStarts(data)
+
+	jc.seen.mu.Lock()
+	defer jc.seen.mu.Unlock()
+	if jc.seen.running != nil && !jc.seen.since.IsZero() {
+		jobs = append(jobs, jc.startedSince(ctx, jc.seen.since, now)...)
+	}
+	running := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		if running[j.ID] {
+			continue // in both squeue and sacct
+		}
+		running[j.ID] = true
+		if jc.seen.running != nil && !jc.seen.running[j.ID] {
+			jc.wait.WithLabelValues(j.Partition, j.Account).Observe(j.Wait)
+		}
+	}
+	jc.seen.running, jc.seen.since = running, now
+	if jc.stateFile != "" {
+		st := &jobWaitState{Running: make([]string, 0, len(running)), SavedAt: now}
+		for id := range running {
+			st.Running = append(st.Running, id)
+		}
+		slices.Sort(st.Running)
+		if err := saveJobWaitState(jc.stateFile, st); err != nil {
+			// The observations are made: failing the collection would only
+			// hide them. A restart reads the older state, and observes again
+			// the jobs that started since it was written.
+			jc.logger.Warn("Cannot write the job wait state file", "file", jc.stateFile, "err", err)
+		}
+	}
+	jc.wait.Collect(ch)
+	return nil
+}
+
+// startedSince returns the jobs sacct reports started between since and
+// until. A sacct that fails costs the jobs that ended before this collection
+// saw them, not the collection: squeue still has the running ones. The
+// window moves on regardless, so that a job is never observed from two.
+func (jc *JobWaitCollector) startedSince(ctx context.Context, since, until time.Time) []JobStart {
+	data, err := JobWaitStartedData(ctx, jc.logger, since, until)
+	if err != nil {
+		jc.logger.Warn("Cannot list the jobs started since the last collection, observing only the running ones", "err", err)
+		return nil
+	}
+	// sacct prints seconds: a job started in the second since falls in.
+	since = since.Truncate(time.Second)
+	var jobs []JobStart
+	for _, j := range parseJobStarts(data) {
+		// --state RUNNING also brings the jobs that were running when the
+		// window opened, started before it.
+		if !j.Start.Before(since) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
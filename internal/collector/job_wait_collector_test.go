@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// jobWaitStub answers the job_wait collector's squeue with squeue, and its
+// sacct with sacct or sacctErr, recording the --starttime of each.
+type jobWaitStub struct {
+	squeue, sacct string
+	sacctErr      error
+	starttimes    []string
+}
+
+func stubJobWait(t *testing.T) *jobWaitStub {
+	t.Helper()
+	stub := &jobWaitStub{}
+	old := Execute
+	t.Cleanup(func() { Execute = old })
+	Execute = func(_ context.Context, _ *logger.Logger, command string, args []string) ([]byte, error) {
+		if command != "sacct" {
+			return []byte(stub.squeue), nil
+		}
+		if i := slices.Index(args, "--starttime"); i >= 0 {
+			stub.starttimes = append(stub.starttimes, args[i+1])
+		}
+		return []byte(stub.sacct), stub.sacctErr
+	}
+	return stub
+}
+
+func TestJobWaitCollector_ObservesEachJobOnce(t *testing.T) {
+	stub := stubJobWait(t)
+	fixture := string(readJobWaitFixture(t))
+	lines := strings.SplitAfter(fixture, "\n")
+	c := NewJobWaitCollector(logger.NewLogger("error"), []float64{60, 1800}, "")
+
+	// 4711 and 4720 were running when the exporter started.
+	stub.squeue = lines[0] + lines[3]
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Zero(t, testutil.CollectAndCount(c.wait), "the first collection only records the running jobs")
+
+	stub.squeue = fixture
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.NoError(t, testutil.CollectAndCompare(c.wait, strings.NewReader(`
+# HELP slurm_job_wait_seconds Time jobs spent queued, from submission to start, observed once per job when it starts
+# TYPE slurm_job_wait_seconds histogram
+slurm_job_wait_seconds_bucket{account="bio",partition="cpu",le="60"} 0
+slurm_job_wait_seconds_bucket{account="bio",partition="cpu",le="1800"} 2
+slurm_job_wait_seconds_bucket{account="bio",partition="cpu",le="+Inf"} 2
+slurm_job_wait_seconds_sum{account="bio",partition="cpu"} 2072
+slurm_job_wait_seconds_count{account="bio",partition="cpu"} 2
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="60"} 1
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="1800"} 1
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="+Inf"} 1
+slurm_job_wait_seconds_sum{account="hpc_team",partition="debug"} 0
+slurm_job_wait_seconds_count{account="hpc_team",partition="debug"} 1
+`)), "the three jobs that started are observed once, however many collections see them")
+}
+
+func TestJobWaitCollector_StartedBetweenCollections(t *testing.T) {
+	stub := stubJobWait(t)
+	lines := strings.SplitAfter(string(readJobWaitFixture(t)), "\n")
+	started, err := os.ReadFile(filepath.Join(testDataDir, "job_wait_started.txt"))
+	require.NoError(t, err)
+	c := NewJobWaitCollector(logger.NewLogger("error"), []float64{60, 1800}, "")
+
+	stub.squeue = lines[0]
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Empty(t, stub.starttimes, "the first collection has no window to ask sacct about")
+
+	// 4740 and 4741_1 started and ended since, 4731 started and still runs.
+	c.seen.since = parseSlurmTime("2026-03-17T09:40:00")
+	stub.squeue, stub.sacct = lines[0]+lines[4], string(started)
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Equal(t, []string{"2026-03-17T09:40:00"}, stub.starttimes)
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.NoError(t, testutil.CollectAndCompare(c.wait, strings.NewReader(`
+# HELP slurm_job_wait_seconds Time jobs spent queued, from submission to start, observed once per job when it starts
+# TYPE slurm_job_wait_seconds histogram
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="60"} 1
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="1800"} 1
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="+Inf"} 1
+slurm_job_wait_seconds_sum{account="hpc_team",partition="debug"} 0
+slurm_job_wait_seconds_count{account="hpc_team",partition="debug"} 1
+slurm_job_wait_seconds_bucket{account="ml_group",partition="gpu",le="60"} 0
+slurm_job_wait_seconds_bucket{account="ml_group",partition="gpu",le="1800"} 1
+slurm_job_wait_seconds_bucket{account="ml_group",partition="gpu",le="+Inf"} 1
+slurm_job_wait_seconds_sum{account="ml_group",partition="gpu"} 810
+slurm_job_wait_seconds_count{account="ml_group",partition="gpu"} 1
+slurm_job_wait_seconds_bucket{account="physics",partition="cpu",le="60"} 0
+slurm_job_wait_seconds_bucket{account="physics",partition="cpu",le="1800"} 1
+slurm_job_wait_seconds_bucket{account="physics",partition="cpu",le="+Inf"} 1
+slurm_job_wait_seconds_sum{account="physics",partition="cpu"} 391
+slurm_job_wait_seconds_count{account="physics",partition="cpu"} 1
+`)), "4731 once though in both commands, the jobs sacct alone saw, not 4711 which started before the window")
+}
+
+func TestJobWaitCollector_SacctFails(t *testing.T) {
+	stub := stubJobWait(t)
+	lines := strings.SplitAfter(string(readJobWaitFixture(t)), "\n")
+	log, buf := bufferLogger()
+	c := NewJobWaitCollector(log, nil, "")
+
+	stub.squeue = lines[0]
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	stub.squeue, stub.sacctErr = lines[0]+lines[4], errors.New("sacct: error: Problem talking to the database")
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)),
+		"a sacct that fails does not fail the collection")
+	assert.Equal(t, 1, testutil.CollectAndCount(c.wait), "4731 is observed from squeue")
+	assert.Contains(t, buf.String(), "observing only the running ones")
+}
+
+func TestJobWaitCollector_StateFile(t *testing.T) {
+	stub := stubJobWait(t)
+	lines := strings.SplitAfter(string(readJobWaitFixture(t)), "\n")
+	path := filepath.Join(t.TempDir(), "job_wait.json")
+
+	first := NewJobWaitCollector(logger.NewLogger("error"), nil, path)
+	stub.squeue = lines[0] + lines[1]
+	require.NoError(t, first.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	stub.squeue = lines[0] + lines[1] + lines[3]
+	require.NoError(t, first.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Equal(t, 1, testutil.CollectAndCount(first.wait), "4720 started")
+
+	// A restart: 4711 ended and 4731 started while the exporter was down.
+	restarted := NewJobWaitCollector(logger.NewLogger("error"), []float64{60}, path)
+	stub.squeue = lines[1] + lines[3] + lines[4]
+	require.NoError(t, restarted.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.NoError(t, testutil.CollectAndCompare(restarted.wait, strings.NewReader(`
+# HELP slurm_job_wait_seconds Time jobs spent queued, from submission to start, observed once per job when it starts
+# TYPE slurm_job_wait_seconds histogram
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="60"} 1
+slurm_job_wait_seconds_bucket{account="hpc_team",partition="debug",le="+Inf"} 1
+slurm_job_wait_seconds_sum{account="hpc_team",partition="debug"} 0
+slurm_job_wait_seconds_count{account="hpc_team",partition="debug"} 1
+`)), "only 4731 is new: 4712_3 and 4720 were recorded before the restart")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"running":["4712_3","4720","4731"]`)
+}
+
+func TestJobWaitCollector_UnreadableStateFile(t *testing.T) {
+	stub := stubJobWait(t)
+	path := filepath.Join(t.TempDir(), "job_wait.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	log, buf := bufferLogger()
+
+	c := NewJobWaitCollector(log, nil, path)
+	assert.Contains(t, buf.String(), "Cannot read the job wait state file")
+	stub.squeue = string(readJobWaitFixture(t))
+	require.NoError(t, c.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Zero(t, testutil.CollectAndCount(c.wait), "a state that cannot be read is a first start")
+}
+
+func TestJobWaitCollector_InheritState(t *testing.T) {
+	stub := stubJobWait(t)
+	lines := strings.SplitAfter(string(readJobWaitFixture(t)), "\n")
+	log := logger.NewLogger("error")
+
+	prev := NewJobWaitCollector(log, []float64{60}, "")
+	stub.squeue = lines[0]
+	require.NoError(t, prev.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	stub.squeue = lines[0] + lines[4]
+	require.NoError(t, prev.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+
+	same := NewJobWaitCollector(log, []float64{60}, "")
+	InheritState(same, prev)
+	stub.squeue = lines[0] + lines[3] + lines[4]
+	require.NoError(t, same.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Equal(t, prev.wait, same.wait, "the same buckets keep the histogram")
+	assert.Equal(t, 2, testutil.CollectAndCount(same.wait),
+		"4731, observed before the reload, is not observed again; 4720 is new")
+
+	rebucketed := NewJobWaitCollector(log, []float64{60, 1800}, "")
+	InheritState(rebucketed, same)
+	require.NoError(t, rebucketed.tryCollect(context.Background(), make(chan prometheus.Metric, 100)))
+	assert.Zero(t, testutil.CollectAndCount(rebucketed.wait),
+		"new buckets start a new histogram, still without observing the running jobs again")
+}
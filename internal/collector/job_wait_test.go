@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readJobWaitFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testDataDir, "job_wait.txt"))
+	require.NoError(t, err)
+	return data
+}
+
+func TestParseJobStarts(t *testing.T) {
+	jobs := parseJobStarts(readJobWaitFixture(t))
+	at := parseSlurmTime
+	assert.Equal(t, []JobStart{
+		{ID: "4711", Partition: "gpu", Account: "ml_group", Start: at("2026-03-17T08:02:11"), Wait: 22*60 + 9},
+		{ID: "4712_3", Partition: "cpu", Account: "bio", Start: at("2026-03-17T09:30:00"), Wait: 17*60 + 15},
+		{ID: "4712_4", Partition: "cpu", Account: "bio", Start: at("2026-03-17T09:30:02"), Wait: 17*60 + 17},
+		{ID: "4720", Partition: "cpu", Account: "physics", Start: at("2026-03-16T22:15:40"), Wait: 2},
+		{ID: "4731", Partition: "debug", Account: "hpc_team", Start: at("2026-03-17T09:41:05"), Wait: 0},
+	}, jobs)
+
+	assert.Empty(t, parseJobStarts([]byte("4800|cpu|bio|2026-03-17T09:12:45|N/A\n")), "no start time, no wait")
+	assert.Equal(t, 0.0, parseJobStarts([]byte("4801|cpu|bio|2026-03-17T09:12:45|2026-03-17T09:12:40\n"))[0].Wait,
+		"a start before the submission is no wait")
+}
+
+func TestJobWaitState_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job_wait.json")
+	st, err := loadJobWaitState(path)
+	require.NoError(t, err)
+	assert.Nil(t, st, "a missing file is a first start")
+
+	saved := &jobWaitState{Running: []string{"4711", "4712_3"}, SavedAt: time.Unix(1773734531, 0).UTC()}
+	require.NoError(t, saveJobWaitState(path, saved))
+	st, err = loadJobWaitState(path)
+	require.NoError(t, err)
+	assert.Equal(t, saved, st)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = loadJobWaitState(path)
+	assert.ErrorContains(t, err, "parsing "+path)
+}
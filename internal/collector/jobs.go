@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// runningJobsColumns is the squeue layout of the jobs collector. It is the
+// squeueJobsColumns layout less the state, which --states=running makes
+// constant, plus what a single job needs and the queue aggregates do not.
+// Comment is last: it is free text, and a pipe inside it stays in the last
+// column (see squeueFields). A pipe in a job name still shifts the comment.
+//
+// Field order, referenced by parseRunningJobs:
+//
+//	0 JobID  1 Account  2 UserName  3 Partition  4 NumNodes  5 NumCPUs
+//	6 tres-alloc  7 StartTime  8 TimeLimit  9 NodeList  10 QOS  11 WCKey
+//	12 Name  13 Comment
+const runningJobsColumns = "JobID:|,Account:|,UserName:|,Partition:|,NumNodes:|,NumCPUs:|,tres-alloc:|," +
+	"StartTime:|,TimeLimit:|,NodeList:|,QOS:|,WCKey:|,Name:|,Comment:"
+
+const runningJobsFieldCount = 14
+
+// tresMemRe matches the memory of a TRES string: "mem=15867M", "mem=4G".
+var tresMemRe = regexp.MustCompile(`(?:^|,)mem=([0-9.]+[KMGTP]?)`)
+
+// RunningJob is one running job as the jobs collector reports it. An array
+// task is a job of its own, with the "<array_job_id>_<task>" ID squeue -r
+// prints.
+type RunningJob struct {
+	ID        string
+	User      string
+	Account   string
+	Partition string
+	Nodes     float64
+	CPUs      float64
+	GPUs      float64
+	// MemoryBytes is the allocated memory, 0 when tres-alloc has none.
+	MemoryBytes float64
+	// StartTime is in Unix seconds, 0 when squeue printed none.
+	StartTime float64
+	// TimeLimit is in seconds, 0 for UNLIMITED or a limit squeue could not
+	// print.
+	TimeLimit float64
+	// Fields holds the optional label values, keyed by their name in
+	// config.JobLabels.
+	Fields map[string]string
+}
+
+// RunningJobsData runs the jobs collector's squeue. It is a query of its own
+// rather than a projection of SqueueJobsData: that snapshot lacks the start
+// time, time limit and labels, and widening it would make every scrape of
+// the accounts, users and partitions collectors pay for columns only this
+// opt-in collector reads. --states=running keeps the pending backlog, often
+// the bulk of the queue, out of it.
+func RunningJobsData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "squeue", []string{"-a", "-r", "-h", "--states=running", "-O", runningJobsColumns})
+}
+
+// squeueNull is how squeue prints a string field that was never set, such as
+// the WCKey or Comment of most jobs.
+const squeueNull = "(null)"
+
+// parseRunningJobs parses the runningJobsColumns layout.
+func parseRunningJobs(data []byte) []RunningJob {
+	var jobs []RunningJob
+	for line := range strings.SplitSeq(string(data), "\n") {
+		f := squeueFields(line, runningJobsFieldCount)
+		if f == nil {
+			continue
+		}
+		for i, v := range f {
+			if v == squeueNull {
+				f[i] = ""
+			}
+		}
+		j := RunningJob{
+			ID:        f[0],
+			Account:   f[1],
+			User:      f[2],
+			Partition: f[3],
+			GPUs:      parseGPUsFromTRES(f[6]),
+			TimeLimit: parseSacctDuration(f[8]),
+			Fields: map[string]string{
+				"nodelist": f[9],
+				"qos":      f[10],
+				"wckey":    f[11],
+				"name":     f[12],
+				"comment":  f[13],
+			},
+		}
+		j.Nodes, _ = strconv.ParseFloat(f[4], 64)
+		j.CPUs, _ = strconv.ParseFloat(f[5], 64)
+		if m := tresMemRe.FindStringSubmatch(f[6]); m != nil {
+			if mib, ok := parseSacctMemory(m[1]); ok {
+				j.MemoryBytes = mib * 1024 * 1024
+			}
+		}
+		if t := parseSlurmTime(f[7]); !t.IsZero() {
+			j.StartTime = float64(t.Unix())
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// largestJobs returns the max jobs holding the most GPUs, then the most CPUs,
+// in that order: with a cap in place, the big allocations are the ones worth
+// a series. Ties go to the lowest job ID, so the set is stable across scrapes.
+func largestJobs(jobs []RunningJob, max int) []RunningJob {
+	if len(jobs) <= max {
+		return jobs
+	}
+	jobs = slices.Clone(jobs)
+	slices.SortFunc(jobs, func(a, b RunningJob) int {
+		return cmp.Or(
+			cmp.Compare(b.GPUs, a.GPUs),
+			cmp.Compare(b.CPUs, a.CPUs),
+			compareJobIDs(a.ID, b.ID),
+		)
+	})
+	return jobs[:max]
+}
+
+// compareJobIDs orders job IDs as Slurm numbers them: by job ID, then by
+// array task or heterogeneous component, so that "9999" comes before "10000"
+// and "4712_2" before "4712_10". An ID that does not parse comes after those
+// that do, by its text.
+func compareJobIDs(a, b string) int {
+	jobA, subA, okA := splitJobID(a)
+	jobB, subB, okB := splitJobID(b)
+	switch {
+	case okA && okB:
+		return cmp.Or(cmp.Compare(jobA, jobB), cmp.Compare(subA, subB))
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return cmp.Compare(a, b)
+}
+
+// splitJobID splits "<job>", "<job>_<task>" or "<job>+<component>" into its
+// two numbers, the second -1 when there is none.
+func splitJobID(id string) (job, sub int64, ok bool) {
+	head, tail, found := strings.Cut(id, "_")
+	if !found {
+		head, tail, found = strings.Cut(id, "+")
+	}
+	job, err := strconv.ParseInt(head, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !found {
+		return job, -1, true
+	}
+	if sub, err = strconv.ParseInt(tail, 10, 64); err != nil {
+		return 0, 0, false
+	}
+	return job, sub, true
+}
+
+// JobsCollector reports every running job: an info series carrying its
+// labels, and its resources keyed by job ID alone, to be joined on it.
+type JobsCollector struct {
+	info      *prometheus.Desc
+	cpus      *prometheus.Desc
+	memory    *prometheus.Desc
+	gpus      *prometheus.Desc
+	nodes     *prometheus.Desc
+	startTime *prometheus.Desc
+	timeLimit *prometheus.Desc
+	dropped   *prometheus.Desc
+	// labels are the optional fields slurm_job_info carries, in flag order.
+	labels []string
+	// maxJobs caps the jobs reported per scrape.
+	maxJobs int
+	logger  *logger.Logger
+}
+
+// NewJobsCollector creates a collector for the running jobs. labels are the
+// fields of config.JobLabels to add to slurm_job_info, and maxJobs, which
+// must be positive, the most jobs a scrape reports.
+func NewJobsCollector(logger *logger.Logger, labels []string, maxJobs int) *JobsCollector {
+	jobLabel := []string{"job_id"}
+	infoLabels := append([]string{"job_id", "user", "account", "partition"}, labels...)
+	return &JobsCollector{
+		info: prometheus.NewDesc("slurm_job_info",
+			"Information about a running job, always 1", infoLabels, nil),
+		cpus: prometheus.NewDesc("slurm_job_cpus",
+			"CPUs allocated to a running job", jobLabel, nil),
+		memory: prometheus.NewDesc("slurm_job_memory_bytes",
+			"Memory allocated to a running job, from tres-alloc", jobLabel, nil),
+		gpus: prometheus.NewDesc("slurm_job_gpus",
+			"GPUs allocated to a running job, from tres-alloc", jobLabel, nil),
+		nodes: prometheus.NewDesc("slurm_job_nodes",
+			"Nodes allocated to a running job", jobLabel, nil),
+		startTime: prometheus.NewDesc("slurm_job_start_time_seconds",
+			"When a running job started, in Unix seconds", jobLabel, nil),
+		timeLimit: prometheus.NewDesc("slurm_job_time_limit_seconds",
+			"Time limit of a running job. Absent for UNLIMITED", jobLabel, nil),
+		dropped: prometheus.NewDesc("slurm_jobs_dropped",
+			"Running jobs left out of the per-job metrics by --collector.jobs.max-jobs", nil, nil),
+		labels:  labels,
+		maxJobs: maxJobs,
+		logger:  logger,
+	}
+}
+
+func (jc *JobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.info
+	ch <- jc.cpus
+	ch <- jc.memory
+	ch <- jc.gpus
+	ch <- jc.nodes
+	ch <- jc.startTime
+	ch <- jc.timeLimit
+	ch <- jc.dropped
+}
+
+func (jc *JobsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = jc.tryCollect(context.Background(), ch)
+}
+
+func (jc *JobsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	data, err := RunningJobsData(ctx, jc.logger)
+	if err != nil {
+		jc.logger.Error("Failed to get running jobs", "err", err)
+		return err
+	}
+	all := parseRunningJobs(data)
+	jobs := largestJobs(all, jc.maxJobs)
+
+	values := make([]string, 0, 4+len(jc.labels))
+	for _, j := range jobs {
+		values = append(values[:0], j.ID, j.User, j.Account, j.Partition)
+		for _, l := range jc.labels {
+			values = append(values, j.Fields[l])
+		}
+		ch <- prometheus.MustNewConstMetric(jc.info, prometheus.GaugeValue, 1, values...)
+		ch <- prometheus.MustNewConstMetric(jc.cpus, prometheus.GaugeValue, j.CPUs, j.ID)
+		ch <- prometheus.MustNewConstMetric(jc.memory, prometheus.GaugeValue, j.MemoryBytes, j.ID)
+		ch <- prometheus.MustNewConstMetric(jc.gpus, prometheus.GaugeValue, j.GPUs, j.ID)
+		ch <- prometheus.MustNewConstMetric(jc.nodes, prometheus.GaugeValue, j.Nodes, j.ID)
+		if j.StartTime > 0 {
+			ch <- prometheus.MustNewConstMetric(jc.startTime, prometheus.GaugeValue, j.StartTime, j.ID)
+		}
+		if j.TimeLimit > 0 {
+			ch <- prometheus.MustNewConstMetric(jc.timeLimit, prometheus.GaugeValue, j.TimeLimit, j.ID)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(jc.dropped, prometheus.GaugeValue, float64(len(all)-len(jobs)))
+	return nil
+}
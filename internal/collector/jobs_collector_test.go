@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func TestJobsCollector_Collect(t *testing.T) {
+	stubExecute(t, string(readRunningJobsFixture(t)))
+	c := NewJobsCollector(logger.NewLogger("error"), []string{"name", "wckey"}, 100)
+
+	info := gatheredSeries(t, c, "slurm_job_info")
+	assert.Len(t, info, 5)
+	assert.Contains(t, info,
+		`slurm_job_info{account="ml_group",job_id="4711",name="train-llm",partition="gpu",user="eve",wckey=""} 1`)
+	assert.Contains(t, info,
+		`slurm_job_info{account="bio",job_id="4712_3",name="align",partition="cpu",user="bob",wckey="genomics"} 1`)
+
+	assert.Contains(t, gatheredSeries(t, c, "slurm_job_gpus"), `slurm_job_gpus{job_id="4711"} 8`)
+	assert.Contains(t, gatheredSeries(t, c, "slurm_job_cpus"), `slurm_job_cpus{job_id="4720"} 128`)
+	assert.Contains(t, gatheredSeries(t, c, "slurm_job_nodes"), `slurm_job_nodes{job_id="4720"} 4`)
+	assert.Contains(t, gatheredSeries(t, c, "slurm_job_memory_bytes"), `slurm_job_memory_bytes{job_id="4731"} 0`)
+
+	limits := gatheredSeries(t, c, "slurm_job_time_limit_seconds")
+	assert.Len(t, limits, 4, "no series for the UNLIMITED job")
+	assert.NotContains(t, limits, `slurm_job_time_limit_seconds{job_id="4720"} 0`)
+	assert.Equal(t, []string{"slurm_jobs_dropped{} 0"}, gatheredSeries(t, c, "slurm_jobs_dropped"))
+}
+
+func TestJobsCollector_MaxJobs(t *testing.T) {
+	stubExecute(t, string(readRunningJobsFixture(t)))
+	c := NewJobsCollector(logger.NewLogger("error"), nil, 2)
+
+	assert.Equal(t, []string{
+		`slurm_job_info{account="ml_group",job_id="4711",partition="gpu",user="eve"} 1`,
+		`slurm_job_info{account="physics",job_id="4720",partition="cpu",user="jean-luc"} 1`,
+	}, gatheredSeries(t, c, "slurm_job_info"), "the GPU job, then the largest CPU job")
+	assert.Len(t, gatheredSeries(t, c, "slurm_job_cpus"), 2)
+	assert.Equal(t, []string{"slurm_jobs_dropped{} 3"}, gatheredSeries(t, c, "slurm_jobs_dropped"))
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRunningJobsFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testDataDir, "running_jobs.txt"))
+	require.NoError(t, err)
+	return data
+}
+
+func TestParseRunningJobs(t *testing.T) {
+	jobs := parseRunningJobs(readRunningJobsFixture(t))
+	require.Len(t, jobs, 5)
+
+	assert.Equal(t, RunningJob{
+		ID:          "4711",
+		User:        "eve",
+		Account:     "ml_group",
+		Partition:   "gpu",
+		Nodes:       2,
+		CPUs:        64,
+		GPUs:        8,
+		MemoryBytes: 500 * 1024 * 1024 * 1024,
+		StartTime:   unixLocal(t, "2026-03-17T08:02:11"),
+		TimeLimit:   2 * 86400,
+		Fields: map[string]string{
+			"nodelist": "gpu[01-02]",
+			"qos":      "high",
+			"wckey":    "",
+			"name":     "train-llm",
+			"comment":  "sweep 3 | lr=3e-4",
+		},
+	}, jobs[0], "a pipe in the comment stays in it, and (null) is empty")
+
+	assert.Equal(t, "4712_3", jobs[1].ID, "array tasks keep their squeue ID")
+	assert.Equal(t, 16000.0*1024*1024, jobs[1].MemoryBytes)
+	assert.Equal(t, 4*3600.0, jobs[1].TimeLimit)
+	assert.Equal(t, "genomics", jobs[1].Fields["wckey"])
+
+	assert.Zero(t, jobs[3].TimeLimit, "UNLIMITED has no limit")
+	assert.Zero(t, jobs[4].MemoryBytes, "no mem in tres-alloc")
+	assert.Equal(t, 30*60.0, jobs[4].TimeLimit)
+
+	assert.Empty(t, parseRunningJobs(nil))
+	assert.Empty(t, parseRunningJobs([]byte("4711|ml_group|eve\n")), "a short line is not a job")
+}
+
+func TestLargestJobs(t *testing.T) {
+	jobs := []RunningJob{
+		{ID: "1", CPUs: 4},
+		{ID: "2", CPUs: 64},
+		{ID: "3", CPUs: 8, GPUs: 1},
+		{ID: "4", CPUs: 64},
+	}
+	ids := func(jobs []RunningJob) []string {
+		var out []string
+		for _, j := range jobs {
+			out = append(out, j.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"3", "2", "4"}, ids(largestJobs(jobs, 3)), "GPUs first, then CPUs, then job ID")
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ids(largestJobs(jobs, 4)), "under the cap the order is kept")
+	assert.Equal(t, "1", jobs[0].ID, "the input is not reordered")
+}
+
+func TestCompareJobIDs(t *testing.T) {
+	ids := []string{"10000", "4712_10", "weird", "9999", "4712_2", "4712", "4800+1", "4800+0"}
+	slices.SortFunc(ids, compareJobIDs)
+	assert.Equal(t, []string{"4712", "4712_2", "4712_10", "4800+0", "4800+1", "9999", "10000", "weird"}, ids,
+		"numeric job ID, then array task or component; what does not parse last")
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// jsonMinVersion is the first Slurm release whose squeue, scontrol and sdiag
+// accept --json.
+var jsonMinVersion = [2]int{21, 8}
+
+// jsonQuery is one --json command: the registry's JSONForm, as the code that
+// runs it sees it.
+type jsonQuery struct {
+	// name keys the per-process state below; it is the JSONForm name.
+	name string
+	// binary is the executable whose version decides whether --json can be
+	// asked for at all.
+	binary string
+	fetch  func(context.Context, *logger.Logger) ([]byte, error)
+}
+
+var (
+	squeueJSON        = jsonQuery{name: "squeue", binary: "squeue", fetch: SqueueJSONData}
+	scontrolNodesJSON = jsonQuery{name: "scontrol_nodes", binary: "scontrol", fetch: ScontrolNodesJSONData}
+	sdiagJSON         = jsonQuery{name: "sdiag", binary: "sdiag", fetch: SdiagJSONData}
+)
+
+// JSONAll selects, in SetJSONOutput, every command that has a JSON form.
+const JSONAll = "all"
+
+// jsonMode is what --slurm.json selected, and what has since been learned
+// about the installed Slurm.
+var jsonMode struct {
+	sync.Mutex
+	// commands holds the names of the registry commands read through their
+	// JSON form.
+	commands map[string]bool
+	// supported caches the version check per binary. A probe that failed is
+	// not cached, so a binary that was briefly unreachable is asked again.
+	supported map[string]bool
+	// disabled holds the queries that failed while the text form of the same
+	// command worked, which means this Slurm cannot answer them in JSON: a
+	// build without the JSON data_parser plugin, or a schema this exporter
+	// does not read. They stay on the text parser until the next restart.
+	disabled map[string]bool
+}
+
+// JSONCommands returns the names of the registry commands that have a JSON
+// form, in registry order: what SetJSONOutput accepts besides JSONAll.
+func JSONCommands() []string {
+	var names []string
+	for _, c := range CommandRegistry {
+		if c.JSON != nil {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// SetJSONOutput selects the registry commands read through their JSON form,
+// by name or JSONAll, and forgets what was learned about the installed Slurm.
+// The others keep their text parser; an empty list selects none. A name with
+// no JSON form is an error, and leaves the selection as it was.
+func SetJSONOutput(commands []string) error {
+	known := JSONCommands()
+	selected := make(map[string]bool, len(commands))
+	for _, name := range commands {
+		switch {
+		case name == JSONAll:
+			for _, n := range known {
+				selected[n] = true
+			}
+		case slices.Contains(known, name):
+			selected[name] = true
+		default:
+			return fmt.Errorf("%q has no JSON form: want %s or %s", name, strings.Join(known, ", "), JSONAll)
+		}
+	}
+	jsonMode.Lock()
+	defer jsonMode.Unlock()
+	jsonMode.commands = selected
+	jsonMode.supported = make(map[string]bool)
+	jsonMode.disabled = make(map[string]bool)
+	return nil
+}
+
+// jsonWanted reports whether q should be asked for in JSON this time, on
+// behalf of the registry command named command.
+func jsonWanted(ctx context.Context, log *logger.Logger, command string, q jsonQuery) bool {
+	jsonMode.Lock()
+	selected, disabled := jsonMode.commands[command], jsonMode.disabled[q.name]
+	supported, known := jsonMode.supported[q.binary]
+	jsonMode.Unlock()
+	if !selected || disabled {
+		return false
+	}
+	if known {
+		return supported
+	}
+
+	v, found := GetBinaryVersion(ctx, log, q.binary)
+	if !found {
+		return false
+	}
+	supported = slurmVersionAtLeast(v, jsonMinVersion)
+	if !supported {
+		log.Info("Slurm is too old for --json, using the text parser",
+			"binary", q.binary, "version", v,
+			"minimum", strconv.Itoa(jsonMinVersion[0])+"."+strconv.Itoa(jsonMinVersion[1]))
+	}
+	jsonMode.Lock()
+	jsonMode.supported[q.binary] = supported
+	jsonMode.Unlock()
+	return supported
+}
+
+// disableJSON stops asking for q in JSON.
+func disableJSON(log *logger.Logger, q jsonQuery, err error) {
+	log.Warn("JSON output failed where text output worked; using the text parser from now on",
+		"query", q.name, "err", err)
+	jsonMode.Lock()
+	jsonMode.disabled[q.name] = true
+	jsonMode.Unlock()
+}
+
+// withJSONFallback returns the metrics decoded from q's JSON output when
+// --slurm.json selects command, the registry command q stands in for, and
+// Slurm supports it, and from the text parser otherwise. When the JSON attempt
+// fails the text parser answers instead; if it succeeds, the failure was the
+// JSON form's own, and q is not tried again. When both fail, Slurm itself is
+// the likely problem and JSON stays on.
+func withJSONFallback[T any](ctx context.Context, log *logger.Logger, command string, q jsonQuery, decode func([]byte) (T, error), text func() (T, error)) (T, error) {
+	if !jsonWanted(ctx, log, command, q) {
+		return text()
+	}
+	out, err := q.fetch(ctx, log)
+	if err == nil {
+		v, decodeErr := decode(out)
+		if decodeErr == nil {
+			return v, nil
+		}
+		err = decodeErr
+	}
+	v, textErr := text()
+	if textErr == nil {
+		disableJSON(log, q, err)
+	}
+	return v, textErr
+}
+
+// slurmVersionAtLeast reports whether a release string such as "24.11.7" or
+// "21.08.5-2" is at least major.minor. An unparseable string is not.
+func slurmVersionAtLeast(version string, min [2]int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major > min[0] || (major == min[0] && minor >= min[1])
+}
+
+// decodeSlurmJSON unmarshals a --json document and returns its errors array as
+// an error: a command that printed {"errors": [...]} and exited 0 answered
+// nothing.
+func decodeSlurmJSON[T any, PT interface {
+	*T
+	Err() error
+}](data []byte) (*T, error) {
+	v := new(T)
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	if err := PT(v).Err(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SqueueJSONData runs squeue --json. Every filtering and formatting option is
+// ignored alongside --json, so it always returns every job slurmctld still
+// holds, in every state, and the default view is filtered here.
+func SqueueJSONData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "squeue", []string{"--json"})
+}
+
+// ScontrolNodesJSONData runs scontrol show nodes --json: one record per node,
+// with the partitions it belongs to as a list rather than one line each.
+func ScontrolNodesJSONData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "scontrol", []string{"show", "nodes", "--json"})
+}
+
+// SdiagJSONData runs sdiag --json.
+func SdiagJSONData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "sdiag", []string{"--json"})
+}
@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func readJSONFixture(t *testing.T, dir, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testDataDir, dir, name+".json"))
+	require.NoError(t, err)
+	return data
+}
+
+// TestQueueJSONMatchesText compares the two queue parsers on the same jobs.
+// squeue --json ignores --states, so the default view is filtered in Go and
+// has to come out as the text query would.
+func TestQueueJSONMatchesText(t *testing.T) {
+	data := readJSONFixture(t, cliFixtureDir, "squeue")
+	for _, tt := range []struct {
+		fixture            string
+		withTerminalStates bool
+	}{
+		{"queue_all_states", true},
+		{"queue_default_states", false},
+	} {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := ParseQueueMetricsJSON(data, tt.withTerminalStates)
+			require.NoError(t, err)
+			assert.Equal(t, ParseQueueMetrics(readCLIFixture(t, tt.fixture)), got)
+		})
+	}
+}
+
+// TestNodeJSONMatchesText compares the node parsers. sinfo lists a node's
+// partitions in its own order, so only their set is compared.
+func TestNodeJSONMatchesText(t *testing.T) {
+	got, err := ParseNodeMetricsJSON(readJSONFixture(t, cliFixtureDir, "scontrol_nodes"))
+	require.NoError(t, err)
+	want := ParseNodeMetrics(readCLIFixture(t, "node_detail"))
+	for _, nodes := range []map[string]*NodeMetrics{got, want} {
+		for _, n := range nodes {
+			slices.Sort(n.partitions)
+		}
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestSchedulerJSONMatchesText(t *testing.T) {
+	got, err := ParseSchedulerMetricsJSON(readJSONFixture(t, cliFixtureDir, "sdiag"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, got.rpcStatsCount)
+	assert.NotEmpty(t, got.userRPCStatsCount)
+	assert.Equal(t, ParseSchedulerMetrics(readCLIFixture(t, "scheduler")), got)
+}
+
+// TestGPUsJSON checks the GPU counts on both schemas. Like the REST snapshot,
+// the JSON counts each node once, so the 24.11.7 values are the cluster's
+// rather than the per-partition sum in gpus_snapshot.txt. The 21.08.5 values
+// are the ones its sinfo captures give.
+func TestGPUsJSON(t *testing.T) {
+	v21 := gpuFixtureExpect["21.08.5"]
+	tests := []struct {
+		dir                string
+		total, alloc, idle float64
+	}{
+		{cliFixtureDir, 40, 0, 40},
+		{"slurm-21.08.5", v21.total, v21.alloc, v21.idle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			gm, err := ParseGPUsMetricsJSON(readJSONFixture(t, tt.dir, "scontrol_nodes"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.total, gm.total)
+			assert.Equal(t, tt.alloc, gm.alloc)
+			assert.Equal(t, tt.idle, gm.idle)
+			assert.Equal(t, 0.0, gm.other)
+		})
+	}
+}
+
+func TestDecodeSlurmJSON_Errors(t *testing.T) {
+	_, err := ParseSchedulerMetricsJSON([]byte(`{"errors": [{"error": "Unable to contact slurm controller"}]}`))
+	require.ErrorContains(t, err, "Unable to contact slurm controller")
+
+	_, err = ParseNodeMetricsJSON([]byte(`scontrol: unrecognized option '--json'`))
+	require.Error(t, err)
+}
+
+func TestSlurmVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"21.08.0", true},
+		{"21.08.5-2", true},
+		{"24.11.7", true},
+		{"21.02.7", false},
+		{"20.11.8", false},
+		{"unknown", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		assert.Equalf(t, tt.want, slurmVersionAtLeast(tt.version, jsonMinVersion), "%q", tt.version)
+	}
+}
+
+// fakeSlurm stubs Execute with a version answer and a JSON and text answer for
+// sdiag, and counts the JSON calls.
+type fakeSlurm struct {
+	version    string
+	jsonOut    []byte
+	jsonErr    error
+	textErr    error
+	jsonCalls  int
+	probeCalls int
+}
+
+func (f *fakeSlurm) install(t *testing.T) {
+	t.Helper()
+	old := Execute
+	t.Cleanup(func() {
+		Execute = old
+		_ = SetJSONOutput(nil)
+	})
+	Execute = func(_ context.Context, _ *logger.Logger, _ string, args []string) ([]byte, error) {
+		switch {
+		case slices.Equal(args, []string{"--version"}):
+			f.probeCalls++
+			return []byte("slurm " + f.version + "\n"), nil
+		case slices.Contains(args, "--json"):
+			f.jsonCalls++
+			return f.jsonOut, f.jsonErr
+		default:
+			if f.textErr != nil {
+				return nil, f.textErr
+			}
+			return readCLIFixture(t, "scheduler"), nil
+		}
+	}
+}
+
+func TestJSONFallback(t *testing.T) {
+	sdiag := func(t *testing.T) []byte { return readJSONFixture(t, cliFixtureDir, "sdiag") }
+
+	t.Run("off by default", func(t *testing.T) {
+		f := &fakeSlurm{version: "24.11.7"}
+		f.install(t)
+		require.NoError(t, SetJSONOutput(nil))
+		log, _ := bufferLogger()
+		_, err := SchedulerGetMetrics(context.Background(), log)
+		require.NoError(t, err)
+		assert.Zero(t, f.jsonCalls)
+		assert.Zero(t, f.probeCalls)
+	})
+
+	t.Run("json when supported", func(t *testing.T) {
+		f := &fakeSlurm{version: "24.11.7", jsonOut: sdiag(t)}
+		f.install(t)
+		require.NoError(t, SetJSONOutput([]string{"scheduler"}))
+		log, _ := bufferLogger()
+		for range 2 {
+			sm, err := SchedulerGetMetrics(context.Background(), log)
+			require.NoError(t, err)
+			assert.NotEmpty(t, sm.rpcStatsCount)
+		}
+		assert.Equal(t, 2, f.jsonCalls)
+		assert.Equal(t, 1, f.probeCalls, "the version is probed once per binary")
+	})
+
+	t.Run("text below 21.08", func(t *testing.T) {
+		f := &fakeSlurm{version: "20.11.8", jsonOut: sdiag(t)}
+		f.install(t)
+		require.NoError(t, SetJSONOutput([]string{"scheduler"}))
+		log, _ := bufferLogger()
+		_, err := SchedulerGetMetrics(context.Background(), log)
+		require.NoError(t, err)
+		assert.Zero(t, f.jsonCalls)
+	})
+
+	t.Run("undecodable json disables it", func(t *testing.T) {
+		f := &fakeSlurm{version: "24.11.7", jsonOut: []byte("sdiag: invalid option -- '-json'")}
+		f.install(t)
+		require.NoError(t, SetJSONOutput([]string{"scheduler"}))
+		log, buf := bufferLogger()
+		for range 2 {
+			sm, err := SchedulerGetMetrics(context.Background(), log)
+			require.NoError(t, err)
+			assert.NotZero(t, sm.threads)
+		}
+		assert.Equal(t, 1, f.jsonCalls)
+		assert.Contains(t, buf.String(), "using the text parser from now on")
+	})
+
+	t.Run("both failing keeps json", func(t *testing.T) {
+		down := errors.New("slurm_load_ctl_conf error: Unable to contact slurm controller")
+		f := &fakeSlurm{version: "24.11.7", jsonErr: down, textErr: down}
+		f.install(t)
+		require.NoError(t, SetJSONOutput([]string{"scheduler"}))
+		log, _ := bufferLogger()
+		for range 2 {
+			_, err := SchedulerGetMetrics(context.Background(), log)
+			require.Error(t, err)
+		}
+		assert.Equal(t, 2, f.jsonCalls)
+	})
+}
+
+func TestJSONFallback_PerCommand(t *testing.T) {
+	f := &fakeSlurm{version: "24.11.7", jsonOut: readJSONFixture(t, cliFixtureDir, "sdiag")}
+	f.install(t)
+	log, _ := bufferLogger()
+
+	require.NoError(t, SetJSONOutput([]string{"node_detail"}))
+	_, err := SchedulerGetMetrics(context.Background(), log)
+	require.NoError(t, err)
+	assert.Zero(t, f.jsonCalls, "only the commands named are read in JSON")
+
+	require.NoError(t, SetJSONOutput([]string{JSONAll}))
+	_, err = SchedulerGetMetrics(context.Background(), log)
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.jsonCalls)
+
+	assert.ErrorContains(t, SetJSONOutput([]string{"cpus"}), `"cpus" has no JSON form`)
+	_, err = SchedulerGetMetrics(context.Background(), log)
+	require.NoError(t, err)
+	assert.Equal(t, 2, f.jsonCalls, "a rejected list leaves the selection as it was")
+}
+
+func TestJSONCommands(t *testing.T) {
+	assert.Equal(t, []string{"queue_all_states", "queue_default_states", "gpus_snapshot", "node_detail", "scheduler"}, JSONCommands())
+}
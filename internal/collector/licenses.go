@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -23,8 +24,8 @@ type LicenseMetrics struct {
 }
 
 // LicenseGetMetrics fetches and parses license metrics.
-func LicenseGetMetrics(logger *logger.Logger) (*LicenseMetrics, error) {
-	data, err := LicenseData(logger)
+func LicenseGetMetrics(ctx context.Context, logger *logger.Logger) (*LicenseMetrics, error) {
+	data, err := LicenseData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -56,8 +57,8 @@ func ParseLicenseMetrics(input []byte) *LicenseMetrics {
 }
 
 // LicenseData runs scontrol to retrieve license information.
-func LicenseData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "scontrol", []string{"show", "licenses", "-o"})
+func LicenseData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	return Execute(ctx, logger, "scontrol", []string{"show", "licenses", "-o"})
 }
 
 // NewLicensesCollector creates a collector for software license metrics.
@@ -87,10 +88,12 @@ func (lc *LicenseCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- lc.reserved
 }
 
-func (lc *LicenseCollector) Collect(ch chan<- prometheus.Metric) { _ = lc.tryCollect(ch) }
+func (lc *LicenseCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = lc.tryCollect(context.Background(), ch)
+}
 
-func (lc *LicenseCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	lm, err := LicenseGetMetrics(lc.logger)
+func (lc *LicenseCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	lm, err := LicenseGetMetrics(ctx, lc.logger)
 	if err != nil {
 		lc.logger.Error("Failed to get license metrics", "err", err)
 		return err
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"slices"
 	"strconv"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
 // NodeMetrics stores metrics for each node
@@ -27,12 +29,18 @@ type NodeMetrics struct {
 	gresUsed  map[string]uint64
 }
 
-func NodeGetMetrics(logger *logger.Logger) (map[string]*NodeMetrics, error) {
-	data, err := NodeData(logger)
-	if err != nil {
-		return nil, err
-	}
-	return ParseNodeMetrics(data), nil
+// NodeGetMetrics reads the nodes from scontrol show nodes --json under
+// --slurm.json=node_detail, and from sinfo otherwise or when the JSON form is
+// unavailable.
+func NodeGetMetrics(ctx context.Context, logger *logger.Logger) (map[string]*NodeMetrics, error) {
+	return withJSONFallback(ctx, logger, "node_detail", scontrolNodesJSON, ParseNodeMetricsJSON,
+		func() (map[string]*NodeMetrics, error) {
+			data, err := NodeData(ctx, logger)
+			if err != nil {
+				return nil, err
+			}
+			return ParseNodeMetrics(data), nil
+		})
 }
 
 // ParseNodeMetrics takes the output of sinfo with node data
@@ -92,6 +100,39 @@ func ParseNodeMetrics(input []byte) map[string]*NodeMetrics {
 	return nodes
 }
 
+// ParseNodeMetricsJSON reads the output of scontrol show nodes --json into the
+// same metrics. The state label is rendered as sinfo's StateLong, so a series
+// keeps its identity when --slurm.json is turned on; nothing here needs the
+// "*" marker stripped or "(null)" recognised, since neither exists in JSON.
+func ParseNodeMetricsJSON(input []byte) (map[string]*NodeMetrics, error) {
+	r, err := decodeSlurmJSON[slurmrest.NodesResponse](input)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*NodeMetrics, len(r.Nodes))
+	for i := range r.Nodes {
+		n := &r.Nodes[i]
+		alloc, idle, other, total := nodeCPUs(n)
+		partitions := []string{}
+		for _, p := range n.Partitions {
+			partitions = appendUnique(partitions, p)
+		}
+		nodes[n.Name] = &NodeMetrics{
+			memAlloc:   uint64(max(n.AllocMemory, 0)),
+			memTotal:   uint64(max(n.RealMemory, 0)),
+			cpuAlloc:   uint64(max(alloc, 0)),
+			cpuIdle:    uint64(max(idle, 0)),
+			cpuOther:   uint64(max(other, 0)),
+			cpuTotal:   uint64(max(total, 0)),
+			nodeStatus: sinfoStateLong(n.States()),
+			partitions: partitions,
+			gresTotal:  parseGRESByType(n.GRES),
+			gresUsed:   parseGRESByType(n.GRESUsed),
+		}
+	}
+	return nodes, nil
+}
+
 /*
 NodeData executes the sinfo command to get detailed data for each node.
 Expected sinfo output format: space-separated columns
@@ -102,10 +143,10 @@ without it, long node names (>20 chars, the default NodeList width) collide
 with the next column and produce <6 whitespace-separated tokens — silently
 dropping those nodes. See https://github.com/SckyzO/slurm_exporter/issues/10.
 */
-func NodeData(logger *logger.Logger) ([]byte, error) {
+func NodeData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
 	args := []string{"-h", "-N", "-O",
 		"NodeList: ,AllocMem: ,Memory: ,CPUsState: ,StateLong: ,Partition: ,Gres: ,GresUsed:"}
-	return Execute(logger, "sinfo", args)
+	return Execute(ctx, logger, "sinfo", args)
 }
 
 type NodeCollector struct {
@@ -164,10 +205,12 @@ func (nc *NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	}
 }
 
-func (nc *NodeCollector) Collect(ch chan<- prometheus.Metric) { _ = nc.tryCollect(ch) }
+func (nc *NodeCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = nc.tryCollect(context.Background(), ch)
+}
 
-func (nc *NodeCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	nodes, err := NodeGetMetrics(nc.logger)
+func (nc *NodeCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	nodes, err := NodeGetMetrics(ctx, nc.logger)
 	if err != nil {
 		nc.logger.Error("Failed to get node metrics", "err", err)
 		return err
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -104,8 +105,8 @@ func ParseDrainReasonMetrics(input []byte) []DrainReasonMetrics {
 
 // DrainReasonData executes sinfo to retrieve node drain/down reasons.
 // Uses -N (per-node) to get one line per node.
-func DrainReasonData(log *logger.Logger) ([]byte, error) {
-	return Execute(log, "sinfo", []string{"-h", "-N", "-o", "%N|%E|%H|%T"})
+func DrainReasonData(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "sinfo", []string{"-h", "-N", "-o", "%N|%E|%H|%T"})
 }
 
 // DrainReasonCollector collects slurm_node_drain_reason_info for degraded nodes.
@@ -149,10 +150,12 @@ func (c *DrainReasonCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.since
 }
 
-func (c *DrainReasonCollector) Collect(ch chan<- prometheus.Metric) { _ = c.tryCollect(ch) }
+func (c *DrainReasonCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = c.tryCollect(context.Background(), ch)
+}
 
-func (c *DrainReasonCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	data, err := DrainReasonData(c.logger)
+func (c *DrainReasonCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	data, err := DrainReasonData(ctx, c.logger)
 	if err != nil {
 		c.logger.Error("Failed to get drain reason data", "err", err)
 		return err
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -65,7 +66,7 @@ c2||Unknown|mixed
 func TestDrainReasonCollector_Collect(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`c1|audit-drain|2026-04-01T10:00:00|drained
 c2|hw-fail|2026-04-01T09:00:00|down
 `), nil
@@ -91,7 +92,7 @@ c2|hw-fail|2026-04-01T09:00:00|down
 func TestDrainReasonCollector_EmptyCluster(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte("c1|none|Unknown|idle\n"), nil
 	}
 
@@ -108,7 +109,7 @@ func TestDrainReasonCollector_EmptyCluster(t *testing.T) {
 func TestDrainReasonCollector_ErrorHandling(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
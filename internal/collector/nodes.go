@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"slices"
 	"strconv"
@@ -113,8 +114,8 @@ func normalizeFeatureSet(raw string) string {
 // Format: "%R|%D|%T|%b" (Partition|Nodes|State|Features).
 // This replaces N per-partition calls with one RPC, significantly reducing
 // load on slurmctld on clusters with many partitions.
-func NodesDataGlobal(log *logger.Logger) ([]byte, error) {
-	return Execute(log, "sinfo", []string{"-h", "-o", "%R|%D|%T|%b"})
+func NodesDataGlobal(ctx context.Context, log *logger.Logger) ([]byte, error) {
+	return Execute(ctx, log, "sinfo", []string{"-h", "-o", "%R|%D|%T|%b"})
 }
 
 // ParseNodesMetricsGlobal parses the global sinfo output (with partition
@@ -147,8 +148,8 @@ func ParseNodesMetricsGlobal(input []byte) map[string]*NodesMetrics {
 
 // NodesGetMetricsGlobal fetches and parses node metrics for all partitions
 // in a single sinfo call.
-func NodesGetMetricsGlobal(log *logger.Logger) (map[string]*NodesMetrics, error) {
-	data, err := NodesDataGlobal(log)
+func NodesGetMetricsGlobal(ctx context.Context, log *logger.Logger) (map[string]*NodesMetrics, error) {
+	data, err := NodesDataGlobal(ctx, log)
 	if err != nil {
 		return nil, err
 	}
@@ -161,9 +162,9 @@ Expected scontrol output format: one line per node.
 Uses scontrolNodesCache to avoid redundant fetches when both the nodes and
 reservation_nodes collectors run in the same scrape cycle.
 */
-func SlurmGetTotal(log *logger.Logger) (float64, error) {
+func SlurmGetTotal(ctx context.Context, log *logger.Logger) (float64, error) {
 	out, err := scontrolNodesCache.GetOrFetch(func() ([]byte, error) {
-		return Execute(log, "scontrol", []string{"show", "nodes", "-o"})
+		return Execute(ctx, log, "scontrol", []string{"show", "nodes", "-o"})
 	})
 	updateCacheAge()
 	if err != nil {
@@ -268,11 +269,13 @@ func SendFeatureSetMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, va
 	}
 }
 
-func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) { _ = nc.tryCollect(ch) }
+func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = nc.tryCollect(context.Background(), ch)
+}
 
-func (nc *NodesCollector) tryCollect(ch chan<- prometheus.Metric) error {
+func (nc *NodesCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// Single global sinfo call for all partitions — replaces N per-partition calls.
-	allPartitions, err := NodesGetMetricsGlobal(nc.logger)
+	allPartitions, err := NodesGetMetricsGlobal(ctx, nc.logger)
 	if err != nil {
 		nc.logger.Error("Failed to get global nodes metrics", "err", err)
 		return err
@@ -331,7 +334,7 @@ func (nc *NodesCollector) tryCollect(ch chan<- prometheus.Metric) error {
 			ch <- prometheus.MustNewConstMetric(nc.planned, prometheus.GaugeValue, sumMap(nm.planned), part)
 		}
 	}
-	total, err := SlurmGetTotal(nc.logger)
+	total, err := SlurmGetTotal(ctx, nc.logger)
 	if err != nil {
 		nc.logger.Error("Failed to get total nodes", "err", err)
 		return err
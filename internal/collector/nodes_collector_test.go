@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,7 +16,7 @@ func TestNodesCollector_Collect(t *testing.T) {
 	defer func() { Execute = oldExecute }()
 
 	callCount := 0
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		callCount++
 		switch command {
 		case "sinfo":
@@ -73,19 +74,19 @@ func TestSlurmGetTotal_UsesCache(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
 	calls := 0
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		calls++
 		return []byte("NodeName=c1\nNodeName=c2\nNodeName=c3\n"), nil
 	}
 
 	log := logger.NewLogger("error")
-	total1, err := SlurmGetTotal(log)
+	total1, err := SlurmGetTotal(context.Background(), log)
 	require.NoError(t, err)
 	assert.Equal(t, float64(3), total1)
 	assert.Equal(t, 1, calls)
 
 	// Second call must hit cache
-	total2, err := SlurmGetTotal(log)
+	total2, err := SlurmGetTotal(context.Background(), log)
 	require.NoError(t, err)
 	assert.Equal(t, float64(3), total2)
 	assert.Equal(t, 1, calls, "cache must prevent second Execute call")
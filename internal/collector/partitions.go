@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"strconv"
 	"strings"
 
@@ -13,8 +14,8 @@ import (
 PartitionsData executes the sinfo command to retrieve partition CPU information.
 Expected sinfo output format: "%R,%C" (PartitionName,Alloc/Idle/Other/Total CPUs).
 */
-func PartitionsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "-o", "%R,%C"})
+func PartitionsData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	return Execute(ctx, logger, "sinfo", []string{"-h", "-o", "%R,%C"})
 }
 
 /*
@@ -27,8 +28,8 @@ Gres:50, GresUsed:50) silently truncate long partition names or rich GRES
 specs (e.g. multi-type GPU + MIG slices), producing wrong GPU counts.
 See https://github.com/SckyzO/slurm_exporter/issues/10.
 */
-func PartitionsGpuData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "--Format=Nodes: ,Partition: ,Gres: ,GresUsed:", "--state=idle,allocated"})
+func PartitionsGpuData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	return Execute(ctx, logger, "sinfo", []string{"-h", "--Format=Nodes: ,Partition: ,Gres: ,GresUsed:", "--state=idle,allocated"})
 }
 
 type PartitionMetrics struct {
@@ -134,16 +135,16 @@ func parsePartitionJobs(pendingData, runningData []byte, partitions map[string]*
 }
 
 // ParsePartitionsMetrics collects CPU, GPU, and job metrics for all Slurm partitions.
-func ParsePartitionsMetrics(logger *logger.Logger) (map[string]*PartitionMetrics, error) {
+func ParsePartitionsMetrics(ctx context.Context, logger *logger.Logger) (map[string]*PartitionMetrics, error) {
 	partitions := make(map[string]*PartitionMetrics)
 
-	cpuData, err := PartitionsData(logger)
+	cpuData, err := PartitionsData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
 	parsePartitionCPUs(cpuData, partitions)
 
-	gpuData, err := PartitionsGpuData(logger)
+	gpuData, err := PartitionsGpuData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +154,7 @@ func ParsePartitionsMetrics(logger *logger.Logger) (map[string]*PartitionMetrics
 	// (issue #144): the default state set includes PENDING and RUNNING, and the
 	// -a -r flags match the dedicated per-state queries this replaced, so the
 	// counts are identical while slurmctld is queried once instead of twice.
-	jobsData, err := SqueueJobsData(logger)
+	jobsData, err := SqueueJobsData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -200,10 +201,12 @@ func (pc *PartitionsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.gpuAllocated
 }
 
-func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) { _ = pc.tryCollect(ch) }
+func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = pc.tryCollect(context.Background(), ch)
+}
 
-func (pc *PartitionsCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	pm, err := ParsePartitionsMetrics(pc.logger)
+func (pc *PartitionsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	pm, err := ParsePartitionsMetrics(ctx, pc.logger)
 	if err != nil {
 		pc.logger.Error("Failed to parse partitions metrics", "err", err)
 		return err
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -52,7 +53,7 @@ func TestParsePartitionsMetricsWithRealOutput(t *testing.T) {
 		}
 		ran = true
 		t.Run(slurmVersion, func(t *testing.T) {
-			Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+			Execute = func(_ context.Context, logger *logger.Logger, command string, args []string) ([]byte, error) {
 				path := pickPartitionFixturePath(dir, command, args)
 				if path == "" {
 					return nil, fmt.Errorf("unhandled command: %s %v", command, args)
@@ -66,7 +67,7 @@ func TestParsePartitionsMetricsWithRealOutput(t *testing.T) {
 
 			testLogger := logger.NewLogger("debug")
 			resetSqueueJobsCache() // partitions reads through the shared squeue cache (#144)
-			metrics, err := ParsePartitionsMetrics(testLogger)
+			metrics, err := ParsePartitionsMetrics(context.Background(), testLogger)
 			require.NoError(t, err)
 
 			for part, pm := range metrics {
@@ -123,7 +124,7 @@ func TestParsePartitionsMetricsGPUOnlyPartition(t *testing.T) {
 
 	// CPU data only knows about "cpu_partition"; GPU data mentions "gpu_only_partition"
 	// which is NOT present in the CPU data — this is the exact scenario that caused issue #5.
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		switch command {
 		case "sinfo":
 			if len(args) >= 3 && args[1] == "-o" && args[2] == "%R,%C" {
@@ -143,7 +144,7 @@ func TestParsePartitionsMetricsGPUOnlyPartition(t *testing.T) {
 
 	// Must not panic — this is the regression assertion for issue #5.
 	require.NotPanics(t, func() {
-		metrics, err := ParsePartitionsMetrics(testLogger)
+		metrics, err := ParsePartitionsMetrics(context.Background(), testLogger)
 		require.NoError(t, err)
 
 		// CPU-only partition is present with correct values
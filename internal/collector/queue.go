@@ -1,12 +1,15 @@
 package collector
 
 import (
+	"context"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
 type NNVal map[string]map[string]map[string]float64
@@ -44,12 +47,23 @@ type QueueMetrics struct {
 	coreTotals map[string]float64
 }
 
-func QueueGetMetrics(logger *logger.Logger, withTerminalStates bool) (*QueueMetrics, error) {
-	data, err := QueueData(logger, withTerminalStates)
-	if err != nil {
-		return nil, err
+// QueueGetMetrics reads the queue from squeue --json when --slurm.json selects
+// its command, and from the text output otherwise or when the JSON form is
+// unavailable.
+func QueueGetMetrics(ctx context.Context, logger *logger.Logger, withTerminalStates bool) (*QueueMetrics, error) {
+	command := "queue_default_states"
+	if withTerminalStates {
+		command = "queue_all_states"
 	}
-	return ParseQueueMetrics(data), nil
+	return withJSONFallback(ctx, logger, command, squeueJSON,
+		func(data []byte) (*QueueMetrics, error) { return ParseQueueMetricsJSON(data, withTerminalStates) },
+		func() (*QueueMetrics, error) {
+			data, err := QueueData(ctx, logger, withTerminalStates)
+			if err != nil {
+				return nil, err
+			}
+			return ParseQueueMetrics(data), nil
+		})
 }
 
 func (s *NVal) Incr(user string, part string, count float64) {
@@ -76,12 +90,9 @@ func (s *NNVal) Incr2(reason string, user string, part string, count float64) {
 	child2[part] += count
 }
 
-/*
-ParseQueueMetrics parses the output of the squeue command for queue metrics.
-Expected input format: "%P,%T,%C,%r,%u" (Partition,State,CPUs,Reason,User).
-*/
-func ParseQueueMetrics(input []byte) *QueueMetrics {
-	qm := QueueMetrics{
+// newQueueMetrics returns a QueueMetrics with every map allocated.
+func newQueueMetrics() *QueueMetrics {
+	return &QueueMetrics{
 		pending:      make(NNVal),
 		running:      make(NVal),
 		suspended:    make(NVal),
@@ -107,6 +118,63 @@ func ParseQueueMetrics(input []byte) *QueueMetrics {
 		jobTotals:    make(map[string]float64),
 		coreTotals:   make(map[string]float64),
 	}
+}
+
+// addJob counts one job, whichever parser read it. parts are the partitions
+// it is queued in, already normalised by squeuePartitions.
+func (qm *QueueMetrics) addJob(parts []string, state string, cores float64, reason, user string) {
+	// A job queued in several partitions contends for each, so it is
+	// counted in each — the rule parsePartitionJobs already applies.
+	// The cluster-wide totals stay at one per job.
+	addN := func(jobs, jobCores NVal) {
+		for _, part := range parts {
+			jobs.Incr(user, part, 1)
+			jobCores.Incr(user, part, cores)
+		}
+		qm.jobTotals[state]++
+		qm.coreTotals[state] += cores
+	}
+	addNN := func(jobs, jobCores NNVal) {
+		for _, part := range parts {
+			jobs.Incr2(reason, user, part, 1)
+			jobCores.Incr2(reason, user, part, cores)
+		}
+		qm.jobTotals[state]++
+		qm.coreTotals[state] += cores
+	}
+
+	switch state {
+	case "PENDING":
+		addNN(qm.pending, qm.cPending)
+	case "RUNNING":
+		addN(qm.running, qm.cRunning)
+	case "SUSPENDED":
+		addN(qm.suspended, qm.cSuspended)
+	case "CANCELLED":
+		addN(qm.cancelled, qm.cCancelled)
+	case "COMPLETING":
+		addN(qm.completing, qm.cCompleting)
+	case "COMPLETED":
+		addN(qm.completed, qm.cCompleted)
+	case "CONFIGURING":
+		addN(qm.configuring, qm.cConfiguring)
+	case "FAILED":
+		addN(qm.failed, qm.cFailed)
+	case "TIMEOUT":
+		addN(qm.timeout, qm.cTimeout)
+	case "PREEMPTED":
+		addN(qm.preempted, qm.cPreempted)
+	case "NODE_FAIL":
+		addN(qm.nodeFail, qm.cNodeFail)
+	}
+}
+
+/*
+ParseQueueMetrics parses the output of the squeue command for queue metrics.
+Expected input format: "%P,%T,%C,%r,%u" (Partition,State,CPUs,Reason,User).
+*/
+func ParseQueueMetrics(input []byte) *QueueMetrics {
+	qm := newQueueMetrics()
 	for line := range strings.SplitSeq(string(input), "\n") {
 		if strings.Contains(line, "|") {
 			// SplitN with 5 keeps a reason field that may itself contain pipes
@@ -119,60 +187,39 @@ func ParseQueueMetrics(input []byte) *QueueMetrics {
 			// a "*" marker. squeuePartitions applies both normalisations —
 			// the same ones parsePartitionJobs needs — so the label always
 			// names a partition that exists (issues #20 and #154).
-			parts := squeuePartitions(fields[0])
-			state := fields[1]
 			coresI, _ := strconv.Atoi(fields[2])
-			cores := float64(coresI)
-			reason := fields[3]
-			user := strings.TrimSpace(fields[4])
-
-			// A job queued in several partitions contends for each, so it is
-			// counted in each — the rule parsePartitionJobs already applies.
-			// The cluster-wide totals stay at one per job.
-			addN := func(jobs, jobCores NVal) {
-				for _, part := range parts {
-					jobs.Incr(user, part, 1)
-					jobCores.Incr(user, part, cores)
-				}
-				qm.jobTotals[state]++
-				qm.coreTotals[state] += cores
-			}
-			addNN := func(jobs, jobCores NNVal) {
-				for _, part := range parts {
-					jobs.Incr2(reason, user, part, 1)
-					jobCores.Incr2(reason, user, part, cores)
-				}
-				qm.jobTotals[state]++
-				qm.coreTotals[state] += cores
-			}
+			qm.addJob(squeuePartitions(fields[0]), fields[1], float64(coresI), fields[3],
+				strings.TrimSpace(fields[4]))
+		}
+	}
+	return qm
+}
 
-			switch state {
-			case "PENDING":
-				addNN(qm.pending, qm.cPending)
-			case "RUNNING":
-				addN(qm.running, qm.cRunning)
-			case "SUSPENDED":
-				addN(qm.suspended, qm.cSuspended)
-			case "CANCELLED":
-				addN(qm.cancelled, qm.cCancelled)
-			case "COMPLETING":
-				addN(qm.completing, qm.cCompleting)
-			case "COMPLETED":
-				addN(qm.completed, qm.cCompleted)
-			case "CONFIGURING":
-				addN(qm.configuring, qm.cConfiguring)
-			case "FAILED":
-				addN(qm.failed, qm.cFailed)
-			case "TIMEOUT":
-				addN(qm.timeout, qm.cTimeout)
-			case "PREEMPTED":
-				addN(qm.preempted, qm.cPreempted)
-			case "NODE_FAIL":
-				addN(qm.nodeFail, qm.cNodeFail)
-			}
+// ParseQueueMetricsJSON reads the output of squeue --json into the same
+// metrics. squeue ignores --states alongside --json, so withTerminalStates
+// is applied here: without it only the states squeue shows by default are
+// counted, as ParseQueueMetrics sees them.
+func ParseQueueMetricsJSON(input []byte, withTerminalStates bool) (*QueueMetrics, error) {
+	r, err := decodeSlurmJSON[slurmrest.JobsResponse](input)
+	if err != nil {
+		return nil, err
+	}
+	qm := newQueueMetrics()
+	for i := range r.Jobs {
+		j := &r.Jobs[i]
+		state := jobStateName(j.JobState)
+		if !withTerminalStates && !slices.Contains(squeueDefaultStates, state) {
+			continue
 		}
+		// squeue prints "None" for a job with no reason; the JSON leaves it
+		// empty. The label keeps the text form.
+		reason := j.StateReason
+		if reason == "" {
+			reason = "None"
+		}
+		qm.addJob(squeuePartitions(j.Partition), state, float64(j.CPUs.Value()), reason, j.UserName)
 	}
-	return &qm
+	return qm, nil
 }
 
 /*
@@ -189,12 +236,12 @@ The window is bounded by MinJobAge (slurm.conf, 300s by default): slurmctld
 forgets a terminated job once it is older than that, so a job counts here for as
 long as the controller still remembers it and no longer.
 */
-func QueueData(logger *logger.Logger, withTerminalStates bool) ([]byte, error) {
+func QueueData(ctx context.Context, logger *logger.Logger, withTerminalStates bool) ([]byte, error) {
 	args := []string{"-h", "-o", "%P|%T|%C|%r|%u"}
 	if withTerminalStates {
 		args = append(args, "--states=all")
 	}
-	return Execute(logger, "squeue", args)
+	return Execute(ctx, logger, "squeue", args)
 }
 
 /*
@@ -206,7 +253,9 @@ func QueueData(logger *logger.Logger, withTerminalStates bool) ([]byte, error) {
 // NewQueueCollector creates a queue metrics collector.
 // When withUserLabel is false, the user label is omitted and counts are
 // aggregated per partition only, reducing cardinality on large clusters.
-func NewQueueCollector(logger *logger.Logger, withUserLabel, withTerminalStates bool) *QueueCollector {
+// topN, when positive, keeps the topN users of each metric family and folds
+// the rest into user="__other__".
+func NewQueueCollector(logger *logger.Logger, withUserLabel, withTerminalStates bool, topN int) *QueueCollector {
 	var labelsJob, labelsPending []string
 	if withUserLabel {
 		labelsJob = []string{"user", "partition"}
@@ -218,6 +267,7 @@ func NewQueueCollector(logger *logger.Logger, withUserLabel, withTerminalStates
 	return &QueueCollector{
 		withUserLabel:      withUserLabel,
 		withTerminalStates: withTerminalStates,
+		topN:               topN,
 		pending:            prometheus.NewDesc("slurm_queue_pending", "Pending jobs in queue", labelsPending, nil),
 		running:            prometheus.NewDesc("slurm_queue_running", "Running jobs in the cluster", labelsJob, nil),
 		suspended:          prometheus.NewDesc("slurm_queue_suspended", "Suspended jobs in the cluster", labelsJob, nil),
@@ -285,6 +335,9 @@ type QueueCollector struct {
 	// withTerminalStates asks squeue for every job state rather than only the
 	// pending and running ones it reports by default. See issue #27.
 	withTerminalStates bool
+	// topN limits the users of each family when withUserLabel is set. 0 keeps
+	// them all.
+	topN int
 	// Global totals — no labels, always emitted even when 0
 	jobsPending      *prometheus.Desc
 	jobsRunning      *prometheus.Desc
@@ -340,10 +393,12 @@ func (qc *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- qc.jobsCoresPending
 }
 
-func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) { _ = qc.tryCollect(ch) }
+func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = qc.tryCollect(context.Background(), ch)
+}
 
-func (qc *QueueCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	qm, err := QueueGetMetrics(qc.logger, qc.withTerminalStates)
+func (qc *QueueCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	qm, err := QueueGetMetrics(ctx, qc.logger, qc.withTerminalStates)
 	if err != nil {
 		qc.logger.Error("Failed to get queue metrics", "err", err)
 		// Emit global totals at 0 so they remain present in Prometheus
@@ -354,32 +409,32 @@ func (qc *QueueCollector) tryCollect(ch chan<- prometheus.Metric) error {
 		return err
 	}
 	if qc.withUserLabel {
-		for reason, values := range qm.pending {
+		for reason, values := range limitNNVal(qm.pending, qc.topN) {
 			PushMetric(values, ch, qc.pending, reason)
 		}
-		PushMetric(qm.running, ch, qc.running, "")
-		PushMetric(qm.suspended, ch, qc.suspended, "")
-		PushMetric(qm.cancelled, ch, qc.cancelled, "")
-		PushMetric(qm.completing, ch, qc.completing, "")
-		PushMetric(qm.completed, ch, qc.completed, "")
-		PushMetric(qm.configuring, ch, qc.configuring, "")
-		PushMetric(qm.failed, ch, qc.failed, "")
-		PushMetric(qm.timeout, ch, qc.timeout, "")
-		PushMetric(qm.preempted, ch, qc.preempted, "")
-		PushMetric(qm.nodeFail, ch, qc.nodeFail, "")
-		for reason, value := range qm.cPending {
+		PushMetric(limitNVal(qm.running, qc.topN), ch, qc.running, "")
+		PushMetric(limitNVal(qm.suspended, qc.topN), ch, qc.suspended, "")
+		PushMetric(limitNVal(qm.cancelled, qc.topN), ch, qc.cancelled, "")
+		PushMetric(limitNVal(qm.completing, qc.topN), ch, qc.completing, "")
+		PushMetric(limitNVal(qm.completed, qc.topN), ch, qc.completed, "")
+		PushMetric(limitNVal(qm.configuring, qc.topN), ch, qc.configuring, "")
+		PushMetric(limitNVal(qm.failed, qc.topN), ch, qc.failed, "")
+		PushMetric(limitNVal(qm.timeout, qc.topN), ch, qc.timeout, "")
+		PushMetric(limitNVal(qm.preempted, qc.topN), ch, qc.preempted, "")
+		PushMetric(limitNVal(qm.nodeFail, qc.topN), ch, qc.nodeFail, "")
+		for reason, value := range limitNNVal(qm.cPending, qc.topN) {
 			PushMetric(value, ch, qc.coresPending, reason)
 		}
-		PushMetric(qm.cRunning, ch, qc.coresRunning, "")
-		PushMetric(qm.cSuspended, ch, qc.coresSuspended, "")
-		PushMetric(qm.cCancelled, ch, qc.coresCancelled, "")
-		PushMetric(qm.cCompleting, ch, qc.coresCompleting, "")
-		PushMetric(qm.cCompleted, ch, qc.coresCompleted, "")
-		PushMetric(qm.cConfiguring, ch, qc.coresConfiguring, "")
-		PushMetric(qm.cFailed, ch, qc.coresFailed, "")
-		PushMetric(qm.cTimeout, ch, qc.coresTimeout, "")
-		PushMetric(qm.cPreempted, ch, qc.coresPreempted, "")
-		PushMetric(qm.cNodeFail, ch, qc.coresNodeFail, "")
+		PushMetric(limitNVal(qm.cRunning, qc.topN), ch, qc.coresRunning, "")
+		PushMetric(limitNVal(qm.cSuspended, qc.topN), ch, qc.coresSuspended, "")
+		PushMetric(limitNVal(qm.cCancelled, qc.topN), ch, qc.coresCancelled, "")
+		PushMetric(limitNVal(qm.cCompleting, qc.topN), ch, qc.coresCompleting, "")
+		PushMetric(limitNVal(qm.cCompleted, qc.topN), ch, qc.coresCompleted, "")
+		PushMetric(limitNVal(qm.cConfiguring, qc.topN), ch, qc.coresConfiguring, "")
+		PushMetric(limitNVal(qm.cFailed, qc.topN), ch, qc.coresFailed, "")
+		PushMetric(limitNVal(qm.cTimeout, qc.topN), ch, qc.coresTimeout, "")
+		PushMetric(limitNVal(qm.cPreempted, qc.topN), ch, qc.coresPreempted, "")
+		PushMetric(limitNVal(qm.cNodeFail, qc.topN), ch, qc.coresNodeFail, "")
 	} else {
 		// user label disabled: aggregate all users per partition
 		pushAggregatedNNVal(qm.pending, ch, qc.pending)
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -18,12 +19,12 @@ func TestQueueCollector_Collect(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return data, nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewQueueCollector(log, true, true)
+	c := NewQueueCollector(log, true, true, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 
@@ -42,7 +43,7 @@ func TestQueueCollector_Collect(t *testing.T) {
 
 func TestQueueCollector_Describe(t *testing.T) {
 	log := logger.NewLogger("error")
-	c := NewQueueCollector(log, true, true)
+	c := NewQueueCollector(log, true, true, 0)
 	ch := make(chan *prometheus.Desc, 50)
 	c.Describe(ch)
 	close(ch)
@@ -63,14 +64,14 @@ func TestQueueCollector_EmitsSuspendedMetrics(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return data, nil
 	}
 
 	for _, withUserLabel := range []bool{true, false} {
 		t.Run(fmtBool("withUserLabel", withUserLabel), func(t *testing.T) {
 			log := logger.NewLogger("error")
-			c := NewQueueCollector(log, withUserLabel, true)
+			c := NewQueueCollector(log, withUserLabel, true, 0)
 			reg := prometheus.NewRegistry()
 			require.NoError(t, reg.Register(c))
 
@@ -120,12 +121,12 @@ func TestQueueCollector_ErrorEmitsGlobalTotals(t *testing.T) {
 	// Even on error, global job totals must be emitted (always-present guarantee)
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
 	log := logger.NewLogger("error")
-	c := NewQueueCollector(log, false, true)
+	c := NewQueueCollector(log, false, true, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 
@@ -180,12 +181,12 @@ func TestQueueCollectorSplitsMultiPartitionJobs(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return input, nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewQueueCollector(log, true, true)
+	c := NewQueueCollector(log, true, true, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 
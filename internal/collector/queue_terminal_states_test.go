@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,7 +21,7 @@ func captureExecuteArgs(t *testing.T, output string) *[]string {
 	t.Cleanup(func() { Execute = old })
 
 	var got []string
-	Execute = func(_ *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, _ *logger.Logger, command string, args []string) ([]byte, error) {
 		got = append([]string{command}, args...)
 		return []byte(output), nil
 	}
@@ -38,7 +39,7 @@ func captureExecuteArgs(t *testing.T, output string) *[]string {
 func TestQueueDataAsksSqueueForTerminalStates(t *testing.T) {
 	args := captureExecuteArgs(t, "")
 
-	_, err := QueueData(logger.NewLogger("error"), true)
+	_, err := QueueData(context.Background(), logger.NewLogger("error"), true)
 	require.NoError(t, err)
 	assert.Contains(t, *args, "--states=all",
 		"without it squeue hides the terminal states and every failure metric stays at zero")
@@ -51,7 +52,7 @@ func TestQueueDataAsksSqueueForTerminalStates(t *testing.T) {
 func TestQueueDataOmitsTerminalStatesWhenDisabled(t *testing.T) {
 	args := captureExecuteArgs(t, "")
 
-	_, err := QueueData(logger.NewLogger("error"), false)
+	_, err := QueueData(context.Background(), logger.NewLogger("error"), false)
 	require.NoError(t, err)
 	assert.NotContains(t, *args, "--states=all")
 	assert.Equal(t, []string{"squeue", "-h", "-o", "%P|%T|%C|%r|%u"}, *args,
@@ -73,7 +74,7 @@ func TestQueueCollectorPassesTerminalStatesToSqueue(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			args := captureExecuteArgs(t, "")
 
-			c := NewQueueCollector(logger.NewLogger("error"), true, tc.terminalStates)
+			c := NewQueueCollector(logger.NewLogger("error"), true, tc.terminalStates, 0)
 			ch := make(chan prometheus.Metric, 128)
 			c.Collect(ch)
 			close(ch)
@@ -97,7 +98,7 @@ func TestQueueCollectorPublishesTerminalStates(t *testing.T) {
 		"visualisation|COMPLETED|2|None|alice\n")
 
 	log := logger.NewLogger("error")
-	c := func() prometheus.Collector { return NewQueueCollector(log, true, true) }
+	c := func() prometheus.Collector { return NewQueueCollector(log, true, true, 0) }
 
 	assert.Equal(t, []string{`slurm_queue_failed{partition="exclusive",user="alice"} 1`},
 		gatheredSeries(t, c(), "slurm_queue_failed"))
@@ -135,7 +135,7 @@ func TestPushAggregatedNVal(t *testing.T) {
 	qm := ParseQueueMetrics(data)
 
 	// The collector built without the user label carries partition-only descs.
-	qc := NewQueueCollector(logger.NewLogger("error"), false, true)
+	qc := NewQueueCollector(logger.NewLogger("error"), false, true, 0)
 
 	got := collectPushed(t, func(ch chan<- prometheus.Metric) {
 		pushAggregatedNVal(qm.running, ch, qc.running, "")
@@ -157,7 +157,7 @@ func TestPushAggregatedNNVal(t *testing.T) {
 	require.NoError(t, err)
 	qm := ParseQueueMetrics(data)
 
-	qc := NewQueueCollector(logger.NewLogger("error"), false, true)
+	qc := NewQueueCollector(logger.NewLogger("error"), false, true, 0)
 
 	got := collectPushed(t, func(ch chan<- prometheus.Metric) {
 		pushAggregatedNNVal(qm.pending, ch, qc.pending)
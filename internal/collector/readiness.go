@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// errNoControllerUp is returned by PingController when scontrol ping ran but
+// reported no controller UP.
+var errNoControllerUp = errors.New("scontrol ping reports no slurmctld UP")
+
+// PingController runs scontrol ping and returns every controller it reports.
+// It fails unless at least one of them is UP: a down backup beside a
+// primary that answers is still a reachable cluster, even though scontrol
+// exits non-zero for it.
+//
+// The ping runs outside the scontrol circuit breaker. A failed ping must not
+// open it on the collectors, and an open one must not fail the ping: /readyz
+// reports whether slurmctld answers, not whether the collectors backed off.
+func PingController(ctx context.Context, log *logger.Logger) ([]ControllerState, error) {
+	out, err := ControllerPingData(withoutCircuitBreaker(ctx), log)
+	states := parsePing(out)
+	for _, s := range states {
+		if s.Up {
+			return states, nil
+		}
+	}
+	if err == nil {
+		err = errNoControllerUp
+	}
+	return states, err
+}
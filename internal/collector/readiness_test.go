@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// pingSource answers scontrol ping with out, failing with err.
+type pingSource struct {
+	out string
+	err error
+}
+
+func (pingSource) Name() string { return "ping" }
+
+func (s pingSource) Run(context.Context, string, []string) ([]byte, error) {
+	return []byte(s.out), s.err
+}
+
+func TestPingController(t *testing.T) {
+	oldTimeout := CommandTimeout()
+	t.Cleanup(func() { SetCommandTimeout(oldTimeout) })
+	SetCommandTimeout(5 * time.Second)
+	log := logger.NewLogger("error")
+	exit1 := errors.New("exit status 1")
+
+	backupDown, err := os.ReadFile(filepath.Join(testDataDir, "controller_ping_backup_down.txt"))
+	require.NoError(t, err)
+	withDataSource(t, pingSource{out: string(backupDown), err: exit1})
+	states, err := PingController(context.Background(), log)
+	require.NoError(t, err, "a down backup beside a primary that answers is reachable")
+	assert.Len(t, states, 2)
+
+	withDataSource(t, pingSource{out: "Slurmctld(primary) at ctl1 is DOWN\nSlurmctld(backup) at ctl2 is DOWN\n", err: exit1})
+	states, err = PingController(context.Background(), log)
+	assert.Equal(t, exit1, err)
+	assert.Len(t, states, 2)
+
+	withDataSource(t, pingSource{out: "scontrol: error: slurm_load_ctl_conf"})
+	_, err = PingController(context.Background(), log)
+	assert.ErrorIs(t, err, errNoControllerUp)
+}
+
+func TestPingController_OutsideCircuitBreaker(t *testing.T) {
+	src := &scriptedSource{out: []byte("scontrol: error: Unable to contact slurm controller (connect failure)"), err: errUnreachable}
+	withDataSource(t, src)
+	withCircuitBreaker(t, 2, time.Minute)
+	log := logger.NewLogger("error")
+
+	for range 3 {
+		_, err := PingController(context.Background(), log)
+		require.Error(t, err)
+	}
+	for range 2 {
+		_, err := ControllerPingData(context.Background(), log)
+		require.NotErrorIs(t, err, errCircuitOpen, "failed readiness pings do not open the collectors' circuit")
+	}
+
+	_, err := ControllerPingData(context.Background(), log)
+	require.ErrorIs(t, err, errCircuitOpen, "two collector failures do")
+	_, err = PingController(context.Background(), log)
+	require.NotErrorIs(t, err, errCircuitOpen, "and the readiness ping still runs")
+	assert.Equal(t, 6, src.calls)
+}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Record and replay.
+//
+// A bug report that depends on what a site's Slurm prints is hard to act on
+// without that output, and a demo or a parser change is easier to try against
+// a real cluster's answers than against a live one. NewRecordingSource saves
+// every command the collectors run into a directory; NewReplaySource serves a
+// directory like that back in place of the binaries, so the exporter runs on a
+// laptop with the site's data.
+//
+// Files are named after the CommandRegistry entry the call matches, so a
+// recording reads like test_data/: squeue_jobs.txt, scontrol_nodes.json for
+// the --json form, binary_version-sinfo.txt for a command run once per binary.
+// The match is the one the contract test uses, placeholders included: the
+// sacct_efficiency call made on replay has other --starttime and --endtime
+// values than the recorded one, and still finds it. Beside each output,
+// <file>.meta.json holds the exact arguments, when the command ran, how long
+// it took and the error it returned, if any.
+//
+// Each command keeps its latest recording: the directory is a snapshot of the
+// cluster, not a log.
+
+// recordingMeta is the content of a recording's .meta.json file.
+type recordingMeta struct {
+	Binary   string    `json:"binary"`
+	Args     []string  `json:"args"`
+	Source   string    `json:"source"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// recordingName returns the file a call is recorded under. A call the registry
+// does not declare still gets a stable name, from its binary and a hash of its
+// arguments, so that replay finds it again.
+func recordingName(binary string, args []string) string {
+	for _, f := range JSONForms() {
+		if f.Binary == binary && slices.Equal(f.Args, args) {
+			return f.Name + ".json"
+		}
+	}
+	if c := lookupCommand(binary, args); c != nil {
+		return c.callName(binary) + ".txt"
+	}
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return filepath.Base(binary) + "-" + hex.EncodeToString(sum[:])[:12] + ".txt"
+}
+
+// recordingSource runs every command through next and saves what it returned.
+type recordingSource struct {
+	next DataSource
+	dir  string
+	log  *logger.Logger
+}
+
+// NewRecordingSource returns a DataSource that answers from next and records
+// each answer under dir, which is created if needed.
+func NewRecordingSource(log *logger.Logger, next DataSource, dir string) (DataSource, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("recording directory: %w", err)
+	}
+	return &recordingSource{next: next, dir: dir, log: log}, nil
+}
+
+func (s *recordingSource) Name() string { return s.next.Name() }
+
+func (s *recordingSource) Run(ctx context.Context, command string, args []string) ([]byte, error) {
+	start := time.Now()
+	out, err := s.next.Run(ctx, command, args)
+	// A command that timed out or was abandoned printed only part of its
+	// answer. The previous recording, if any, is the better snapshot.
+	if ctx.Err() != nil {
+		return out, err
+	}
+	meta := recordingMeta{
+		Binary:   command,
+		Args:     args,
+		Source:   s.next.Name(),
+		Started:  start.UTC(),
+		Duration: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		meta.Error = err.Error()
+	}
+	name := recordingName(command, args)
+	if werr := s.write(name, out, meta); werr != nil {
+		s.log.Warn("Cannot record command output", "command", command, "file", name, "err", werr)
+	}
+	return out, err
+}
+
+// write replaces the recording atomically, so that a replay reading the same
+// directory never sees half of one.
+func (s *recordingSource) write(name string, out []byte, meta recordingMeta) error {
+	metaJSON, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, name+".meta.json"), append(metaJSON, '\n')); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, name), out)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replaySource answers every command from a directory NewRecordingSource wrote.
+type replaySource struct {
+	dir string
+}
+
+// NewReplaySource returns a DataSource that serves the recordings under dir
+// instead of running anything.
+func NewReplaySource(dir string) (DataSource, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("replay directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("replay directory: %s is not a directory", dir)
+	}
+	return replaySource{dir: dir}, nil
+}
+
+func (replaySource) Name() string { return "replay" }
+
+// Run returns the recorded output of the call. A call that failed when it was
+// recorded fails again, with the recorded error message; a call that was never
+// recorded fails with an error wrapping fs.ErrNotExist.
+func (s replaySource) Run(_ context.Context, command string, args []string) ([]byte, error) {
+	name := recordingName(command, args)
+	out, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no recording of %s %s in %s: %w", command, strings.Join(args, " "), s.dir, err)
+		}
+		return nil, err
+	}
+	// The output alone is a valid recording, so that a fixture copied from
+	// test_data/ can be replayed as is.
+	var meta recordingMeta
+	if data, err := os.ReadFile(filepath.Join(s.dir, name+".meta.json")); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("recording %s: %w", name+".meta.json", err)
+		}
+	}
+	if meta.Error != "" {
+		return out, errors.New(meta.Error)
+	}
+	return out, nil
+}
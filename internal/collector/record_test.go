@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoSource answers every call with its own command line, and fails the ones
+// listed in fail.
+type echoSource struct {
+	fail map[string]bool
+}
+
+func (echoSource) Name() string { return "echo" }
+
+func (s echoSource) Run(_ context.Context, command string, args []string) ([]byte, error) {
+	out := []byte(command + " " + strings.Join(args, " ") + "\n")
+	if s.fail[command] {
+		return out, errors.New("exit status 1")
+	}
+	return out, nil
+}
+
+// sacctArgs returns the sacct_efficiency arguments for a window ending at end.
+func sacctArgs(end time.Time) []string {
+	return windowArgs("sacct_efficiency", end)
+}
+
+// windowArgs returns the arguments of the named sacct registry entry for an
+// hour's window ending at end.
+func windowArgs(name string, end time.Time) []string {
+	args := append([]string(nil), registryEntry(name).Args...)
+	for i, a := range args {
+		switch a {
+		case "{{starttime}}":
+			args[i] = end.Add(-time.Hour).Format(slurmTimeLayout)
+		case "{{endtime}}":
+			args[i] = end.Format(slurmTimeLayout)
+		}
+	}
+	return args
+}
+
+func TestRecordingName(t *testing.T) {
+	assert.Equal(t, "squeue_jobs.txt", recordingName("squeue", registryEntry("squeue_jobs").Args))
+	assert.Equal(t, "scontrol_nodes.json", recordingName("scontrol", scontrolNodesJSONForm.Args))
+	assert.Equal(t, "binary_version-sdiag.txt", recordingName("sdiag", []string{"--version"}))
+	assert.Equal(t, "sacct_efficiency.txt", recordingName("sacct", sacctArgs(time.Now())))
+	assert.Equal(t, recordingName("sinfo", []string{"--unknown"}), recordingName("sinfo", []string{"--unknown"}),
+		"an unregistered call gets a stable name")
+	assert.NotEqual(t, recordingName("sinfo", []string{"--unknown"}), recordingName("sinfo", []string{"--other"}))
+}
+
+// TestRecordReplay records a few calls and replays them, the sacct one with a
+// window computed at another time.
+func TestRecordReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rec")
+	log, buf := bufferLogger()
+	rec, err := NewRecordingSource(log, echoSource{fail: map[string]bool{"sdiag": true}}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "echo", rec.Name())
+
+	ctx := context.Background()
+	recorded := sacctArgs(time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local))
+	want, err := rec.Run(ctx, "sacct", recorded)
+	require.NoError(t, err)
+	_, err = rec.Run(ctx, "sdiag", registryEntry("scheduler").Args)
+	require.Error(t, err)
+	assert.Empty(t, buf.String())
+
+	data, err := os.ReadFile(filepath.Join(dir, "sacct_efficiency.txt.meta.json"))
+	require.NoError(t, err)
+	var meta recordingMeta
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, recorded, meta.Args)
+	assert.Equal(t, "echo", meta.Source)
+	assert.Empty(t, meta.Error)
+
+	replay, err := NewReplaySource(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "replay", replay.Name())
+
+	out, err := replay.Run(ctx, "sacct", sacctArgs(time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(out))
+
+	_, err = replay.Run(ctx, "sdiag", registryEntry("scheduler").Args)
+	require.EqualError(t, err, "exit status 1", "a recorded failure fails again")
+
+	_, err = replay.Run(ctx, "squeue", registryEntry("squeue_jobs").Args)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.Contains(t, err.Error(), "no recording of squeue")
+}
+
+// TestRecordingSource_Abandoned checks that a cancelled call leaves the
+// previous recording alone.
+func TestRecordingSource_Abandoned(t *testing.T) {
+	dir := t.TempDir()
+	log, _ := bufferLogger()
+	rec, err := NewRecordingSource(log, echoSource{}, dir)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rec.Run(ctx, "squeue", registryEntry("squeue_jobs").Args)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "squeue_jobs.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestReplaySource_Fixtures checks that a copy of test_data/ replays without
+// .meta.json files.
+func TestReplaySource_Fixtures(t *testing.T) {
+	replay, err := NewReplaySource(filepath.Join(testDataDir, cliFixtureDir))
+	require.NoError(t, err)
+	out, err := replay.Run(context.Background(), "sinfo", registryEntry("cpus").Args)
+	require.NoError(t, err)
+	assert.Equal(t, string(readCLIFixture(t, "cpus")), string(out))
+
+	_, err = NewReplaySource(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
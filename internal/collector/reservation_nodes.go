@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strings"
 
@@ -119,17 +120,17 @@ func ParseReservationNodesMetrics(input []byte) map[string]*ReservationNodesMetr
 // ReservationNodesData returns the output of scontrol show nodes -o.
 // Uses scontrolNodesCache so that when both the nodes and reservation_nodes
 // collectors run in the same scrape cycle, the scontrol RPC is only sent once.
-func ReservationNodesData(log *logger.Logger) ([]byte, error) {
+func ReservationNodesData(ctx context.Context, log *logger.Logger) ([]byte, error) {
 	data, err := scontrolNodesCache.GetOrFetch(func() ([]byte, error) {
-		return Execute(log, "scontrol", []string{"show", "nodes", "-o"})
+		return Execute(ctx, log, "scontrol", []string{"show", "nodes", "-o"})
 	})
 	updateCacheAge()
 	return data, err
 }
 
 // ReservationNodesGetMetrics fetches and parses per-reservation node state metrics.
-func ReservationNodesGetMetrics(logger *logger.Logger) (map[string]*ReservationNodesMetrics, error) {
-	data, err := ReservationNodesData(logger)
+func ReservationNodesGetMetrics(ctx context.Context, logger *logger.Logger) (map[string]*ReservationNodesMetrics, error) {
+	data, err := ReservationNodesData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -177,10 +178,12 @@ func (rnc *ReservationNodesCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- rnc.healthy
 }
 
-func (rnc *ReservationNodesCollector) Collect(ch chan<- prometheus.Metric) { _ = rnc.tryCollect(ch) }
+func (rnc *ReservationNodesCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = rnc.tryCollect(context.Background(), ch)
+}
 
-func (rnc *ReservationNodesCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	metrics, err := ReservationNodesGetMetrics(rnc.logger)
+func (rnc *ReservationNodesCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	metrics, err := ReservationNodesGetMetrics(ctx, rnc.logger)
 	if err != nil {
 		rnc.logger.Error("Failed to get reservation nodes metrics", "err", err)
 		return err
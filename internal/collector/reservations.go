@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -89,10 +90,12 @@ func (c *ReservationsCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect is called by the Prometheus registry when collecting metrics.
-func (c *ReservationsCollector) Collect(ch chan<- prometheus.Metric) { _ = c.tryCollect(ch) }
+func (c *ReservationsCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = c.tryCollect(context.Background(), ch)
+}
 
-func (c *ReservationsCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	data, err := c.reservationsData()
+func (c *ReservationsCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	data, err := c.reservationsData(ctx)
 	if err != nil {
 		c.logger.Error("Failed to fetch reservation data", "err", err)
 		return err
@@ -144,8 +147,8 @@ func (c *ReservationsCollector) emitTime(ch chan<- prometheus.Metric, desc *prom
 reservationsData executes the scontrol command to retrieve reservation information.
 Expected scontrol output format: key=value pairs for each reservation, separated by blank lines.
 */
-func (c *ReservationsCollector) reservationsData() ([]byte, error) {
-	return Execute(c.logger, "scontrol", []string{"show", "reservation"})
+func (c *ReservationsCollector) reservationsData(ctx context.Context) ([]byte, error) {
+	return Execute(ctx, c.logger, "scontrol", []string{"show", "reservation"})
 }
 
 // setReservationField assigns one parsed key=value pair into res.
@@ -0,0 +1,952 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// ErrNoRESTEquivalent is returned for a command slurmrestd has no endpoint
+// for. The collector that issued it fails, and slurm_exporter_collector_success
+// says so, rather than publishing zeros.
+var ErrNoRESTEquivalent = errors.New("no slurmrestd equivalent")
+
+// restSource answers the collectors' commands from slurmrestd.
+//
+// Each registry entry it supports has a renderer that fetches the matching
+// endpoint and prints what the command would have printed, in the exact layout
+// the entry's parser reads. Translating at this seam rather than behind every
+// *Data() function keeps one parser per metric: the CLI fixtures under
+// test_data/ go on defining what each metric means, and the REST path is
+// tested by rendering the JSON counterpart of a captured cluster and checking
+// that the parsers read the same thing from both.
+//
+// Most endpoints feed several commands: /nodes alone answers eight, /jobs six.
+// The renderers read them through a restShared, so a scrape fetches each
+// endpoint once however many collectors ask for it.
+type restSource struct {
+	api *restShared
+}
+
+// NewRESTSource returns a DataSource backed by slurmrestd.
+func NewRESTSource(client *slurmrest.Client) DataSource {
+	return &restSource{api: newRESTShared(client, restShareTTL)}
+}
+
+func (*restSource) Name() string { return "rest" }
+
+func (s *restSource) Run(ctx context.Context, command string, args []string) ([]byte, error) {
+	cmd := lookupCommand(command, args)
+	if cmd == nil {
+		return nil, fmt.Errorf("%s %s: not a registered Slurm command: %w",
+			command, strings.Join(args, " "), ErrNoRESTEquivalent)
+	}
+	if reason, ok := restUnsupported[cmd.Name]; ok {
+		return nil, fmt.Errorf("%s: %w: %s", cmd.Name, ErrNoRESTEquivalent, reason)
+	}
+	render, ok := restRenderers[cmd.Name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", cmd.Name, ErrNoRESTEquivalent)
+	}
+	return render(ctx, s.api)
+}
+
+// restAPI is the part of slurmrest.Client the renderers read. A renderer must
+// not modify a response: under restShared, other renderers read the same one.
+type restAPI interface {
+	Jobs(ctx context.Context) (*slurmrest.JobsResponse, error)
+	Nodes(ctx context.Context) (*slurmrest.NodesResponse, error)
+	Partitions(ctx context.Context) (*slurmrest.PartitionsResponse, error)
+	Reservations(ctx context.Context) (*slurmrest.ReservationsResponse, error)
+	Licenses(ctx context.Context) (*slurmrest.LicensesResponse, error)
+	Diag(ctx context.Context) (*slurmrest.DiagResponse, error)
+	Ping(ctx context.Context) (*slurmrest.PingResponse, error)
+}
+
+// restShareTTL is how long a slurmrestd response answers later commands. It
+// only has to span one scrape, whose collectors run concurrently, and stays
+// well below any scrape interval so that the next scrape fetches afresh.
+const restShareTTL = 5 * time.Second
+
+// restShared is a restAPI that fetches each endpoint at most once per ttl,
+// the REST counterpart of scontrolNodesCache and squeueJobsCache. Concurrent
+// callers of one endpoint wait for a single request; a failed request is not
+// kept, so the next caller tries again.
+type restShared struct {
+	client *slurmrest.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*restEntry
+}
+
+// restEntry holds the last response of one endpoint. Its lock is held for the
+// whole fetch, which is what makes concurrent callers wait for it.
+type restEntry struct {
+	mu      sync.Mutex
+	value   any
+	fetchAt time.Time
+}
+
+func newRESTShared(client *slurmrest.Client, ttl time.Duration) *restShared {
+	return &restShared{client: client, ttl: ttl, entries: map[string]*restEntry{}}
+}
+
+// sharedFetch returns the response of endpoint from s if it is still fresh,
+// otherwise calls fetch and keeps what it returns.
+func sharedFetch[T any](s *restShared, endpoint string, fetch func() (T, error)) (T, error) {
+	s.mu.Lock()
+	e, ok := s.entries[endpoint]
+	if !ok {
+		e = &restEntry{}
+		s.entries[endpoint] = e
+	}
+	s.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.fetchAt.IsZero() && time.Since(e.fetchAt) < s.ttl {
+		return e.value.(T), nil
+	}
+	v, err := fetch()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	e.value, e.fetchAt = v, time.Now()
+	return v, nil
+}
+
+func (s *restShared) Jobs(ctx context.Context) (*slurmrest.JobsResponse, error) {
+	return sharedFetch(s, "jobs", func() (*slurmrest.JobsResponse, error) { return s.client.Jobs(ctx) })
+}
+
+func (s *restShared) Nodes(ctx context.Context) (*slurmrest.NodesResponse, error) {
+	return sharedFetch(s, "nodes", func() (*slurmrest.NodesResponse, error) { return s.client.Nodes(ctx) })
+}
+
+func (s *restShared) Partitions(ctx context.Context) (*slurmrest.PartitionsResponse, error) {
+	return sharedFetch(s, "partitions", func() (*slurmrest.PartitionsResponse, error) { return s.client.Partitions(ctx) })
+}
+
+func (s *restShared) Reservations(ctx context.Context) (*slurmrest.ReservationsResponse, error) {
+	return sharedFetch(s, "reservations", func() (*slurmrest.ReservationsResponse, error) { return s.client.Reservations(ctx) })
+}
+
+func (s *restShared) Licenses(ctx context.Context) (*slurmrest.LicensesResponse, error) {
+	return sharedFetch(s, "licenses", func() (*slurmrest.LicensesResponse, error) { return s.client.Licenses(ctx) })
+}
+
+func (s *restShared) Diag(ctx context.Context) (*slurmrest.DiagResponse, error) {
+	return sharedFetch(s, "diag", func() (*slurmrest.DiagResponse, error) { return s.client.Diag(ctx) })
+}
+
+func (s *restShared) Ping(ctx context.Context) (*slurmrest.PingResponse, error) {
+	return sharedFetch(s, "ping", func() (*slurmrest.PingResponse, error) { return s.client.Ping(ctx) })
+}
+
+// restRenderer fetches what one registry entry needs and renders it as that
+// command's output.
+type restRenderer func(ctx context.Context, c restAPI) ([]byte, error)
+
+// restRenderers maps registry names to their renderer. Every entry of
+// CommandRegistry is either here or in restUnsupported; the test enforces it,
+// so a new Slurm call cannot be added without deciding what the REST path does
+// with it.
+var restRenderers = map[string]restRenderer{
+	"squeue_jobs":          withJobs(renderSqueueJobs),
+	"running_jobs":         withJobs(renderRunningJobs),
+	"job_wait":             withJobs(renderJobWait),
+	"job_wait_started":     withJobs(renderJobWaitStarted),
+	"queue_all_states":     withJobs(func(jobs []slurmrest.Job) []byte { return renderQueue(jobs, true) }),
+	"queue_default_states": withJobs(func(jobs []slurmrest.Job) []byte { return renderQueue(jobs, false) }),
+	"cpus":                 withNodes(renderCPUs),
+	"gpus_snapshot":        withNodes(renderGPUsSnapshot),
+	"node_detail":          withNodes(renderNodeDetail),
+	"nodes_global":         withPartitionNodes(renderNodesGlobal),
+	"scontrol_nodes":       withNodes(renderScontrolNodes),
+	"partitions_cpu":       withPartitionNodes(renderPartitionsCPU),
+	"partitions_gpu":       withPartitionNodes(renderPartitionsGPU),
+	"drain_reason":         withNodes(renderDrainReason),
+	"reservations":         renderReservationsFrom,
+	"licenses":             renderLicensesFrom,
+	"scheduler":            renderSchedulerFrom,
+	"binary_version":       renderVersionFrom,
+	"controller_ping":      renderPingFrom,
+}
+
+// restUnsupported lists the registry entries with no slurmrestd counterpart,
+// and why. The collectors behind them fail on every scrape with the REST
+// source; disable them.
+var restUnsupported = map[string]string{
+	"fairshare": "sshare reads the association tree from slurmctld's priority plugin, " +
+		"which the slurm/ endpoints listed in the REST source do not cover; " +
+		"disable the fairshare collector",
+	"sacct_efficiency": "sacct reads SlurmDBD, which slurmrestd serves under slurmdb/ with a " +
+		"separate schema and authorisation; disable the sacct_efficiency collector",
+}
+
+// RESTUnsupported reports whether the registry entry of that name, which for
+// fairshare and sacct_efficiency is also the collector's name, has no
+// slurmrestd counterpart, and why.
+func RESTUnsupported(name string) (string, bool) {
+	reason, ok := restUnsupported[name]
+	return reason, ok
+}
+
+func withJobs(render func([]slurmrest.Job) []byte) restRenderer {
+	return func(ctx context.Context, c restAPI) ([]byte, error) {
+		r, err := c.Jobs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return render(r.Jobs), nil
+	}
+}
+
+func withNodes(render func([]slurmrest.Node) []byte) restRenderer {
+	return func(ctx context.Context, c restAPI) ([]byte, error) {
+		r, err := c.Nodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return render(r.Nodes), nil
+	}
+}
+
+func withPartitionNodes(render func([]partitionNodes) []byte) restRenderer {
+	return func(ctx context.Context, c restAPI) ([]byte, error) {
+		parts, err := c.Partitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := c.Nodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return render(groupByPartition(parts.Partitions, nodes.Nodes)), nil
+	}
+}
+
+// ── Jobs ─────────────────────────────────────────────────────────────────────
+
+// squeueDefaultStates is what squeue reports when it is not told which states
+// to view.
+var squeueDefaultStates = []string{"PENDING", "RUNNING", "SUSPENDED", "COMPLETING", "CONFIGURING"}
+
+// jobStateName is the state squeue prints for a job: COMPLETING and
+// CONFIGURING are flags in the JSON but states on the command line.
+func jobStateName(states []string) string {
+	switch {
+	case slices.Contains(states, "COMPLETING"):
+		return "COMPLETING"
+	case slices.Contains(states, "CONFIGURING"):
+		return "CONFIGURING"
+	case len(states) == 0:
+		return "UNKNOWN"
+	}
+	return states[0]
+}
+
+// renderQueue prints `squeue -h -o %P|%T|%C|%r|%u [--states=all]`. /jobs
+// always returns every state slurmctld still holds, so the default view is the
+// filtered one here.
+func renderQueue(jobs []slurmrest.Job, allStates bool) []byte {
+	var b strings.Builder
+	for i := range jobs {
+		j := &jobs[i]
+		state := jobStateName(j.JobState)
+		if !allStates && !slices.Contains(squeueDefaultStates, state) {
+			continue
+		}
+		reason := j.StateReason
+		if reason == "" {
+			reason = "None"
+		}
+		fmt.Fprintf(&b, "%s|%s|%d|%s|%s\n", j.Partition, state, j.CPUs.Value(), reason, j.UserName)
+	}
+	return []byte(b.String())
+}
+
+// renderSqueueJobs prints `squeue -a -r -h -O <squeueJobsColumns>`. -r
+// prints one line per array task, so a pending array that slurmctld still
+// holds as a single record is expanded from its task string, as squeue does.
+func renderSqueueJobs(jobs []slurmrest.Job) []byte {
+	var b strings.Builder
+	for i := range jobs {
+		j := &jobs[i]
+		state := jobStateName(j.JobState)
+		if !slices.Contains(squeueDefaultStates, state) {
+			continue
+		}
+		tres := j.TRESAllocStr
+		if tres == "" {
+			tres = j.TRESReqStr
+		}
+		rest := fmt.Sprintf("|%s|%s|%s|%s|%d|%d|%s\n",
+			j.Account, j.UserName, j.Partition, state, j.NodeCount.Value(), j.CPUs.Value(), tres)
+		for _, id := range squeueJobIDs(j) {
+			b.WriteString(id)
+			b.WriteString(rest)
+		}
+	}
+	return []byte(b.String())
+}
+
+// renderRunningJobs prints `squeue -a -r -h --states=running -O
+// <runningJobsColumns>`. A running array task is a record of its own, so
+// squeueJobIDs never has to expand one here.
+func renderRunningJobs(jobs []slurmrest.Job) []byte {
+	var b strings.Builder
+	for i := range jobs {
+		j := &jobs[i]
+		if jobStateName(j.JobState) != "RUNNING" {
+			continue
+		}
+		rest := fmt.Sprintf("|%s|%s|%s|%d|%d|%s|%s|%s|%s|%s|%s|%s|%s\n",
+			j.Account, j.UserName, j.Partition, j.NodeCount.Value(), j.CPUs.Value(), j.TRESAllocStr,
+			slurmTimeString(j.StartTime), squeueTimeLimit(j.TimeLimit), j.Nodes, j.QOS,
+			squeueString(j.WCKey), j.Name, squeueString(j.Comment))
+		for _, id := range squeueJobIDs(j) {
+			b.WriteString(id)
+			b.WriteString(rest)
+		}
+	}
+	return []byte(b.String())
+}
+
+// renderJobWait prints `squeue -a -r -h --states=running -O <jobWaitColumns>`.
+func renderJobWait(jobs []slurmrest.Job) []byte {
+	var b strings.Builder
+	for i := range jobs {
+		j := &jobs[i]
+		if jobStateName(j.JobState) != "RUNNING" {
+			continue
+		}
+		rest := fmt.Sprintf("|%s|%s|%s|%s\n",
+			j.Partition, j.Account, slurmTimeString(j.SubmitTime), slurmTimeString(j.StartTime))
+		for _, id := range squeueJobIDs(j) {
+			b.WriteString(id)
+			b.WriteString(rest)
+		}
+	}
+	return []byte(b.String())
+}
+
+// renderJobWaitStarted prints what `sacct -a -X -P -n --format
+// JobID,Partition,Account,Submit,Start --state RUNNING` would for the jobs
+// slurmctld still holds: every one that got nodes, running or finished less
+// than MinJobAge ago. /jobs takes no time window; the job_wait collector
+// drops the jobs that started before its own. A job cancelled while pending
+// got no nodes and is left out, as sacct has it never start.
+func renderJobWaitStarted(jobs []slurmrest.Job) []byte {
+	var b strings.Builder
+	for i := range jobs {
+		j := &jobs[i]
+		if j.Nodes == "" || j.StartTime.Value() == 0 || jobStateName(j.JobState) == "PENDING" {
+			continue
+		}
+		rest := fmt.Sprintf("|%s|%s|%s|%s\n",
+			j.Partition, j.Account, slurmTimeString(j.SubmitTime), slurmTimeString(j.StartTime))
+		for _, id := range squeueJobIDs(j) {
+			b.WriteString(id)
+			b.WriteString(rest)
+		}
+	}
+	return []byte(b.String())
+}
+
+// squeueTimeLimit prints a time limit in minutes as squeue does:
+// "UNLIMITED", "D-HH:MM:SS", "H:MM:SS" or "M:SS".
+func squeueTimeLimit(n slurmrest.Number) string {
+	if n.Infinite {
+		return "UNLIMITED"
+	}
+	secs := n.Value() * 60
+	days, hours, mins := secs/86400, secs/3600%24, secs/60%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, mins, secs%60)
+	case hours > 0:
+		return fmt.Sprintf("%d:%02d:%02d", hours, mins, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", mins, secs%60)
+}
+
+// squeueString prints a string field as squeue does, "(null)" when unset.
+func squeueString(s string) string {
+	if s == "" {
+		return squeueNull
+	}
+	return s
+}
+
+// squeueJobIDs returns the JobID column squeue -r prints for one record:
+// "<array_job_id>_<task>" per task for an array, the job ID otherwise.
+func squeueJobIDs(j *slurmrest.Job) []string {
+	if !j.ArrayJobID.Set || j.ArrayJobID.Number == 0 {
+		return []string{strconv.FormatInt(j.JobID, 10)}
+	}
+	prefix := strconv.FormatInt(j.ArrayJobID.Number, 10) + "_"
+	if j.ArrayTaskID.Set {
+		return []string{prefix + strconv.FormatInt(j.ArrayTaskID.Number, 10)}
+	}
+	tasks := expandArrayTasks(j.ArrayTaskString)
+	if len(tasks) == 0 {
+		return []string{prefix + "[" + j.ArrayTaskString + "]"}
+	}
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = prefix + strconv.FormatInt(t, 10)
+	}
+	return ids
+}
+
+// expandArrayTasks expands an array task string such as "1-5,8,10-20:2%4"
+// into task IDs. The "%N" throttle suffix limits how many run at once, not
+// which exist, and is dropped. nil means the string did not parse.
+func expandArrayTasks(spec string) []int64 {
+	spec, _, _ = strings.Cut(spec, "%")
+	spec = strings.Trim(spec, "[]")
+	var tasks []int64
+	for part := range strings.SplitSeq(spec, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, ":")
+		step := int64(1)
+		if hasStep {
+			s, err := strconv.ParseInt(stepStr, 10, 64)
+			if err != nil || s < 1 {
+				return nil
+			}
+			step = s
+		}
+		loStr, hiStr, isRange := strings.Cut(rng, "-")
+		lo, err := strconv.ParseInt(loStr, 10, 64)
+		if err != nil {
+			return nil
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.ParseInt(hiStr, 10, 64); err != nil || hi < lo {
+				return nil
+			}
+		}
+		for t := lo; t <= hi; t += step {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// ── Nodes ────────────────────────────────────────────────────────────────────
+
+// nodeFlags splits a node state array into its lower-cased base state and
+// the set of flags that follow it.
+func nodeFlags(states []string) (string, map[string]bool) {
+	if len(states) == 0 {
+		return "unknown", nil
+	}
+	flags := make(map[string]bool, len(states)-1)
+	for _, f := range states[1:] {
+		flags[f] = true
+	}
+	return strings.ToLower(states[0]), flags
+}
+
+// nodeStateSuffixes are the markers sinfo appends to a state name, in the
+// order it picks them. Only the first that applies is printed.
+var nodeStateSuffixes = []struct{ flag, suffix string }{
+	{"NOT_RESPONDING", "*"},
+	{"POWERED_DOWN", "~"},
+	{"POWERING_UP", "#"},
+	{"POWERING_DOWN", "%"},
+	{"POWER_DOWN", "!"},
+	{"REBOOT_REQUESTED", "@"},
+	{"REBOOT_ISSUED", "^"},
+	{"PLANNED", "-"},
+}
+
+// sinfoStateLong renders a node state array as sinfo's StateLong (%T) does:
+// "drained" for an idle node with the DRAIN flag, "draining" for a busy one,
+// "mixed-" for a mixed node with a planned job, "idle*" for one that stopped
+// responding. It mirrors node_state_string() in Slurm for the states the
+// collectors tell apart; flags with no effect on the name, such as
+// DYNAMIC_NORM, are dropped as sinfo drops them.
+func sinfoStateLong(states []string) string {
+	base, flags := nodeFlags(states)
+	busy := base == "allocated" || base == "mixed" || flags["COMPLETING"]
+
+	var name string
+	switch {
+	case flags["INVALID_REG"]:
+		name = "inval"
+	case flags["MAINTENANCE"]:
+		name = "maint"
+	case flags["DRAIN"] && busy:
+		name = "draining"
+	case flags["DRAIN"]:
+		name = "drained"
+	case flags["FAIL"] && busy:
+		name = "failing"
+	case flags["FAIL"]:
+		name = "fail"
+	case base == "down":
+		name = "down"
+	case flags["COMPLETING"]:
+		name = "completing"
+	case base == "idle" && flags["RESERVED"]:
+		name = "reserved"
+	case base == "idle" && flags["PLANNED"]:
+		return "planned"
+	default:
+		name = base
+	}
+	for _, s := range nodeStateSuffixes {
+		if flags[s.flag] {
+			return name + s.suffix
+		}
+	}
+	return name
+}
+
+// nodeCPUs returns a node's CPUs as sinfo's %C splits them: allocated, idle,
+// other, total. A node that cannot take work, down, drained or failed, has its
+// unallocated CPUs counted as other rather than idle.
+func nodeCPUs(n *slurmrest.Node) (alloc, idle, other, total int64) {
+	base, flags := nodeFlags(n.States())
+	total, alloc = n.CPUs, n.AllocCPUs
+	if base == "down" || flags["DRAIN"] || flags["FAIL"] {
+		return alloc, 0, total - alloc, total
+	}
+	return alloc, total - alloc, 0, total
+}
+
+// cpuStates accumulates %C over several nodes.
+type cpuStates struct{ alloc, idle, other, total int64 }
+
+func (c *cpuStates) add(n *slurmrest.Node) {
+	a, i, o, t := nodeCPUs(n)
+	c.alloc += a
+	c.idle += i
+	c.other += o
+	c.total += t
+}
+
+func (c cpuStates) String() string {
+	return fmt.Sprintf("%d/%d/%d/%d", c.alloc, c.idle, c.other, c.total)
+}
+
+// orNull is how sinfo and scontrol print an empty field.
+func orNull(s string) string {
+	if s == "" {
+		return "(null)"
+	}
+	return s
+}
+
+// counted groups lines in first-seen order and counts their occurrences, the
+// way sinfo collapses identical nodes into one line with a node count.
+type counted struct {
+	keys   []string
+	counts map[string]int
+}
+
+func (c *counted) add(key string) {
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	if c.counts[key] == 0 {
+		c.keys = append(c.keys, key)
+	}
+	c.counts[key]++
+}
+
+// renderCPUs prints `sinfo -h -o %C`: every node once, across all partitions.
+func renderCPUs(nodes []slurmrest.Node) []byte {
+	var c cpuStates
+	for i := range nodes {
+		c.add(&nodes[i])
+	}
+	return []byte(c.String() + "\n")
+}
+
+// renderGPUsSnapshot prints `sinfo -a -h --Format=Nodes: ,StateLong: ,Gres: ,GresUsed:`.
+// Each node is counted once, whatever the number of partitions it belongs to.
+func renderGPUsSnapshot(nodes []slurmrest.Node) []byte {
+	var c counted
+	for i := range nodes {
+		n := &nodes[i]
+		c.add(sinfoStateLong(n.States()) + " " + orNull(n.GRES) + " " + orNull(n.GRESUsed))
+	}
+	var b strings.Builder
+	for _, k := range c.keys {
+		fmt.Fprintf(&b, "%d %s\n", c.counts[k], k)
+	}
+	return []byte(b.String())
+}
+
+// renderNodeDetail prints `sinfo -h -N -O NodeList: ,AllocMem: ,Memory:
+// ,CPUsState: ,StateLong: ,Partition: ,Gres: ,GresUsed:`, one line per node
+// and partition.
+func renderNodeDetail(nodes []slurmrest.Node) []byte {
+	var b strings.Builder
+	for i := range nodes {
+		n := &nodes[i]
+		var c cpuStates
+		c.add(n)
+		for _, p := range n.Partitions {
+			fmt.Fprintf(&b, "%s %d %d %s %s %s %s %s\n", n.Name, n.AllocMemory, n.RealMemory, c,
+				sinfoStateLong(n.States()), p, orNull(n.GRES), orNull(n.GRESUsed))
+		}
+	}
+	return []byte(b.String())
+}
+
+// renderScontrolNodes prints `scontrol show nodes -o`, limited to the keys the
+// collectors read. State is the JSON state array joined with "+", which is
+// how scontrol prints it.
+func renderScontrolNodes(nodes []slurmrest.Node) []byte {
+	var b strings.Builder
+	for i := range nodes {
+		n := &nodes[i]
+		fmt.Fprintf(&b, "NodeName=%s CPUAlloc=%d CPUTot=%d AvailableFeatures=%s ActiveFeatures=%s Gres=%s "+
+			"RealMemory=%d AllocMem=%d State=%s Partitions=%s",
+			n.Name, n.AllocCPUs, n.CPUs, orNull(strings.Join(n.Features, ",")),
+			orNull(strings.Join(n.ActiveFeatures, ",")), orNull(n.GRES),
+			n.RealMemory, n.AllocMemory, strings.Join(n.States(), "+"), strings.Join(n.Partitions, ","))
+		if n.Reason != "" {
+			fmt.Fprintf(&b, " Reason=%s", n.Reason)
+		}
+		if n.Reservation != "" {
+			fmt.Fprintf(&b, " ReservationName=%s", n.Reservation)
+		}
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// renderDrainReason prints `sinfo -h -N -o %N|%E|%H|%T`, one line per node.
+func renderDrainReason(nodes []slurmrest.Node) []byte {
+	var b strings.Builder
+	for i := range nodes {
+		n := &nodes[i]
+		reason, since := "none", "Unknown"
+		if n.Reason != "" {
+			reason = n.Reason
+			since = slurmTimeString(n.ReasonChangedAt)
+		}
+		fmt.Fprintf(&b, "%s|%s|%s|%s\n", n.Name, reason, since, sinfoStateLong(n.States()))
+	}
+	return []byte(b.String())
+}
+
+// slurmTimeString formats a Unix timestamp in slurmTimeLayout and the local
+// zone, as Slurm prints it under SLURM_TIME_FORMAT=standard. An unset value
+// prints as Slurm's "Unknown".
+func slurmTimeString(n slurmrest.Number) string {
+	v := n.Value()
+	if v == 0 {
+		return "Unknown"
+	}
+	return time.Unix(v, 0).In(time.Local).Format(slurmTimeLayout)
+}
+
+// ── Partitions ───────────────────────────────────────────────────────────────
+
+// partitionNodes is one partition and the nodes in it.
+type partitionNodes struct {
+	name  string
+	nodes []*slurmrest.Node
+}
+
+// groupByPartition assigns nodes to partitions in the order /partitions lists
+// them, which is slurm.conf order and the order sinfo prints. A partition a
+// node names but /partitions did not return still gets its nodes, at the end.
+func groupByPartition(parts []slurmrest.Partition, nodes []slurmrest.Node) []partitionNodes {
+	var groups []partitionNodes
+	index := make(map[string]int, len(parts))
+	ensure := func(name string) int {
+		if i, ok := index[name]; ok {
+			return i
+		}
+		index[name] = len(groups)
+		groups = append(groups, partitionNodes{name: name})
+		return len(groups) - 1
+	}
+	for i := range parts {
+		ensure(parts[i].Name)
+	}
+	for i := range nodes {
+		for _, p := range nodes[i].Partitions {
+			g := ensure(p)
+			groups[g].nodes = append(groups[g].nodes, &nodes[i])
+		}
+	}
+	return groups
+}
+
+// renderNodesGlobal prints `sinfo -h -o %R|%D|%T|%b`: node counts per
+// partition, state and active feature set.
+func renderNodesGlobal(parts []partitionNodes) []byte {
+	var b strings.Builder
+	for _, p := range parts {
+		var c counted
+		for _, n := range p.nodes {
+			c.add(sinfoStateLong(n.States()) + "|" + orNull(strings.Join(n.ActiveFeatures, ",")))
+		}
+		for _, k := range c.keys {
+			state, features, _ := strings.Cut(k, "|")
+			fmt.Fprintf(&b, "%s|%d|%s|%s\n", p.name, c.counts[k], state, features)
+		}
+	}
+	return []byte(b.String())
+}
+
+// renderPartitionsCPU prints `sinfo -h -o %R,%C`.
+func renderPartitionsCPU(parts []partitionNodes) []byte {
+	var b strings.Builder
+	for _, p := range parts {
+		var c cpuStates
+		for _, n := range p.nodes {
+			c.add(n)
+		}
+		fmt.Fprintf(&b, "%s,%s\n", p.name, c)
+	}
+	return []byte(b.String())
+}
+
+// renderPartitionsGPU prints `sinfo -h --Format=Nodes: ,Partition: ,Gres:
+// ,GresUsed: --state=idle,allocated`. sinfo's "allocated" filter also selects
+// mixed nodes, and the filter reads the base state, so a drained idle node is
+// still selected.
+func renderPartitionsGPU(parts []partitionNodes) []byte {
+	var b strings.Builder
+	for _, p := range parts {
+		var c counted
+		for _, n := range p.nodes {
+			if base, _ := nodeFlags(n.States()); base != "idle" && base != "allocated" && base != "mixed" {
+				continue
+			}
+			c.add(orNull(n.GRES) + " " + orNull(n.GRESUsed))
+		}
+		for _, k := range c.keys {
+			fmt.Fprintf(&b, "%d %s %s\n", c.counts[k], p.name, k)
+		}
+	}
+	return []byte(b.String())
+}
+
+// ── Reservations, licenses, scheduler, version ───────────────────────────────
+
+func renderReservationsFrom(ctx context.Context, c restAPI) ([]byte, error) {
+	r, err := c.Reservations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return renderReservations(r.Reservations, time.Now()), nil
+}
+
+// renderReservations prints `scontrol show reservation`. The JSON carries no
+// state, so ACTIVE or INACTIVE is derived from the window against now, which
+// is what slurmctld does before printing it.
+func renderReservations(resvs []slurmrest.Reservation, now time.Time) []byte {
+	if len(resvs) == 0 {
+		return []byte("No reservations in the system\n")
+	}
+	var b strings.Builder
+	for i := range resvs {
+		r := &resvs[i]
+		state := "INACTIVE"
+		if start, end := r.StartTime.Value(), r.EndTime.Value(); start <= now.Unix() && now.Unix() < end {
+			state = "ACTIVE"
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "ReservationName=%s StartTime=%s EndTime=%s\n", r.Name,
+			slurmTimeString(r.StartTime), slurmTimeString(r.EndTime))
+		fmt.Fprintf(&b, "   Nodes=%s NodeCnt=%d CoreCnt=%d PartitionName=%s Flags=%s\n",
+			orNull(r.NodeList), r.NodeCount, r.CoreCount, orNull(r.Partition), orNull(strings.Join(r.Flags, ",")))
+		fmt.Fprintf(&b, "   Users=%s Accounts=%s State=%s\n", orNull(r.Users), orNull(r.Accounts), state)
+	}
+	return []byte(b.String())
+}
+
+func renderLicensesFrom(ctx context.Context, c restAPI) ([]byte, error) {
+	r, err := c.Licenses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return renderLicenses(r.Licenses), nil
+}
+
+// renderLicenses prints `scontrol show licenses -o`.
+func renderLicenses(licenses []slurmrest.License) []byte {
+	if len(licenses) == 0 {
+		return []byte("No licenses configured in Slurm.\n")
+	}
+	var b strings.Builder
+	for _, l := range licenses {
+		remote := "no"
+		if l.Remote {
+			remote = "yes"
+		}
+		fmt.Fprintf(&b, "LicenseName=%s Total=%d Used=%d Free=%d Reserved=%d Remote=%s\n",
+			l.Name, l.Total, l.Used, l.Free, l.Reserved, remote)
+	}
+	return []byte(b.String())
+}
+
+func renderSchedulerFrom(ctx context.Context, c restAPI) ([]byte, error) {
+	r, err := c.Diag(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return renderScheduler(&r.Statistics), nil
+}
+
+// sdiagTime formats a timestamp the way the sdiag header does.
+func sdiagTime(n slurmrest.Number) string {
+	v := n.Value()
+	return fmt.Sprintf("%s (%d)", time.Unix(v, 0).In(time.Local).Format(sdiagTimeLayout), v)
+}
+
+// renderScheduler prints `sdiag`. The backfill means are printed only once a
+// backfill cycle has run, as sdiag does, since they are divisions by the cycle
+// count.
+func renderScheduler(s *slurmrest.Statistics) []byte {
+	var b strings.Builder
+	b.WriteString("*******************************************************\n")
+	fmt.Fprintf(&b, "sdiag output at %s\n", sdiagTime(s.ReqTime))
+	fmt.Fprintf(&b, "Data since      %s\n", sdiagTime(s.ReqTimeStart))
+	b.WriteString("*******************************************************\n")
+	fmt.Fprintf(&b, "Server thread count:  %d\n", s.ServerThreadCount)
+	fmt.Fprintf(&b, "Agent queue size:     %d\n", s.AgentQueueSize)
+	fmt.Fprintf(&b, "Agent count:          %d\n", s.AgentCount)
+	fmt.Fprintf(&b, "Agent thread count:   %d\n", s.AgentThreadCount)
+	fmt.Fprintf(&b, "DBD Agent queue size: %d\n\n", s.DBDAgentQueueSize)
+
+	fmt.Fprintf(&b, "Jobs submitted: %d\n", s.JobsSubmitted)
+	fmt.Fprintf(&b, "Jobs started:   %d\n", s.JobsStarted)
+	fmt.Fprintf(&b, "Jobs completed: %d\n", s.JobsCompleted)
+	fmt.Fprintf(&b, "Jobs canceled:  %d\n", s.JobsCanceled)
+	fmt.Fprintf(&b, "Jobs failed:    %d\n\n", s.JobsFailed)
+
+	fmt.Fprintf(&b, "Job states ts:  %s\n", sdiagTime(s.JobStatesTime))
+	fmt.Fprintf(&b, "Jobs pending:   %d\n", s.JobsPending)
+	fmt.Fprintf(&b, "Jobs running:   %d\n\n", s.JobsRunning)
+
+	b.WriteString("Main schedule statistics (microseconds):\n")
+	fmt.Fprintf(&b, "\tLast cycle:   %d\n", s.ScheduleCycleLast)
+	fmt.Fprintf(&b, "\tMax cycle:    %d\n", s.ScheduleCycleMax)
+	fmt.Fprintf(&b, "\tTotal cycles: %d\n", s.ScheduleCycleTotal)
+	fmt.Fprintf(&b, "\tMean cycle:   %d\n", s.ScheduleCycleMean)
+	fmt.Fprintf(&b, "\tMean depth cycle:  %d\n", s.ScheduleCycleMeanDepth)
+	fmt.Fprintf(&b, "\tCycles per minute: %d\n", s.ScheduleCyclePerMinute)
+	fmt.Fprintf(&b, "\tLast queue length: %d\n\n", s.ScheduleQueueLength)
+
+	e := s.ScheduleExit
+	b.WriteString("Main scheduler exit:\n")
+	fmt.Fprintf(&b, "\tEnd of job queue: %d\n", e.EndJobQueue)
+	fmt.Fprintf(&b, "\tHit default_queue_depth: %d\n", e.DefaultQueueDepth)
+	fmt.Fprintf(&b, "\tHit sched_max_job_start: %d\n", e.MaxJobStart)
+	fmt.Fprintf(&b, "\tBlocked on licenses: %d\n", e.Licenses)
+	fmt.Fprintf(&b, "\tHit max_rpc_cnt: %d\n", e.MaxRPCCnt)
+	fmt.Fprintf(&b, "\tTimeout (max_sched_time): %d\n\n", e.MaxSchedTime)
+
+	b.WriteString("Backfilling stats\n")
+	fmt.Fprintf(&b, "\tTotal backfilled jobs (since last slurm start): %d\n", s.BFBackfilledJobs)
+	fmt.Fprintf(&b, "\tTotal backfilled jobs (since last stats cycle start): %d\n", s.BFLastBackfilledJobs)
+	fmt.Fprintf(&b, "\tTotal backfilled heterogeneous job components: %d\n", s.BFBackfilledHetJobs)
+	fmt.Fprintf(&b, "\tTotal cycles: %d\n", s.BFCycleCounter)
+	if s.BFWhenLastCycle.Value() == 0 {
+		b.WriteString("\tLast cycle when: N/A\n")
+	} else {
+		fmt.Fprintf(&b, "\tLast cycle when: %s\n", sdiagTime(s.BFWhenLastCycle))
+	}
+	fmt.Fprintf(&b, "\tLast cycle: %d\n", s.BFCycleLast)
+	fmt.Fprintf(&b, "\tMax cycle:  %d\n", s.BFCycleMax)
+	if s.BFCycleCounter > 0 {
+		fmt.Fprintf(&b, "\tMean cycle: %d\n", s.BFCycleMean)
+	}
+	fmt.Fprintf(&b, "\tLast depth cycle: %d\n", s.BFLastDepth)
+	fmt.Fprintf(&b, "\tLast depth cycle (try sched): %d\n", s.BFLastDepthTry)
+	if s.BFCycleCounter > 0 {
+		fmt.Fprintf(&b, "\tDepth Mean: %d\n", s.BFDepthMean)
+		fmt.Fprintf(&b, "\tDepth Mean (try depth): %d\n", s.BFDepthMeanTry)
+	}
+	fmt.Fprintf(&b, "\tLast queue length: %d\n", s.BFQueueLen)
+	if s.BFCycleCounter > 0 {
+		fmt.Fprintf(&b, "\tQueue length mean: %d\n", s.BFQueueLenMean)
+	}
+	fmt.Fprintf(&b, "\tLast table size: %d\n", s.BFTableSize)
+	if s.BFCycleCounter > 0 {
+		fmt.Fprintf(&b, "\tMean table size: %d\n", s.BFTableSizeMean)
+	}
+
+	bf := s.BFExit
+	b.WriteString("\nBackfill exit\n")
+	fmt.Fprintf(&b, "\tEnd of job queue: %d\n", bf.EndJobQueue)
+	fmt.Fprintf(&b, "\tHit bf_max_job_start: %d\n", bf.BFMaxJobStart)
+	fmt.Fprintf(&b, "\tHit bf_max_job_test: %d\n", bf.BFMaxJobTest)
+	fmt.Fprintf(&b, "\tSystem state changed: %d\n", bf.StateChanged)
+	fmt.Fprintf(&b, "\tHit table size limit (bf_node_space_size): %d\n", bf.BFNodeSpaceSize)
+	fmt.Fprintf(&b, "\tTimeout (bf_max_time): %d\n", bf.BFMaxTime)
+	fmt.Fprintf(&b, "\nLatency for 1000 calls to gettimeofday(): %d microseconds\n\n", s.GettimeofdayLatency)
+
+	b.WriteString("Remote Procedure Call statistics by message type\n")
+	for _, r := range s.RPCsByMessageType {
+		fmt.Fprintf(&b, "\t%-40s(%5d) count:%-6d ave_time:%-6d total_time:%d\n",
+			r.MessageType, r.TypeID, r.Count, r.AverageTime.Value(), r.TotalTime)
+	}
+	b.WriteString("\nRemote Procedure Call statistics by user\n")
+	for _, r := range s.RPCsByUser {
+		fmt.Fprintf(&b, "\t%-16s(%8d) count:%-6d ave_time:%-6d total_time:%d\n",
+			r.User, r.UserID, r.Count, r.AverageTime.Value(), r.TotalTime)
+	}
+	b.WriteString("\nPending RPC statistics\n")
+	if len(s.PendingRPCs) == 0 {
+		b.WriteString("\tNo pending RPCs\n")
+	}
+	for _, r := range s.PendingRPCs {
+		fmt.Fprintf(&b, "\t%-40s(%5d) count:%d\n", r.MessageType, r.TypeID, r.Count)
+	}
+	return []byte(b.String())
+}
+
+// renderVersionFrom prints `<binary> --version` as "slurm <release>", the
+// release of the slurmctld behind slurmrestd. There are no local binaries to
+// probe, so every one reports the controller's version.
+func renderVersionFrom(ctx context.Context, c restAPI) ([]byte, error) {
+	r, err := c.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r.Meta.Slurm.Release == "" {
+		return nil, errors.New("slurmrestd reported no Slurm release")
+	}
+	return []byte("slurm " + r.Meta.Slurm.Release + "\n"), nil
+}
+
+func renderPingFrom(ctx context.Context, c restAPI) ([]byte, error) {
+	r, err := c.Ping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return renderPing(r.Pings), nil
+}
+
+// renderPing prints `scontrol ping`, one line per controller.
+func renderPing(pings []slurmrest.Ping) []byte {
+	var b strings.Builder
+	for _, p := range pings {
+		fmt.Fprintf(&b, "Slurmctld(%s) at %s is %s\n", p.Mode, p.Hostname, p.Pinged)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,441 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// restFixtureDir is the JSON counterpart of cliFixtureDir: the same cluster,
+// as slurmrestd v0.0.41 describes it.
+const (
+	restFixtureDir = "slurmrestd-v0.0.41"
+	cliFixtureDir  = "slurm-24.11.7"
+)
+
+// restStandIn serves test_data/slurmrestd-v0.0.41/<endpoint>.json under
+// /slurm/v0.0.41/<endpoint>, the way slurmrestd would, and returns a client
+// pointed at it.
+func restStandIn(t *testing.T) *slurmrest.Client {
+	t.Helper()
+	c, _ := countingRESTStandIn(t)
+	return c
+}
+
+// countingRESTStandIn is restStandIn that also returns how many times each
+// endpoint has been requested.
+func countingRESTStandIn(t *testing.T) (*slurmrest.Client, func(endpoint string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := strings.CutPrefix(r.URL.Path, "/slurm/v0.0.41/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		hits[endpoint]++
+		mu.Unlock()
+		data, err := os.ReadFile(filepath.Join(testDataDir, restFixtureDir, endpoint+".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := slurmrest.NewClient(slurmrest.Options{URL: srv.URL})
+	require.NoError(t, err)
+	return c, func(endpoint string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[endpoint]
+	}
+}
+
+// restRender renders one registry entry from the stand-in.
+func restRender(t *testing.T, c *slurmrest.Client, name string) []byte {
+	t.Helper()
+	render, ok := restRenderers[name]
+	require.Truef(t, ok, "no REST renderer for %s", name)
+	out, err := render(context.Background(), c)
+	require.NoError(t, err)
+	return out
+}
+
+func readCLIFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testDataDir, cliFixtureDir, name+".txt"))
+	require.NoError(t, err)
+	return data
+}
+
+// TestRESTSourceMatchesCLI is the contract of the REST source: for every
+// command it answers, the parser reads the same values from the rendered JSON
+// as from the CLI capture of the same cluster.
+func TestRESTSourceMatchesCLI(t *testing.T) {
+	c := restStandIn(t)
+
+	tests := []struct {
+		name  string
+		parse func([]byte) any
+	}{
+		{"cpus", func(b []byte) any { return ParseCPUsMetrics(b) }},
+		{"node_detail", func(b []byte) any { return ParseNodeMetrics(b) }},
+		{"nodes_global", func(b []byte) any { return ParseNodesMetricsGlobal(b) }},
+		{"scontrol_nodes", func(b []byte) any { return ParseReservationNodesMetrics(b) }},
+		{"drain_reason", func(b []byte) any { return ParseDrainReasonMetrics(b) }},
+		{"queue_all_states", func(b []byte) any { return ParseQueueMetrics(b) }},
+		{"queue_default_states", func(b []byte) any { return ParseQueueMetrics(b) }},
+		{"scheduler", func(b []byte) any { return ParseSchedulerMetrics(b) }},
+		{"partitions_cpu", func(b []byte) any {
+			p := map[string]*PartitionMetrics{}
+			parsePartitionCPUs(b, p)
+			return p
+		}},
+		{"partitions_gpu", func(b []byte) any {
+			p := map[string]*PartitionMetrics{}
+			parsePartitionGPUs(b, p)
+			return p
+		}},
+		{"squeue_jobs", func(b []byte) any {
+			return []any{
+				ParseAccountsMetrics(projectAccountsView(b)),
+				ParseUsersMetrics(projectUsersView(b)),
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.parse(readCLIFixture(t, tt.name))
+			got := tt.parse(restRender(t, c, tt.name))
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+// TestRESTSourceSqueueJobsText checks the squeue rendering byte for byte: the
+// projections behind the per-job collectors split it by column position.
+func TestRESTSourceSqueueJobsText(t *testing.T) {
+	c := restStandIn(t)
+	assert.Equal(t, string(readCLIFixture(t, "squeue_jobs")), string(restRender(t, c, "squeue_jobs")))
+}
+
+// TestRESTSourceGPUsSnapshot is not in the equivalence table: the 24.11.7
+// capture lists the gpu nodes once per partition, which a snapshot that counts
+// each node once does not reproduce. The values are the cluster's: 40 GPUs,
+// none allocated.
+func TestRESTSourceGPUsSnapshot(t *testing.T) {
+	c := restStandIn(t)
+	gm := computeGPUsFromSnapshot(restRender(t, c, "gpus_snapshot"))
+	assert.Equal(t, 40.0, gm.total)
+	assert.Equal(t, 0.0, gm.alloc)
+	assert.Equal(t, 40.0, gm.idle)
+	assert.Equal(t, 0.0, gm.other)
+}
+
+func TestRESTSourceLicenses(t *testing.T) {
+	c := restStandIn(t)
+	want, err := os.ReadFile(filepath.Join(testDataDir, "licenses.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, ParseLicenseMetrics(want), ParseLicenseMetrics(restRender(t, c, "licenses")))
+}
+
+// TestRESTSourceReservations compares the timestamps against the JSON epochs
+// rather than the capture: the capture's wall-clock times are in the zone of
+// the host that took it, the JSON's are absolute.
+func TestRESTSourceReservations(t *testing.T) {
+	c := restStandIn(t)
+	data, err := os.ReadFile(filepath.Join(testDataDir, "reservations.txt"))
+	require.NoError(t, err)
+	want, err := parseReservations(data)
+	require.NoError(t, err)
+	got, err := parseReservations(restRender(t, c, "reservations"))
+	require.NoError(t, err)
+	require.Len(t, got, len(want))
+
+	assert.Equal(t, time.Unix(1756191600, 0), got[0].StartTime)
+	assert.Equal(t, time.Unix(1756497600, 0), got[0].EndTime)
+	for i := range got {
+		got[i].StartTime, got[i].EndTime = time.Time{}, time.Time{}
+		want[i].StartTime, want[i].EndTime = time.Time{}, time.Time{}
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestRenderReservations_State(t *testing.T) {
+	r := []slurmrest.Reservation{{
+		Name:      "maint",
+		StartTime: slurmrest.Number{Set: true, Number: 1000},
+		EndTime:   slurmrest.Number{Set: true, Number: 2000},
+	}}
+	active, err := parseReservations(renderReservations(r, time.Unix(1500, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, "ACTIVE", active[0].State)
+
+	ended, err := parseReservations(renderReservations(r, time.Unix(2000, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, "INACTIVE", ended[0].State)
+
+	none, err := parseReservations(renderReservations(nil, time.Unix(0, 0)))
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestRESTSourceBinaryVersion(t *testing.T) {
+	c := restStandIn(t)
+	assert.Equal(t, "slurm 24.11.7\n", string(restRender(t, c, "binary_version")))
+}
+
+func TestRESTSourceControllerPing(t *testing.T) {
+	c := restStandIn(t)
+	out := restRender(t, c, "controller_ping")
+	assert.Equal(t, "Slurmctld(primary) at slurmctld is UP\n", string(out))
+	assert.Equal(t, []ControllerState{{Role: "primary", Host: "slurmctld", Up: true}}, parsePing(out))
+}
+
+// TestRESTSourceCoversRegistry makes adding a Slurm call a decision about the
+// REST path too: every registry entry needs a renderer or a stated reason why
+// there is none, never both.
+func TestRESTSourceCoversRegistry(t *testing.T) {
+	for _, cmd := range CommandRegistry {
+		_, rendered := restRenderers[cmd.Name]
+		_, unsupported := restUnsupported[cmd.Name]
+		assert.Truef(t, rendered != unsupported,
+			"%s must be in exactly one of restRenderers and restUnsupported", cmd.Name)
+	}
+	for name := range restRenderers {
+		assert.NotNilf(t, registryEntry(name), "restRenderers has %s, which is not in CommandRegistry", name)
+	}
+	for name := range restUnsupported {
+		assert.NotNilf(t, registryEntry(name), "restUnsupported has %s, which is not in CommandRegistry", name)
+	}
+}
+
+func registryEntry(name string) *Command {
+	for i := range CommandRegistry {
+		if CommandRegistry[i].Name == name {
+			return &CommandRegistry[i]
+		}
+	}
+	return nil
+}
+
+// TestRESTSourceRun goes through the DataSource the way Execute does, from the
+// binary and arguments a collector passes.
+func TestRESTSourceRun(t *testing.T) {
+	src := NewRESTSource(restStandIn(t))
+
+	out, err := src.Run(context.Background(), "sinfo", []string{"-h", "-o", "%C"})
+	require.NoError(t, err)
+	assert.Equal(t, string(readCLIFixture(t, "cpus")), string(out))
+
+	_, err = src.Run(context.Background(), "sshare", registryEntry("fairshare").Args)
+	require.ErrorIs(t, err, ErrNoRESTEquivalent)
+	assert.Contains(t, err.Error(), "fairshare")
+
+	_, err = src.Run(context.Background(), "sinfo", []string{"--not-a-registered-call"})
+	require.ErrorIs(t, err, ErrNoRESTEquivalent)
+}
+
+// TestRESTSourceSharesFetches renders every command a scrape issues,
+// concurrently as the collectors do, and checks that slurmrestd sees each endpoint once.
+func TestRESTSourceSharesFetches(t *testing.T) {
+	c, hits := countingRESTStandIn(t)
+	api := NewRESTSource(c).(*restSource).api
+
+	scrape := func() {
+		var wg sync.WaitGroup
+		for name, render := range restRenderers {
+			wg.Go(func() {
+				_, err := render(context.Background(), api)
+				assert.NoErrorf(t, err, "%s", name)
+			})
+		}
+		wg.Wait()
+	}
+
+	scrape()
+	scrape()
+	for _, endpoint := range []string{"jobs", "nodes", "partitions", "reservations", "licenses", "diag", "ping"} {
+		assert.Equalf(t, 1, hits(endpoint), "GET /%s", endpoint)
+	}
+
+	// Past the TTL, the next scrape fetches afresh.
+	for _, e := range api.entries {
+		e.fetchAt = e.fetchAt.Add(-api.ttl)
+	}
+	scrape()
+	assert.Equal(t, 2, hits("nodes"))
+	assert.Equal(t, 2, hits("jobs"))
+}
+
+// TestExecuteUsesDataSource checks that Execute goes through the configured
+// source and keeps the per-command metrics for it.
+func TestExecuteUsesDataSource(t *testing.T) {
+	old, oldTimeout := dataSource, CommandTimeout()
+	t.Cleanup(func() {
+		SetDataSource(old)
+		SetCommandTimeout(oldTimeout)
+	})
+	SetDataSource(NewRESTSource(restStandIn(t)))
+	SetCommandTimeout(5 * time.Second)
+
+	log, _ := bufferLogger()
+	out, err := Execute(context.Background(), log, "sinfo", []string{"-h", "-o", "%C"})
+	require.NoError(t, err)
+	assert.Equal(t, string(readCLIFixture(t, "cpus")), string(out))
+
+	_, err = Execute(context.Background(), log, "sshare", registryEntry("fairshare").Args)
+	assert.ErrorIs(t, err, ErrNoRESTEquivalent)
+}
+
+func TestSinfoStateLong(t *testing.T) {
+	tests := []struct {
+		states []string
+		want   string
+	}{
+		{[]string{"IDLE"}, "idle"},
+		{[]string{"IDLE", "DYNAMIC_NORM"}, "idle"},
+		{[]string{"MIXED"}, "mixed"},
+		{[]string{"ALLOCATED"}, "allocated"},
+		{[]string{"IDLE", "DRAIN"}, "drained"},
+		{[]string{"MIXED", "DRAIN"}, "draining"},
+		{[]string{"ALLOCATED", "DRAIN"}, "draining"},
+		{[]string{"IDLE", "DRAIN", "NOT_RESPONDING"}, "drained*"},
+		{[]string{"DOWN", "NOT_RESPONDING"}, "down*"},
+		{[]string{"IDLE", "POWERED_DOWN"}, "idle~"},
+		{[]string{"IDLE", "COMPLETING"}, "completing"},
+		{[]string{"MIXED", "PLANNED"}, "mixed-"},
+		{[]string{"IDLE", "PLANNED"}, "planned"},
+		{[]string{"IDLE", "RESERVED"}, "reserved"},
+		{[]string{"IDLE", "MAINTENANCE"}, "maint"},
+		{[]string{"IDLE", "FAIL"}, "fail"},
+		{[]string{"MIXED", "FAIL"}, "failing"},
+		{[]string{"DOWN", "INVALID_REG"}, "inval"},
+		{nil, "unknown"},
+	}
+	for _, tt := range tests {
+		assert.Equalf(t, tt.want, sinfoStateLong(tt.states), "%v", tt.states)
+	}
+}
+
+func TestExpandArrayTasks(t *testing.T) {
+	assert.Equal(t, []int64{1, 2, 3}, expandArrayTasks("1-3"))
+	assert.Equal(t, []int64{1, 2, 3, 8, 10, 12}, expandArrayTasks("1-3,8,10-12:2%4"))
+	assert.Equal(t, []int64{4, 5}, expandArrayTasks("[4-5]"))
+	assert.Nil(t, expandArrayTasks("3-1"))
+	assert.Nil(t, expandArrayTasks("a-b"))
+}
+
+func TestRenderSqueueJobs_Arrays(t *testing.T) {
+	var jobs []slurmrest.Job
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"job_id": 10, "account": "a", "user_name": "u", "partition": "p",
+		 "job_state": ["PENDING"], "node_count": 1, "cpus": 2, "tres_req_str": "cpu=2",
+		 "array_job_id": {"set": true, "number": 10}, "array_task_id": {"set": false},
+		 "array_task_string": "3-4"},
+		{"job_id": 12, "account": "a", "user_name": "u", "partition": "p",
+		 "job_state": ["RUNNING"], "node_count": 1, "cpus": 2, "tres_alloc_str": "cpu=2",
+		 "array_job_id": {"set": true, "number": 10}, "array_task_id": {"set": true, "number": 1}},
+		{"job_id": 13, "account": "a", "user_name": "u", "partition": "p",
+		 "job_state": ["COMPLETED"], "node_count": 1, "cpus": 2}
+	]`), &jobs))
+	assert.Equal(t,
+		"10_3|a|u|p|PENDING|1|2|cpu=2\n"+
+			"10_4|a|u|p|PENDING|1|2|cpu=2\n"+
+			"10_1|a|u|p|RUNNING|1|2|cpu=2\n",
+		string(renderSqueueJobs(jobs)))
+}
+
+func TestRenderRunningJobs(t *testing.T) {
+	var jobs []slurmrest.Job
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"job_id": 20, "account": "a", "user_name": "u", "partition": "p", "qos": "normal",
+		 "name": "train", "job_state": ["RUNNING"], "node_count": 2, "cpus": 16,
+		 "tres_alloc_str": "cpu=16,mem=32G,gres/gpu=2", "nodes": "n[1-2]",
+		 "start_time": {"set": true, "number": 0}, "time_limit": {"set": true, "number": 90},
+		 "wckey": "w", "comment": "x | y"},
+		{"job_id": 21, "account": "a", "user_name": "u", "partition": "p", "qos": "normal",
+		 "name": "idle", "job_state": ["PENDING"], "node_count": 1, "cpus": 1},
+		{"job_id": 22, "account": "a", "user_name": "u", "partition": "p", "qos": "normal",
+		 "name": "long", "job_state": ["RUNNING"], "node_count": 1, "cpus": 1, "nodes": "n3",
+		 "time_limit": {"set": true, "infinite": true, "number": 0}}
+	]`), &jobs))
+	got := parseRunningJobs(renderRunningJobs(jobs))
+	require.Len(t, got, 2, "only running jobs")
+	assert.Equal(t, "20", got[0].ID)
+	assert.Equal(t, 2.0, got[0].GPUs)
+	assert.Equal(t, 32.0*1024*1024*1024, got[0].MemoryBytes)
+	assert.Equal(t, 90*60.0, got[0].TimeLimit)
+	assert.Equal(t, map[string]string{
+		"nodelist": "n[1-2]", "qos": "normal", "wckey": "w", "name": "train", "comment": "x | y",
+	}, got[0].Fields)
+	assert.Zero(t, got[1].TimeLimit, "UNLIMITED")
+	assert.Empty(t, got[1].Fields["wckey"])
+}
+
+func TestRenderJobWait(t *testing.T) {
+	var jobs []slurmrest.Job
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"job_id": 30, "account": "a", "partition": "p", "job_state": ["RUNNING"],
+		 "submit_time": {"set": true, "number": 1773734400}, "start_time": {"set": true, "number": 1773735000}},
+		{"job_id": 31, "account": "a", "partition": "p", "job_state": ["PENDING"],
+		 "submit_time": {"set": true, "number": 1773734400}}
+	]`), &jobs))
+	assert.Equal(t, []JobStart{{ID: "30", Partition: "p", Account: "a", Start: time.Unix(1773735000, 0), Wait: 600}},
+		parseJobStarts(renderJobWait(jobs)))
+}
+
+func TestRenderJobWaitStarted(t *testing.T) {
+	var jobs []slurmrest.Job
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"job_id": 30, "account": "a", "partition": "p", "job_state": ["RUNNING"], "nodes": "n1",
+		 "submit_time": {"set": true, "number": 1773734400}, "start_time": {"set": true, "number": 1773735000}},
+		{"job_id": 31, "account": "a", "partition": "p", "job_state": ["COMPLETED"], "nodes": "n2",
+		 "submit_time": {"set": true, "number": 1773734400}, "start_time": {"set": true, "number": 1773734700}},
+		{"job_id": 32, "account": "a", "partition": "p", "job_state": ["CANCELLED"],
+		 "submit_time": {"set": true, "number": 1773734400}, "start_time": {"set": true, "number": 1773734800}},
+		{"job_id": 33, "account": "a", "partition": "p", "job_state": ["PENDING"],
+		 "submit_time": {"set": true, "number": 1773734400}}
+	]`), &jobs))
+	got := parseJobStarts(renderJobWaitStarted(jobs))
+	require.Len(t, got, 2, "a job cancelled before it got nodes never started")
+	assert.Equal(t, "30", got[0].ID)
+	assert.Equal(t, JobStart{ID: "31", Partition: "p", Account: "a", Start: time.Unix(1773734700, 0), Wait: 300}, got[1],
+		"a job slurmctld still holds after it ended is reported")
+}
+
+// TestRESTSourceDrainedNode covers what the capture cannot: a drained node's
+// idle CPUs are other, and its reason and timestamp reach the drain collector.
+func TestRESTSourceDrainedNode(t *testing.T) {
+	nodes := []slurmrest.Node{{
+		Name:            "n1",
+		State:           slurmrest.StringList{"IDLE", "DRAIN"},
+		CPUs:            8,
+		Partitions:      slurmrest.StringList{"p"},
+		Reason:          "bad dimm",
+		ReasonChangedAt: slurmrest.Number{Set: true, Number: 1700000000},
+	}}
+	assert.Equal(t, "0/0/8/8\n", string(renderCPUs(nodes)))
+
+	dr := ParseDrainReasonMetrics(renderDrainReason(nodes))
+	require.Len(t, dr, 1)
+	assert.Equal(t, "bad dimm", dr[0].Reason)
+	assert.Equal(t, 1700000000.0, dr[0].SinceUnix)
+}
@@ -318,13 +318,13 @@ func NewSacctEfficiencyCollector(log *logger.Logger, interval, lookback time.Dur
 func (c *SacctEfficiencyCollector) Start(ctx context.Context) {
 	go func() {
 		defer close(c.done)
-		c.refresh()
+		c.refresh(ctx)
 		ticker := time.NewTicker(c.interval)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				c.refresh()
+				c.refresh(ctx)
 			case <-ctx.Done():
 				return
 			}
@@ -339,7 +339,7 @@ func (c *SacctEfficiencyCollector) Done() <-chan struct{} {
 	return c.done
 }
 
-func (c *SacctEfficiencyCollector) refresh() {
+func (c *SacctEfficiencyCollector) refresh(ctx context.Context) {
 	now := time.Now()
 	startTime := now.Add(-c.lookback).Format("2006-01-02T15:04:05")
 	endTime := now.Format("2006-01-02T15:04:05")
@@ -351,7 +351,7 @@ func (c *SacctEfficiencyCollector) refresh() {
 	// rows at all (Slurm bounds a state-filtered search to [starttime, endtime]
 	// and the endtime default does not cover our window). Without it the whole
 	// collector reported nothing, not just memory (issue #143).
-	data, err := Execute(c.logger, "sacct", []string{
+	data, err := Execute(ctx, c.logger, "sacct", []string{
 		"-P", "-n",
 		"--starttime", startTime,
 		"--endtime", endTime,
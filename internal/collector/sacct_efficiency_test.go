@@ -219,7 +219,7 @@ func TestAggregateSacctEfficiency_ExcludesJobsWithoutMaxRSS(t *testing.T) {
 func TestSacctEfficiencyCollector_Collect(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`1|alice|hpc_team|4|01:00:00|03:00:00|04:00:00||2G
 1.batch|||4|01:00:00|00:00:00|04:00:00|1G|
 2|bob|ml_group|8|00:30:00|02:00:00|04:00:00||4G
@@ -260,7 +260,7 @@ func TestSacctEfficiencyCollector_Collect(t *testing.T) {
 func TestSacctEfficiencyCollector_NoMemMetricWithoutData(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		// Allocation lines with ReqMem set but no step line → MaxRSS absent.
 		return []byte(`1|alice|hpc_team|4|01:00:00|03:00:00|04:00:00||2G
 2|bob|ml_group|8|00:30:00|02:00:00|04:00:00||4G
@@ -297,7 +297,7 @@ func TestSacctEfficiencyRefresh_QueryShape(t *testing.T) {
 	oldExecute := Execute
 	var gotArgs []string
 	captured := make(chan struct{}, 1)
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		if command == "sacct" {
 			gotArgs = args
 			select {
@@ -360,7 +360,7 @@ func TestSacctEfficiencyCollector_DoneClosesOnCancel(t *testing.T) {
 		<-c.Done()
 		Execute = oldExecute
 	}()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(""), nil
 	}
 
@@ -394,7 +394,7 @@ func TestSacctEfficiencyCollector_ErrorKeepsPreviousCache(t *testing.T) {
 		Execute = oldExecute
 	}()
 
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		if callCount.Add(1) == 1 {
 			return []byte("1|alice|hpc_team|4|01:00:00|03:00:00|04:00:00||2G\n" +
 				"1.batch|||4|01:00:00|00:00:00|04:00:00|1G|"), nil
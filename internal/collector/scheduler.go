@@ -1,29 +1,38 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
 // Pre-compiled regex patterns for sdiag output line matching.
 // Defined at package level to avoid recompilation on every Collect() call.
 var (
-	schedulerPatternThreads     = regexp.MustCompile(`^Server thread`)
-	schedulerPatternQueue       = regexp.MustCompile(`^Agent queue`)
-	schedulerPatternDBD         = regexp.MustCompile(`^DBD Agent queue size`)
-	schedulerPatternLastCycle   = regexp.MustCompile(`^[\s]+Last cycle$`)
-	schedulerPatternMeanCycle   = regexp.MustCompile(`^[\s]+Mean cycle$`)
-	schedulerPatternCyclesPer   = regexp.MustCompile(`^[\s]+Cycles per`)
-	schedulerPatternDepthMean   = regexp.MustCompile(`^[\s]+Depth Mean$`)
-	schedulerPatternTotalStart  = regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last slurm start\)`)
-	schedulerPatternTotalCycle  = regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last stats cycle start\)`)
-	schedulerPatternTotalHetero = regexp.MustCompile(`^[\s]+Total backfilled heterogeneous job components`)
-	schedulerRPCLineRe          = regexp.MustCompile(`^\s*([A-Za-z0-9_-]*).*count:([0-9]*)\s*ave_time:([0-9]*)\s\s*total_time:([0-9]*)\s*$`)
+	schedulerPatternThreads      = regexp.MustCompile(`^Server thread`)
+	schedulerPatternQueue        = regexp.MustCompile(`^Agent queue`)
+	schedulerPatternAgentCount   = regexp.MustCompile(`^Agent count`)
+	schedulerPatternAgentThreads = regexp.MustCompile(`^Agent thread count`)
+	schedulerPatternDBD          = regexp.MustCompile(`^DBD Agent queue size`)
+	schedulerRPCLineRe           = regexp.MustCompile(`^\s*([A-Za-z0-9_-]*).*count:([0-9]*)\s*ave_time:([0-9]*)\s\s*total_time:([0-9]*)\s*$`)
+	// schedulerPendingRPCLineRe matches one row of the pending RPC table,
+	// which has a count and no times.
+	schedulerPendingRPCLineRe = regexp.MustCompile(`^\s*([A-Z0-9_]+)\s*\(\s*\d+\)\s*count:([0-9]+)\s*$`)
+
+	// The header lines carry a date and no "key:" separator.
+	schedulerPatternServerTime = regexp.MustCompile(`^sdiag output at (.+)$`)
+	schedulerPatternDataSince  = regexp.MustCompile(`^Data since\s+(.+)$`)
+	schedulerPatternLatency    = regexp.MustCompile(`^Latency for 1000 calls to gettimeofday\(\):\s*([0-9]+)`)
+	// schedulerPatternEpoch is the Unix time Slurm 23.02 and later print
+	// after every date of the report.
+	schedulerPatternEpoch = regexp.MustCompile(`\((\d+)\)\s*$`)
 
 	// Job counters (sdiag "Jobs submitted/started/completed/canceled/failed")
 	schedulerPatternJobsSubmitted = regexp.MustCompile(`^Jobs submitted`)
@@ -31,95 +40,225 @@ var (
 	schedulerPatternJobsCompleted = regexp.MustCompile(`^Jobs completed`)
 	schedulerPatternJobsCanceled  = regexp.MustCompile(`^Jobs canceled`)
 	schedulerPatternJobsFailed    = regexp.MustCompile(`^Jobs failed`)
+	schedulerPatternJobsPending   = regexp.MustCompile(`^Jobs pending`)
+	schedulerPatternJobsRunning   = regexp.MustCompile(`^Jobs running`)
+	schedulerPatternJobStatesTime = regexp.MustCompile(`^Job states ts`)
+)
+
+// sdiagTimeLayout is how sdiag prints a date, in the local zone of the host
+// running it.
+const sdiagTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// sdiagSection is the block of sdiag output a line belongs to. "Last cycle",
+// "Max cycle", "Total cycles", "Mean cycle", "Last queue length" and "End of
+// job queue" each appear in two blocks, for the main scheduler and for
+// backfill, and only the block tells them apart.
+type sdiagSection int
+
+const (
+	sdiagHeader sdiagSection = iota
+	sdiagMain
+	sdiagMainExit
+	sdiagBackfill
+	sdiagBackfillExit
+	sdiagRPC
+)
+
+// sdiagSectionOf returns the block a header line opens.
+func sdiagSectionOf(line string) (sdiagSection, bool) {
+	switch {
+	case strings.HasPrefix(line, "Main schedule statistics"):
+		return sdiagMain, true
+	case strings.HasPrefix(line, "Main scheduler exit"):
+		return sdiagMainExit, true
+	case strings.HasPrefix(line, "Backfilling stats"):
+		return sdiagBackfill, true
+	case strings.HasPrefix(line, "Backfill exit"):
+		return sdiagBackfillExit, true
+	case strings.HasPrefix(line, "Remote Procedure Call"), strings.HasPrefix(line, "Pending RPC"):
+		return sdiagRPC, true
+	}
+	return 0, false
+}
+
+// The exit tables, keyed by their sdiag line and mapped to the keys of
+// sdiag --json, which are the reason labels.
+var (
+	schedulerMainExitReasons = map[string]string{
+		"End of job queue":         "end_job_queue",
+		"Hit default_queue_depth":  "default_queue_depth",
+		"Hit sched_max_job_start":  "max_job_start",
+		"Blocked on licenses":      "licenses",
+		"Hit max_rpc_cnt":          "max_rpc_cnt",
+		"Timeout (max_sched_time)": "max_sched_time",
+	}
+	schedulerBackfillExitReasons = map[string]string{
+		"End of job queue":                          "end_job_queue",
+		"Hit bf_max_job_start":                      "bf_max_job_start",
+		"Hit bf_max_job_test":                       "bf_max_job_test",
+		"System state changed":                      "state_changed",
+		"Hit table size limit (bf_node_space_size)": "bf_node_space_size",
+		"Timeout (bf_max_time)":                     "bf_max_time",
+	}
 )
 
 // SchedulerMetrics holds performance statistics from the Slurm scheduler daemon
 type SchedulerMetrics struct {
+	// The report's own dates, in Unix seconds: when slurmctld produced it
+	// and when its counters were last reset.
+	serverTime float64
+	dataSince  float64
+
 	threads                       float64 // Number of scheduler threads
-	queueSize                     float64 // Length of the scheduler queue
+	queueSize                     float64 // Length of the agent queue
+	agentCount                    float64 // Number of agent threads
+	agentThreads                  float64 // Threads the agents started
 	dbdQueueSize                  float64 // Length of the DBD agent queue
 	lastCycle                     float64 // Last scheduler cycle time (microseconds)
+	maxCycle                      float64 // Longest scheduler cycle time (microseconds)
 	meanCycle                     float64 // Mean scheduler cycle time (microseconds)
+	totalCycles                   float64 // Scheduler cycles since the last stats reset
+	meanDepth                     float64 // Mean jobs examined per scheduler cycle
 	cyclePerMinute                float64 // Number of scheduler cycles per minute
+	lastQueueLength               float64 // Pending jobs at the last scheduler cycle
 	backfillLastCycle             float64 // Last backfill cycle time (microseconds)
+	backfillMaxCycle              float64 // Longest backfill cycle time (microseconds)
 	backfillMeanCycle             float64 // Mean backfill cycle time (microseconds)
+	backfillTotalCycles           float64 // Backfill cycles since the last stats reset
+	backfillLastCycleTime         float64 // When the last backfill cycle ran (Unix seconds), 0 for never
 	backfillDepthMean             float64 // Mean backfill depth
+	backfillDepthMeanTry          float64 // Mean backfill depth, jobs it tried to schedule
+	backfillLastDepth             float64 // Jobs examined by the last backfill cycle
+	backfillLastDepthTry          float64 // Jobs the last backfill cycle tried to schedule
+	backfillLastQueueLength       float64 // Pending jobs at the last backfill cycle
+	backfillQueueLengthMean       float64 // Mean pending jobs per backfill cycle
+	backfillLastTableSize         float64 // Time slots in the last backfill cycle's table
+	backfillTableSizeMean         float64 // Mean time slots per backfill cycle
 	totalBackfilledJobsSinceStart float64 // Total backfilled jobs since Slurm start
 	totalBackfilledJobsSinceCycle float64 // Total backfilled jobs since stats cycle start
 	totalBackfilledHeterogeneous  float64 // Total backfilled heterogeneous job components
+	gettimeofdayLatency           float64 // Time 1000 gettimeofday() calls took (microseconds)
 	// Job lifecycle counters, all since the last stats reset.
-	jobsSubmitted         float64
-	jobsStarted           float64 // dispatched
-	jobsCompleted         float64
-	jobsCanceled          float64
-	jobsFailed            float64
+	jobsSubmitted float64
+	jobsStarted   float64 // dispatched
+	jobsCompleted float64
+	jobsCanceled  float64
+	jobsFailed    float64
+	// The job states, counted by slurmctld at jobStatesTime.
+	jobsPending   float64
+	jobsRunning   float64
+	jobStatesTime float64
+	// Cycles by the reason they ended, keyed by the sdiag --json names.
+	mainExits             map[string]float64
+	backfillExits         map[string]float64
 	rpcStatsCount         map[string]float64 // RPC call counts by operation
 	rpcStatsAvgTime       map[string]float64 // RPC average times by operation
 	rpcStatsTotalTime     map[string]float64 // RPC total times by operation
 	userRPCStatsCount     map[string]float64 // RPC call counts by user
 	userRPCStatsAvgTime   map[string]float64 // RPC average times by user
 	userRPCStatsTotalTime map[string]float64 // RPC total times by user
+	pendingRPCs           map[string]float64 // RPCs queued for the nodes by operation
 }
 
 // SchedulerData executes the sdiag command to retrieve scheduler statistics
-func SchedulerData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sdiag", nil)
+func SchedulerData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	return Execute(ctx, logger, "sdiag", nil)
 }
 
-// applySchedulerCoreField assigns the simple scalar sdiag fields (thread
-// count, queue depths, scheduling rate). Returns true when the key matched.
+// parseSdiagTime reads a date of the report as Unix seconds: the epoch
+// recent releases print after it when there is one, the date itself in the
+// exporter's local zone otherwise, as for every other Slurm timestamp. N/A,
+// which a backfill scheduler that never ran reports, reads as 0.
+func parseSdiagTime(value string) float64 {
+	value = strings.TrimSpace(value)
+	if m := schedulerPatternEpoch.FindStringSubmatch(value); m != nil {
+		epoch, _ := strconv.ParseFloat(m[1], 64)
+		return epoch
+	}
+	t, err := time.ParseInLocation(sdiagTimeLayout, value, time.Local)
+	if err != nil {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
+// applySchedulerCoreField assigns the simple scalar sdiag fields of the
+// header (thread count, queue depths). Returns true when the key matched.
 func applySchedulerCoreField(sm *SchedulerMetrics, key string, value float64) bool {
 	switch {
 	case schedulerPatternThreads.MatchString(key):
 		sm.threads = value
 	case schedulerPatternQueue.MatchString(key):
 		sm.queueSize = value
+	case schedulerPatternAgentThreads.MatchString(key):
+		sm.agentThreads = value
+	case schedulerPatternAgentCount.MatchString(key):
+		sm.agentCount = value
 	case schedulerPatternDBD.MatchString(key):
 		sm.dbdQueueSize = value
-	case schedulerPatternCyclesPer.MatchString(key):
-		sm.cyclePerMinute = value
 	default:
 		return false
 	}
 	return true
 }
 
-// applySchedulerCycleField handles "Last cycle" and "Mean cycle", which both
-// appear twice in sdiag output — first for the main scheduler, then for the
-// backfill scheduler. The counters track which occurrence is being parsed.
-func applySchedulerCycleField(sm *SchedulerMetrics, key string, value float64, lastCycleCount, meanCycleCount *int) bool {
-	switch {
-	case schedulerPatternLastCycle.MatchString(key):
-		if *lastCycleCount == 0 {
-			sm.lastCycle = value
-			*lastCycleCount++
-		} else {
-			sm.backfillLastCycle = value
-		}
-	case schedulerPatternMeanCycle.MatchString(key):
-		if *meanCycleCount == 0 {
-			sm.meanCycle = value
-			*meanCycleCount++
-		} else {
-			sm.backfillMeanCycle = value
-		}
+// applySchedulerMainField assigns the "Main schedule statistics" block.
+func applySchedulerMainField(sm *SchedulerMetrics, key string, value float64) bool {
+	switch key {
+	case "Last cycle":
+		sm.lastCycle = value
+	case "Max cycle":
+		sm.maxCycle = value
+	case "Total cycles":
+		sm.totalCycles = value
+	case "Mean cycle":
+		sm.meanCycle = value
+	case "Mean depth cycle":
+		sm.meanDepth = value
+	case "Cycles per minute":
+		sm.cyclePerMinute = value
+	case "Last queue length":
+		sm.lastQueueLength = value
 	default:
 		return false
 	}
 	return true
 }
 
-// applySchedulerBackfillField assigns the backfill-specific counters.
+// applySchedulerBackfillField assigns the "Backfilling stats" block. "Mean
+// table size" was spelled "Table size mean" by older releases.
 func applySchedulerBackfillField(sm *SchedulerMetrics, key string, value float64) bool {
-	switch {
-	case schedulerPatternDepthMean.MatchString(key):
-		sm.backfillDepthMean = value
-	case schedulerPatternTotalStart.MatchString(key):
+	switch key {
+	case "Total backfilled jobs (since last slurm start)":
 		sm.totalBackfilledJobsSinceStart = value
-	case schedulerPatternTotalCycle.MatchString(key):
+	case "Total backfilled jobs (since last stats cycle start)":
 		sm.totalBackfilledJobsSinceCycle = value
-	case schedulerPatternTotalHetero.MatchString(key):
+	case "Total backfilled heterogeneous job components":
 		sm.totalBackfilledHeterogeneous = value
+	case "Total cycles":
+		sm.backfillTotalCycles = value
+	case "Last cycle":
+		sm.backfillLastCycle = value
+	case "Max cycle":
+		sm.backfillMaxCycle = value
+	case "Mean cycle":
+		sm.backfillMeanCycle = value
+	case "Last depth cycle":
+		sm.backfillLastDepth = value
+	case "Last depth cycle (try sched)":
+		sm.backfillLastDepthTry = value
+	case "Depth Mean":
+		sm.backfillDepthMean = value
+	case "Depth Mean (try depth)":
+		sm.backfillDepthMeanTry = value
+	case "Last queue length":
+		sm.backfillLastQueueLength = value
+	case "Queue length mean":
+		sm.backfillQueueLengthMean = value
+	case "Last table size":
+		sm.backfillLastTableSize = value
+	case "Mean table size", "Table size mean":
+		sm.backfillTableSizeMean = value
 	default:
 		return false
 	}
@@ -127,7 +266,8 @@ func applySchedulerBackfillField(sm *SchedulerMetrics, key string, value float64
 }
 
 // applySchedulerJobsField assigns the job lifecycle counters
-// (submitted / started / completed / canceled / failed).
+// (submitted / started / completed / canceled / failed) and the job states
+// (pending / running).
 func applySchedulerJobsField(sm *SchedulerMetrics, key string, value float64) bool {
 	switch {
 	case schedulerPatternJobsSubmitted.MatchString(key):
@@ -140,40 +280,88 @@ func applySchedulerJobsField(sm *SchedulerMetrics, key string, value float64) bo
 		sm.jobsCanceled = value
 	case schedulerPatternJobsFailed.MatchString(key):
 		sm.jobsFailed = value
+	case schedulerPatternJobsPending.MatchString(key):
+		sm.jobsPending = value
+	case schedulerPatternJobsRunning.MatchString(key):
+		sm.jobsRunning = value
+	default:
+		return false
+	}
+	return true
+}
+
+// applySchedulerHeaderLine reads the lines that are not "key: number": the
+// dates and the gettimeofday() latency. Returns true when the line matched.
+func applySchedulerHeaderLine(sm *SchedulerMetrics, line string) bool {
+	if m := schedulerPatternServerTime.FindStringSubmatch(line); m != nil {
+		sm.serverTime = parseSdiagTime(m[1])
+		return true
+	}
+	if m := schedulerPatternDataSince.FindStringSubmatch(line); m != nil {
+		sm.dataSince = parseSdiagTime(m[1])
+		return true
+	}
+	if m := schedulerPatternLatency.FindStringSubmatch(line); m != nil {
+		sm.gettimeofdayLatency, _ = strconv.ParseFloat(m[1], 64)
+		return true
+	}
+	key, value, found := strings.Cut(line, ":")
+	switch {
+	case found && schedulerPatternJobStatesTime.MatchString(key):
+		sm.jobStatesTime = parseSdiagTime(value)
+	case found && strings.TrimSpace(key) == "Last cycle when":
+		sm.backfillLastCycleTime = parseSdiagTime(value)
 	default:
 		return false
 	}
 	return true
 }
 
-// ParseSchedulerMetrics parses the output of the sdiag command.
-// "Last cycle" and "Mean cycle" appear twice (main scheduler then backfill
-// scheduler); the per-domain helpers below own those two duplications.
+// ParseSchedulerMetrics parses the output of the sdiag command. The main
+// scheduler and backfill blocks share key names, so each line is read in the
+// context of the block it sits in.
 func ParseSchedulerMetrics(input []byte) *SchedulerMetrics {
-	var sm SchedulerMetrics
+	sm := SchedulerMetrics{
+		mainExits:     make(map[string]float64),
+		backfillExits: make(map[string]float64),
+	}
 	lines := strings.Split(string(input), "\n")
 
-	lastCycleCount := 0
-	meanCycleCount := 0
-
+	section := sdiagHeader
 	for _, line := range lines {
-		if !strings.Contains(line, ":") {
+		if s, ok := sdiagSectionOf(line); ok {
+			section = s
 			continue
 		}
-		// SplitN limits to 2 parts so values containing ":" (e.g. timestamps,
-		// "Last cycle when: Wed Apr 12 11:03:21 2017") are not silently truncated.
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) < 2 {
+		if applySchedulerHeaderLine(&sm, line) {
 			continue
 		}
-		key := parts[0]
-		value, _ := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		// Cut at the first ":" so values containing one (e.g. timestamps,
+		// "Last cycle when: Wed Apr 12 11:03:21 2017") are not truncated.
+		rawKey, rawValue, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key := strings.TrimSpace(rawKey)
+		value, _ := strconv.ParseFloat(strings.TrimSpace(rawValue), 64)
 
-		switch {
-		case applySchedulerCoreField(&sm, key, value):
-		case applySchedulerCycleField(&sm, key, value, &lastCycleCount, &meanCycleCount):
-		case applySchedulerBackfillField(&sm, key, value):
-		case applySchedulerJobsField(&sm, key, value):
+		switch section {
+		case sdiagHeader:
+			if !applySchedulerCoreField(&sm, rawKey, value) {
+				applySchedulerJobsField(&sm, rawKey, value)
+			}
+		case sdiagMain:
+			applySchedulerMainField(&sm, key, value)
+		case sdiagMainExit:
+			if reason, ok := schedulerMainExitReasons[key]; ok {
+				sm.mainExits[reason] = value
+			}
+		case sdiagBackfill:
+			applySchedulerBackfillField(&sm, key, value)
+		case sdiagBackfillExit:
+			if reason, ok := schedulerBackfillExitReasons[key]; ok {
+				sm.backfillExits[reason] = value
+			}
 		}
 	}
 
@@ -184,6 +372,7 @@ func ParseSchedulerMetrics(input []byte) *SchedulerMetrics {
 	sm.userRPCStatsCount = rpcStats[3]
 	sm.userRPCStatsAvgTime = rpcStats[4]
 	sm.userRPCStatsTotalTime = rpcStats[5]
+	sm.pendingRPCs = parsePendingRPCs(lines)
 
 	return &sm
 }
@@ -238,13 +427,129 @@ func ParseRPCStats(lines []string) []map[string]float64 {
 	}
 }
 
-// SchedulerGetMetrics retrieves and parses scheduler metrics from Slurm
-func SchedulerGetMetrics(logger *logger.Logger) (*SchedulerMetrics, error) {
-	data, err := SchedulerData(logger)
+// parsePendingRPCs reads the "Pending RPC statistics" table: the RPCs
+// slurmctld's agent has queued for the nodes, by type. It stops at the
+// "Pending RPCs" list that follows, which names the nodes of each one.
+func parsePendingRPCs(lines []string) map[string]float64 {
+	pending := make(map[string]float64)
+	in := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "Pending RPC statistics"):
+			in = true
+			continue
+		case !in:
+			continue
+		case strings.HasPrefix(line, "Pending RPCs"):
+			return pending
+		}
+		if m := schedulerPendingRPCLineRe.FindStringSubmatch(line); m != nil {
+			pending[m[1]], _ = strconv.ParseFloat(m[2], 64)
+		}
+	}
+	return pending
+}
+
+// ParseSchedulerMetricsJSON reads the output of sdiag --json into the same
+// metrics. The main and backfill cycles have their own keys, so nothing
+// depends on which "Last cycle" line comes first.
+func ParseSchedulerMetricsJSON(input []byte) (*SchedulerMetrics, error) {
+	r, err := decodeSlurmJSON[slurmrest.DiagResponse](input)
 	if err != nil {
 		return nil, err
 	}
-	return ParseSchedulerMetrics(data), nil
+	s := &r.Statistics
+	sm := &SchedulerMetrics{
+		serverTime:                    float64(s.ReqTime.Value()),
+		dataSince:                     float64(s.ReqTimeStart.Value()),
+		threads:                       float64(s.ServerThreadCount),
+		queueSize:                     float64(s.AgentQueueSize),
+		agentCount:                    float64(s.AgentCount),
+		agentThreads:                  float64(s.AgentThreadCount),
+		dbdQueueSize:                  float64(s.DBDAgentQueueSize),
+		lastCycle:                     float64(s.ScheduleCycleLast),
+		maxCycle:                      float64(s.ScheduleCycleMax),
+		meanCycle:                     float64(s.ScheduleCycleMean),
+		totalCycles:                   float64(s.ScheduleCycleTotal),
+		meanDepth:                     float64(s.ScheduleCycleMeanDepth),
+		cyclePerMinute:                float64(s.ScheduleCyclePerMinute),
+		lastQueueLength:               float64(s.ScheduleQueueLength),
+		backfillLastCycle:             float64(s.BFCycleLast),
+		backfillMaxCycle:              float64(s.BFCycleMax),
+		backfillMeanCycle:             float64(s.BFCycleMean),
+		backfillTotalCycles:           float64(s.BFCycleCounter),
+		backfillLastCycleTime:         float64(s.BFWhenLastCycle.Value()),
+		backfillDepthMean:             float64(s.BFDepthMean),
+		backfillDepthMeanTry:          float64(s.BFDepthMeanTry),
+		backfillLastDepth:             float64(s.BFLastDepth),
+		backfillLastDepthTry:          float64(s.BFLastDepthTry),
+		backfillLastQueueLength:       float64(s.BFQueueLen),
+		backfillQueueLengthMean:       float64(s.BFQueueLenMean),
+		backfillLastTableSize:         float64(s.BFTableSize),
+		backfillTableSizeMean:         float64(s.BFTableSizeMean),
+		totalBackfilledJobsSinceStart: float64(s.BFBackfilledJobs),
+		totalBackfilledJobsSinceCycle: float64(s.BFLastBackfilledJobs),
+		totalBackfilledHeterogeneous:  float64(s.BFBackfilledHetJobs),
+		gettimeofdayLatency:           float64(s.GettimeofdayLatency),
+		jobsSubmitted:                 float64(s.JobsSubmitted),
+		jobsStarted:                   float64(s.JobsStarted),
+		jobsCompleted:                 float64(s.JobsCompleted),
+		jobsCanceled:                  float64(s.JobsCanceled),
+		jobsFailed:                    float64(s.JobsFailed),
+		jobsPending:                   float64(s.JobsPending),
+		jobsRunning:                   float64(s.JobsRunning),
+		jobStatesTime:                 float64(s.JobStatesTime.Value()),
+		mainExits: map[string]float64{
+			"end_job_queue":       float64(s.ScheduleExit.EndJobQueue),
+			"default_queue_depth": float64(s.ScheduleExit.DefaultQueueDepth),
+			"max_job_start":       float64(s.ScheduleExit.MaxJobStart),
+			"licenses":            float64(s.ScheduleExit.Licenses),
+			"max_rpc_cnt":         float64(s.ScheduleExit.MaxRPCCnt),
+			"max_sched_time":      float64(s.ScheduleExit.MaxSchedTime),
+		},
+		backfillExits: map[string]float64{
+			"end_job_queue":      float64(s.BFExit.EndJobQueue),
+			"bf_max_job_start":   float64(s.BFExit.BFMaxJobStart),
+			"bf_max_job_test":    float64(s.BFExit.BFMaxJobTest),
+			"state_changed":      float64(s.BFExit.StateChanged),
+			"bf_node_space_size": float64(s.BFExit.BFNodeSpaceSize),
+			"bf_max_time":        float64(s.BFExit.BFMaxTime),
+		},
+		rpcStatsCount:         make(map[string]float64, len(s.RPCsByMessageType)),
+		rpcStatsAvgTime:       make(map[string]float64, len(s.RPCsByMessageType)),
+		rpcStatsTotalTime:     make(map[string]float64, len(s.RPCsByMessageType)),
+		userRPCStatsCount:     make(map[string]float64, len(s.RPCsByUser)),
+		userRPCStatsAvgTime:   make(map[string]float64, len(s.RPCsByUser)),
+		userRPCStatsTotalTime: make(map[string]float64, len(s.RPCsByUser)),
+		pendingRPCs:           make(map[string]float64, len(s.PendingRPCs)),
+	}
+	for _, rpc := range s.RPCsByMessageType {
+		sm.rpcStatsCount[rpc.MessageType] = float64(rpc.Count)
+		sm.rpcStatsAvgTime[rpc.MessageType] = float64(rpc.AverageTime.Value())
+		sm.rpcStatsTotalTime[rpc.MessageType] = float64(rpc.TotalTime)
+	}
+	for _, rpc := range s.RPCsByUser {
+		sm.userRPCStatsCount[rpc.User] = float64(rpc.Count)
+		sm.userRPCStatsAvgTime[rpc.User] = float64(rpc.AverageTime.Value())
+		sm.userRPCStatsTotalTime[rpc.User] = float64(rpc.TotalTime)
+	}
+	for _, rpc := range s.PendingRPCs {
+		sm.pendingRPCs[rpc.MessageType] = float64(rpc.Count)
+	}
+	return sm, nil
+}
+
+// SchedulerGetMetrics retrieves and parses scheduler metrics from Slurm, from
+// sdiag --json under --slurm.json=scheduler.
+func SchedulerGetMetrics(ctx context.Context, logger *logger.Logger) (*SchedulerMetrics, error) {
+	return withJSONFallback(ctx, logger, "scheduler", sdiagJSON, ParseSchedulerMetricsJSON,
+		func() (*SchedulerMetrics, error) {
+			data, err := SchedulerData(ctx, logger)
+			if err != nil {
+				return nil, err
+			}
+			return ParseSchedulerMetrics(data), nil
+		})
 }
 
 // SchedulerCollector implements the Prometheus Collector interface for scheduler metrics
@@ -261,18 +566,53 @@ type SchedulerCollector struct {
 	totalBackfilledJobsSinceStart *prometheus.Desc
 	totalBackfilledJobsSinceCycle *prometheus.Desc
 	totalBackfilledHeterogeneous  *prometheus.Desc
+	serverTime                    *prometheus.Desc
+	dataSince                     *prometheus.Desc
+	agentQueueSize                *prometheus.Desc
+	agentCount                    *prometheus.Desc
+	agentThreads                  *prometheus.Desc
+	maxCycle                      *prometheus.Desc
+	totalCycles                   *prometheus.Desc
+	meanDepth                     *prometheus.Desc
+	lastQueueLength               *prometheus.Desc
+	mainExits                     *prometheus.Desc
+	backfillMaxCycle              *prometheus.Desc
+	backfillTotalCycles           *prometheus.Desc
+	backfillLastCycleTime         *prometheus.Desc
+	backfillDepthMeanTry          *prometheus.Desc
+	backfillLastDepth             *prometheus.Desc
+	backfillLastDepthTry          *prometheus.Desc
+	backfillLastQueueLength       *prometheus.Desc
+	backfillQueueLengthMean       *prometheus.Desc
+	backfillLastTableSize         *prometheus.Desc
+	backfillTableSizeMean         *prometheus.Desc
+	backfillExits                 *prometheus.Desc
+	gettimeofdayLatency           *prometheus.Desc
 	jobsSubmitted                 *prometheus.Desc
 	jobsStarted                   *prometheus.Desc
 	jobsCompleted                 *prometheus.Desc
 	jobsCanceled                  *prometheus.Desc
 	jobsFailed                    *prometheus.Desc
+	jobsPending                   *prometheus.Desc
+	jobsRunning                   *prometheus.Desc
+	jobStatesTime                 *prometheus.Desc
 	rpcStatsCount                 *prometheus.Desc
 	rpcStatsAvgTime               *prometheus.Desc
 	rpcStatsTotalTime             *prometheus.Desc
 	userRPCStatsCount             *prometheus.Desc
 	userRPCStatsAvgTime           *prometheus.Desc
 	userRPCStatsTotalTime         *prometheus.Desc
-	logger                        *logger.Logger
+	pendingRPCs                   *prometheus.Desc
+	jobsTotal                     [len(schedulerJobCounters)]*prometheus.Desc
+	rpcStatsCountTotal            *prometheus.Desc
+	rpcStatsTimeTotal             *prometheus.Desc
+	statsResets                   *prometheus.Desc
+	controllerStartTime           *prometheus.Desc
+	counters                      *schedulerCounters
+	// topN limits the users of the per-user RPC families, ranked by call
+	// count. 0 keeps them all.
+	topN   int
+	logger *logger.Logger
 }
 
 func (sc *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -293,18 +633,53 @@ func (sc *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- sc.totalBackfilledJobsSinceStart
 	ch <- sc.totalBackfilledJobsSinceCycle
 	ch <- sc.totalBackfilledHeterogeneous
+	ch <- sc.serverTime
+	ch <- sc.dataSince
+	ch <- sc.agentQueueSize
+	ch <- sc.agentCount
+	ch <- sc.agentThreads
+	ch <- sc.maxCycle
+	ch <- sc.totalCycles
+	ch <- sc.meanDepth
+	ch <- sc.lastQueueLength
+	ch <- sc.mainExits
+	ch <- sc.backfillMaxCycle
+	ch <- sc.backfillTotalCycles
+	ch <- sc.backfillLastCycleTime
+	ch <- sc.backfillDepthMeanTry
+	ch <- sc.backfillLastDepth
+	ch <- sc.backfillLastDepthTry
+	ch <- sc.backfillLastQueueLength
+	ch <- sc.backfillQueueLengthMean
+	ch <- sc.backfillLastTableSize
+	ch <- sc.backfillTableSizeMean
+	ch <- sc.backfillExits
+	ch <- sc.gettimeofdayLatency
+	ch <- sc.jobsPending
+	ch <- sc.jobsRunning
+	ch <- sc.jobStatesTime
 	ch <- sc.rpcStatsCount
 	ch <- sc.rpcStatsAvgTime
 	ch <- sc.rpcStatsTotalTime
 	ch <- sc.userRPCStatsCount
 	ch <- sc.userRPCStatsAvgTime
 	ch <- sc.userRPCStatsTotalTime
+	ch <- sc.pendingRPCs
+	for _, desc := range sc.jobsTotal {
+		ch <- desc
+	}
+	ch <- sc.rpcStatsCountTotal
+	ch <- sc.rpcStatsTimeTotal
+	ch <- sc.statsResets
+	ch <- sc.controllerStartTime
 }
 
-func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) { _ = sc.tryCollect(ch) }
+func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = sc.tryCollect(context.Background(), ch)
+}
 
-func (sc *SchedulerCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	sm, err := SchedulerGetMetrics(sc.logger)
+func (sc *SchedulerCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	sm, err := SchedulerGetMetrics(ctx, sc.logger)
 	if err != nil {
 		sc.logger.Error("Failed to get scheduler metrics", "err", err)
 		return err
@@ -326,6 +701,8 @@ func (sc *SchedulerCollector) tryCollect(ch chan<- prometheus.Metric) error {
 	ch <- prometheus.MustNewConstMetric(sc.totalBackfilledJobsSinceStart, prometheus.GaugeValue, sm.totalBackfilledJobsSinceStart)
 	ch <- prometheus.MustNewConstMetric(sc.totalBackfilledJobsSinceCycle, prometheus.GaugeValue, sm.totalBackfilledJobsSinceCycle)
 	ch <- prometheus.MustNewConstMetric(sc.totalBackfilledHeterogeneous, prometheus.GaugeValue, sm.totalBackfilledHeterogeneous)
+	sc.collectDetail(ch, sm)
+	sc.collectCounters(ch, sm)
 	for rpcType, value := range sm.rpcStatsCount {
 		ch <- prometheus.MustNewConstMetric(sc.rpcStatsCount, prometheus.GaugeValue, value, rpcType)
 	}
@@ -335,24 +712,120 @@ func (sc *SchedulerCollector) tryCollect(ch chan<- prometheus.Metric) error {
 	for rpcType, value := range sm.rpcStatsTotalTime {
 		ch <- prometheus.MustNewConstMetric(sc.rpcStatsTotalTime, prometheus.GaugeValue, value, rpcType)
 	}
-	for user, value := range sm.userRPCStatsCount {
+	// The average time cannot be summed: it keeps the users the call count
+	// keeps, and the "__other__" average is the folded total time over the
+	// folded count.
+	kept := topNKeys(sm.userRPCStatsCount, sc.topN)
+	count := foldKeys(sm.userRPCStatsCount, kept)
+	totalTime := foldKeys(sm.userRPCStatsTotalTime, kept)
+	for user, value := range count {
 		ch <- prometheus.MustNewConstMetric(sc.userRPCStatsCount, prometheus.GaugeValue, value, user)
 	}
 	for user, value := range sm.userRPCStatsAvgTime {
-		ch <- prometheus.MustNewConstMetric(sc.userRPCStatsAvgTime, prometheus.GaugeValue, value, user)
+		if kept == nil || kept[user] {
+			ch <- prometheus.MustNewConstMetric(sc.userRPCStatsAvgTime, prometheus.GaugeValue, value, user)
+		}
 	}
-	for user, value := range sm.userRPCStatsTotalTime {
+	if n := count[OtherLabel]; kept != nil && n > 0 {
+		ch <- prometheus.MustNewConstMetric(sc.userRPCStatsAvgTime, prometheus.GaugeValue, totalTime[OtherLabel]/n, OtherLabel)
+	}
+	for user, value := range totalTime {
 		ch <- prometheus.MustNewConstMetric(sc.userRPCStatsTotalTime, prometheus.GaugeValue, value, user)
 	}
+	for rpcType, value := range sm.pendingRPCs {
+		ch <- prometheus.MustNewConstMetric(sc.pendingRPCs, prometheus.GaugeValue, value, rpcType)
+	}
 
 	return nil
 }
 
-// NewSchedulerCollector creates a new scheduler metrics collector
-func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
+// collectDetail emits the sdiag fields added after the first release of the
+// collector. Times are in seconds, as sdiag's microseconds were not; a date
+// sdiag did not print, by release or because it never happened, is left out
+// rather than reported as 1970.
+func (sc *SchedulerCollector) collectDetail(ch chan<- prometheus.Metric, sm *SchedulerMetrics) {
+	timestamp := func(desc *prometheus.Desc, value float64) {
+		if value > 0 {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		}
+	}
+	timestamp(sc.serverTime, sm.serverTime)
+	timestamp(sc.dataSince, sm.dataSince)
+	timestamp(sc.backfillLastCycleTime, sm.backfillLastCycleTime)
+	// The job states came with their timestamp: without it, the release
+	// does not report them, and 0 would read as an empty queue.
+	if sm.jobStatesTime > 0 {
+		timestamp(sc.jobStatesTime, sm.jobStatesTime)
+		ch <- prometheus.MustNewConstMetric(sc.jobsPending, prometheus.GaugeValue, sm.jobsPending)
+		ch <- prometheus.MustNewConstMetric(sc.jobsRunning, prometheus.GaugeValue, sm.jobsRunning)
+	}
+
+	ch <- prometheus.MustNewConstMetric(sc.agentQueueSize, prometheus.GaugeValue, sm.queueSize)
+	ch <- prometheus.MustNewConstMetric(sc.agentCount, prometheus.GaugeValue, sm.agentCount)
+	ch <- prometheus.MustNewConstMetric(sc.agentThreads, prometheus.GaugeValue, sm.agentThreads)
+	ch <- prometheus.MustNewConstMetric(sc.maxCycle, prometheus.GaugeValue, sm.maxCycle/1e6)
+	ch <- prometheus.MustNewConstMetric(sc.totalCycles, prometheus.GaugeValue, sm.totalCycles)
+	ch <- prometheus.MustNewConstMetric(sc.meanDepth, prometheus.GaugeValue, sm.meanDepth)
+	ch <- prometheus.MustNewConstMetric(sc.lastQueueLength, prometheus.GaugeValue, sm.lastQueueLength)
+	ch <- prometheus.MustNewConstMetric(sc.backfillMaxCycle, prometheus.GaugeValue, sm.backfillMaxCycle/1e6)
+	ch <- prometheus.MustNewConstMetric(sc.backfillTotalCycles, prometheus.GaugeValue, sm.backfillTotalCycles)
+	ch <- prometheus.MustNewConstMetric(sc.backfillDepthMeanTry, prometheus.GaugeValue, sm.backfillDepthMeanTry)
+	ch <- prometheus.MustNewConstMetric(sc.backfillLastDepth, prometheus.GaugeValue, sm.backfillLastDepth)
+	ch <- prometheus.MustNewConstMetric(sc.backfillLastDepthTry, prometheus.GaugeValue, sm.backfillLastDepthTry)
+	ch <- prometheus.MustNewConstMetric(sc.backfillLastQueueLength, prometheus.GaugeValue, sm.backfillLastQueueLength)
+	ch <- prometheus.MustNewConstMetric(sc.backfillQueueLengthMean, prometheus.GaugeValue, sm.backfillQueueLengthMean)
+	ch <- prometheus.MustNewConstMetric(sc.backfillLastTableSize, prometheus.GaugeValue, sm.backfillLastTableSize)
+	ch <- prometheus.MustNewConstMetric(sc.backfillTableSizeMean, prometheus.GaugeValue, sm.backfillTableSizeMean)
+	ch <- prometheus.MustNewConstMetric(sc.gettimeofdayLatency, prometheus.GaugeValue, sm.gettimeofdayLatency/1e6)
+	for reason, value := range sm.mainExits {
+		ch <- prometheus.MustNewConstMetric(sc.mainExits, prometheus.GaugeValue, value, reason)
+	}
+	for reason, value := range sm.backfillExits {
+		ch <- prometheus.MustNewConstMetric(sc.backfillExits, prometheus.GaugeValue, value, reason)
+	}
+}
+
+// inheritState shares the _total counters of prev, so a reload neither
+// restarts them nor, with both instances briefly scraped, counts a delta
+// twice.
+func (sc *SchedulerCollector) inheritState(prev prometheus.Collector) {
+	if p, ok := prev.(*SchedulerCollector); ok {
+		sc.counters = p.counters
+	}
+}
+
+// NewSchedulerCollector creates a new scheduler metrics collector. topN, when
+// positive, keeps the topN users of the per-user RPC families and folds the
+// rest into user="__other__".
+func NewSchedulerCollector(logger *logger.Logger, topN int) *SchedulerCollector {
 	rpcLabels := []string{"operation"}
 	userRPCLabels := []string{"user"}
+	var jobsTotal [len(schedulerJobCounters)]*prometheus.Desc
+	for i, name := range schedulerJobCounters {
+		jobsTotal[i] = prometheus.NewDesc(
+			"slurm_scheduler_jobs_"+name+"_total",
+			"Jobs "+name+", from the sdiag counter of the same name carried across its resets",
+			nil, nil)
+	}
 	return &SchedulerCollector{
+		jobsTotal: jobsTotal,
+		rpcStatsCountTotal: prometheus.NewDesc(
+			"slurm_rpc_stats_total",
+			"RPC calls by operation, from the sdiag table carried across its resets",
+			rpcLabels, nil),
+		rpcStatsTimeTotal: prometheus.NewDesc(
+			"slurm_rpc_stats_time_seconds_total",
+			"Time slurmctld spent in RPCs by operation, from the sdiag table carried across its resets",
+			rpcLabels, nil),
+		statsResets: prometheus.NewDesc(
+			"slurm_scheduler_stats_reset_total",
+			"Resets of the sdiag statistics seen since the exporter started: daily, on restart or on sdiag --reset",
+			nil, nil),
+		controllerStartTime: prometheus.NewDesc(
+			"slurm_controller_start_time_seconds",
+			"When slurmctld last started, in Unix seconds, taken from the last sdiag reset away from midnight UTC",
+			nil, nil),
+		counters: newSchedulerCounters(),
 		jobsSubmitted: prometheus.NewDesc(
 			"slurm_scheduler_jobs_submitted",
 			"Jobs submitted to the scheduler since last stats reset (sdiag). Value resets on slurmctld restart or scontrol reconfigure.",
@@ -379,7 +852,7 @@ func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
 			nil, nil),
 		queueSize: prometheus.NewDesc(
 			"slurm_scheduler_queue_size",
-			"Length of the scheduler queue reported by sdiag",
+			"Length of the agent queue reported by sdiag. Deprecated: the same value as slurm_scheduler_agent_queue_size",
 			nil, nil),
 		dbdQueueSize: prometheus.NewDesc(
 			"slurm_scheduler_dbd_queue_size",
@@ -421,6 +894,110 @@ func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
 			"slurm_scheduler_backfilled_heterogeneous_total",
 			"Heterogeneous job components started via backfilling since last Slurm start, reported by sdiag",
 			nil, nil),
+		serverTime: prometheus.NewDesc(
+			"slurm_scheduler_server_time_seconds",
+			"Clock of slurmctld when it produced the sdiag report, in Unix seconds",
+			nil, nil),
+		dataSince: prometheus.NewDesc(
+			"slurm_scheduler_data_since_timestamp_seconds",
+			"Start of the period the sdiag counters cover, their last reset, in Unix seconds",
+			nil, nil),
+		agentQueueSize: prometheus.NewDesc(
+			"slurm_scheduler_agent_queue_size",
+			"RPCs queued for slurmctld's agent to send to the nodes, reported by sdiag",
+			nil, nil),
+		agentCount: prometheus.NewDesc(
+			"slurm_scheduler_agents",
+			"Agents slurmctld runs to send RPCs to the nodes, reported by sdiag",
+			nil, nil),
+		agentThreads: prometheus.NewDesc(
+			"slurm_scheduler_agent_threads",
+			"Threads the agents run, reported by sdiag",
+			nil, nil),
+		maxCycle: prometheus.NewDesc(
+			"slurm_scheduler_max_cycle_seconds",
+			"Longest scheduler cycle since the last stats reset, reported by sdiag",
+			nil, nil),
+		totalCycles: prometheus.NewDesc(
+			"slurm_scheduler_cycles",
+			"Scheduler cycles since the last stats reset, reported by sdiag",
+			nil, nil),
+		meanDepth: prometheus.NewDesc(
+			"slurm_scheduler_mean_depth",
+			"Mean number of jobs a scheduler cycle examined, reported by sdiag",
+			nil, nil),
+		lastQueueLength: prometheus.NewDesc(
+			"slurm_scheduler_last_queue_length",
+			"Pending jobs the last scheduler cycle had in its queue, reported by sdiag",
+			nil, nil),
+		mainExits: prometheus.NewDesc(
+			"slurm_scheduler_cycle_exits",
+			"Scheduler cycles since the last stats reset, by the reason they ended, reported by sdiag",
+			[]string{"reason"}, nil),
+		backfillMaxCycle: prometheus.NewDesc(
+			"slurm_scheduler_backfill_max_cycle_seconds",
+			"Longest backfill cycle since the last stats reset, reported by sdiag",
+			nil, nil),
+		backfillTotalCycles: prometheus.NewDesc(
+			"slurm_scheduler_backfill_cycles",
+			"Backfill cycles since the last stats reset, reported by sdiag",
+			nil, nil),
+		backfillLastCycleTime: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_cycle_timestamp_seconds",
+			"When the last backfill cycle ran, in Unix seconds, reported by sdiag",
+			nil, nil),
+		backfillDepthMeanTry: prometheus.NewDesc(
+			"slurm_scheduler_backfill_depth_mean_try_sched",
+			"Mean number of jobs a backfill cycle tried to schedule, reported by sdiag",
+			nil, nil),
+		backfillLastDepth: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_depth",
+			"Jobs the last backfill cycle examined, reported by sdiag",
+			nil, nil),
+		backfillLastDepthTry: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_depth_try_sched",
+			"Jobs the last backfill cycle tried to schedule, reported by sdiag",
+			nil, nil),
+		backfillLastQueueLength: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_queue_length",
+			"Pending jobs the last backfill cycle had in its queue, reported by sdiag",
+			nil, nil),
+		backfillQueueLengthMean: prometheus.NewDesc(
+			"slurm_scheduler_backfill_queue_length_mean",
+			"Mean number of pending jobs in a backfill cycle's queue, reported by sdiag",
+			nil, nil),
+		backfillLastTableSize: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_table_size",
+			"Time slots in the last backfill cycle's node space table, reported by sdiag",
+			nil, nil),
+		backfillTableSizeMean: prometheus.NewDesc(
+			"slurm_scheduler_backfill_table_size_mean",
+			"Mean number of time slots in a backfill cycle's node space table, reported by sdiag",
+			nil, nil),
+		backfillExits: prometheus.NewDesc(
+			"slurm_scheduler_backfill_cycle_exits",
+			"Backfill cycles since the last stats reset, by the reason they ended, reported by sdiag",
+			[]string{"reason"}, nil),
+		gettimeofdayLatency: prometheus.NewDesc(
+			"slurm_scheduler_gettimeofday_latency_seconds",
+			"Time 1000 calls to gettimeofday() took on the slurmctld host, reported by sdiag",
+			nil, nil),
+		jobsPending: prometheus.NewDesc(
+			"slurm_scheduler_jobs_pending",
+			"Pending jobs when slurmctld last counted the job states, reported by sdiag",
+			nil, nil),
+		jobsRunning: prometheus.NewDesc(
+			"slurm_scheduler_jobs_running",
+			"Running jobs when slurmctld last counted the job states, reported by sdiag",
+			nil, nil),
+		jobStatesTime: prometheus.NewDesc(
+			"slurm_scheduler_job_states_timestamp_seconds",
+			"When slurmctld last counted the pending and running jobs, in Unix seconds, reported by sdiag",
+			nil, nil),
+		pendingRPCs: prometheus.NewDesc(
+			"slurm_rpc_pending",
+			"RPCs queued for the nodes and not sent yet, by operation, reported by sdiag",
+			rpcLabels, nil),
 		rpcStatsCount: prometheus.NewDesc(
 			"slurm_rpc_stats",
 			"RPC call count by operation, reported by sdiag",
@@ -445,6 +1022,7 @@ func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
 			"slurm_user_rpc_stats_total_time",
 			"RPC total time per user, reported by sdiag",
 			userRPCLabels, nil),
+		topN:   topN,
 		logger: logger,
 	}
 }
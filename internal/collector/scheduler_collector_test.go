@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -17,12 +18,12 @@ func TestSchedulerCollector_Collect(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return data, nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewSchedulerCollector(log)
+	c := NewSchedulerCollector(log, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 
@@ -39,30 +40,70 @@ func TestSchedulerCollector_Collect(t *testing.T) {
 	assert.True(t, names["slurm_scheduler_backfill_last_cycle"])
 	assert.True(t, names["slurm_scheduler_jobs_submitted"])
 	assert.True(t, names["slurm_scheduler_jobs_completed"])
+	assert.True(t, names["slurm_scheduler_agent_queue_size"])
+	assert.True(t, names["slurm_scheduler_backfill_table_size_mean"])
+	// This sdiag predates the job states: no pending or running count
+	// rather than an empty queue.
+	assert.False(t, names["slurm_scheduler_jobs_pending"])
+	assert.False(t, names["slurm_scheduler_job_states_timestamp_seconds"])
+}
+
+func TestSchedulerCollector_CollectFull(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scheduler_full.txt")
+	require.NoError(t, err)
+
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
+		return data, nil
+	}
+
+	c := NewSchedulerCollector(logger.NewLogger("error"), 0)
+	assert.Equal(t, []string{
+		`slurm_scheduler_max_cycle_seconds{} 2.915407`,
+	}, gatheredSeries(t, c, "slurm_scheduler_max_cycle_seconds"))
+	assert.Equal(t, []string{
+		`slurm_scheduler_gettimeofday_latency_seconds{} 2.1e-05`,
+	}, gatheredSeries(t, c, "slurm_scheduler_gettimeofday_latency_seconds"))
+	assert.Equal(t, []string{
+		`slurm_scheduler_jobs_pending{} 2841`,
+	}, gatheredSeries(t, c, "slurm_scheduler_jobs_pending"))
+	assert.Equal(t, []string{
+		`slurm_scheduler_backfill_last_cycle_timestamp_seconds{} 1.7737573e+09`,
+	}, gatheredSeries(t, c, "slurm_scheduler_backfill_last_cycle_timestamp_seconds"))
+	assert.Contains(t, gatheredSeries(t, c, "slurm_scheduler_cycle_exits"),
+		`slurm_scheduler_cycle_exits{reason="max_rpc_cnt"} 263`)
+	assert.Contains(t, gatheredSeries(t, c, "slurm_scheduler_backfill_cycle_exits"),
+		`slurm_scheduler_backfill_cycle_exits{reason="bf_max_job_test"} 311`)
+	assert.Equal(t, []string{
+		`slurm_rpc_pending{operation="REQUEST_BATCH_JOB_LAUNCH"} 5`,
+		`slurm_rpc_pending{operation="REQUEST_LAUNCH_PROLOG"} 9`,
+		`slurm_rpc_pending{operation="REQUEST_TERMINATE_JOB"} 23`,
+	}, gatheredSeries(t, c, "slurm_rpc_pending"))
 }
 
 func TestSchedulerCollector_Describe(t *testing.T) {
 	log := logger.NewLogger("error")
-	c := NewSchedulerCollector(log)
-	ch := make(chan *prometheus.Desc, 30)
+	c := NewSchedulerCollector(log, 0)
+	ch := make(chan *prometheus.Desc, 64)
 	c.Describe(ch)
 	close(ch)
 	count := 0
 	for range ch {
 		count++
 	}
-	assert.GreaterOrEqual(t, count, 18)
+	assert.GreaterOrEqual(t, count, 49)
 }
 
 func TestSchedulerCollector_ErrorHandling(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
 	log := logger.NewLogger("error")
-	c := NewSchedulerCollector(log)
+	c := NewSchedulerCollector(log, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 	mfs, err := reg.Gather()
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dailyResetWindow is how long after midnight UTC a reset of the sdiag
+// statistics is taken for slurmctld's own daily one: it runs from the
+// background loop, which can be a few seconds late.
+const dailyResetWindow = time.Minute
+
+// schedulerJobCounters are the sdiag job counters, in the order
+// schedulerCounterValues.jobs holds them.
+var schedulerJobCounters = [...]string{"submitted", "started", "completed", "canceled", "failed"}
+
+// schedulerCounters turns the cumulative sdiag statistics into counters that
+// only go up. slurmctld zeroes its job counters at midnight UTC, on restart
+// and on sdiag --reset, which moves "Data since"; the RPC tables survive
+// midnight and are cleared only by the other two. A value that goes down is
+// a reset too, whichever the group. Across a reset the whole current value
+// is new; otherwise only what it gained since the last scrape is added.
+//
+// A reset the collector does not see, between two scrapes, with the counters
+// back above their old values, is still caught by "Data since" for the job
+// counters but not for the RPC tables, which then miss what they had before
+// the reset.
+type schedulerCounters struct {
+	mu   sync.Mutex
+	seen bool
+
+	// The raw sdiag values of the last scrape.
+	dataSince float64
+	jobs      [len(schedulerJobCounters)]float64
+	rpcCount  map[string]float64
+	rpcTime   map[string]float64
+
+	totals schedulerCounterValues
+}
+
+// schedulerCounterValues is a snapshot of the accumulated counters. RPC
+// times are in microseconds, as sdiag prints them.
+type schedulerCounterValues struct {
+	jobs     [len(schedulerJobCounters)]float64
+	rpcCount map[string]float64
+	rpcTime  map[string]float64
+	resets   float64
+	// startTime is when slurmctld started, 0 until a reset away from
+	// midnight has been seen: sdiag does not report it otherwise.
+	startTime float64
+}
+
+func newSchedulerCounters() *schedulerCounters {
+	return &schedulerCounters{
+		totals: schedulerCounterValues{
+			rpcCount: make(map[string]float64),
+			rpcTime:  make(map[string]float64),
+		},
+	}
+}
+
+// isDailyReset reports whether a reset at dataSince is slurmctld's midnight
+// one. Any other reset is a restart or an sdiag --reset, which sdiag cannot
+// tell apart: both start the statistics over from the RPC tables down.
+func isDailyReset(dataSince float64) bool {
+	t := time.Unix(int64(dataSince), 0).UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return t.Sub(midnight) < dailyResetWindow
+}
+
+// update folds one sdiag report into the counters and returns them. The
+// first report only sets the baseline: the counters start at 0 like any
+// counter of a process that just started, so that an exporter restart does
+// not count again, through rate(), everything sdiag had counted before it.
+func (c *schedulerCounters) update(sm *SchedulerMetrics) schedulerCounterValues {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jobs := [...]float64{sm.jobsSubmitted, sm.jobsStarted, sm.jobsCompleted, sm.jobsCanceled, sm.jobsFailed}
+	restart := sm.dataSince > 0 && !isDailyReset(sm.dataSince)
+	if !c.seen {
+		c.seen = true
+		if restart {
+			c.totals.startTime = sm.dataSince
+		}
+		for op := range sm.rpcStatsCount {
+			c.totals.rpcCount[op] = 0
+			c.totals.rpcTime[op] = 0
+		}
+	} else {
+		statsReset := sm.dataSince != c.dataSince
+		for i, v := range jobs {
+			statsReset = statsReset || v < c.jobs[i]
+		}
+		restart = restart && sm.dataSince != c.dataSince
+		rpcReset := restart || decreased(sm.rpcStatsCount, c.rpcCount) || decreased(sm.rpcStatsTotalTime, c.rpcTime)
+		if statsReset || rpcReset {
+			c.totals.resets++
+		}
+		if restart {
+			c.totals.startTime = sm.dataSince
+		}
+
+		for i, v := range jobs {
+			c.totals.jobs[i] += gained(v, c.jobs[i], statsReset)
+		}
+		for op, v := range sm.rpcStatsCount {
+			c.totals.rpcCount[op] += gained(v, c.rpcCount[op], rpcReset)
+		}
+		for op, v := range sm.rpcStatsTotalTime {
+			c.totals.rpcTime[op] += gained(v, c.rpcTime[op], rpcReset)
+		}
+	}
+
+	c.dataSince = sm.dataSince
+	c.jobs = jobs
+	c.rpcCount = maps.Clone(sm.rpcStatsCount)
+	c.rpcTime = maps.Clone(sm.rpcStatsTotalTime)
+
+	out := c.totals
+	out.rpcCount = maps.Clone(c.totals.rpcCount)
+	out.rpcTime = maps.Clone(c.totals.rpcTime)
+	return out
+}
+
+// gained is what a cumulative value added since the last scrape: all of it
+// across a reset.
+func gained(current, previous float64, reset bool) float64 {
+	if reset {
+		return current
+	}
+	return current - previous
+}
+
+// decreased reports whether any value of current is below its previous one.
+// An operation absent from current has not gone down: the table lists only
+// the operations called since its last reset.
+func decreased(current, previous map[string]float64) bool {
+	for k, v := range current {
+		if v < previous[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// collectCounters emits the counters built from one sdiag report.
+func (sc *SchedulerCollector) collectCounters(ch chan<- prometheus.Metric, sm *SchedulerMetrics) {
+	v := sc.counters.update(sm)
+	for i, desc := range sc.jobsTotal {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v.jobs[i])
+	}
+	for op, value := range v.rpcCount {
+		ch <- prometheus.MustNewConstMetric(sc.rpcStatsCountTotal, prometheus.CounterValue, value, op)
+	}
+	for op, value := range v.rpcTime {
+		ch <- prometheus.MustNewConstMetric(sc.rpcStatsTimeTotal, prometheus.CounterValue, value/1e6, op)
+	}
+	ch <- prometheus.MustNewConstMetric(sc.statsResets, prometheus.CounterValue, v.resets)
+	if v.startTime > 0 {
+		ch <- prometheus.MustNewConstMetric(sc.controllerStartTime, prometheus.GaugeValue, v.startTime)
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+const (
+	// midnightUTC is 2026-03-17 00:00:00 UTC, the Data since of
+	// scheduler_full.txt.
+	midnightUTC = 1773705600.0
+	// restartTime is the same day at 09:12:40 UTC.
+	restartTime = midnightUTC + 9*3600 + 12*60 + 40
+)
+
+// sdiagReport builds the counters update reads, with submitted jobs and
+// REQUEST_JOB_INFO calls and time.
+func sdiagReport(dataSince, submitted, jobInfo float64) *SchedulerMetrics {
+	return &SchedulerMetrics{
+		dataSince:         dataSince,
+		jobsSubmitted:     submitted,
+		rpcStatsCount:     map[string]float64{"REQUEST_JOB_INFO": jobInfo},
+		rpcStatsTotalTime: map[string]float64{"REQUEST_JOB_INFO": jobInfo * 100},
+	}
+}
+
+func TestIsDailyReset(t *testing.T) {
+	assert.True(t, isDailyReset(midnightUTC))
+	assert.True(t, isDailyReset(midnightUTC+3), "the background loop runs late")
+	assert.False(t, isDailyReset(midnightUTC+dailyResetWindow.Seconds()))
+	assert.False(t, isDailyReset(restartTime))
+}
+
+func TestSchedulerCounters(t *testing.T) {
+	c := newSchedulerCounters()
+
+	v := c.update(sdiagReport(midnightUTC, 100, 40))
+	assert.Zero(t, v.jobs[0], "the first report is the baseline")
+	assert.Contains(t, v.rpcCount, "REQUEST_JOB_INFO")
+	assert.Zero(t, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Zero(t, v.resets)
+	assert.Zero(t, v.startTime, "a midnight reset says nothing of the start")
+
+	v = c.update(sdiagReport(midnightUTC, 130, 55))
+	assert.Equal(t, 30.0, v.jobs[0])
+	assert.Equal(t, 15.0, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 1500.0, v.rpcTime["REQUEST_JOB_INFO"])
+
+	// The next midnight clears the job counters and leaves the RPC tables.
+	v = c.update(sdiagReport(midnightUTC+86400, 4, 60))
+	assert.Equal(t, 34.0, v.jobs[0])
+	assert.Equal(t, 20.0, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 1.0, v.resets)
+	assert.Zero(t, v.startTime)
+
+	// A restart clears both, and dates the start.
+	v = c.update(sdiagReport(restartTime+86400, 2, 3))
+	assert.Equal(t, 36.0, v.jobs[0])
+	assert.Equal(t, 23.0, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 2300.0, v.rpcTime["REQUEST_JOB_INFO"])
+	assert.Equal(t, 2.0, v.resets)
+	assert.Equal(t, restartTime+86400, v.startTime)
+
+	// A reset between two scrapes that already counted past the old value
+	// is caught by Data since alone.
+	v = c.update(sdiagReport(midnightUTC+2*86400, 9, 7))
+	assert.Equal(t, 45.0, v.jobs[0])
+	assert.Equal(t, 27.0, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 3.0, v.resets)
+	assert.Equal(t, restartTime+86400, v.startTime, "a midnight reset keeps the start")
+
+	// A value going down is a reset even when Data since stays.
+	v = c.update(sdiagReport(midnightUTC+2*86400, 9, 2))
+	assert.Equal(t, 45.0, v.jobs[0])
+	assert.Equal(t, 29.0, v.rpcCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 4.0, v.resets)
+}
+
+func TestSchedulerCounters_FirstReportAfterRestart(t *testing.T) {
+	v := newSchedulerCounters().update(sdiagReport(restartTime, 1, 1))
+	assert.Equal(t, restartTime, v.startTime)
+}
+
+func TestSchedulerCollector_Counters(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scheduler_full.txt")
+	require.NoError(t, err)
+
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
+		return data, nil
+	}
+
+	c := NewSchedulerCollector(logger.NewLogger("error"), 0)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(c))
+	for range 2 {
+		_, err := reg.Gather()
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 0, testutil.CollectAndCount(c, "slurm_controller_start_time_seconds"),
+		"the fixture's statistics were reset at midnight")
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP slurm_scheduler_jobs_failed_total Jobs failed, from the sdiag counter of the same name carried across its resets
+# TYPE slurm_scheduler_jobs_failed_total counter
+slurm_scheduler_jobs_failed_total 0
+# HELP slurm_scheduler_stats_reset_total Resets of the sdiag statistics seen since the exporter started: daily, on restart or on sdiag --reset
+# TYPE slurm_scheduler_stats_reset_total counter
+slurm_scheduler_stats_reset_total 0
+`), "slurm_scheduler_jobs_failed_total", "slurm_scheduler_stats_reset_total"))
+	assert.Equal(t, 9, testutil.CollectAndCount(c, "slurm_rpc_stats_total"))
+	assert.Equal(t, 9, testutil.CollectAndCount(c, "slurm_rpc_stats_time_seconds_total"))
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,6 +27,106 @@ func TestSchedulerMetrics(t *testing.T) {
 	assert.Equal(t, 111544.0, sm.totalBackfilledJobsSinceStart)
 	assert.Equal(t, 793.0, sm.totalBackfilledJobsSinceCycle)
 	assert.Equal(t, 10.0, sm.totalBackfilledHeterogeneous)
+
+	// The backfill block reuses the main block's keys: each must land in
+	// its own field.
+	assert.Equal(t, 1407590.0, sm.maxCycle)
+	assert.Equal(t, 34585.0, sm.totalCycles)
+	assert.Equal(t, 57011.0, sm.lastQueueLength)
+	assert.Equal(t, 5933334.0, sm.backfillMaxCycle)
+	assert.Equal(t, 529.0, sm.backfillTotalCycles)
+	assert.Equal(t, 57064.0, sm.backfillLastQueueLength)
+	assert.Equal(t, 40772.0, sm.backfillQueueLengthMean)
+	assert.Equal(t, 1659.0, sm.backfillDepthMeanTry)
+
+	// This release printed no epoch after its dates: they are local time.
+	date := func(s string) float64 {
+		d, err := time.ParseInLocation(sdiagTimeLayout, s, time.Local)
+		require.NoError(t, err)
+		return float64(d.Unix())
+	}
+	assert.Equal(t, date("Wed Apr 12 11:04:01 2017"), sm.serverTime)
+	assert.Equal(t, date("Wed Apr 12 02:00:00 2017"), sm.dataSince)
+	assert.Equal(t, date("Wed Apr 12 11:03:21 2017"), sm.backfillLastCycleTime)
+	assert.Zero(t, sm.jobStatesTime, "no job states before 23.02")
+	assert.Empty(t, sm.mainExits)
+}
+
+func TestSchedulerMetrics_Full(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scheduler_full.txt")
+	require.NoError(t, err)
+
+	sm := ParseSchedulerMetrics(data)
+
+	assert.Equal(t, 1773757325.0, sm.serverTime)
+	assert.Equal(t, 1773705600.0, sm.dataSince)
+	assert.Equal(t, 12.0, sm.threads)
+	assert.Equal(t, 37.0, sm.queueSize)
+	assert.Equal(t, 4.0, sm.agentCount)
+	assert.Equal(t, 96.0, sm.agentThreads)
+	assert.Equal(t, 3.0, sm.dbdQueueSize)
+	assert.Equal(t, 87.0, sm.jobsFailed)
+
+	assert.Equal(t, 1773757318.0, sm.jobStatesTime)
+	assert.Equal(t, 2841.0, sm.jobsPending)
+	assert.Equal(t, 1630.0, sm.jobsRunning)
+
+	assert.Equal(t, 184233.0, sm.lastCycle)
+	assert.Equal(t, 2915407.0, sm.maxCycle)
+	assert.Equal(t, 26104.0, sm.totalCycles)
+	assert.Equal(t, 412.0, sm.meanDepth)
+	assert.Equal(t, 2790.0, sm.lastQueueLength)
+	assert.Equal(t, map[string]float64{
+		"end_job_queue":       18342,
+		"default_queue_depth": 6917,
+		"max_job_start":       512,
+		"licenses":            41,
+		"max_rpc_cnt":         263,
+		"max_sched_time":      29,
+	}, sm.mainExits)
+
+	assert.Equal(t, 1577.0, sm.backfillTotalCycles)
+	assert.Equal(t, 1773757300.0, sm.backfillLastCycleTime)
+	assert.Equal(t, 8412330.0, sm.backfillLastCycle)
+	assert.Equal(t, 29804117.0, sm.backfillMaxCycle)
+	assert.Equal(t, 2788.0, sm.backfillLastDepth)
+	assert.Equal(t, 611.0, sm.backfillLastDepthTry)
+	assert.Equal(t, 2504.0, sm.backfillDepthMean)
+	assert.Equal(t, 587.0, sm.backfillDepthMeanTry)
+	assert.Equal(t, 2790.0, sm.backfillLastQueueLength)
+	assert.Equal(t, 2611.0, sm.backfillQueueLengthMean)
+	assert.Equal(t, 173.0, sm.backfillLastTableSize)
+	assert.Equal(t, 158.0, sm.backfillTableSizeMean)
+	assert.Equal(t, map[string]float64{
+		"end_job_queue":      1204,
+		"bf_max_job_start":   0,
+		"bf_max_job_test":    311,
+		"state_changed":      48,
+		"bf_node_space_size": 2,
+		"bf_max_time":        12,
+	}, sm.backfillExits)
+
+	assert.Equal(t, 21.0, sm.gettimeofdayLatency)
+
+	assert.Len(t, sm.rpcStatsCount, 9)
+	assert.Equal(t, 97215.0, sm.rpcStatsCount["REQUEST_JOB_INFO"])
+	assert.Equal(t, 18427.0, sm.rpcStatsAvgTime["REQUEST_JOB_INFO"])
+	assert.Len(t, sm.userRPCStatsCount, 5)
+	assert.Equal(t, 82417.0, sm.userRPCStatsCount["svc-pipeline"])
+	assert.Equal(t, 2920960.0, sm.userRPCStatsTotalTime["al-rashid"])
+
+	// The Pending RPCs hostlists below the table are not counts.
+	assert.Equal(t, map[string]float64{
+		"REQUEST_TERMINATE_JOB":    23,
+		"REQUEST_LAUNCH_PROLOG":    9,
+		"REQUEST_BATCH_JOB_LAUNCH": 5,
+	}, sm.pendingRPCs)
+}
+
+func TestParseSdiagTime(t *testing.T) {
+	assert.Equal(t, 1785470428.0, parseSdiagTime("Fri Jul 31 04:00:28 2026 (1785470428)"))
+	assert.Zero(t, parseSdiagTime("N/A"))
+	assert.Zero(t, parseSdiagTime(""))
 }
 
 // TestSchedulerRPCLineRe_HyphenatedUsername is the non-regression test for
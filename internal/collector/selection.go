@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Selection picks the inner collectors one scrape runs, from the collect[] and
+// exclude[] query parameters of /metrics, as node_exporter does. The zero value
+// runs them all.
+//
+// Prometheus can then scrape the expensive collectors, sacct_efficiency or
+// fairshare, every few minutes and nodes every 30s, from one exporter process
+// and separate scrape jobs.
+type Selection struct {
+	// Collect, when not empty, runs only these collectors.
+	Collect []string
+	// Exclude runs every collector but these.
+	Exclude []string
+}
+
+func (s Selection) includes(name string) bool {
+	if len(s.Collect) > 0 {
+		return slices.Contains(s.Collect, name)
+	}
+	return !slices.Contains(s.Exclude, name)
+}
+
+// key identifies the set of collectors s selects, so that scrapes selecting
+// the same set share a coalesced collection and no other.
+func (s Selection) key() string {
+	collect, exclude := slices.Clone(s.Collect), slices.Clone(s.Exclude)
+	slices.Sort(collect)
+	slices.Sort(exclude)
+	return "collect=" + strings.Join(slices.Compact(collect), ",") +
+		";exclude=" + strings.Join(slices.Compact(exclude), ",")
+}
+
+// BindSelection is Bind restricted to the collectors sel selects. Naming a
+// collector that is not enabled is an error rather than an empty scrape, so a
+// misspelt scrape job fails loudly; so is giving both collect[] and exclude[].
+func (st *StatusTracker) BindSelection(ctx context.Context, sel Selection) (prometheus.Collector, error) {
+	if len(sel.Collect) > 0 && len(sel.Exclude) > 0 {
+		return nil, fmt.Errorf("collect[] and exclude[] cannot be combined")
+	}
+	entries, _ := st.snapshot()
+	enabled := make([]string, 0, len(entries))
+	for _, e := range entries {
+		enabled = append(enabled, e.name)
+	}
+	for _, name := range slices.Concat(sel.Collect, sel.Exclude) {
+		if !slices.Contains(enabled, name) {
+			return nil, fmt.Errorf("collector %q is unknown or disabled (enabled: %s)", name, strings.Join(enabled, ", "))
+		}
+	}
+	return boundTracker{st: st, ctx: ctx, sel: sel}, nil
+}
@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelection(t *testing.T) {
+	all := Selection{}
+	only := Selection{Collect: []string{"nodes", "queue"}}
+	but := Selection{Exclude: []string{"sacct_efficiency"}}
+
+	assert.True(t, all.includes("nodes"))
+	assert.True(t, only.includes("queue"))
+	assert.False(t, only.includes("fairshare"))
+	assert.True(t, but.includes("fairshare"))
+	assert.False(t, but.includes("sacct_efficiency"))
+
+	assert.Equal(t, only.key(), Selection{Collect: []string{"queue", "nodes", "queue"}}.key(),
+		"the same set in another order is the same selection")
+	assert.NotEqual(t, only.key(), all.key())
+}
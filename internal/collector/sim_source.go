@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/simulator"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// simSource answers the collectors' commands from a simulated cluster.
+//
+// The simulator hands out its state as the slurmrest types, so most entries
+// are printed by the REST source's renderers, and the --json forms are the
+// same types marshalled. sshare and sacct have no slurmrestd counterpart and
+// are printed here. Each call first brings the cluster up to the wall clock,
+// so consecutive scrapes see it move.
+type simSource struct {
+	cluster *simulator.Cluster
+}
+
+// NewSimulatedSource returns a DataSource backed by a simulated cluster.
+func NewSimulatedSource(c *simulator.Cluster) DataSource {
+	return &simSource{cluster: c}
+}
+
+func (*simSource) Name() string { return "simulate" }
+
+func (s *simSource) Run(_ context.Context, command string, args []string) ([]byte, error) {
+	s.cluster.Sync()
+	for _, f := range JSONForms() {
+		if f.Binary == command && slices.Equal(f.Args, args) {
+			r := simJSONRenderers[f.Name]
+			s.cluster.Query(r.rpc)
+			return json.Marshal(r.render(s.cluster))
+		}
+	}
+	cmd := lookupCommand(command, args)
+	if cmd == nil {
+		return nil, fmt.Errorf("%s %s: not a registered Slurm command, the simulator cannot answer it",
+			command, strings.Join(args, " "))
+	}
+	r, ok := simRenderers[cmd.Name]
+	if !ok {
+		return nil, fmt.Errorf("%s: the simulator has no renderer for this command", cmd.Name)
+	}
+	if r.rpc != "" {
+		s.cluster.Query(r.rpc)
+	}
+	return r.render(s.cluster, args)
+}
+
+// simRenderer prints one registry entry from the cluster, and names the RPC
+// the command costs slurmctld.
+type simRenderer struct {
+	rpc    string
+	render func(c *simulator.Cluster, args []string) ([]byte, error)
+}
+
+func simNodes(render func([]slurmrest.Node) []byte) simRenderer {
+	return simRenderer{"REQUEST_NODE_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return render(c.Nodes()), nil
+	}}
+}
+
+func simJobs(render func([]slurmrest.Job) []byte) simRenderer {
+	return simRenderer{"REQUEST_JOB_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return render(c.Jobs()), nil
+	}}
+}
+
+func simPartitionNodes(render func([]partitionNodes) []byte) simRenderer {
+	return simRenderer{"REQUEST_PARTITION_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return render(groupByPartition(c.Partitions(), c.Nodes())), nil
+	}}
+}
+
+// simRenderers maps registry names to their renderer. Unlike the REST source,
+// the simulator answers every entry; the test enforces it.
+var simRenderers = map[string]simRenderer{
+	"squeue_jobs":          simJobs(renderSqueueJobs),
+	"running_jobs":         simJobs(renderRunningJobs),
+	"job_wait":             simJobs(renderJobWait),
+	"queue_all_states":     simJobs(func(jobs []slurmrest.Job) []byte { return renderQueue(jobs, true) }),
+	"queue_default_states": simJobs(func(jobs []slurmrest.Job) []byte { return renderQueue(jobs, false) }),
+	"cpus":                 simNodes(renderCPUs),
+	"gpus_snapshot":        simNodes(renderGPUsSnapshot),
+	"node_detail":          simNodes(renderNodeDetail),
+	"nodes_global":         simPartitionNodes(renderNodesGlobal),
+	"scontrol_nodes":       simNodes(renderScontrolNodes),
+	"partitions_cpu":       simPartitionNodes(renderPartitionsCPU),
+	"partitions_gpu":       simPartitionNodes(renderPartitionsGPU),
+	"drain_reason":         simNodes(renderDrainReason),
+	"reservations": {"REQUEST_RESERVATION_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return renderReservations(c.Reservations(), c.Now()), nil
+	}},
+	"licenses": {"REQUEST_LICENSE_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return renderLicenses(c.Licenses()), nil
+	}},
+	"scheduler": {"REQUEST_STATS_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		s := c.Statistics()
+		return renderScheduler(&s), nil
+	}},
+	"binary_version": {"", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return []byte("slurm " + c.Version() + "\n"), nil
+	}},
+	"fairshare": {"REQUEST_SHARE_INFO", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return renderSshare(c.Associations()), nil
+	}},
+	"sacct_efficiency": {"", renderSacctWindow},
+	"job_wait_started": {"", renderSacctStarted},
+	"controller_ping": {"REQUEST_PING", func(c *simulator.Cluster, _ []string) ([]byte, error) {
+		return renderPing([]slurmrest.Ping{{Hostname: c.Meta().Slurm.Cluster + "-ctl", Pinged: "UP", Mode: "primary"}}), nil
+	}},
+}
+
+// simJSONRenderer builds the document of one --json form.
+type simJSONRenderer struct {
+	rpc    string
+	render func(c *simulator.Cluster) any
+}
+
+var simJSONRenderers = map[string]simJSONRenderer{
+	"squeue": {"REQUEST_JOB_INFO", func(c *simulator.Cluster) any {
+		return slurmrest.JobsResponse{Response: slurmrest.Response{Meta: c.Meta()}, Jobs: c.Jobs()}
+	}},
+	"scontrol_nodes": {"REQUEST_NODE_INFO", func(c *simulator.Cluster) any {
+		return slurmrest.NodesResponse{Response: slurmrest.Response{Meta: c.Meta()}, Nodes: c.Nodes()}
+	}},
+	"sdiag": {"REQUEST_STATS_INFO", func(c *simulator.Cluster) any {
+		return slurmrest.DiagResponse{Response: slurmrest.Response{Meta: c.Meta()}, Statistics: c.Statistics()}
+	}},
+}
+
+// renderSshare prints `sshare -a -P -n -o
+// Account,User,RawShares,NormShares,RawUsage,NormUsage,FairShare`: the root
+// row, then each account indented one level and its users two.
+func renderSshare(assocs []simulator.Association) []byte {
+	var b strings.Builder
+	for i, a := range assocs {
+		if i == 0 {
+			fmt.Fprintf(&b, "%s|||0.000000|%d||\n", a.Account, a.RawUsage)
+			continue
+		}
+		indent := " "
+		if a.User != "" {
+			indent = "  "
+		}
+		fmt.Fprintf(&b, "%s%s|%s|%d|%.6f|%d|%.6f|%.6f\n", indent, a.Account, a.User,
+			a.RawShares, a.NormShares, a.RawUsage, a.NormUsage, a.FairShare)
+	}
+	return []byte(b.String())
+}
+
+// renderSacctWindow prints `sacct -P -n --format
+// JobID,User,Account,AllocCPUS,Elapsed,TotalCPU,CPUTime,MaxRSS,ReqMem` over
+// the --starttime/--endtime window of args. sacct is served by SlurmDBD, not
+// slurmctld, so it costs no RPC.
+func renderSacctWindow(c *simulator.Cluster, args []string) ([]byte, error) {
+	from, to, err := sacctWindow(args)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, r := range c.Accounting(from, to) {
+		cpuTime := r.Elapsed * time.Duration(r.CPUs)
+		fmt.Fprintf(&b, "%d|%s|%s|%d|%s|%s|%s||%dM\n", r.JobID, r.User, r.Account, r.CPUs,
+			sacctDuration(r.Elapsed), sacctDuration(r.TotalCPU), sacctDuration(cpuTime), r.ReqMemMB)
+		fmt.Fprintf(&b, "%d.batch|||%d|%s|%s|%s|%dM|\n", r.JobID, r.CPUs,
+			sacctDuration(r.Elapsed), sacctDuration(r.TotalCPU), sacctDuration(cpuTime), r.MaxRSSMB)
+	}
+	return []byte(b.String()), nil
+}
+
+// renderSacctStarted prints `sacct -a -X -P -n --format
+// JobID,Partition,Account,Submit,Start --state RUNNING` over the
+// --starttime/--endtime window of args.
+func renderSacctStarted(c *simulator.Cluster, args []string) ([]byte, error) {
+	from, to, err := sacctWindow(args)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, r := range c.Started(from, to) {
+		fmt.Fprintf(&b, "%d|%s|%s|%s|%s\n", r.JobID, r.Partition, r.Account,
+			r.Submit.In(time.Local).Format(slurmTimeLayout), r.Start.In(time.Local).Format(slurmTimeLayout))
+	}
+	return []byte(b.String()), nil
+}
+
+// sacctWindow reads the --starttime and --endtime of a sacct command line.
+func sacctWindow(args []string) (from, to time.Time, err error) {
+	for i := 0; i+1 < len(args); i++ {
+		var dst *time.Time
+		switch args[i] {
+		case "--starttime":
+			dst = &from
+		case "--endtime":
+			dst = &to
+		default:
+			continue
+		}
+		t, err := time.ParseInLocation(slurmTimeLayout, args[i+1], time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("sacct %s: %w", args[i], err)
+		}
+		*dst = t
+	}
+	return from, to, nil
+}
+
+// sacctDuration prints a duration as sacct does, [D-]HH:MM:SS.
+func sacctDuration(d time.Duration) string {
+	s := int64(d / time.Second)
+	days, s := s/86400, s%86400
+	hms := fmt.Sprintf("%02d:%02d:%02d", s/3600, s%3600/60, s%60)
+	if days > 0 {
+		return fmt.Sprintf("%d-%s", days, hms)
+	}
+	return hms
+}
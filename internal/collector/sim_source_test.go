@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/simulator"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// simulated builds the example cluster of docs/simulate-cluster.yaml and points
+// Execute at it for the rest of the test.
+func simulated(t *testing.T) DataSource {
+	t.Helper()
+	m, err := simulator.Load("../../docs/simulate-cluster.yaml")
+	require.NoError(t, err)
+	src := NewSimulatedSource(simulator.New(m))
+
+	old, oldTimeout := dataSource, CommandTimeout()
+	t.Cleanup(func() {
+		SetDataSource(old)
+		SetCommandTimeout(oldTimeout)
+	})
+	SetDataSource(src)
+	SetCommandTimeout(5 * time.Second)
+	return src
+}
+
+func TestSimulatedSourceCoversRegistry(t *testing.T) {
+	for _, cmd := range CommandRegistry {
+		_, ok := simRenderers[cmd.Name]
+		assert.Truef(t, ok, "%s has no simulator renderer", cmd.Name)
+	}
+	for _, f := range JSONForms() {
+		_, ok := simJSONRenderers[f.Name]
+		assert.Truef(t, ok, "the %s --json form has no simulator renderer", f.Name)
+	}
+}
+
+// TestSimulatedSourceRun runs every registry entry and JSON form through the
+// source, as Execute would, and reads the JSON back the way the collectors do.
+func TestSimulatedSourceRun(t *testing.T) {
+	src := simulated(t)
+	assert.Equal(t, "simulate", src.Name())
+	ctx := context.Background()
+
+	for _, cmd := range CommandRegistry {
+		binary := cmd.Binary
+		if binary == "" {
+			binary = cmd.EachBinary[0]
+		}
+		args := cmd.Args
+		if len(cmd.Placeholders) > 0 {
+			args = windowArgs(cmd.Name, time.Now())
+		}
+		out, err := src.Run(ctx, binary, args)
+		require.NoErrorf(t, err, "%s", cmd.Name)
+		assert.NotEmptyf(t, out, "%s", cmd.Name)
+	}
+
+	out, err := src.Run(ctx, "squeue", squeueJSONForm.Args)
+	require.NoError(t, err)
+	jobs, err := decodeSlurmJSON[slurmrest.JobsResponse](out)
+	require.NoError(t, err)
+	assert.NotEmpty(t, jobs.Jobs)
+	assert.Equal(t, simulator.DefaultVersion, jobs.Meta.Slurm.Release)
+
+	out, err = src.Run(ctx, "scontrol", scontrolNodesJSONForm.Args)
+	require.NoError(t, err)
+	nodes, err := decodeSlurmJSON[slurmrest.NodesResponse](out)
+	require.NoError(t, err)
+	assert.Len(t, nodes.Nodes, 20)
+
+	out, err = src.Run(ctx, "sdiag", sdiagJSONForm.Args)
+	require.NoError(t, err)
+	diag, err := decodeSlurmJSON[slurmrest.DiagResponse](out)
+	require.NoError(t, err)
+	assert.Positive(t, diag.Statistics.JobsSubmitted)
+
+	_, err = src.Run(ctx, "sinfo", []string{"--not-a-registered-call"})
+	assert.ErrorContains(t, err, "not a registered Slurm command")
+}
+
+// TestSimulatedSourceCollectors checks that the collectors read the simulated
+// cluster, with figures that follow from the model.
+func TestSimulatedSourceCollectors(t *testing.T) {
+	simulated(t)
+	log, _ := bufferLogger()
+
+	// 16 nodes of 64 CPUs and 4 of 48; 4 nodes of 4 GPUs.
+	assert.Equal(t, []string{`slurm_cpus_total{} 1216`}, gatheredSeries(t, NewCPUsCollector(log), "slurm_cpus_total"))
+	assert.Equal(t, []string{`slurm_gpus_total{} 16`}, gatheredSeries(t, NewGPUsCollector(log), "slurm_gpus_total"))
+	assert.Equal(t, []string{`slurm_license_total{license="matlab"} 10`},
+		gatheredSeries(t, NewLicensesCollector(log), "slurm_license_total"))
+	assert.Equal(t, []string{
+		`slurm_account_fairshare_raw_shares{account="chemistry"} 50`,
+		`slurm_account_fairshare_raw_shares{account="ml"} 50`,
+		`slurm_account_fairshare_raw_shares{account="physics"} 100`,
+		`slurm_account_fairshare_raw_shares{account="root"} 0`,
+	}, gatheredSeries(t, NewFairShareCollector(log, true, 0), "slurm_account_fairshare_raw_shares"))
+	assert.NotEmpty(t, gatheredSeries(t, NewQueueCollector(log, true, true, 0), "slurm_queue_running"),
+		"the warmup leaves jobs running")
+}
+
+func TestRenderSacctWindow(t *testing.T) {
+	src := simulated(t)
+	out, err := src.Run(context.Background(), "sacct", sacctArgs(time.Now()))
+	require.NoError(t, err)
+	records := ParseSacctEfficiency(out)
+	require.NotEmpty(t, records, "two hours of warmup finish jobs in the last hour")
+	for _, r := range records {
+		assert.NotEmpty(t, r.User)
+		assert.LessOrEqual(t, r.TotalCPUSeconds, r.CPUTimeSeconds)
+		assert.True(t, r.MaxRSSPresent)
+		assert.LessOrEqual(t, r.MaxRSSMB, r.ReqMemMB)
+	}
+
+	_, err = src.Run(context.Background(), "sacct", []string{
+		"-P", "-n", "--starttime", "yesterday", "--endtime", "2026-03-01T00:00:00",
+		"--format", "JobID,User,Account,AllocCPUS,Elapsed,TotalCPU,CPUTime,MaxRSS,ReqMem",
+		"--state", "COMPLETED,FAILED,TIMEOUT,CANCELLED",
+	})
+	assert.Error(t, err, "a window the registry does not match is not answered")
+}
+
+func TestSacctDuration(t *testing.T) {
+	assert.Equal(t, "00:00:59", sacctDuration(59*time.Second))
+	assert.Equal(t, "1-02:00:00", sacctDuration(26*time.Hour))
+	assert.InDelta(t, 93600, parseSacctDuration(sacctDuration(26*time.Hour)), 0)
+}
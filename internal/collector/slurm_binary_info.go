@@ -1,11 +1,13 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 
@@ -32,6 +34,9 @@ type SlurmInfoCollector struct {
 	// resolved once on the first scrape and served from memory thereafter.
 	resolveOnce sync.Once
 	series      []infoSeries
+	// resolved is set once series is, for Versions, which reads it outside
+	// resolveOnce.
+	resolved atomic.Bool
 }
 
 func NewSlurmInfoCollector(logger *logger.Logger) *SlurmInfoCollector {
@@ -61,10 +66,21 @@ func (c *SlurmInfoCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *SlurmInfoCollector) Collect(ch chan<- prometheus.Metric) {
-	c.resolveOnce.Do(c.resolve)
+	_ = c.tryCollect(context.Background(), ch)
+}
+
+// tryCollect never fails: a binary that cannot be probed is reported as
+// version="not_found", which is the signal. It exists so the scrape context
+// reaches the version probes.
+func (c *SlurmInfoCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// The probes run once for the process lifetime, so they must not inherit
+	// the cancellation of whichever scrape happened to come first: an abandoned
+	// scrape would otherwise pin every binary at not_found until a restart.
+	c.resolveOnce.Do(func() { c.resolve(context.WithoutCancel(ctx)) })
 	for _, s := range c.series {
 		ch <- prometheus.MustNewConstMetric(c.slurmInfo, prometheus.GaugeValue, s.value, s.typ, s.binary, s.version)
 	}
+	return nil
 }
 
 // resolve probes every binary's version once and builds the series to emit on
@@ -72,10 +88,10 @@ func (c *SlurmInfoCollector) Collect(ch chan<- prometheus.Metric) {
 // happen a single time for the process lifetime rather than on each scrape
 // (issue #149). A Slurm upgrade under a running exporter is not a supported
 // state — the process is restarted by whatever performed the upgrade.
-func (c *SlurmInfoCollector) resolve() {
+func (c *SlurmInfoCollector) resolve(ctx context.Context) {
 	// sinfo is probed once and reused for both the "general" series and its
 	// entry in requiredBinaries, removing the duplicate fork.
-	version, found := GetBinaryVersion(c.logger, "sinfo")
+	version, found := GetBinaryVersion(ctx, c.logger, "sinfo")
 	generalValue := 0.0
 	if found {
 		generalValue = 1.0
@@ -87,7 +103,7 @@ func (c *SlurmInfoCollector) resolve() {
 	for _, binary := range c.requiredBinaries {
 		binVersion, binFound := version, found
 		if binary != "sinfo" {
-			binVersion, binFound = GetBinaryVersion(c.logger, binary)
+			binVersion, binFound = GetBinaryVersion(ctx, c.logger, binary)
 		}
 		binValue := 0.0
 		if binFound {
@@ -103,7 +119,7 @@ func (c *SlurmInfoCollector) resolve() {
 		if !binaryAvailable(binary) {
 			continue
 		}
-		binVersion, binFound := GetBinaryVersion(c.logger, binary)
+		binVersion, binFound := GetBinaryVersion(ctx, c.logger, binary)
 		if !binFound {
 			continue
 		}
@@ -111,6 +127,24 @@ func (c *SlurmInfoCollector) resolve() {
 	}
 
 	c.series = series
+	c.resolved.Store(true)
+}
+
+// Versions returns the versions resolve found, or nil before the first scrape
+// has resolved them.
+func (c *SlurmInfoCollector) Versions() *SlurmVersions {
+	if !c.resolved.Load() {
+		return nil
+	}
+	v := &SlurmVersions{}
+	for _, s := range c.series {
+		if s.typ == "general" {
+			v.Version = s.version
+			continue
+		}
+		v.Binaries = append(v.Binaries, BinaryVersion{Binary: s.binary, Version: s.version, Found: s.value == 1})
+	}
+	return v
 }
 
 // binaryAvailable reports whether the given binary can be found on disk
@@ -130,8 +164,8 @@ var binaryAvailable = func(binary string) bool {
 	return err == nil
 }
 
-func GetBinaryVersion(logger *logger.Logger, binary string) (string, bool) {
-	output, err := Execute(logger, binary, []string{"--version"})
+func GetBinaryVersion(ctx context.Context, logger *logger.Logger, binary string) (string, bool) {
+	output, err := Execute(ctx, logger, binary, []string{"--version"})
 	if err != nil {
 		// The Execute function already logs the error, so we just return.
 		return "not_found", false
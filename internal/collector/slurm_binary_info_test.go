@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"sync"
 	"testing"
 
@@ -24,7 +25,7 @@ func TestSlurmInfoCollector_VersionsResolvedOnce(t *testing.T) {
 	defer func() { Execute = oldExecute }()
 	var mu sync.Mutex
 	calls := map[string]int{}
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		mu.Lock()
 		calls[command]++
 		mu.Unlock()
@@ -67,10 +68,10 @@ func TestSlurmInfoCollector_OptionalBinariesSilentlySkipped(t *testing.T) {
 	// function — binaryAvailable() must short-circuit them.
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		for _, optional := range []string{"sbatch", "salloc", "srun"} {
 			if command == optional {
-				t.Fatalf("Execute() called for optional binary %q — binaryAvailable() should have skipped it", command)
+				t.Fatalf("Execute(context.Background()) called for optional binary %q — binaryAvailable() should have skipped it", command)
 			}
 		}
 		return []byte("slurm 23.11.10"), nil
@@ -117,7 +118,7 @@ func TestSlurmInfoCollector_OptionalBinariesEmittedWhenAvailable(t *testing.T) {
 
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte("slurm 23.11.10"), nil
 	}
 
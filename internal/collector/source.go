@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DataSource answers the Slurm commands the collectors issue.
+//
+// Every *Data() function goes through Execute with a binary and its arguments,
+// and every parser reads the text that command prints. A DataSource is where
+// that text comes from. The default runs the command; NewRESTSource builds the
+// same text from slurmrestd, so a host with no Slurm client, munge key or
+// slurm.conf can run the exporter without a single collector or parser knowing
+// the difference.
+type DataSource interface {
+	// Name identifies the source in logs: "cli", "rest" or "replay".
+	Name() string
+	// Run returns what command would print for args. ctx carries the
+	// command's deadline, and is cancelled when the scrape is abandoned.
+	Run(ctx context.Context, command string, args []string) ([]byte, error)
+}
+
+// dataSource is set once at startup, before any collector runs.
+var dataSource DataSource = cliSource{}
+
+// SetDataSource selects where Execute gets its data from. Not safe to call
+// while collectors are running.
+func SetDataSource(s DataSource) {
+	dataSource = s
+}
+
+// ActiveDataSource returns the source Execute currently reads from, for a
+// DataSource that wraps it.
+func ActiveDataSource() DataSource {
+	return dataSource
+}
+
+// cliSource runs the Slurm binaries, resolved against binPath when one is set,
+// through the command wrapper when one is set.
+type cliSource struct{}
+
+func (cliSource) Name() string { return "cli" }
+
+func (cliSource) Run(ctx context.Context, command string, args []string) ([]byte, error) {
+	bin := command
+	if binPath != "" {
+		bin = filepath.Join(binPath, command)
+	}
+	w := wrapper
+	if w != nil {
+		bin, args = w.wrap(bin, args)
+	}
+	cmd := exec.CommandContext(ctx, bin, args...) //nolint:gosec // G204: command is always a controlled Slurm binary or the operator's wrapper, never user input
+	cmd.Env = slurmCommandEnv()
+	killProcessGroup(cmd)
+	// Bounds the wait for output once the command is killed, in case something
+	// outside its process group still holds the pipe open.
+	cmd.WaitDelay = time.Second
+	var out []byte
+	var err error
+	if c := captureFrom(ctx); c != nil {
+		out, err = runCaptured(cmd, c)
+	} else {
+		out, err = cmd.CombinedOutput()
+	}
+	if err != nil && w != nil && ctx.Err() == nil {
+		err = w.classify(err)
+	}
+	return out, err
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package collector
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as it is: process groups are a Unix notion, and
+// cancellation kills the command alone.
+func killProcessGroup(*exec.Cmd) {}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package collector
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts cmd in a process group of its own and makes
+// cancellation kill the whole group. exec.CommandContext kills only the direct
+// child, so whatever it forked outlived it: an abandoned scrape left squeue
+// processes piling up on the controller.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// A negative pid signals every process in the group.
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCLISource_KillsProcessGroup runs a command that forks a child of its own
+// and times it out. The child must die with it: killing the direct child alone
+// left it running, holding the output pipe and a slurmctld connection.
+func TestCLISource_KillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cliSource{}.Run(ctx, "sh", []string{"-c", "sleep 30 & echo $! > " + pidFile + "; wait"})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second, "Run waited for the forked child")
+
+	data, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return !processAlive(pid) }, 3*time.Second, 20*time.Millisecond,
+		"the forked child outlived the command")
+}
+
+// processAlive reports whether pid is running. A zombie counts as dead: it
+// has exited and only waits for whoever inherited it to reap it.
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
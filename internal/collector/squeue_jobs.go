@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"strings"
 
 	"github.com/sckyzo/slurm_exporter/internal/logger"
@@ -29,9 +30,9 @@ const squeueJobsColumns = "JobID:|,Account:|,UserName:|,Partition:|,State:|,NumN
 // already consumes. queue.go is deliberately NOT a consumer: it omits -a/-r and
 // toggles --states=all, and folding it in here would change how job arrays and
 // hidden-partition jobs are counted.
-func SqueueJobsData(log *logger.Logger) ([]byte, error) {
+func SqueueJobsData(ctx context.Context, log *logger.Logger) ([]byte, error) {
 	out, err := squeueJobsCache.GetOrFetch(func() ([]byte, error) {
-		return Execute(log, "squeue", []string{"-a", "-r", "-h", "-O", squeueJobsColumns})
+		return Execute(ctx, log, "squeue", []string{"-a", "-r", "-h", "-O", squeueJobsColumns})
 	})
 	updateCacheAge()
 	return out, err
@@ -40,11 +41,19 @@ func SqueueJobsData(log *logger.Logger) ([]byte, error) {
 // squeueJobsFields splits one squeueJobsColumns line into its trimmed fields,
 // or returns nil when the line is not a full data row.
 func squeueJobsFields(line string) []string {
+	return squeueFields(line, 8)
+}
+
+// squeueFields splits one line of a pipe-delimited squeue -O layout of n
+// columns into its trimmed fields, or returns nil when the line is not a full
+// data row. Only the separators of the first n-1 columns are split on, so a
+// pipe inside the last column stays in it.
+func squeueFields(line string, n int) []string {
 	if !strings.Contains(line, "|") {
 		return nil
 	}
-	fields := strings.SplitN(line, "|", 8)
-	if len(fields) < 8 {
+	fields := strings.SplitN(line, "|", n)
+	if len(fields) < n {
 		return nil
 	}
 	for i := range fields {
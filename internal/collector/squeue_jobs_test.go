@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"sync/atomic"
 	"testing"
@@ -40,7 +41,7 @@ func TestSqueueJobsSingleCall(t *testing.T) {
 
 	fixture := loadSqueueJobsFixture(t)
 	var squeueCalls atomic.Int64
-	Execute = func(_ *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, _ *logger.Logger, command string, args []string) ([]byte, error) {
 		switch command {
 		case "squeue":
 			squeueCalls.Add(1)
@@ -56,8 +57,8 @@ func TestSqueueJobsSingleCall(t *testing.T) {
 
 	log := logger.NewLogger("error")
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(NewAccountsCollector(log))
-	reg.MustRegister(NewUsersCollector(log))
+	reg.MustRegister(NewAccountsCollector(log, 0))
+	reg.MustRegister(NewUsersCollector(log, 0))
 	reg.MustRegister(NewPartitionsCollector(log))
 
 	_, err := reg.Gather()
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// staleCache implements stale-while-error for one collector: it keeps the
+// metrics of the last successful collection and serves them in place of a
+// failed one, for up to maxAge.
+//
+// Without it, a sinfo timeout makes every series of the collector vanish for
+// the scrape. Dashboards draw gaps, and absent() alerts fire for an outage of
+// the exporter's view rather than of the cluster. Serving the last known state
+// keeps both quiet through a short outage, while
+// slurm_exporter_collector_success still drops to 0 and
+// slurm_exporter_collector_data_age_seconds says how old the served data is.
+type staleCache struct {
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+	at      time.Time
+}
+
+// resolve returns what to serve after a collection that emitted fresh, and
+// when the served metrics were gathered. A success is served and remembered.
+// A failure is replaced by the last success while it is younger than maxAge;
+// past that, the fresh output is served and the cache dropped. stale reports
+// whether the last success was served.
+func (s *staleCache) resolve(fresh []prometheus.Metric, succeeded bool, freshAt, now time.Time) (served []prometheus.Metric, at time.Time, stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if succeeded {
+		s.metrics, s.at = fresh, freshAt
+		return fresh, freshAt, false
+	}
+	if s.metrics != nil && now.Sub(s.at) <= s.maxAge {
+		return s.metrics, s.at, true
+	}
+	s.metrics = nil
+	return fresh, freshAt, false
+}
+
+// metricBuffer collects what a collector emits instead of passing it on.
+type metricBuffer struct {
+	ch      chan prometheus.Metric
+	metrics []prometheus.Metric
+	done    chan struct{}
+}
+
+func newMetricBuffer() *metricBuffer {
+	b := &metricBuffer{ch: make(chan prometheus.Metric), done: make(chan struct{})}
+	go func() {
+		defer close(b.done)
+		for m := range b.ch {
+			b.metrics = append(b.metrics, m)
+		}
+	}()
+	return b
+}
+
+// close ends the collection and returns what was collected.
+func (b *metricBuffer) close() []prometheus.Metric {
+	close(b.ch)
+	<-b.done
+	return b.metrics
+}
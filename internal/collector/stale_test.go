@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// TestStatusTracker_StaleWhileError runs a collector that succeeds once and
+// then fails, under different stale-while-error policies.
+func TestStatusTracker_StaleWhileError(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		wantStale bool
+	}{
+		{"no policy", 0, false},
+		{"within max age", time.Hour, true},
+		{"past max age", time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &failingMock{mockCollector: *newMockCollector("slurm_flaky_metric", 3)}
+			st := NewStatusTracker(logger.NewLogger("error"))
+			st.AddWithOptions("flaky", flaky, EntryOptions{StaleMaxAge: tt.maxAge})
+			reg := prometheus.NewRegistry()
+			require.NoError(t, reg.Register(st))
+			labels := map[string]string{"collector": "flaky"}
+
+			mfs, err := reg.Gather()
+			require.NoError(t, err)
+			age, ok := gatheredValue(mfs, "slurm_exporter_collector_data_age_seconds", labels)
+			require.True(t, ok)
+			assert.Zero(t, age, "data collected by the scrape is not old")
+
+			flaky.fail.Store(true)
+			time.Sleep(10 * time.Millisecond)
+			mfs, err = reg.Gather()
+			require.NoError(t, err)
+
+			success, _ := gatheredValue(mfs, "slurm_exporter_collector_success", labels)
+			assert.Zero(t, success, "serving stale data is still a failure")
+			v, served := gatheredValue(mfs, "slurm_flaky_metric", nil)
+			assert.Equal(t, tt.wantStale, served)
+			age, _ = gatheredValue(mfs, "slurm_exporter_collector_data_age_seconds", labels)
+			if tt.wantStale {
+				assert.Equal(t, 3.0, v)
+				assert.GreaterOrEqual(t, age, 0.01)
+			} else {
+				assert.Zero(t, age)
+			}
+		})
+	}
+}
+
+// TestStatusTracker_StaleRecovers checks that the first success after an
+// outage replaces the stale metrics.
+func TestStatusTracker_StaleRecovers(t *testing.T) {
+	flaky := &failingMock{mockCollector: *newMockCollector("slurm_flaky_metric", 3)}
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.AddWithOptions("flaky", flaky, EntryOptions{StaleMaxAge: time.Hour})
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	flaky.fail.Store(true)
+	_, err = reg.Gather()
+	require.NoError(t, err)
+
+	flaky.fail.Store(false)
+	flaky.value = 5
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	v, _ := gatheredValue(mfs, "slurm_flaky_metric", nil)
+	assert.Equal(t, 5.0, v)
+}
@@ -1,6 +1,10 @@
 package collector
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,15 +17,68 @@ import (
 // avoids duplicate descriptor panics that occur when each inner collector
 // independently emits the same status metric descriptor.
 type StatusTracker struct {
-	entries  []statusEntry
-	success  *prometheus.Desc
-	duration *prometheus.Desc
-	logger   *logger.Logger
+	// mu guards entries and maxConcurrency. A configuration reload swaps the
+	// entries while a scrape may be running; Collect works on the slice it
+	// read at the start.
+	mu      sync.RWMutex
+	entries []statusEntry
+	// maxConcurrency bounds how many inner collectors run at once.
+	maxConcurrency int
+
+	// lastSuccess records, per collector name, when it last collected
+	// successfully, and lastCollections how its last collection went. Keyed
+	// by name rather than held in the entries so that they survive a reload.
+	lastSuccessMu   sync.Mutex
+	lastSuccess     map[string]time.Time
+	lastCollections map[string]lastCollection
+
+	// flightMu guards coalesceWindow and flights, the collections concurrent
+	// scrapes share, keyed by Selection.key. See coalesce.go.
+	flightMu       sync.Mutex
+	coalesceWindow time.Duration
+	flights        map[string]*flight
+	coalesced      prometheus.Counter
+
+	success         *prometheus.Desc
+	dataAge         *prometheus.Desc
+	duration        *prometheus.Desc
+	lastSuccessTime *prometheus.Desc
+	staleness       *prometheus.Desc
+	logger          *logger.Logger
 }
 
 type statusEntry struct {
 	name      string
 	collector prometheus.Collector
+	// timeout overrides --command.timeout for the commands this collector
+	// runs. Zero keeps the global value.
+	timeout time.Duration
+	// stale holds the last successful metrics while the collector fails. Nil
+	// when the collector has no stale-while-error policy. It belongs to the
+	// entry, so a reload, which may change the collector's labels, drops it.
+	stale *staleCache
+}
+
+// lastCollection is how the last collection of a collector went, for Status.
+type lastCollection struct {
+	at       time.Time
+	duration time.Duration
+	// err is what the collector returned, or the panic it recovered from.
+	err error
+	// failures counts the collections in a row that failed, this one
+	// included.
+	failures int
+}
+
+// EntryOptions tunes how StatusTracker runs one inner collector.
+type EntryOptions struct {
+	// Timeout overrides --command.timeout for the collector's commands. Zero
+	// keeps the global value.
+	Timeout time.Duration
+	// StaleMaxAge, when positive, keeps the collector's last successful
+	// metrics served for up to that long while it fails, instead of letting
+	// its series disappear.
+	StaleMaxAge time.Duration
 }
 
 // failableCollector is a collector that reports whether its collection
@@ -36,16 +93,43 @@ type statusEntry struct {
 // tryCollect is unexported, so only collectors in this package can implement
 // it. Those that do not are still run through the plain Collect path and
 // reported as successful unless they panic.
+//
+// ctx is the scrape's: cancelled when the HTTP client goes away, and carrying
+// the collector's timeout override when it has one. Everything tryCollect runs
+// through Execute has to be given it.
 type failableCollector interface {
 	prometheus.Collector
-	tryCollect(ch chan<- prometheus.Metric) error
+	tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error
 }
 
+// snapshotCollector is a collector that serves metrics gathered earlier,
+// such as a BackgroundCollector. Its last success is when it gathered them,
+// not when a scrape read them, and lastRun is when the metrics it serves now
+// were gathered.
+type snapshotCollector interface {
+	lastSuccess() time.Time
+	lastRun() time.Time
+}
+
+// DefaultMaxConcurrency is how many inner collectors a scrape runs at once
+// unless SetMaxConcurrency says otherwise. Most of a collector's time is spent
+// waiting on a Slurm command, so running a few together shortens the scrape
+// without multiplying the load on slurmctld by the number of collectors.
+const DefaultMaxConcurrency = 4
+
 // NewStatusTracker creates a StatusTracker. Register it once with the Prometheus
 // registry; add inner collectors via Add().
 func NewStatusTracker(log *logger.Logger) *StatusTracker {
 	return &StatusTracker{
-		logger: log,
+		logger:          log,
+		maxConcurrency:  DefaultMaxConcurrency,
+		lastSuccess:     make(map[string]time.Time),
+		lastCollections: make(map[string]lastCollection),
+		flights:         make(map[string]*flight),
+		coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "slurm_exporter_scrapes_coalesced_total",
+			Help: "Total number of scrapes served from a collection started by another scrape.",
+		}),
 		success: prometheus.NewDesc(
 			"slurm_exporter_collector_success",
 			"Whether the last scrape of the collector succeeded (1=success, 0=failure)",
@@ -56,53 +140,243 @@ func NewStatusTracker(log *logger.Logger) *StatusTracker {
 			"Duration of the last scrape for the collector in seconds",
 			[]string{"collector"}, nil,
 		),
+		lastSuccessTime: prometheus.NewDesc(
+			"slurm_exporter_collector_last_success_timestamp_seconds",
+			"Unix timestamp of the last successful collection by the collector. "+
+				"For a collector refreshed in the background, when that refresh ran.",
+			[]string{"collector"}, nil,
+		),
+		staleness: prometheus.NewDesc(
+			"slurm_exporter_collector_staleness_seconds",
+			"Seconds since the last successful collection by the collector.",
+			[]string{"collector"}, nil,
+		),
+		dataAge: prometheus.NewDesc(
+			"slurm_exporter_collector_data_age_seconds",
+			"Age of the metrics served for the collector: 0 when this scrape collected them, "+
+				"more when they come from a background refresh or from the last success while the collector fails.",
+			[]string{"collector"}, nil,
+		),
 	}
 }
 
 // Add registers an inner collector under the given name.
 func (st *StatusTracker) Add(name string, c prometheus.Collector) {
-	st.entries = append(st.entries, statusEntry{name: name, collector: c})
+	st.AddWithOptions(name, c, EntryOptions{})
+}
+
+// AddWithOptions registers an inner collector under the given name, run as
+// opts says.
+func (st *StatusTracker) AddWithOptions(name string, c prometheus.Collector, opts EntryOptions) {
+	e := statusEntry{name: name, collector: c, timeout: opts.Timeout}
+	if opts.StaleMaxAge > 0 {
+		e.stale = &staleCache{maxAge: opts.StaleMaxAge}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries = append(st.entries, e)
+}
+
+// Replace swaps in the inner collectors of next, so a configuration reload
+// can rebuild the collector set while the tracker stays registered. A scrape
+// already running finishes with the collectors it started with.
+//
+// The tracker is not re-registered, so collectors enabled by a reload are
+// never checked against the registry's descriptors. That is only a problem for
+// a pedantic registry, which the exporter does not use.
+func (st *StatusTracker) Replace(next *StatusTracker) {
+	next.mu.RLock()
+	entries := slices.Clone(next.entries)
+	next.mu.RUnlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.entries = entries
+}
+
+// SetMaxConcurrency sets how many inner collectors a scrape runs at once. 1
+// runs them one after another; anything below 1 is taken as 1.
+func (st *StatusTracker) SetMaxConcurrency(n int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.maxConcurrency = max(n, 1)
 }
 
-// Describe sends the inner collectors' descriptors plus the two status descriptors.
+// snapshot returns the current inner collectors and the concurrency limit.
+func (st *StatusTracker) snapshot() ([]statusEntry, int) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.entries, st.maxConcurrency
+}
+
+// Describe sends the inner collectors' descriptors plus the status descriptors.
 func (st *StatusTracker) Describe(ch chan<- *prometheus.Desc) {
-	for _, e := range st.entries {
-		e.collector.Describe(ch)
+	st.describe(Selection{}, ch)
+}
+
+func (st *StatusTracker) describe(sel Selection, ch chan<- *prometheus.Desc) {
+	entries, _ := st.snapshot()
+	for _, e := range entries {
+		if sel.includes(e.name) {
+			e.collector.Describe(ch)
+		}
 	}
 	ch <- st.success
 	ch <- st.duration
+	ch <- st.lastSuccessTime
+	ch <- st.staleness
+	ch <- st.dataAge
+	ch <- st.coalesced.Desc()
+}
+
+// Collect runs the inner collectors with no scrape to follow. The HTTP
+// handler goes through Bind instead, so an abandoned scrape stops its
+// commands.
+func (st *StatusTracker) Collect(ch chan<- prometheus.Metric) {
+	st.collectShared(context.Background(), Selection{}, ch)
+	ch <- st.coalesced
+}
+
+// Bind returns the tracker as a collector whose Collect runs under ctx,
+// normally the scrape request's. When Prometheus gives up on a scrape, the
+// request context is cancelled and every Slurm command still running for it is
+// killed, instead of finishing for nobody.
+func (st *StatusTracker) Bind(ctx context.Context) prometheus.Collector {
+	return boundTracker{st: st, ctx: ctx}
+}
+
+type boundTracker struct {
+	st  *StatusTracker
+	ctx context.Context
+	sel Selection
 }
 
-// Collect runs each inner collector, measures its duration, and emits status metrics.
-// Each inner collector writes directly into ch — no intermediate channel or extra
-// goroutine. Panics are caught via defer/recover in the same goroutine, which is
-// standard Go and avoids any buffering overhead regardless of metric volume.
+func (b boundTracker) Describe(ch chan<- *prometheus.Desc) { b.st.describe(b.sel, ch) }
+func (b boundTracker) Collect(ch chan<- prometheus.Metric) {
+	b.st.collectShared(b.ctx, b.sel, ch)
+	ch <- b.st.coalesced
+}
+
+// collect runs the inner collectors concurrently, at most maxConcurrency at a
+// time, and emits their status metrics. Run one after another, a scrape took
+// the sum of every Slurm command's latency, which on a large cluster exceeds
+// the scrape timeout.
+//
+// Each inner collector writes directly into ch, which is safe from several
+// goroutines, and collect returns once all of them are done. Collectors that
+// read the same shared cache still fetch once: timedCache holds its write lock
+// across the fetch, so the others wait for it and read the result.
 //
 // A collector reports failure two ways: by panicking, or by implementing
 // failableCollector and returning an error. Both lower its success gauge to 0.
-func (st *StatusTracker) Collect(ch chan<- prometheus.Metric) {
-	for _, e := range st.entries {
-		start := time.Now()
-		succeeded := 1.0
-
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					st.logger.Error("Collector panicked", "collector", e.name, "panic", r)
-					succeeded = 0
-				}
-			}()
-			if fc, ok := e.collector.(failableCollector); ok {
-				if err := fc.tryCollect(ch); err != nil {
-					succeeded = 0
-				}
-				return
+func (st *StatusTracker) collect(ctx context.Context, sel Selection, ch chan<- prometheus.Metric) {
+	entries, limit := st.snapshot()
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if !sel.includes(e.name) {
+			continue
+		}
+		wg.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			st.collectOne(ctx, e, ch)
+		})
+	}
+	wg.Wait()
+}
+
+// collectOne runs one inner collector and emits its status metrics. The
+// duration counts from the moment the collector starts, not from the start of
+// the scrape, so time spent waiting for a slot is not charged to it. Panics are
+// recovered here, in the collector's own goroutine: one that escaped would take
+// the whole exporter down.
+//
+// A collector with a stale-while-error policy writes into a buffer rather
+// than ch, so that a failed collection can be swapped for its last success
+// before anything reaches the scrape.
+func (st *StatusTracker) collectOne(ctx context.Context, e statusEntry, ch chan<- prometheus.Metric) {
+	start := time.Now()
+	succeeded := 1.0
+	var collectErr error
+	if e.timeout > 0 {
+		ctx = WithCommandTimeout(ctx, e.timeout)
+	}
+
+	out := ch
+	var buffer *metricBuffer
+	if e.stale != nil {
+		buffer = newMetricBuffer()
+		out = buffer.ch
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				st.logger.Error("Collector panicked", "collector", e.name, "panic", r)
+				succeeded = 0
+				collectErr = fmt.Errorf("panic: %v", r)
 			}
-			e.collector.Collect(ch)
 		}()
+		if fc, ok := e.collector.(failableCollector); ok {
+			if err := fc.tryCollect(ctx, out); err != nil {
+				succeeded = 0
+				collectErr = err
+			}
+			return
+		}
+		e.collector.Collect(out)
+	}()
+
+	now := time.Now()
+	gatheredAt := now
+	if sc, ok := e.collector.(snapshotCollector); ok {
+		gatheredAt = sc.lastRun()
+	}
+	if buffer != nil {
+		fresh := buffer.close()
+		served, at, stale := e.stale.resolve(fresh, succeeded == 1, gatheredAt, now)
+		if stale {
+			st.logger.Warn("Collector failed, serving its last successful metrics",
+				"collector", e.name, "age", now.Sub(at).Round(time.Second))
+		}
+		for _, m := range served {
+			ch <- m
+		}
+		gatheredAt = at
+	}
 
-		elapsed := time.Since(start).Seconds()
-		ch <- prometheus.MustNewConstMetric(st.success, prometheus.GaugeValue, succeeded, e.name)
-		ch <- prometheus.MustNewConstMetric(st.duration, prometheus.GaugeValue, elapsed, e.name)
+	elapsed := now.Sub(start).Seconds()
+	ch <- prometheus.MustNewConstMetric(st.success, prometheus.GaugeValue, succeeded, e.name)
+	ch <- prometheus.MustNewConstMetric(st.duration, prometheus.GaugeValue, elapsed, e.name)
+	ch <- prometheus.MustNewConstMetric(st.dataAge, prometheus.GaugeValue, now.Sub(gatheredAt).Seconds(), e.name)
+
+	if last := st.recordCollection(e, lastCollection{at: now, duration: now.Sub(start), err: collectErr}); !last.IsZero() {
+		ch <- prometheus.MustNewConstMetric(st.lastSuccessTime, prometheus.GaugeValue,
+			float64(last.UnixNano())/1e9, e.name)
+		ch <- prometheus.MustNewConstMetric(st.staleness, prometheus.GaugeValue,
+			now.Sub(last).Seconds(), e.name)
+	}
+}
+
+// recordCollection keeps c as the last collection of e, updates the last
+// success of e, and returns it. The zero time means the collector has never
+// succeeded, and its timestamp and staleness are not emitted rather than
+// reported as 1970.
+func (st *StatusTracker) recordCollection(e statusEntry, c lastCollection) time.Time {
+	st.lastSuccessMu.Lock()
+	defer st.lastSuccessMu.Unlock()
+	if c.err != nil {
+		c.failures = st.lastCollections[e.name].failures + 1
+	}
+	st.lastCollections[e.name] = c
+	switch sc, ok := e.collector.(snapshotCollector); {
+	case ok:
+		if t := sc.lastSuccess(); t.After(st.lastSuccess[e.name]) {
+			st.lastSuccess[e.name] = t
+		}
+	case c.err == nil:
+		st.lastSuccess[e.name] = c.at
 	}
+	return st.lastSuccess[e.name]
 }
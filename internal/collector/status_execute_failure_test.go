@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -53,7 +54,7 @@ func TestStatusTracker_SuccessIsZeroWhenSlurmCommandsFail(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
 
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, errors.New("simulated: slurmctld unreachable")
 	}
 
@@ -71,16 +72,16 @@ func TestStatusTracker_SuccessIsZeroWhenSlurmCommandsFail(t *testing.T) {
 	// sacct_efficiency which is opt-in and serves a background cache rather
 	// than running on the scrape path.
 	tracker := NewStatusTracker(log)
-	tracker.Add("accounts", NewAccountsCollector(log))
+	tracker.Add("accounts", NewAccountsCollector(log, 0))
 	tracker.Add("cpus", NewCPUsCollector(log))
 	tracker.Add("nodes", NewNodesCollector(log, true))
 	tracker.Add("node", NewNodeCollector(log, true))
 	tracker.Add("drain_reason", NewDrainReasonCollector(log))
 	tracker.Add("partitions", NewPartitionsCollector(log))
-	tracker.Add("queue", NewQueueCollector(log, true, true))
-	tracker.Add("scheduler", NewSchedulerCollector(log))
-	tracker.Add("fairshare", NewFairShareCollector(log, true))
-	tracker.Add("users", NewUsersCollector(log))
+	tracker.Add("queue", NewQueueCollector(log, true, true, 0))
+	tracker.Add("scheduler", NewSchedulerCollector(log, 0))
+	tracker.Add("fairshare", NewFairShareCollector(log, true, 0))
+	tracker.Add("users", NewUsersCollector(log, 0))
 	tracker.Add("gpus", NewGPUsCollector(log))
 	tracker.Add("reservations", NewReservationsCollector(log))
 	tracker.Add("reservation_nodes", NewReservationNodesCollector(log))
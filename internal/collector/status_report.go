@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// The status report.
+//
+// slurm_exporter_collector_success says that a collector failed, not why. The
+// report is what /api/v1/status and the index page show an operator instead:
+// per collector, how its last collection went and the error it returned,
+// which Slurm commands it runs and how old the shared caches it reads are,
+// next to the Slurm versions the info collector resolved.
+
+// CollectorStatus is the state of one collector.
+type CollectorStatus struct {
+	Name string `json:"name"`
+	// Enabled is false for a collector that is known but not running, by
+	// flag or by the configuration file. The fields below still describe its
+	// last collection if it ran before a reload disabled it.
+	Enabled bool `json:"enabled"`
+	// LastCollection is when its last collection ended, and LastSuccess when
+	// the last successful one did. Both are zero until it has run.
+	LastCollection time.Time `json:"last_collection,omitzero"`
+	LastSuccess    time.Time `json:"last_success,omitzero"`
+	// LastDurationSeconds is how long the last collection took.
+	LastDurationSeconds float64 `json:"last_duration_seconds"`
+	// LastError is what the last collection failed with, empty when it
+	// succeeded.
+	LastError string `json:"last_error,omitempty"`
+	// ConsecutiveFailures counts the collections in a row that failed, 0
+	// once one succeeds.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Commands are the CommandRegistry calls the collector reads, its own and
+	// those it shares with other collectors.
+	Commands []CommandStatus `json:"commands"`
+	// Caches are the shared caches those calls go through.
+	Caches []CacheStatus `json:"caches,omitempty"`
+}
+
+// CommandStatus is one Slurm call a collector depends on.
+type CommandStatus struct {
+	// Name is the call's name in the command registry and the command log.
+	Name string `json:"name"`
+	// Command is the binary and its arguments, placeholders included.
+	Command string `json:"command"`
+	// OptIn is the flag the call needs, if any.
+	OptIn string `json:"opt_in,omitempty"`
+}
+
+// CacheStatus is the state of one shared cache.
+type CacheStatus struct {
+	Name string `json:"name"`
+	// AgeSeconds is the time since the last refresh, nil when the cache has
+	// never been filled.
+	AgeSeconds *float64 `json:"age_seconds"`
+	TTLSeconds float64  `json:"ttl_seconds"`
+}
+
+// SlurmVersions are the versions the info collector resolved.
+type SlurmVersions struct {
+	// Version is the cluster's, as sinfo --version reports it.
+	Version  string          `json:"version"`
+	Binaries []BinaryVersion `json:"binaries"`
+}
+
+// BinaryVersion is the version of one Slurm binary. Found is false for a
+// required binary that could not be run, whose Version is then not_found.
+type BinaryVersion struct {
+	Binary  string `json:"binary"`
+	Version string `json:"version"`
+	Found   bool   `json:"found"`
+}
+
+// collectorFiles maps each collector, by the name --collector.<name> gives it,
+// to the file implementing it: the Source or a Consumer of the registry
+// entries it reads.
+var collectorFiles = map[string]string{
+	"accounts":          "accounts.go",
+	"controller":        "controller.go",
+	"cpus":              "cpus.go",
+	"drain_reason":      "node_drain.go",
+	"fairshare":         "fairshare.go",
+	"gpus":              "gpus.go",
+	"info":              "slurm_binary_info.go",
+	"job_wait":          "job_wait.go",
+	"jobs":              "jobs.go",
+	"licenses":          "licenses.go",
+	"node":              "node.go",
+	"nodes":             "nodes.go",
+	"partitions":        "partitions.go",
+	"queue":             "queue.go",
+	"reservation_nodes": "reservation_nodes.go",
+	"reservations":      "reservations.go",
+	"sacct_efficiency":  "sacct_efficiency.go",
+	"scheduler":         "scheduler.go",
+	"users":             "users.go",
+}
+
+// Status reports every collector in names, the ones the exporter knows, in
+// that order. Those the tracker is not running are reported disabled.
+func (st *StatusTracker) Status(names []string) []CollectorStatus {
+	entries, _ := st.snapshot()
+	st.lastSuccessMu.Lock()
+	defer st.lastSuccessMu.Unlock()
+	out := make([]CollectorStatus, 0, len(names))
+	for _, name := range names {
+		s := CollectorStatus{
+			Name: name,
+			Enabled: slices.ContainsFunc(entries, func(e statusEntry) bool {
+				return e.name == name
+			}),
+			LastSuccess: st.lastSuccess[name],
+		}
+		if c, ok := st.lastCollections[name]; ok {
+			s.LastCollection = c.at
+			s.LastDurationSeconds = c.duration.Seconds()
+			s.ConsecutiveFailures = c.failures
+			if c.err != nil {
+				s.LastError = c.err.Error()
+			}
+		}
+		s.Commands, s.Caches = collectorCommands(name)
+		out = append(out, s)
+	}
+	return out
+}
+
+// Failing returns the collectors that failed their last n collections, when
+// every running collector that has collected did, and nil otherwise: one
+// collector that works is enough to show Slurm answering. Collectors yet to
+// run are not counted either way. n below 1 finds nothing failing.
+func (st *StatusTracker) Failing(n int) []CollectorStatus {
+	if n < 1 {
+		return nil
+	}
+	entries, _ := st.snapshot()
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	var failing []CollectorStatus
+	for _, s := range st.Status(names) {
+		if s.LastCollection.IsZero() {
+			continue
+		}
+		if s.ConsecutiveFailures < n {
+			return nil
+		}
+		failing = append(failing, s)
+	}
+	return failing
+}
+
+// SlurmVersions returns the versions the running info collector resolved, or
+// nil when it is disabled or has not been scraped yet.
+func (st *StatusTracker) SlurmVersions() *SlurmVersions {
+	entries, _ := st.snapshot()
+	for _, e := range entries {
+		c := e.collector
+		if bc, ok := c.(*BackgroundCollector); ok {
+			c = bc.inner
+		}
+		if info, ok := c.(*SlurmInfoCollector); ok {
+			return info.Versions()
+		}
+	}
+	return nil
+}
+
+// collectorCommands returns the registry calls the collector named name reads,
+// their --json forms included, and the shared caches among them.
+func collectorCommands(name string) ([]CommandStatus, []CacheStatus) {
+	file, ok := collectorFiles[name]
+	if !ok {
+		return nil, nil
+	}
+	var commands []CommandStatus
+	var caches []CacheStatus
+	seen := make(map[string]bool)
+	add := func(s CommandStatus) {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			commands = append(commands, s)
+		}
+	}
+	for i := range CommandRegistry {
+		c := &CommandRegistry[i]
+		if c.Source != file && !slices.Contains(c.Consumers, file) {
+			continue
+		}
+		for _, bin := range c.binaries() {
+			add(CommandStatus{Name: c.callName(bin), Command: commandTemplate(bin, c.Args), OptIn: c.OptIn})
+		}
+		if c.JSON != nil {
+			add(CommandStatus{Name: c.JSON.Name + ".json", Command: commandTemplate(c.JSON.Binary, c.JSON.Args), OptIn: "--slurm.json=" + c.Name})
+		}
+		if get, ok := cacheRegistry[c.Name]; ok && !slices.ContainsFunc(caches, func(s CacheStatus) bool { return s.Name == c.Name }) {
+			caches = append(caches, cacheStatus(c.Name, get()))
+		}
+	}
+	return commands, caches
+}
+
+func commandTemplate(binary string, args []string) string {
+	return strings.Join(append([]string{binary}, args...), " ")
+}
+
+func cacheStatus(name string, c *timedCache) CacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := CacheStatus{Name: name, TTLSeconds: c.ttl.Seconds()}
+	if !c.fetchAt.IsZero() {
+		s.AgeSeconds = new(time.Since(c.fetchAt).Seconds())
+	}
+	return s
+}
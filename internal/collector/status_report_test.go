@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func TestStatusTracker_Status(t *testing.T) {
+	old := squeueJobsCache
+	t.Cleanup(func() { squeueJobsCache = old })
+	squeueJobsCache = &timedCache{ttl: 25 * time.Second}
+
+	accounts := &failingMock{mockCollector: *newMockCollector("slurm_accounts_metric", 1)}
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.Add("accounts", accounts)
+	st.Add("panicky", &mockCollector{desc: prometheus.NewDesc("slurm_panicky", "p", nil, nil), panic: true})
+
+	before := st.Status([]string{"accounts", "users"})
+	require.Len(t, before, 2)
+	assert.True(t, before[0].Enabled)
+	assert.True(t, before[0].LastCollection.IsZero(), "not collected yet")
+	assert.False(t, before[1].Enabled, "users is known but not running")
+	require.Len(t, before[0].Caches, 1)
+	assert.Equal(t, "squeue_jobs", before[0].Caches[0].Name)
+	assert.Nil(t, before[0].Caches[0].AgeSeconds, "never filled")
+	assert.Equal(t, 25.0, before[0].Caches[0].TTLSeconds)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	accounts.fail.Store(true)
+	_, err = squeueJobsCache.GetOrFetch(func() ([]byte, error) { return nil, nil })
+	require.NoError(t, err)
+	_, err = reg.Gather()
+	require.NoError(t, err)
+
+	after := st.Status([]string{"accounts", "panicky"})
+	s := after[0]
+	assert.False(t, s.LastCollection.IsZero())
+	assert.False(t, s.LastSuccess.IsZero(), "the first collection succeeded")
+	assert.True(t, s.LastSuccess.Before(s.LastCollection))
+	assert.Equal(t, assert.AnError.Error(), s.LastError)
+	assert.NotNil(t, s.Caches[0].AgeSeconds)
+	assert.Equal(t, "panic: simulated collector panic", after[1].LastError)
+	assert.Empty(t, after[1].Commands, "not a collector the registry knows")
+}
+
+func TestStatusTracker_Failing(t *testing.T) {
+	a := &failingMock{mockCollector: *newMockCollector("slurm_a", 1)}
+	b := &failingMock{mockCollector: *newMockCollector("slurm_b", 1)}
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.Add("a", a)
+	st.Add("b", b)
+	assert.Nil(t, st.Failing(1), "nothing has run")
+
+	collect := func() {
+		ch := make(chan prometheus.Metric, 100)
+		st.Collect(ch)
+	}
+	a.fail.Store(true)
+	collect()
+	assert.Nil(t, st.Failing(1), "b still works")
+
+	b.fail.Store(true)
+	collect()
+	assert.Nil(t, st.Failing(2), "b failed once only")
+	failing := st.Failing(1)
+	require.Len(t, failing, 2)
+	assert.Equal(t, 2, failing[0].ConsecutiveFailures)
+	assert.Nil(t, st.Failing(0), "disabled")
+
+	a.fail.Store(false)
+	collect()
+	assert.Nil(t, st.Failing(1))
+	assert.Zero(t, st.Status([]string{"a"})[0].ConsecutiveFailures, "a success resets the count")
+}
+
+func TestStatusTracker_SlurmVersions(t *testing.T) {
+	stubExecute(t, "slurm 23.11.10")
+	oldAvail := binaryAvailable
+	t.Cleanup(func() { binaryAvailable = oldAvail })
+	binaryAvailable = func(string) bool { return false }
+
+	st := NewStatusTracker(logger.NewLogger("error"))
+	assert.Nil(t, st.SlurmVersions(), "no info collector")
+	st.Add("info", NewSlurmInfoCollector(logger.NewLogger("error")))
+	assert.Nil(t, st.SlurmVersions(), "not scraped yet")
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+	_, err := reg.Gather()
+	require.NoError(t, err)
+
+	v := st.SlurmVersions()
+	require.NotNil(t, v)
+	assert.Equal(t, "23.11.10", v.Version)
+	assert.Contains(t, v.Binaries, BinaryVersion{Binary: "sdiag", Version: "23.11.10", Found: true})
+	assert.Len(t, v.Binaries, 5, "the required binaries only")
+}
+
+// TestCollectorFiles checks that every collector maps to a file that exists
+// and reads at least one registry call, so a renamed file cannot leave a
+// collector with no commands in the status report.
+func TestCollectorFiles(t *testing.T) {
+	for name, file := range collectorFiles {
+		_, err := os.Stat(file)
+		require.NoError(t, err, name)
+		commands, _ := collectorCommands(name)
+		assert.NotEmpty(t, commands, name)
+	}
+
+	commands, caches := collectorCommands("nodes")
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"nodes_global", "scontrol_nodes"}, names, "its own call and the one it shares")
+	require.Len(t, caches, 1)
+	assert.Equal(t, "scontrol_nodes", caches[0].Name)
+
+	commands, _ = collectorCommands("queue")
+	assert.Contains(t, commands, CommandStatus{Name: "squeue.json", Command: "squeue --json", OptIn: "--slurm.json=queue_all_states"})
+}
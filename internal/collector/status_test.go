@@ -1,7 +1,15 @@
 package collector
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -142,8 +150,9 @@ func TestStatusTracker_Describe(t *testing.T) {
 	for range ch {
 		count++
 	}
-	// 2 inner descriptors + success + duration = 4
-	assert.Equal(t, 4, count)
+	// 2 inner descriptors + success, duration, last success, staleness, data age
+	// and coalesced scrapes = 8
+	assert.Equal(t, 8, count)
 }
 
 func TestStatusTracker_Add(t *testing.T) {
@@ -154,3 +163,259 @@ func TestStatusTracker_Add(t *testing.T) {
 	st.Add("b", newMockCollector("slurm_add_b", 1))
 	assert.Len(t, st.entries, 2)
 }
+
+// TestStatusTracker_Replace is what a configuration reload relies on: the
+// tracker stays registered while its collector set changes underneath it.
+func TestStatusTracker_Replace(t *testing.T) {
+	log := logger.NewLogger("error")
+	st := NewStatusTracker(log)
+	st.Add("old", newMockCollector("slurm_replace_old", 1))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+
+	next := NewStatusTracker(log)
+	next.Add("new", newMockCollector("slurm_replace_new", 2))
+	st.Replace(next)
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	names := make(map[string]bool)
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	assert.True(t, names["slurm_replace_new"], "the replacement set must be collected")
+	assert.False(t, names["slurm_replace_old"], "the replaced set must no longer be collected")
+
+	// Adding to next after the swap must not leak into the tracker.
+	next.Add("late", newMockCollector("slurm_replace_late", 3))
+	entries, _ := st.snapshot()
+	assert.Len(t, entries, 1)
+}
+
+// slowCollector holds its slot for a while and records how many collectors
+// were running alongside it.
+type slowCollector struct {
+	*mockCollector
+	inFlight, peak *atomic.Int32
+}
+
+func (c slowCollector) Collect(ch chan<- prometheus.Metric) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		p := c.peak.Load()
+		if n <= p || c.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.mockCollector.Collect(ch)
+}
+
+// TestStatusTracker_MaxConcurrency checks that the inner collectors run in
+// parallel, never more of them at once than the limit, and that every one of
+// them still reports its status.
+func TestStatusTracker_MaxConcurrency(t *testing.T) {
+	for _, limit := range []int{1, 3} {
+		var inFlight, peak atomic.Int32
+		st := NewStatusTracker(logger.NewLogger("error"))
+		st.SetMaxConcurrency(limit)
+		for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+			st.Add(name, slowCollector{newMockCollector("slurm_slow_"+name, 1), &inFlight, &peak})
+		}
+
+		reg := prometheus.NewRegistry()
+		require.NoError(t, reg.Register(st))
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+
+		assert.Equalf(t, int32(limit), peak.Load(), "limit %d", limit)
+		for _, mf := range mfs {
+			if mf.GetName() == "slurm_exporter_collector_success" {
+				assert.Lenf(t, mf.Metric, 6, "limit %d", limit)
+			}
+		}
+	}
+}
+
+func TestStatusTracker_SetMaxConcurrencyFloor(t *testing.T) {
+	st := NewStatusTracker(logger.NewLogger("error"))
+	_, limit := st.snapshot()
+	assert.Equal(t, DefaultMaxConcurrency, limit)
+	st.SetMaxConcurrency(0)
+	_, limit = st.snapshot()
+	assert.Equal(t, 1, limit)
+}
+
+// TestStatusTracker_ConcurrentPanic checks that a panic in one collector's
+// goroutine is recovered there and leaves the others reporting.
+func TestStatusTracker_ConcurrentPanic(t *testing.T) {
+	st := NewStatusTracker(logger.NewLogger("error"))
+	panicking := newMockCollector("slurm_panic_metric", 0)
+	panicking.panic = true
+	st.Add("panicking", panicking)
+	st.Add("healthy", newMockCollector("slurm_healthy_metric", 1))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() == "slurm_exporter_collector_success" {
+			for _, m := range mf.Metric {
+				got[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"panicking": 0, "healthy": 1}, got)
+}
+
+// TestStatusTracker_SharedCachesFetchOnce runs every collector reading
+// scontrolNodesCache or squeueJobsCache in the same scrape, all at once, and
+// checks that each cached command still reaches Slurm once.
+func TestStatusTracker_SharedCachesFetchOnce(t *testing.T) {
+	resetSharedCaches(t)
+	oldTimeout := CommandTimeout()
+	t.Cleanup(func() { SetCommandTimeout(oldTimeout) })
+	SetCommandTimeout(5 * time.Second)
+
+	fixture := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(testDataDir, name))
+		require.NoError(t, err)
+		return data
+	}
+	scontrolNodes, squeueJobs := fixture("scontrol_nodes.txt"), fixture("squeue_jobs.txt")
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	old := Execute
+	t.Cleanup(func() { Execute = old })
+	Execute = func(_ context.Context, _ *logger.Logger, command string, args []string) ([]byte, error) {
+		key := command + " " + strings.Join(args, " ")
+		mu.Lock()
+		calls[key]++
+		mu.Unlock()
+		// Long enough for every collector to be waiting on the cache.
+		time.Sleep(20 * time.Millisecond)
+		switch {
+		case command == "scontrol" && slices.Equal(args, []string{"show", "nodes", "-o"}):
+			return scontrolNodes, nil
+		case command == "squeue" && slices.Contains(args, squeueJobsColumns):
+			return squeueJobs, nil
+		}
+		return nil, nil
+	}
+
+	log := logger.NewLogger("error")
+	st := NewStatusTracker(log)
+	st.SetMaxConcurrency(8)
+	st.Add("accounts", NewAccountsCollector(log, 0))
+	st.Add("users", NewUsersCollector(log, 0))
+	st.Add("partitions", NewPartitionsCollector(log))
+	st.Add("nodes", NewNodesCollector(log, false))
+	st.Add("reservation_nodes", NewReservationNodesCollector(log))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+	_, err := reg.Gather()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, calls["scontrol show nodes -o"])
+	assert.Equal(t, 1, calls["squeue -a -r -h -O "+squeueJobsColumns])
+}
+
+// ctxCollector is a failableCollector that records the context it ran under.
+type ctxCollector struct {
+	mockCollector
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (c *ctxCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mu.Lock()
+	c.ctx = ctx
+	c.mu.Unlock()
+	c.Collect(ch)
+	return nil
+}
+
+// TestStatusTracker_CollectorTimeout checks that a collector added with its own
+// timeout runs its commands with it, and that the others keep the global one.
+func TestStatusTracker_CollectorTimeout(t *testing.T) {
+	oldTimeout := CommandTimeout()
+	t.Cleanup(func() { SetCommandTimeout(oldTimeout) })
+	SetCommandTimeout(5 * time.Second)
+
+	slow := &ctxCollector{mockCollector: *newMockCollector("slow_metric", 1)}
+	fast := &ctxCollector{mockCollector: *newMockCollector("fast_metric", 1)}
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.AddWithOptions("sacct_efficiency", slow, EntryOptions{Timeout: 2 * time.Minute})
+	st.Add("sdiag", fast)
+
+	ch := make(chan prometheus.Metric, 20)
+	st.Collect(ch)
+	assert.Equal(t, 2*time.Minute, commandTimeoutFor(slow.ctx))
+	assert.Equal(t, 5*time.Second, commandTimeoutFor(fast.ctx))
+}
+
+// TestStatusTracker_Bind checks that the bound tracker hands its context to
+// the collectors, which is how a cancelled scrape reaches Execute.
+func TestStatusTracker_Bind(t *testing.T) {
+	c := &ctxCollector{mockCollector: *newMockCollector("bound_metric", 1)}
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.Add("bound", c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st.Bind(ctx)))
+	_, err := reg.Gather()
+	require.NoError(t, err)
+	assert.ErrorIs(t, c.ctx.Err(), context.Canceled)
+}
+
+// failingMock is a failableCollector whose outcome the test controls.
+type failingMock struct {
+	mockCollector
+	fail atomic.Bool
+}
+
+func (f *failingMock) tryCollect(_ context.Context, ch chan<- prometheus.Metric) error {
+	if f.fail.Load() {
+		return assert.AnError
+	}
+	f.Collect(ch)
+	return nil
+}
+
+// TestStatusTracker_LastSuccess checks that the last success timestamp holds
+// through a failure, and is absent until the collector has ever succeeded.
+func TestStatusTracker_LastSuccess(t *testing.T) {
+	flaky := &failingMock{mockCollector: *newMockCollector("slurm_flaky_metric", 1)}
+	never := &failingMock{mockCollector: *newMockCollector("slurm_never_metric", 1)}
+	never.fail.Store(true)
+	st := NewStatusTracker(logger.NewLogger("error"))
+	st.Add("flaky", flaky)
+	st.Add("never", never)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(st))
+	const name = "slurm_exporter_collector_last_success_timestamp_seconds"
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	first, ok := gatheredValue(mfs, name, map[string]string{"collector": "flaky"})
+	require.True(t, ok)
+	_, ok = gatheredValue(mfs, name, map[string]string{"collector": "never"})
+	assert.False(t, ok, "a collector that never succeeded has no timestamp")
+
+	flaky.fail.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	mfs, err = reg.Gather()
+	require.NoError(t, err)
+	again, _ := gatheredValue(mfs, name, map[string]string{"collector": "flaky"})
+	assert.Equal(t, first, again, "a failure keeps the previous success")
+}
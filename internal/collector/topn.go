@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Top-N cardinality limit.
+//
+// Per-user series are most of the exporter's output on a large cluster: 3,000
+// users times every slurm_user_*, slurm_queue_* and slurm_user_rpc_stats*
+// family. Turning the user label off loses the heavy users along with the
+// long tail. With a limit of N, each metric family keeps the N users (or
+// accounts) with the largest values in that family, and folds the rest into
+// one series labelled OtherLabel holding their sum, so the family still adds
+// up to the cluster total.
+//
+// A user's rank is their total across the family's other labels (every
+// partition of slurm_queue_running, say), and the series folded into
+// OtherLabel keep those labels. A family whose values do not add up, like a
+// fairshare factor, cannot be folded: it keeps the users its additive sibling
+// kept, and has no OtherLabel series. The per-user RPC families of sdiag all
+// rank by call count, so that the OtherLabel average can be derived from the
+// folded count and total time.
+
+// OtherLabel is the user or account label value of the series a top-N limit
+// folds the rest into.
+const OtherLabel = "__other__"
+
+// topNKeys returns the n keys of totals with the largest values. Ties are
+// broken by name, so the same input keeps the same keys from one scrape to the
+// next. A nil result means keep every key: n is 0, or there are no more than n.
+func topNKeys(totals map[string]float64, n int) map[string]bool {
+	if n <= 0 || len(totals) <= n {
+		return nil
+	}
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := cmp.Compare(totals[b], totals[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	kept := make(map[string]bool, n)
+	for _, k := range keys[:n] {
+		kept[k] = true
+	}
+	return kept
+}
+
+// limitTopN keeps the n largest values and folds the others into OtherLabel.
+func limitTopN(values map[string]float64, n int) map[string]float64 {
+	return foldKeys(values, topNKeys(values, n))
+}
+
+// foldKeys keeps the keys in kept and folds the others into OtherLabel. A nil
+// kept keeps everything.
+func foldKeys(values map[string]float64, kept map[string]bool) map[string]float64 {
+	if kept == nil {
+		return values
+	}
+	out := make(map[string]float64, len(kept)+1)
+	for k, v := range values {
+		if kept[k] {
+			out[k] = v
+		} else {
+			out[OtherLabel] += v
+		}
+	}
+	return out
+}
+
+// limitNVal applies the limit to the first level of an NVal (user, then
+// partition or account): users are ranked by their total, and the others are
+// folded into OtherLabel per second-level label.
+func limitNVal(m NVal, n int) NVal {
+	return foldNVal(m, topNKeys(nvalTotals(m, nil), n))
+}
+
+// limitNNVal applies the limit to the users of an NNVal (reason, user,
+// partition), ranked across every reason so the family as a whole keeps n.
+func limitNNVal(m NNVal, n int) NNVal {
+	totals := make(map[string]float64)
+	for _, users := range m {
+		nvalTotals(users, totals)
+	}
+	kept := topNKeys(totals, n)
+	if kept == nil {
+		return m
+	}
+	out := make(NNVal, len(m))
+	for reason, users := range m {
+		out[reason] = foldNVal(users, kept)
+	}
+	return out
+}
+
+// nvalTotals adds the total of every first-level key of m into totals, which
+// it allocates when nil.
+func nvalTotals(m NVal, totals map[string]float64) map[string]float64 {
+	if totals == nil {
+		totals = make(map[string]float64, len(m))
+	}
+	for k, inner := range m {
+		for _, v := range inner {
+			totals[k] += v
+		}
+	}
+	return totals
+}
+
+func foldNVal(m NVal, kept map[string]bool) NVal {
+	if kept == nil {
+		return m
+	}
+	out := make(NVal, len(kept)+1)
+	for k, inner := range m {
+		if kept[k] {
+			out[k] = inner
+			continue
+		}
+		if out[OtherLabel] == nil {
+			out[OtherLabel] = make(map[string]float64)
+		}
+		for label, v := range inner {
+			out[OtherLabel][label] += v
+		}
+	}
+	return out
+}
+
+// keepNVal keeps the first-level keys in kept and drops the others, for a
+// family whose values cannot be summed. A nil kept keeps everything.
+func keepNVal(m NVal, kept map[string]bool) NVal {
+	if kept == nil {
+		return m
+	}
+	out := make(NVal, len(kept))
+	for k, inner := range m {
+		if kept[k] {
+			out[k] = inner
+		}
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func TestLimitTopN(t *testing.T) {
+	values := map[string]float64{"alice": 10, "bob": 3, "carol": 7, "dave": 3, "eve": 1}
+
+	assert.Equal(t, values, limitTopN(values, 0), "0 keeps every key")
+	assert.Equal(t, values, limitTopN(values, 5), "a limit no smaller than the set keeps every key, and adds no __other__")
+	assert.Equal(t, map[string]float64{"alice": 10, "carol": 7, OtherLabel: 7}, limitTopN(values, 2))
+	// bob and dave tie; the name decides, so the result is stable.
+	assert.Equal(t, map[string]float64{"alice": 10, "carol": 7, "bob": 3, OtherLabel: 4}, limitTopN(values, 3))
+}
+
+// TestLimitNVal checks that users are ranked by their total across the other
+// label, and that what is folded keeps that label.
+func TestLimitNVal(t *testing.T) {
+	m := NVal{
+		"alice": {"cpu": 1, "gpu": 9},
+		"bob":   {"cpu": 6},
+		"carol": {"cpu": 2, "gpu": 1},
+	}
+	assert.Equal(t, NVal{
+		"alice":    {"cpu": 1, "gpu": 9},
+		OtherLabel: {"cpu": 8, "gpu": 1},
+	}, limitNVal(m, 1))
+}
+
+// TestLimitNNVal checks that the pending families keep n users overall, not n
+// per reason.
+func TestLimitNNVal(t *testing.T) {
+	m := NNVal{
+		"Priority":  {"alice": {"cpu": 5}, "bob": {"cpu": 1}},
+		"Resources": {"bob": {"gpu": 2}, "carol": {"gpu": 4}},
+	}
+	assert.Equal(t, NNVal{
+		"Priority":  {"alice": {"cpu": 5}, OtherLabel: {"cpu": 1}},
+		"Resources": {OtherLabel: {"gpu": 6}},
+	}, limitNNVal(m, 1))
+}
+
+func TestTopN_Collectors(t *testing.T) {
+	resetSqueueJobsCache()
+	t.Cleanup(resetSqueueJobsCache)
+	stubExecute(t, `1|physics|alice|cpu|RUNNING|1|16|cpu=16,node=1
+2|physics|bob|cpu|RUNNING|1|4|cpu=4,node=1
+3|chem|carol|gpu|RUNNING|1|2|cpu=2,node=1
+4|chem|carol|gpu|RUNNING|1|2|cpu=2,node=1
+5|chem|carol|gpu|RUNNING|1|2|cpu=2,node=1`)
+	log := logger.NewLogger("error")
+
+	assert.Equal(t, []string{
+		`slurm_user_cpus_running{user="__other__"} 10`,
+		`slurm_user_cpus_running{user="alice"} 16`,
+	}, gatheredSeries(t, NewUsersCollector(log, 1), "slurm_user_cpus_running"))
+	assert.Equal(t, []string{
+		`slurm_user_jobs_running{user="__other__"} 2`,
+		`slurm_user_jobs_running{user="carol"} 3`,
+	}, gatheredSeries(t, NewUsersCollector(log, 1), "slurm_user_jobs_running"), "each family ranks by its own values")
+	assert.Equal(t, []string{
+		`slurm_account_cpus_running{account="__other__"} 6`,
+		`slurm_account_cpus_running{account="physics"} 20`,
+	}, gatheredSeries(t, NewAccountsCollector(log, 1), "slurm_account_cpus_running"))
+}
+
+func TestTopN_QueueCollector(t *testing.T) {
+	stubExecute(t, `cpu|RUNNING|16|None|alice
+cpu|RUNNING|4|None|bob
+gpu|RUNNING|2|None|carol
+gpu|PENDING|8|Resources|bob
+gpu|PENDING|1|Priority|carol`)
+	c := NewQueueCollector(logger.NewLogger("error"), true, true, 1)
+
+	assert.Equal(t, []string{
+		`slurm_cores_running{partition="cpu",user="__other__"} 4`,
+		`slurm_cores_running{partition="cpu",user="alice"} 16`,
+		`slurm_cores_running{partition="gpu",user="__other__"} 2`,
+	}, gatheredSeries(t, c, "slurm_cores_running"))
+	assert.Equal(t, []string{
+		`slurm_queue_pending{partition="gpu",reason="Priority",user="__other__"} 1`,
+		`slurm_queue_pending{partition="gpu",reason="Resources",user="bob"} 1`,
+	}, gatheredSeries(t, c, "slurm_queue_pending"), "bob and carol tie at one pending job each: bob is kept, by name")
+}
+
+func TestTopN_FairShareCollector(t *testing.T) {
+	stubExecute(t, `physics||100|0.5|1000|0.5|0.6
+physics|alice|10|0.1|900|0.45|0.2
+physics|bob|10|0.1|50|0.025|0.8
+physics|carol|10|0.1|50|0.025|0.9`)
+	c := NewFairShareCollector(logger.NewLogger("error"), true, 1)
+
+	assert.Equal(t, []string{
+		`slurm_user_fairshare_raw_usage_cpu_seconds{account="physics",user="__other__"} 100`,
+		`slurm_user_fairshare_raw_usage_cpu_seconds{account="physics",user="alice"} 900`,
+	}, gatheredSeries(t, c, "slurm_user_fairshare_raw_usage_cpu_seconds"))
+	assert.Equal(t, []string{
+		`slurm_user_fairshare{account="physics",user="alice"} 0.2`,
+	}, gatheredSeries(t, c, "slurm_user_fairshare"), "the factor keeps the heaviest user and has no __other__")
+}
+
+func TestTopN_SchedulerCollector(t *testing.T) {
+	stubExecute(t, `Remote Procedure Call statistics by user
+	alice            (   1000) count:100    ave_time:10    total_time:1000
+	bob              (   1001) count:10     ave_time:50    total_time:500
+	carol            (   1002) count:30     ave_time:50    total_time:1500
+`)
+	c := NewSchedulerCollector(logger.NewLogger("error"), 1)
+
+	assert.Equal(t, []string{
+		`slurm_user_rpc_stats{user="__other__"} 40`,
+		`slurm_user_rpc_stats{user="alice"} 100`,
+	}, gatheredSeries(t, c, "slurm_user_rpc_stats"))
+	assert.Equal(t, []string{
+		`slurm_user_rpc_stats_total_time{user="__other__"} 2000`,
+		`slurm_user_rpc_stats_total_time{user="alice"} 1000`,
+	}, gatheredSeries(t, c, "slurm_user_rpc_stats_total_time"), "ranked by call count, like the average")
+	assert.Equal(t, []string{
+		`slurm_user_rpc_stats_avg_time{user="__other__"} 50`,
+		`slurm_user_rpc_stats_avg_time{user="alice"} 10`,
+	}, gatheredSeries(t, c, "slurm_user_rpc_stats_avg_time"))
+}
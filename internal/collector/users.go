@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,8 +21,8 @@ var (
 // squeue snapshot (SqueueJobsData) — the same single controller query accounts
 // and partitions read (issue #144). The projection emits the exact layout
 // ParseUsersMetrics consumes: "JobID|UserName|State|NumNodes|NumCPUs|tres-alloc".
-func UsersData(logger *logger.Logger) ([]byte, error) {
-	data, err := SqueueJobsData(logger)
+func UsersData(ctx context.Context, logger *logger.Logger) ([]byte, error) {
+	data, err := SqueueJobsData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -68,8 +69,8 @@ func ParseUsersMetrics(input []byte) map[string]*UserJobMetrics {
 	return users
 }
 
-func UsersGetMetrics(logger *logger.Logger) (map[string]*UserJobMetrics, error) {
-	data, err := UsersData(logger)
+func UsersGetMetrics(ctx context.Context, logger *logger.Logger) (map[string]*UserJobMetrics, error) {
+	data, err := UsersData(ctx, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -82,10 +83,15 @@ type UsersCollector struct {
 	runningCpus *prometheus.Desc
 	runningGPUs *prometheus.Desc
 	suspended   *prometheus.Desc
-	logger      *logger.Logger
+	// topN limits the users of each family. 0 keeps them all.
+	topN   int
+	logger *logger.Logger
 }
 
-func NewUsersCollector(logger *logger.Logger) *UsersCollector {
+// NewUsersCollector creates a users metrics collector. topN, when positive,
+// keeps the topN users of each metric family and folds the rest into
+// user="__other__".
+func NewUsersCollector(logger *logger.Logger, topN int) *UsersCollector {
 	labels := []string{"user"}
 	return &UsersCollector{
 		pending:     prometheus.NewDesc("slurm_user_jobs_pending", "Pending jobs for user", labels, nil),
@@ -93,6 +99,7 @@ func NewUsersCollector(logger *logger.Logger) *UsersCollector {
 		runningCpus: prometheus.NewDesc("slurm_user_cpus_running", "Running CPUs for user", labels, nil),
 		runningGPUs: prometheus.NewDesc("slurm_user_gpus_running", "Running GPUs for user", labels, nil),
 		suspended:   prometheus.NewDesc("slurm_user_jobs_suspended", "Suspended jobs for user", labels, nil),
+		topN:        topN,
 		logger:      logger,
 	}
 }
@@ -105,31 +112,32 @@ func (uc *UsersCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- uc.suspended
 }
 
-func (uc *UsersCollector) Collect(ch chan<- prometheus.Metric) { _ = uc.tryCollect(ch) }
+func (uc *UsersCollector) Collect(ch chan<- prometheus.Metric) {
+	_ = uc.tryCollect(context.Background(), ch)
+}
 
-func (uc *UsersCollector) tryCollect(ch chan<- prometheus.Metric) error {
-	um, err := UsersGetMetrics(uc.logger)
+func (uc *UsersCollector) tryCollect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	um, err := UsersGetMetrics(ctx, uc.logger)
 	if err != nil {
 		uc.logger.Error("Failed to parse users metrics", "err", err)
 		return err
 	}
-	for u := range um {
-		if um[u].pending > 0 {
-			ch <- prometheus.MustNewConstMetric(uc.pending, prometheus.GaugeValue, um[u].pending, u)
-		}
-		if um[u].running > 0 {
-			ch <- prometheus.MustNewConstMetric(uc.running, prometheus.GaugeValue, um[u].running, u)
-		}
-		if um[u].runningCpus > 0 {
-			ch <- prometheus.MustNewConstMetric(uc.runningCpus, prometheus.GaugeValue, um[u].runningCpus, u)
-		}
-		if um[u].runningGPUs > 0 {
-			ch <- prometheus.MustNewConstMetric(uc.runningGPUs, prometheus.GaugeValue, um[u].runningGPUs, u)
+	emit := func(desc *prometheus.Desc, value func(*UserJobMetrics) float64) {
+		values := make(map[string]float64, len(um))
+		for u, m := range um {
+			if v := value(m); v > 0 {
+				values[u] = v
+			}
 		}
-		if um[u].suspended > 0 {
-			ch <- prometheus.MustNewConstMetric(uc.suspended, prometheus.GaugeValue, um[u].suspended, u)
+		for u, v := range limitTopN(values, uc.topN) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, u)
 		}
 	}
+	emit(uc.pending, func(m *UserJobMetrics) float64 { return m.pending })
+	emit(uc.running, func(m *UserJobMetrics) float64 { return m.running })
+	emit(uc.runningCpus, func(m *UserJobMetrics) float64 { return m.runningCpus })
+	emit(uc.runningGPUs, func(m *UserJobMetrics) float64 { return m.runningGPUs })
+	emit(uc.suspended, func(m *UserJobMetrics) float64 { return m.suspended })
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -75,14 +76,14 @@ func TestUsersCollector_Collect(t *testing.T) {
 	defer func() { Execute = oldExecute }()
 	resetSqueueJobsCache() // users reads through the shared squeue cache (#144)
 	// Wide shared-snapshot layout: JobID|Account|UserName|Partition|State|NumNodes|NumCPUs|tres-alloc.
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return []byte(`1|acct|alice|cpu|RUNNING|1|4|cpu=4,mem=8G,node=1
 2|acct|bob|cpu|PENDING|1|2|cpu=2,mem=4G,node=1
 3|acct|alice|cpu|RUNNING|1|8|cpu=8,mem=16G,node=1,gres/gpu=2`), nil
 	}
 
 	log := logger.NewLogger("error")
-	c := NewUsersCollector(log)
+	c := NewUsersCollector(log, 0)
 
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
@@ -102,7 +103,7 @@ func TestUsersCollector_Collect(t *testing.T) {
 
 func TestUsersCollector_Describe(t *testing.T) {
 	log := logger.NewLogger("error")
-	c := NewUsersCollector(log)
+	c := NewUsersCollector(log, 0)
 	ch := make(chan *prometheus.Desc, 10)
 	c.Describe(ch)
 	close(ch)
@@ -117,12 +118,12 @@ func TestUsersCollector_ErrorHandling(t *testing.T) {
 	oldExecute := Execute
 	defer func() { Execute = oldExecute }()
 	resetSqueueJobsCache() // a warm shared cache would hide the injected failure (#144)
-	Execute = func(l *logger.Logger, command string, args []string) ([]byte, error) {
+	Execute = func(_ context.Context, l *logger.Logger, command string, args []string) ([]byte, error) {
 		return nil, assert.AnError
 	}
 
 	log := logger.NewLogger("error")
-	c := NewUsersCollector(log)
+	c := NewUsersCollector(log, 0)
 	reg := prometheus.NewRegistry()
 	require.NoError(t, reg.Register(c))
 	mfs, err := reg.Gather()
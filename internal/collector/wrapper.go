@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// commandPlaceholder stands, in a command wrapper, for the whole Slurm command
+// line quoted for a shell.
+const commandPlaceholder = "{{command}}"
+
+// DefaultWrapperExitCodes are the exit statuses that mean the wrapper failed
+// rather than the Slurm command it ran: 255 is ssh's own, 125 is podman's and
+// docker's.
+var DefaultWrapperExitCodes = []int{125, 255}
+
+// commandWrapper runs every Slurm command through another program, such as
+// sudo, ssh or podman exec.
+type commandWrapper struct {
+	// argv is the wrapper template split into words.
+	argv []string
+	// shell is set when the command line reaches a shell on the other side,
+	// which splits it again: ssh joins its arguments and hands them to the
+	// remote shell, and {{command}} is meant for `sh -c`. The Slurm arguments
+	// are quoted for it then, or a format such as %P|%T|%C would become a pipe.
+	shell       bool
+	placeholder bool
+	exitCodes   []int
+}
+
+// wrapper is set once at startup, before any collector runs. nil runs the
+// Slurm commands directly.
+var wrapper *commandWrapper
+
+// SetCommandWrapper makes every Slurm command run through template, for example
+// "ssh -o BatchMode=yes head --" or "podman exec slurm-client". template is
+// split into words the way a POSIX shell would, honouring quotes and
+// backslashes. The Slurm command and its arguments are appended to it, quoted
+// for the remote shell when the wrapper is ssh, or substituted for {{command}}
+// as one shell-quoted string when template holds it. An exit status in
+// exitCodes is reported as a failure of the wrapper. An empty template runs the
+// commands directly.
+//
+// Not safe to call while collectors are running.
+func SetCommandWrapper(template string, exitCodes []int) error {
+	if strings.TrimSpace(template) == "" {
+		wrapper = nil
+		return nil
+	}
+	argv, err := splitWords(template)
+	if err != nil {
+		return fmt.Errorf("command wrapper %q: %w", template, err)
+	}
+	w := &commandWrapper{argv: argv, exitCodes: exitCodes}
+	for _, word := range argv {
+		if strings.Contains(word, commandPlaceholder) {
+			w.placeholder = true
+		}
+	}
+	if strings.Contains(argv[0], commandPlaceholder) {
+		return fmt.Errorf("command wrapper %q: %s cannot be the program to run", template, commandPlaceholder)
+	}
+	w.shell = w.placeholder || filepath.Base(argv[0]) == "ssh"
+	wrapper = w
+	return nil
+}
+
+// CommandWrapper returns the wrapper template split into words, or nil when
+// the Slurm commands run directly.
+func CommandWrapper() []string {
+	if wrapper == nil {
+		return nil
+	}
+	return slices.Clone(wrapper.argv)
+}
+
+// wrap returns the program to run and its arguments for the Slurm command bin
+// with args.
+func (w *commandWrapper) wrap(bin string, args []string) (string, []string) {
+	line := append([]string{bin}, args...)
+	if w.shell {
+		for i, a := range line {
+			line[i] = shellQuote(a)
+		}
+	}
+	if !w.placeholder {
+		return w.argv[0], append(slices.Clone(w.argv[1:]), line...)
+	}
+	joined := strings.Join(line, " ")
+	out := make([]string, 0, len(w.argv)-1)
+	for _, word := range w.argv[1:] {
+		out = append(out, strings.ReplaceAll(word, commandPlaceholder, joined))
+	}
+	return w.argv[0], out
+}
+
+// wrapperError is a Slurm command that failed in its wrapper: the wrapper
+// could not be started, or exited with one of its own exit statuses. Execute
+// counts it apart from the failures of Slurm itself.
+type wrapperError struct {
+	err error
+}
+
+func (e *wrapperError) Error() string { return "command wrapper: " + e.err.Error() }
+
+func (e *wrapperError) Unwrap() error { return e.err }
+
+// classify returns err as a wrapperError when it is the wrapper's failure.
+func (w *commandWrapper) classify(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if slices.Contains(w.exitCodes, exitErr.ExitCode()) {
+			return &wrapperError{err}
+		}
+		return err
+	}
+	// The command did not start at all: the wrapper is missing or not
+	// executable.
+	return &wrapperError{err}
+}
+
+// splitWords splits s into words as a POSIX shell would, without expanding
+// anything: single quotes keep everything literal, double quotes keep all but
+// a backslash before ", \, $ or `, and an unquoted backslash escapes the next
+// character.
+func splitWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	switch {
+	case escaped:
+		return nil, errors.New("trailing backslash")
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, errors.New("no program to run")
+	}
+	return words, nil
+}
+
+// shellQuote quotes s for a POSIX shell. A word of characters no shell treats
+// specially is left as it is, so the command lines in logs stay readable.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
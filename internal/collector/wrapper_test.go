@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"ssh -o BatchMode=yes head --", []string{"ssh", "-o", "BatchMode=yes", "head", "--"}},
+		{"  sudo\t-n  -u slurm ", []string{"sudo", "-n", "-u", "slurm"}},
+		{`ssh -o 'ProxyJump bastion' head`, []string{"ssh", "-o", "ProxyJump bastion", "head"}},
+		{`sh -c "exec {{command}}"`, []string{"sh", "-c", "exec {{command}}"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`"say \"hi\" \n"`, []string{`say "hi" \n`}},
+		{`a\ b 'it'\''s' ""`, []string{"a b", "it's", ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.in)
+		require.NoErrorf(t, err, "%s", tt.in)
+		assert.Equalf(t, tt.want, got, "%s", tt.in)
+	}
+
+	for in, want := range map[string]string{
+		`ssh 'head`: "unterminated ' quote",
+		`ssh "head`: `unterminated " quote`,
+		`ssh head\`: "trailing backslash",
+		"   ":       "no program to run",
+	} {
+		_, err := splitWords(in)
+		assert.ErrorContainsf(t, err, want, "%s", in)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "sinfo", shellQuote("sinfo"))
+	assert.Equal(t, "--format=%n,%C", shellQuote("--format=%n,%C"))
+	assert.Equal(t, "'%P|%T|%C'", shellQuote("%P|%T|%C"))
+	assert.Equal(t, "'Nodes: ,Gres: '", shellQuote("Nodes: ,Gres: "))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	assert.Equal(t, "''", shellQuote(""))
+}
+
+// withWrapper sets the command wrapper for the rest of the test.
+func withWrapper(t *testing.T, template string, exitCodes ...int) {
+	t.Helper()
+	old := wrapper
+	t.Cleanup(func() { wrapper = old })
+	require.NoError(t, SetCommandWrapper(template, exitCodes))
+}
+
+func TestCommandWrapperWrap(t *testing.T) {
+	args := []string{"-h", "-o", "%P|%T|%C"}
+
+	withWrapper(t, "podman exec slurm-client")
+	bin, argv := wrapper.wrap("/opt/slurm/bin/sinfo", args)
+	assert.Equal(t, "podman", bin)
+	assert.Equal(t, []string{"exec", "slurm-client", "/opt/slurm/bin/sinfo", "-h", "-o", "%P|%T|%C"}, argv,
+		"no shell on the other side: the arguments are passed as they are")
+
+	withWrapper(t, "/usr/bin/ssh -o BatchMode=yes head --")
+	bin, argv = wrapper.wrap("sinfo", args)
+	assert.Equal(t, "/usr/bin/ssh", bin)
+	assert.Equal(t, []string{"-o", "BatchMode=yes", "head", "--", "sinfo", "-h", "-o", "'%P|%T|%C'"}, argv,
+		"ssh hands the arguments to a remote shell")
+
+	withWrapper(t, `sudo -n -u slurm sh -c "exec {{command}}"`)
+	bin, argv = wrapper.wrap("sinfo", args)
+	assert.Equal(t, "sudo", bin)
+	assert.Equal(t, []string{"-n", "-u", "slurm", "sh", "-c", "exec sinfo -h -o '%P|%T|%C'"}, argv)
+	assert.Equal(t, []string{"sudo", "-n", "-u", "slurm", "sh", "-c", "exec {{command}}"}, CommandWrapper())
+
+	withWrapper(t, "")
+	assert.Nil(t, CommandWrapper())
+
+	assert.ErrorContains(t, SetCommandWrapper("ssh 'head", nil), "unterminated")
+	assert.ErrorContains(t, SetCommandWrapper("{{command}}", nil), "cannot be the program to run")
+}
+
+// fakeSSH installs a stand-in for ssh: it drops its options up to --, then runs
+// what is left through sh, as the remote side would. It exits 255 when the host
+// is "down", as ssh does when it cannot connect. The Slurm binaries it runs are
+// fake too: sinfo prints its arguments one per line, sdiag fails.
+func fakeSSH(t *testing.T) (ssh, bin string) {
+	t.Helper()
+	dir := t.TempDir()
+	bin = filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(bin, 0o755))
+	ssh = filepath.Join(dir, "ssh")
+	require.NoError(t, os.WriteFile(ssh, []byte(`#!/bin/sh
+while [ "$1" != "--" ]; do
+	if [ "$1" = "down" ]; then
+		echo "ssh: connect to host down port 22: Connection refused" >&2
+		exit 255
+	fi
+	shift
+done
+shift
+exec sh -c "$*"
+`), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sinfo"), []byte("#!/bin/sh\nprintf '%s\\n' \"$@\"\n"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sdiag"), []byte("#!/bin/sh\necho 'slurm_load_ctl_conf error' >&2\nexit 1\n"), 0o755))
+
+	oldBinPath, oldTimeout := binPath, CommandTimeout()
+	SetBinPath(bin)
+	SetCommandTimeout(5 * time.Second)
+	t.Cleanup(func() {
+		SetBinPath(oldBinPath)
+		SetCommandTimeout(oldTimeout)
+	})
+	return ssh, bin
+}
+
+// TestExecuteThroughWrapper runs commands through a stand-in ssh, and checks
+// that the arguments survive the remote shell and that the wrapper's failures
+// are counted apart from Slurm's.
+func TestExecuteThroughWrapper(t *testing.T) {
+	ssh, _ := fakeSSH(t)
+	log := logger.NewLogger("error")
+	ctx := context.Background()
+
+	withWrapper(t, ssh+" -o BatchMode=yes head --", DefaultWrapperExitCodes...)
+	out, err := Execute(ctx, log, "sinfo", []string{"-h", "--Format=Nodes: ,Gres: ", "-o", "%P|%T|%C", "it's"})
+	require.NoError(t, err)
+	assert.Equal(t, "-h\n--Format=Nodes: ,Gres: \n-o\n%P|%T|%C\nit's\n", string(out))
+
+	slurmBefore := testutil.ToFloat64(execErrors.WithLabelValues("sdiag", "slurm"))
+	wrapperBefore := testutil.ToFloat64(execErrors.WithLabelValues("sdiag", "wrapper"))
+
+	_, err = Execute(ctx, log, "sdiag", nil)
+	require.Error(t, err)
+	var werr *wrapperError
+	assert.NotErrorAs(t, err, &werr, "sdiag itself failed")
+
+	withWrapper(t, ssh+" down --", DefaultWrapperExitCodes...)
+	_, err = Execute(ctx, log, "sdiag", nil)
+	require.ErrorAs(t, err, &werr)
+	assert.ErrorContains(t, err, "command wrapper: exit status 255")
+
+	withWrapper(t, filepath.Join(t.TempDir(), "absent")+" head --")
+	_, err = Execute(ctx, log, "sdiag", nil)
+	require.ErrorAs(t, err, &werr, "a wrapper that cannot start is the wrapper's failure")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(execErrors.WithLabelValues("sdiag", "slurm"))-slurmBefore)
+	assert.Equal(t, 2.0, testutil.ToFloat64(execErrors.WithLabelValues("sdiag", "wrapper"))-wrapperBefore)
+}
+
+func TestValidateBinariesThroughWrapper(t *testing.T) {
+	ssh, bin := fakeSSH(t)
+	log := logger.NewLogger("error")
+
+	withWrapper(t, ssh+" head --", DefaultWrapperExitCodes...)
+	errs := ValidateBinaries(log, []string{"sinfo", "squeue"})
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "binary not usable through the command wrapper: squeue")
+
+	// binPath is on the other side of the wrapper: it is not looked at here.
+	SetBinPath(filepath.Join(bin, "..", "..", "elsewhere"))
+	withWrapper(t, "sh -c {{command}}")
+	errs = ValidateBinaries(log, []string{"sinfo"})
+	require.Len(t, errs, 1)
+	assert.NotContains(t, errs[0].Error(), "binary not found:", "no local os.Stat with a wrapper")
+	SetBinPath(bin)
+
+	withWrapper(t, ssh+" down --", DefaultWrapperExitCodes...)
+	errs = ValidateBinaries(log, []string{"sinfo", "squeue", "sdiag"})
+	require.Len(t, errs, 1, "the check stops at the wrapper's first failure")
+	assert.ErrorContains(t, errs[0], "Connection refused")
+
+	withWrapper(t, "no-such-wrapper-on-path head --")
+	errs = ValidateBinaries(log, []string{"sinfo"})
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "command wrapper not found")
+}
@@ -0,0 +1,268 @@
+// Package config loads the exporter's optional YAML configuration file.
+//
+// Every setting in the file also exists as a command-line flag, and a flag
+// given on the command line always wins over the file. The file exists so that
+// collector enablement, per-collector options, timeouts, cache TTLs and
+// relabeling rules can be changed by a reload (SIGHUP, or POST /-/reload
+// behind --web.enable-lifecycle) instead of a restart and a systemd unit edit. Resolving flags against the
+// file is the caller's job: this package only parses and validates.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sckyzo/slurm_exporter/internal/relabel"
+)
+
+// Config is the parsed configuration file. Every field is optional: a zero
+// value, or a nil pointer, means "not set in the file", and the flag value
+// (default or explicit) applies.
+type Config struct {
+	Command    CommandConfig              `yaml:"command"`
+	Cache      map[string]CacheConfig     `yaml:"cache"`
+	Collectors map[string]CollectorConfig `yaml:"collectors"`
+	// Relabel is applied to every scrape's output, in order. It has no flag
+	// equivalent.
+	Relabel []relabel.Rule `yaml:"relabel"`
+}
+
+// CommandConfig holds the settings shared by every Slurm command.
+type CommandConfig struct {
+	// Timeout mirrors --command.timeout.
+	Timeout        *time.Duration       `yaml:"timeout"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig holds the settings of the per-binary circuit breaker.
+type CircuitBreakerConfig struct {
+	// Threshold mirrors --command.circuit-breaker.threshold.
+	Threshold *int `yaml:"threshold"`
+	// Backoff mirrors --command.circuit-breaker.backoff.
+	Backoff *time.Duration `yaml:"backoff"`
+}
+
+// CacheConfig holds the settings of one shared cache, keyed in Config.Cache by
+// the same name the slurm_exporter_cache_age_seconds metric carries.
+type CacheConfig struct {
+	TTL *time.Duration `yaml:"ttl"`
+}
+
+// CollectorConfig holds the settings of one collector.
+//
+// The options are flat rather than nested per collector, so that the file
+// reads like the flags it mirrors (collector.queue.user-label becomes
+// collectors.queue.user_label). Validate rejects an option set on a collector
+// it does not belong to, which is what keeps the flat layout from accepting a
+// typo silently.
+type CollectorConfig struct {
+	// Enabled mirrors --[no-]collector.<name>.
+	Enabled *bool `yaml:"enabled"`
+	// Timeout mirrors --collector.<name>.timeout. Valid on every collector.
+	Timeout *time.Duration `yaml:"timeout"`
+	// RefreshInterval mirrors --collector.<name>.refresh-interval. Valid on
+	// every collector.
+	RefreshInterval *time.Duration `yaml:"refresh_interval"`
+	// StaleMaxAge mirrors --collector.<name>.stale-max-age. Valid on every
+	// collector.
+	StaleMaxAge *time.Duration `yaml:"stale_max_age"`
+	// TopN mirrors --collector.<name>.top-n. Valid on TopNCollectors.
+	TopN *int `yaml:"top_n"`
+
+	FeatureSet     *bool          `yaml:"feature_set"`     // nodes
+	GRES           *bool          `yaml:"gres"`            // node
+	UserLabel      *bool          `yaml:"user_label"`      // queue
+	TerminalStates *bool          `yaml:"terminal_states"` // queue
+	UserMetrics    *bool          `yaml:"user_metrics"`    // fairshare
+	Interval       *time.Duration `yaml:"interval"`        // sacct_efficiency
+	Lookback       *time.Duration `yaml:"lookback"`        // sacct_efficiency
+	Labels         *[]string      `yaml:"labels"`          // jobs
+	MaxJobs        *int           `yaml:"max_jobs"`        // jobs
+	Buckets        *[]float64     `yaml:"buckets"`         // job_wait
+	StateFile      *string        `yaml:"state_file"`      // job_wait
+}
+
+// option describes one per-collector option: the collector it belongs to and
+// how to tell whether the file set it.
+type option struct {
+	collector string
+	set       func(c *CollectorConfig) bool
+}
+
+// collectorOptions lists every per-collector option by its YAML key. Adding an
+// option to CollectorConfig means adding it here, or Validate will never
+// reject it on the wrong collector.
+var collectorOptions = map[string]option{
+	"feature_set":     {"nodes", func(c *CollectorConfig) bool { return c.FeatureSet != nil }},
+	"gres":            {"node", func(c *CollectorConfig) bool { return c.GRES != nil }},
+	"user_label":      {"queue", func(c *CollectorConfig) bool { return c.UserLabel != nil }},
+	"terminal_states": {"queue", func(c *CollectorConfig) bool { return c.TerminalStates != nil }},
+	"user_metrics":    {"fairshare", func(c *CollectorConfig) bool { return c.UserMetrics != nil }},
+	"interval":        {"sacct_efficiency", func(c *CollectorConfig) bool { return c.Interval != nil }},
+	"lookback":        {"sacct_efficiency", func(c *CollectorConfig) bool { return c.Lookback != nil }},
+	"labels":          {"jobs", func(c *CollectorConfig) bool { return c.Labels != nil }},
+	"max_jobs":        {"jobs", func(c *CollectorConfig) bool { return c.MaxJobs != nil }},
+	"buckets":         {"job_wait", func(c *CollectorConfig) bool { return c.Buckets != nil }},
+	"state_file":      {"job_wait", func(c *CollectorConfig) bool { return c.StateFile != nil }},
+}
+
+// TopNCollectors lists the collectors with per-user or per-account series that
+// a top-N limit applies to.
+var TopNCollectors = []string{"accounts", "fairshare", "queue", "scheduler", "users"}
+
+// JobLabels lists the job fields the jobs collector can add as labels to
+// slurm_job_info, on top of the user, account and partition it always has.
+var JobLabels = []string{"name", "qos", "wckey", "comment", "nodelist"}
+
+// CheckJobLabels returns an error naming the first entry of labels that is
+// not in JobLabels.
+func CheckJobLabels(labels []string) error {
+	for _, l := range labels {
+		if !slices.Contains(JobLabels, l) {
+			return fmt.Errorf("unknown job label %q (known: %s)", l, strings.Join(JobLabels, ", "))
+		}
+	}
+	return nil
+}
+
+// CheckBuckets returns an error unless buckets are positive and strictly
+// increasing, as histogram upper bounds must be.
+func CheckBuckets(buckets []float64) error {
+	for i, b := range buckets {
+		if b <= 0 {
+			return fmt.Errorf("bucket %g must be positive", b)
+		}
+		if i > 0 && b <= buckets[i-1] {
+			return fmt.Errorf("bucket %g must be greater than %g", b, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// Load reads and parses the file at path. Unknown keys are an error: a
+// misspelt option that was silently ignored would look applied while the
+// flag default kept running.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: the path is the operator's own --config.file
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a configuration document. An empty document is valid and
+// yields an empty Config.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the file against what the exporter actually has: collectors
+// lists every collector name, caches every shared cache name. All problems are
+// reported at once, so an operator fixing a file does not discover them one
+// reload at a time.
+func (c *Config) Validate(collectors, caches []string) error {
+	var errs []error
+
+	if c.Command.Timeout != nil && *c.Command.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("command.timeout must be positive, got %s", *c.Command.Timeout))
+	}
+	if cb := c.Command.CircuitBreaker; cb.Threshold != nil && *cb.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("command.circuit_breaker.threshold must not be negative, got %d", *cb.Threshold))
+	}
+	if cb := c.Command.CircuitBreaker; cb.Backoff != nil && *cb.Backoff <= 0 {
+		errs = append(errs, fmt.Errorf("command.circuit_breaker.backoff must be positive, got %s", *cb.Backoff))
+	}
+
+	for _, name := range sortedKeys(c.Cache) {
+		if !slices.Contains(caches, name) {
+			errs = append(errs, fmt.Errorf("cache.%s: unknown cache (known: %s)", name, strings.Join(caches, ", ")))
+			continue
+		}
+		if ttl := c.Cache[name].TTL; ttl != nil && *ttl <= 0 {
+			errs = append(errs, fmt.Errorf("cache.%s.ttl must be positive, got %s", name, *ttl))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Collectors) {
+		if !slices.Contains(collectors, name) {
+			errs = append(errs, fmt.Errorf("collectors.%s: unknown collector", name))
+			continue
+		}
+		cc := c.Collectors[name]
+		for _, key := range sortedKeys(collectorOptions) {
+			opt := collectorOptions[key]
+			if opt.set(&cc) && opt.collector != name {
+				errs = append(errs, fmt.Errorf("collectors.%s.%s: option belongs to the %s collector", name, key, opt.collector))
+			}
+		}
+		if cc.Timeout != nil && *cc.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.timeout must be positive, got %s", name, *cc.Timeout))
+		}
+		if cc.RefreshInterval != nil && *cc.RefreshInterval < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.refresh_interval must not be negative, got %s", name, *cc.RefreshInterval))
+		}
+		if cc.StaleMaxAge != nil && *cc.StaleMaxAge < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.stale_max_age must not be negative, got %s", name, *cc.StaleMaxAge))
+		}
+		if cc.TopN != nil && !slices.Contains(TopNCollectors, name) {
+			errs = append(errs, fmt.Errorf("collectors.%s.top_n: option is only valid on the %s collectors", name, strings.Join(TopNCollectors, ", ")))
+		} else if cc.TopN != nil && *cc.TopN < 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.top_n must not be negative, got %d", name, *cc.TopN))
+		}
+		if cc.Interval != nil && *cc.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.interval must be positive, got %s", name, *cc.Interval))
+		}
+		if cc.Lookback != nil && *cc.Lookback <= 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.lookback must be positive, got %s", name, *cc.Lookback))
+		}
+		if cc.Labels != nil {
+			if err := CheckJobLabels(*cc.Labels); err != nil {
+				errs = append(errs, fmt.Errorf("collectors.%s.labels: %w", name, err))
+			}
+		}
+		if cc.MaxJobs != nil && *cc.MaxJobs <= 0 {
+			errs = append(errs, fmt.Errorf("collectors.%s.max_jobs must be positive, got %d", name, *cc.MaxJobs))
+		}
+		if cc.Buckets != nil {
+			if err := CheckBuckets(*cc.Buckets); err != nil {
+				errs = append(errs, fmt.Errorf("collectors.%s.buckets: %w", name, err))
+			}
+		}
+	}
+
+	if _, err := relabel.Compile(c.Relabel); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Collector returns the settings for one collector. A collector absent from
+// the file yields an empty CollectorConfig, so callers never nil-check.
+func (c *Config) Collector(name string) CollectorConfig {
+	return c.Collectors[name]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/relabel"
+)
+
+var (
+	knownCollectors = []string{"nodes", "node", "queue", "fairshare", "sacct_efficiency", "cpus", "jobs", "job_wait"}
+	knownCaches     = []string{"scontrol_nodes", "squeue_jobs"}
+)
+
+func TestParse_FullFile(t *testing.T) {
+	cfg, err := Parse([]byte(`
+command:
+  timeout: 10s
+  circuit_breaker:
+    threshold: 3
+    backoff: 2m
+cache:
+  squeue_jobs:
+    ttl: 55s
+collectors:
+  cpus:
+    enabled: false
+  queue:
+    user_label: false
+    terminal_states: true
+    top_n: 50
+  sacct_efficiency:
+    enabled: true
+    timeout: 2m
+    refresh_interval: 0s
+    stale_max_age: 10m
+    interval: 15m
+    lookback: 2h
+  jobs:
+    enabled: true
+    labels: [name, wckey]
+    max_jobs: 500
+  job_wait:
+    buckets: [60, 3600, 86400]
+    state_file: /var/lib/slurm_exporter/job_wait.json
+relabel:
+  - action: replace
+    source_labels: [node]
+    regex: '([^.]+)\..*'
+    target_label: node
+  - action: hash
+    source_labels: [user]
+    salt: s3cret
+`))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate(knownCollectors, knownCaches))
+
+	assert.Equal(t, 10*time.Second, *cfg.Command.Timeout)
+	assert.Equal(t, 3, *cfg.Command.CircuitBreaker.Threshold)
+	assert.Equal(t, 2*time.Minute, *cfg.Command.CircuitBreaker.Backoff)
+	assert.Equal(t, 55*time.Second, *cfg.Cache["squeue_jobs"].TTL)
+	assert.False(t, *cfg.Collector("cpus").Enabled)
+	assert.False(t, *cfg.Collector("queue").UserLabel)
+	assert.True(t, *cfg.Collector("queue").TerminalStates)
+	assert.Equal(t, 50, *cfg.Collector("queue").TopN)
+	assert.Equal(t, 15*time.Minute, *cfg.Collector("sacct_efficiency").Interval)
+	assert.Equal(t, 2*time.Hour, *cfg.Collector("sacct_efficiency").Lookback)
+	assert.Equal(t, 2*time.Minute, *cfg.Collector("sacct_efficiency").Timeout)
+	assert.Equal(t, time.Duration(0), *cfg.Collector("sacct_efficiency").RefreshInterval)
+	assert.Equal(t, 10*time.Minute, *cfg.Collector("sacct_efficiency").StaleMaxAge)
+	assert.Equal(t, []string{"name", "wckey"}, *cfg.Collector("jobs").Labels)
+	assert.Equal(t, 500, *cfg.Collector("jobs").MaxJobs)
+	assert.Equal(t, []float64{60, 3600, 86400}, *cfg.Collector("job_wait").Buckets)
+	assert.Equal(t, "/var/lib/slurm_exporter/job_wait.json", *cfg.Collector("job_wait").StateFile)
+
+	require.Len(t, cfg.Relabel, 2)
+	assert.Equal(t, relabel.Replace, cfg.Relabel[0].Action)
+	assert.Equal(t, `([^.]+)\..*`, cfg.Relabel[0].Regex)
+	assert.Equal(t, "s3cret", cfg.Relabel[1].Salt)
+
+	// A collector absent from the file reads as "nothing set", not as disabled.
+	assert.Nil(t, cfg.Collector("nodes").Enabled)
+}
+
+func TestParse_EmptyDocument(t *testing.T) {
+	cfg, err := Parse(nil)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate(knownCollectors, knownCaches))
+	assert.Nil(t, cfg.Command.Timeout)
+}
+
+// TestParse_RejectsUnknownKeys is why the decoder runs with KnownFields: a
+// misspelt option would otherwise be dropped silently and the flag default
+// would keep running while the operator believes the file applied.
+func TestParse_RejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("collectors:\n  queue:\n    user_lable: false\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "user_lable")
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	cfg, err := Parse([]byte(`
+command:
+  timeout: 0s
+  circuit_breaker:
+    threshold: -1
+    backoff: 0s
+cache:
+  sinfo:
+    ttl: 10s
+  squeue_jobs:
+    ttl: -1s
+collectors:
+  slurmctld:
+    enabled: true
+  queue:
+    feature_set: true
+    timeout: -5s
+    refresh_interval: -1m
+    stale_max_age: -1s
+    top_n: -1
+  sacct_efficiency:
+    interval: 0s
+    top_n: 10
+  jobs:
+    labels: [name, account]
+    max_jobs: 0
+  job_wait:
+    buckets: [60, 3600, 600]
+relabel:
+  - action: rename
+    source_labels: [user]
+`))
+	require.NoError(t, err)
+
+	err = cfg.Validate(knownCollectors, knownCaches)
+	require.Error(t, err)
+	for _, want := range []string{
+		"command.timeout must be positive",
+		"command.circuit_breaker.threshold must not be negative",
+		"command.circuit_breaker.backoff must be positive",
+		"cache.sinfo: unknown cache",
+		"cache.squeue_jobs.ttl must be positive",
+		"collectors.slurmctld: unknown collector",
+		"collectors.queue.feature_set: option belongs to the nodes collector",
+		"collectors.queue.timeout must be positive",
+		"collectors.queue.refresh_interval must not be negative",
+		"collectors.queue.stale_max_age must not be negative",
+		"collectors.sacct_efficiency.interval must be positive",
+		"collectors.queue.top_n must not be negative",
+		"collectors.sacct_efficiency.top_n: option is only valid on the accounts, fairshare, queue, scheduler, users collectors",
+		`collectors.jobs.labels: unknown job label "account" (known: name, qos, wckey, comment, nodelist)`,
+		"collectors.jobs.max_jobs must be positive, got 0",
+		"collectors.job_wait.buckets: bucket 600 must be greater than 3600",
+		`relabel[0]: unknown action "rename"`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "absent.yml"))
+	require.Error(t, err)
+}
+
+func TestLoad_ReadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slurm_exporter.yml")
+	require.NoError(t, os.WriteFile(path, []byte("command:\n  timeout: 7s\n"), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Second, *cfg.Command.Timeout)
+}
@@ -0,0 +1,357 @@
+package otlp
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// instrumentationScope names the scope every metric is reported under.
+const instrumentationScope = "github.com/sckyzo/slurm_exporter"
+
+// Field numbers of the OTLP messages, from opentelemetry/proto/collector/
+// metrics/v1/metrics_service.proto, opentelemetry/proto/metrics/v1/metrics.proto
+// and the common and resource protos they import. As for remote_write, the
+// messages are written by hand rather than pulling in the OpenTelemetry SDK for
+// its generated code.
+const (
+	requestResourceMetrics = 1
+
+	resourceMetricsResource = 1
+	resourceMetricsScope    = 2
+
+	resourceAttributes = 1
+
+	scopeMetricsScope   = 1
+	scopeMetricsMetrics = 2
+
+	scopeName    = 1
+	scopeVersion = 2
+
+	keyValueKey   = 1
+	keyValueValue = 2
+	anyValueStr   = 1
+
+	metricName        = 1
+	metricDescription = 2
+	metricGauge       = 5
+	metricSum         = 7
+	metricHistogram   = 9
+	metricSummary     = 11
+
+	// Gauge, Sum, Histogram and Summary all hold their points in field 1.
+	dataPoints             = 1
+	aggregationTemporality = 2
+	sumIsMonotonic         = 3
+
+	numberStart      = 2
+	numberTime       = 3
+	numberAsDouble   = 4
+	numberAttributes = 7
+
+	histogramStart        = 2
+	histogramTime         = 3
+	histogramCount        = 4
+	histogramSum          = 5
+	histogramBucketCounts = 6
+	histogramBounds       = 7
+	histogramAttributes   = 9
+
+	summaryStart      = 2
+	summaryTime       = 3
+	summaryCount      = 4
+	summarySum        = 5
+	summaryQuantiles  = 6
+	summaryAttributes = 7
+
+	quantileQuantile = 1
+	quantileValue    = 2
+
+	partialSuccess         = 1
+	partialSuccessRejected = 1
+	partialSuccessMessage  = 2
+)
+
+// temporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE: a Prometheus
+// counter or histogram holds everything since the exporter started.
+const temporalityCumulative = 2
+
+// encodeRequest returns mfs as an ExportMetricsServiceRequest with a single
+// resource, described by resource, and a single scope. The metrics keep their
+// Prometheus names and labels, so the same queries work on both sides:
+//   - a gauge or an untyped metric becomes a Gauge;
+//   - a counter becomes a monotonic, cumulative Sum;
+//   - a histogram becomes a cumulative Histogram with explicit bounds;
+//   - a summary becomes a Summary;
+//   - a gauge histogram is dropped: its buckets go down as well as up, which
+//     no cumulative Histogram can carry, and OTLP has no gauge counterpart.
+//
+// Cumulative points start at start, the exporter's start time: a reload
+// carries the counters over rather than restarting them. A point with no
+// timestamp of its own is stamped now.
+func encodeRequest(mfs []*dto.MetricFamily, resource map[string]string, start, now time.Time) []byte {
+	var scope []byte
+	scope = protowire.AppendTag(scope, scopeName, protowire.BytesType)
+	scope = protowire.AppendString(scope, instrumentationScope)
+	scope = protowire.AppendTag(scope, scopeVersion, protowire.BytesType)
+	scope = protowire.AppendString(scope, version.Version)
+
+	var sm []byte
+	sm = protowire.AppendTag(sm, scopeMetricsScope, protowire.BytesType)
+	sm = protowire.AppendBytes(sm, scope)
+	for _, mf := range mfs {
+		if m := encodeMetric(mf, uint64(start.UnixNano()), uint64(now.UnixNano())); m != nil {
+			sm = protowire.AppendTag(sm, scopeMetricsMetrics, protowire.BytesType)
+			sm = protowire.AppendBytes(sm, m)
+		}
+	}
+
+	var res []byte
+	for _, k := range slices.Sorted(maps.Keys(resource)) {
+		res = appendAttribute(res, resourceAttributes, k, resource[k])
+	}
+
+	var rm []byte
+	rm = protowire.AppendTag(rm, resourceMetricsResource, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, res)
+	rm = protowire.AppendTag(rm, resourceMetricsScope, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, sm)
+
+	var b []byte
+	b = protowire.AppendTag(b, requestResourceMetrics, protowire.BytesType)
+	return protowire.AppendBytes(b, rm)
+}
+
+// encodeMetric writes one Metric, or returns nil for a family it cannot
+// represent.
+func encodeMetric(mf *dto.MetricFamily, startNs, nowNs uint64) []byte {
+	var field protowire.Number
+	var data []byte
+	switch mf.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		field = metricGauge
+		for _, m := range mf.GetMetric() {
+			v := m.GetGauge().GetValue()
+			if mf.GetType() == dto.MetricType_UNTYPED {
+				v = m.GetUntyped().GetValue()
+			}
+			data = appendPoint(data, encodeNumberPoint(m, 0, timestamp(m, nowNs), v))
+		}
+	case dto.MetricType_COUNTER:
+		field = metricSum
+		for _, m := range mf.GetMetric() {
+			data = appendPoint(data, encodeNumberPoint(m, startNs, timestamp(m, nowNs), m.GetCounter().GetValue()))
+		}
+		data = protowire.AppendTag(data, aggregationTemporality, protowire.VarintType)
+		data = protowire.AppendVarint(data, temporalityCumulative)
+		data = protowire.AppendTag(data, sumIsMonotonic, protowire.VarintType)
+		data = protowire.AppendVarint(data, 1)
+	case dto.MetricType_HISTOGRAM:
+		field = metricHistogram
+		for _, m := range mf.GetMetric() {
+			data = appendPoint(data, encodeHistogramPoint(m, startNs, timestamp(m, nowNs)))
+		}
+		data = protowire.AppendTag(data, aggregationTemporality, protowire.VarintType)
+		data = protowire.AppendVarint(data, temporalityCumulative)
+	case dto.MetricType_SUMMARY:
+		field = metricSummary
+		for _, m := range mf.GetMetric() {
+			data = appendPoint(data, encodeSummaryPoint(m, startNs, timestamp(m, nowNs)))
+		}
+	default:
+		return nil
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, metricName, protowire.BytesType)
+	b = protowire.AppendString(b, mf.GetName())
+	b = protowire.AppendTag(b, metricDescription, protowire.BytesType)
+	b = protowire.AppendString(b, mf.GetHelp())
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, data)
+}
+
+func encodeNumberPoint(m *dto.Metric, startNs, timeNs uint64, value float64) []byte {
+	b := appendLabels(nil, numberAttributes, m.GetLabel())
+	if startNs != 0 {
+		b = protowire.AppendTag(b, numberStart, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, startNs)
+	}
+	b = protowire.AppendTag(b, numberTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, timeNs)
+	b = protowire.AppendTag(b, numberAsDouble, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(value))
+}
+
+// encodeHistogramPoint turns Prometheus' cumulative buckets into OTLP's
+// per-bucket counts. OTLP's last bucket is implicitly unbounded, so a +Inf
+// bound is dropped and its count goes to that last bucket.
+func encodeHistogramPoint(m *dto.Metric, startNs, timeNs uint64) []byte {
+	h := m.GetHistogram()
+	var bounds []float64
+	var counts []uint64
+	prev := uint64(0)
+	for _, bk := range h.GetBucket() {
+		if math.IsInf(bk.GetUpperBound(), +1) {
+			continue
+		}
+		bounds = append(bounds, bk.GetUpperBound())
+		counts = append(counts, bk.GetCumulativeCount()-prev)
+		prev = bk.GetCumulativeCount()
+	}
+	counts = append(counts, h.GetSampleCount()-prev)
+
+	b := appendLabels(nil, histogramAttributes, m.GetLabel())
+	b = protowire.AppendTag(b, histogramStart, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, startNs)
+	b = protowire.AppendTag(b, histogramTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, timeNs)
+	b = protowire.AppendTag(b, histogramCount, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, h.GetSampleCount())
+	b = protowire.AppendTag(b, histogramSum, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(h.GetSampleSum()))
+
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendFixed64(packed, c)
+	}
+	b = protowire.AppendTag(b, histogramBucketCounts, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	if len(bounds) > 0 {
+		packed = packed[:0]
+		for _, bound := range bounds {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(bound))
+		}
+		b = protowire.AppendTag(b, histogramBounds, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b
+}
+
+func encodeSummaryPoint(m *dto.Metric, startNs, timeNs uint64) []byte {
+	s := m.GetSummary()
+	b := appendLabels(nil, summaryAttributes, m.GetLabel())
+	b = protowire.AppendTag(b, summaryStart, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, startNs)
+	b = protowire.AppendTag(b, summaryTime, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, timeNs)
+	b = protowire.AppendTag(b, summaryCount, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, s.GetSampleCount())
+	b = protowire.AppendTag(b, summarySum, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(s.GetSampleSum()))
+	for _, q := range s.GetQuantile() {
+		var qb []byte
+		qb = protowire.AppendTag(qb, quantileQuantile, protowire.Fixed64Type)
+		qb = protowire.AppendFixed64(qb, math.Float64bits(q.GetQuantile()))
+		qb = protowire.AppendTag(qb, quantileValue, protowire.Fixed64Type)
+		qb = protowire.AppendFixed64(qb, math.Float64bits(q.GetValue()))
+		b = protowire.AppendTag(b, summaryQuantiles, protowire.BytesType)
+		b = protowire.AppendBytes(b, qb)
+	}
+	return b
+}
+
+func appendPoint(b, point []byte) []byte {
+	b = protowire.AppendTag(b, dataPoints, protowire.BytesType)
+	return protowire.AppendBytes(b, point)
+}
+
+// appendLabels writes a metric's labels as string attributes, sorted by name.
+func appendLabels(b []byte, field protowire.Number, pairs []*dto.LabelPair) []byte {
+	pairs = slices.SortedFunc(slices.Values(pairs), func(a, b *dto.LabelPair) int {
+		return cmp.Compare(a.GetName(), b.GetName())
+	})
+	for _, p := range pairs {
+		b = appendAttribute(b, field, p.GetName(), p.GetValue())
+	}
+	return b
+}
+
+// appendAttribute writes one KeyValue holding a string.
+func appendAttribute(b []byte, field protowire.Number, key, value string) []byte {
+	var v []byte
+	v = protowire.AppendTag(v, anyValueStr, protowire.BytesType)
+	v = protowire.AppendString(v, value)
+	var kv []byte
+	kv = protowire.AppendTag(kv, keyValueKey, protowire.BytesType)
+	kv = protowire.AppendString(kv, key)
+	kv = protowire.AppendTag(kv, keyValueValue, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, v)
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, kv)
+}
+
+// timestamp returns a metric's own timestamp, in nanoseconds, or nowNs.
+func timestamp(m *dto.Metric, nowNs uint64) uint64 {
+	if m.TimestampMs != nil {
+		return uint64(m.GetTimestampMs()) * uint64(time.Millisecond)
+	}
+	return nowNs
+}
+
+// decodePartialSuccess reads the partial_success of an
+// ExportMetricsServiceResponse: how many points the receiver rejected, and
+// why. A malformed or empty response reads as no rejection.
+func decodePartialSuccess(resp []byte) (rejected int64, msg string) {
+	ps := bytesField(resp, partialSuccess)
+	for len(ps) > 0 {
+		num, typ, n := protowire.ConsumeTag(ps)
+		if n < 0 {
+			return rejected, msg
+		}
+		ps = ps[n:]
+		switch {
+		case num == partialSuccessRejected && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(ps)
+			if n < 0 {
+				return rejected, msg
+			}
+			rejected, ps = int64(v), ps[n:]
+		case num == partialSuccessMessage && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(ps)
+			if n < 0 {
+				return rejected, msg
+			}
+			msg, ps = string(v), ps[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, ps)
+			if n < 0 {
+				return rejected, msg
+			}
+			ps = ps[n:]
+		}
+	}
+	return rejected, msg
+}
+
+// bytesField returns the last length-delimited field num of msg, nil if absent.
+func bytesField(msg []byte, num protowire.Number) []byte {
+	var out []byte
+	for len(msg) > 0 {
+		n, typ, l := protowire.ConsumeTag(msg)
+		if l < 0 {
+			return out
+		}
+		msg = msg[l:]
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(msg)
+			if l < 0 {
+				return out
+			}
+			out, msg = v, msg[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, msg)
+		if l < 0 {
+			return out
+		}
+		msg = msg[l:]
+	}
+	return out
+}
@@ -0,0 +1,319 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// request is a decoded ExportMetricsServiceRequest, holding what the tests
+// look at.
+type request struct {
+	resource map[string]string
+	scope    string
+	metrics  map[string]metric
+}
+
+type metric struct {
+	description string
+	kind        protowire.Number
+	temporality uint64
+	monotonic   bool
+	points      []point
+}
+
+// point is one data point of any kind, its attributes printed as a scrape
+// prints labels: {a="1",b="2"}, in the order received.
+type point struct {
+	attrs       string
+	start, time uint64
+	value       float64
+	count       uint64
+	sum         float64
+	buckets     []uint64
+	bounds      []float64
+	quantiles   map[float64]float64
+}
+
+// decodeRequest reads a request the way a collector does, failing on anything
+// that is not well-formed.
+func decodeRequest(t *testing.T, raw []byte) request {
+	t.Helper()
+	r := request{resource: map[string]string{}, metrics: map[string]metric{}}
+	fields(t, raw, func(num protowire.Number, b []byte, _ uint64) {
+		require.EqualValues(t, requestResourceMetrics, num)
+		fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+			switch num {
+			case resourceMetricsResource:
+				fields(t, b, func(_ protowire.Number, b []byte, _ uint64) {
+					k, v := decodeAttribute(t, b)
+					r.resource[k] = v
+				})
+			case resourceMetricsScope:
+				fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+					switch num {
+					case scopeMetricsScope:
+						fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+							if num == scopeName {
+								r.scope = string(b)
+							}
+						})
+					case scopeMetricsMetrics:
+						name, m := decodeMetric(t, b)
+						r.metrics[name] = m
+					}
+				})
+			}
+		})
+	})
+	return r
+}
+
+func decodeMetric(t *testing.T, b []byte) (string, metric) {
+	t.Helper()
+	var name string
+	var m metric
+	fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+		switch num {
+		case metricName:
+			name = string(b)
+		case metricDescription:
+			m.description = string(b)
+		default:
+			m.kind = num
+			fields(t, b, func(num protowire.Number, b []byte, v uint64) {
+				switch num {
+				case dataPoints:
+					m.points = append(m.points, decodePoint(t, m.kind, b))
+				case aggregationTemporality:
+					m.temporality = v
+				case sumIsMonotonic:
+					m.monotonic = v == 1
+				}
+			})
+		}
+	})
+	return name, m
+}
+
+func decodePoint(t *testing.T, kind protowire.Number, b []byte) point {
+	t.Helper()
+	var p point
+	var attrs []string
+	fields(t, b, func(num protowire.Number, b []byte, v uint64) {
+		switch {
+		case num == numberStart, num == histogramStart:
+			p.start = v
+		case num == numberTime, num == histogramTime:
+			p.time = v
+		case kind == metricHistogram && num == histogramAttributes,
+			kind != metricHistogram && num == numberAttributes:
+			k, v := decodeAttribute(t, b)
+			attrs = append(attrs, k+`="`+v+`"`)
+		case kind == metricHistogram && num == histogramBucketCounts:
+			for ; len(b) >= 8; b = b[8:] {
+				p.buckets = append(p.buckets, binary.LittleEndian.Uint64(b))
+			}
+		case kind == metricHistogram && num == histogramBounds:
+			for ; len(b) >= 8; b = b[8:] {
+				p.bounds = append(p.bounds, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			}
+		case kind == metricSummary && num == summaryQuantiles:
+			var q, value float64
+			fields(t, b, func(num protowire.Number, _ []byte, v uint64) {
+				if num == quantileQuantile {
+					q = math.Float64frombits(v)
+				} else {
+					value = math.Float64frombits(v)
+				}
+			})
+			if p.quantiles == nil {
+				p.quantiles = map[float64]float64{}
+			}
+			p.quantiles[q] = value
+		case num == numberAsDouble && (kind == metricGauge || kind == metricSum):
+			p.value = math.Float64frombits(v)
+		case num == histogramCount: // summaryCount too
+			p.count = v
+		case num == histogramSum: // summarySum too
+			p.sum = math.Float64frombits(v)
+		}
+	})
+	p.attrs = "{" + strings.Join(attrs, ",") + "}"
+	return p
+}
+
+func decodeAttribute(t *testing.T, b []byte) (key, value string) {
+	t.Helper()
+	fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+		if num == keyValueKey {
+			key = string(b)
+			return
+		}
+		fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+			require.EqualValues(t, anyValueStr, num)
+			value = string(b)
+		})
+	})
+	return key, value
+}
+
+// fields calls fn for each field of a message: b for a length-delimited one,
+// v for a varint or a fixed64.
+func fields(t *testing.T, msg []byte, fn func(num protowire.Number, b []byte, v uint64)) {
+	t.Helper()
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		require.GreaterOrEqual(t, n, 0, "bad tag")
+		msg = msg[n:]
+		switch typ {
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, b, 0)
+			msg = msg[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, nil, v)
+			msg = msg[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, nil, v)
+			msg = msg[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "slurm_nodes_idle", Help: "Idle nodes."}, []string{"partition", "cluster"})
+	gauge.WithLabelValues("cpu", "a").Set(12)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "slurm_scheduler_backfilled_jobs_total", Help: "Backfilled jobs."})
+	counter.Add(7)
+	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "slurm_exporter_command_duration_seconds", Help: "Command durations.", Buckets: []float64{1, 10},
+	}, []string{"command"})
+	hist.WithLabelValues("squeue").Observe(0.5)
+	hist.WithLabelValues("squeue").Observe(5)
+	hist.WithLabelValues("squeue").Observe(50)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "slurm_rpc_seconds", Help: "RPCs.", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(2)
+	reg.MustRegister(gauge, counter, hist, summary)
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	start := time.Unix(1700000000, 0)
+	now := start.Add(time.Minute)
+	r := decodeRequest(t, encodeRequest(mfs, map[string]string{"service.name": "slurm_exporter", "slurm.cluster.name": "a"}, start, now))
+
+	assert.Equal(t, map[string]string{"service.name": "slurm_exporter", "slurm.cluster.name": "a"}, r.resource)
+	assert.Equal(t, instrumentationScope, r.scope)
+	require.Len(t, r.metrics, 4)
+	startNs, nowNs := uint64(start.UnixNano()), uint64(now.UnixNano())
+
+	assert.Equal(t, metric{
+		description: "Idle nodes.",
+		kind:        metricGauge,
+		points:      []point{{attrs: `{cluster="a",partition="cpu"}`, time: nowNs, value: 12}},
+	}, r.metrics["slurm_nodes_idle"], "attributes are sorted by name; a gauge has no start time")
+
+	assert.Equal(t, metric{
+		description: "Backfilled jobs.",
+		kind:        metricSum,
+		temporality: temporalityCumulative,
+		monotonic:   true,
+		points:      []point{{attrs: "{}", start: startNs, time: nowNs, value: 7}},
+	}, r.metrics["slurm_scheduler_backfilled_jobs_total"], "counters keep their name, _total included")
+
+	assert.Equal(t, metric{
+		description: "Command durations.",
+		kind:        metricHistogram,
+		temporality: temporalityCumulative,
+		points: []point{{
+			attrs: `{command="squeue"}`, start: startNs, time: nowNs,
+			count: 3, sum: 55.5, buckets: []uint64{1, 1, 1}, bounds: []float64{1, 10},
+		}},
+	}, r.metrics["slurm_exporter_command_duration_seconds"], "buckets are per bucket, not cumulative, with an implicit +Inf")
+
+	assert.Equal(t, metric{
+		description: "RPCs.",
+		kind:        metricSummary,
+		points: []point{{
+			attrs: "{}", start: startNs, time: nowNs,
+			count: 1, sum: 2, quantiles: map[float64]float64{0.5: 2},
+		}},
+	}, r.metrics["slurm_rpc_seconds"])
+}
+
+func TestEncodeRequest_InfBucketAndOwnTimestamp(t *testing.T) {
+	mfs := []*dto.MetricFamily{{
+		Name: new("slurm_wait_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount: new(uint64(4)),
+				SampleSum:   new(20.0),
+				Bucket: []*dto.Bucket{
+					{UpperBound: new(5.0), CumulativeCount: new(uint64(2))},
+					{UpperBound: new(math.Inf(+1)), CumulativeCount: new(uint64(4))},
+				},
+			},
+			TimestampMs: new(int64(1600000000000)),
+		}},
+	}}
+	r := decodeRequest(t, encodeRequest(mfs, nil, time.Unix(1, 0), time.Unix(2, 0)))
+	p := r.metrics["slurm_wait_seconds"].points
+	require.Len(t, p, 1)
+	assert.Equal(t, []float64{5}, p[0].bounds, "the +Inf bound is implicit")
+	assert.Equal(t, []uint64{2, 2}, p[0].buckets)
+	assert.Equal(t, uint64(1600000000000)*uint64(time.Millisecond), p[0].time)
+}
+
+func TestEncodeRequest_DropsGaugeHistogram(t *testing.T) {
+	mfs := []*dto.MetricFamily{{
+		Name: new("slurm_queue_age_seconds"),
+		Type: dto.MetricType_GAUGE_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount: new(uint64(1)),
+				SampleSum:   new(3.0),
+				Bucket:      []*dto.Bucket{{UpperBound: new(5.0), CumulativeCount: new(uint64(1))}},
+			},
+		}},
+	}}
+	r := decodeRequest(t, encodeRequest(mfs, nil, time.Unix(1, 0), time.Unix(2, 0)))
+	assert.Empty(t, r.metrics, "a gauge histogram is not sent as a cumulative Histogram")
+}
+
+func TestDecodePartialSuccess(t *testing.T) {
+	var ps []byte
+	ps = protowire.AppendTag(ps, partialSuccessRejected, protowire.VarintType)
+	ps = protowire.AppendVarint(ps, 3)
+	ps = protowire.AppendTag(ps, partialSuccessMessage, protowire.BytesType)
+	ps = protowire.AppendString(ps, "bad points")
+	var resp []byte
+	resp = protowire.AppendTag(resp, partialSuccess, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, ps)
+
+	rejected, msg := decodePartialSuccess(resp)
+	assert.EqualValues(t, 3, rejected)
+	assert.Equal(t, "bad points", msg)
+
+	rejected, msg = decodePartialSuccess(nil)
+	assert.Zero(t, rejected)
+	assert.Empty(t, msg)
+	rejected, _ = decodePartialSuccess([]byte{0xff})
+	assert.Zero(t, rejected, "garbage reads as no rejection")
+}
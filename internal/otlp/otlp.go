@@ -0,0 +1,371 @@
+// Package otlp sends the exporter's metrics to an OpenTelemetry collector over
+// OTLP, for platforms that ingest OTLP rather than scrape Prometheus.
+//
+// An Exporter collects on an interval, the same metrics /metrics serves, and
+// sends them as an ExportMetricsServiceRequest over OTLP/HTTP (binary protobuf)
+// or OTLP/gRPC. It runs beside the Prometheus handler, so both kinds of
+// consumer can be served during a migration. OTLP points are cumulative and
+// every export carries the whole state, so a failed export is not retried: the
+// next one makes up for it.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Protocol is the OTLP transport, named as OTEL_EXPORTER_OTLP_PROTOCOL names
+// it.
+type Protocol string
+
+const (
+	// HTTPProtobuf posts binary protobuf to the collector's /v1/metrics,
+	// usually on port 4318.
+	HTTPProtobuf Protocol = "http/protobuf"
+	// GRPC calls the collector's MetricsService/Export, usually on port 4317.
+	GRPC Protocol = "grpc"
+)
+
+// Defaults applied to the zero value of the matching Options field.
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultTimeout  = 10 * time.Second
+)
+
+// DefaultServiceName is the service.name resource attribute when none is
+// given.
+const DefaultServiceName = "slurm_exporter"
+
+// httpPath is where OTLP/HTTP metrics go, appended to an endpoint with no path;
+// grpcPath is the gRPC method exporting them.
+const (
+	httpPath = "/v1/metrics"
+	grpcPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+// Options configures an Exporter.
+type Options struct {
+	// Endpoint is the collector's address: http(s)://host:4318, or the full
+	// /v1/metrics URL, with HTTPProtobuf; http(s)://host:4317 with GRPC,
+	// plain http meaning HTTP/2 without TLS.
+	Endpoint string
+	Protocol Protocol
+	// Interval is the time between two exports. Empty means DefaultInterval.
+	Interval time.Duration
+	// Timeout bounds each export. Empty means DefaultTimeout.
+	Timeout time.Duration
+	// Headers are added to every request, typically for authentication.
+	Headers map[string]string
+	// Resource describes the exporter and its cluster, as resource
+	// attributes. service.name defaults to DefaultServiceName and
+	// service.version to the exporter's version.
+	Resource map[string]string
+	// HTTPClient carries the authentication and TLS settings. nil means a
+	// client of the package's own. It cannot be used for gRPC over plain
+	// http, which needs an HTTP/2 transport without TLS.
+	HTTPClient *http.Client
+	// Gather collects the metrics to send. ctx ends when the Exporter stops.
+	Gather func(ctx context.Context) ([]*dto.MetricFamily, error)
+	// Registerer, when set, receives the Exporter's own metrics.
+	Registerer prometheus.Registerer
+}
+
+// Exporter sends the metrics Gather returns, on an interval.
+type Exporter struct {
+	log      *logger.Logger
+	o        Options
+	url      *url.URL
+	http     *http.Client
+	resource map[string]string
+	start    time.Time
+	metrics  otlpMetrics
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+}
+
+// New validates the options and registers the Exporter's metrics. Nothing is
+// sent before Run.
+func New(log *logger.Logger, o Options) (*Exporter, error) {
+	if o.Endpoint == "" {
+		return nil, errors.New("OTLP endpoint is required")
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OTLP endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("OTLP endpoint %q: scheme must be http or https", o.Endpoint)
+	}
+	client := o.HTTPClient
+	switch o.Protocol {
+	case HTTPProtobuf:
+		if u.Path == "" || u.Path == "/" {
+			u.Path = httpPath
+		}
+		if client == nil {
+			client = &http.Client{}
+		}
+	case GRPC:
+		if u.Path != "" && u.Path != "/" {
+			return nil, fmt.Errorf("OTLP endpoint %q: a gRPC endpoint takes no path", o.Endpoint)
+		}
+		u.Path = grpcPath
+		if client == nil {
+			client = &http.Client{Transport: grpcTransport(u.Scheme == "http")}
+		} else if u.Scheme == "http" {
+			return nil, errors.New("gRPC over plain http needs an HTTP/2 transport without TLS: use https, or headers for authentication")
+		}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", o.Protocol)
+	}
+	if o.Gather == nil {
+		return nil, errors.New("nothing to gather")
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	resource := map[string]string{
+		"service.name":    DefaultServiceName,
+		"service.version": version.Version,
+	}
+	maps.Copy(resource, o.Resource)
+	e := &Exporter{
+		log:      log,
+		o:        o,
+		url:      u,
+		http:     client,
+		resource: resource,
+		start:    time.Now(),
+		metrics:  newOTLPMetrics(),
+		now:      time.Now,
+	}
+	if o.Registerer != nil {
+		if err := e.metrics.register(o.Registerer); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// grpcTransport returns a transport speaking HTTP/2 only, as gRPC requires:
+// over TLS, or in clear text with prior knowledge when plaintext is set.
+func grpcTransport(plaintext bool) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Protocols = new(http.Protocols)
+	if plaintext {
+		t.Protocols.SetUnencryptedHTTP2(true)
+	} else {
+		t.Protocols.SetHTTP2(true)
+	}
+	return t
+}
+
+// Run exports at once, then on every interval, until ctx ends.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.o.Interval)
+	defer ticker.Stop()
+	for {
+		e.exportOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exportOnce collects and sends one set of metrics.
+func (e *Exporter) exportOnce(ctx context.Context) {
+	now := e.now()
+	mfs, err := e.o.Gather(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// As promhttp.ContinueOnError: what was gathered is still worth
+		// sending.
+		e.log.Warn("Gathering metrics to export returned an error", "err", err)
+	}
+	payload := encodeRequest(mfs, e.resource, e.start, now)
+
+	ctx, cancel := context.WithTimeout(ctx, e.o.Timeout)
+	defer cancel()
+	var resp []byte
+	if e.o.Protocol == GRPC {
+		resp, err = e.callGRPC(ctx, payload)
+	} else {
+		resp, err = e.postHTTP(ctx, payload)
+	}
+	if err != nil {
+		// A cancelled context means the exporter is stopping: nothing to report.
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			e.log.Error("OTLP export failed", "endpoint", e.url.Redacted(), "err", err)
+		}
+		e.metrics.exports.WithLabelValues("error").Inc()
+		return
+	}
+	e.metrics.exports.WithLabelValues("success").Inc()
+	e.metrics.lastSuccess.Set(float64(e.now().UnixNano()) / 1e9)
+	if rejected, msg := decodePartialSuccess(resp); rejected > 0 || msg != "" {
+		e.log.Warn("OTLP collector rejected part of the export", "rejected_points", rejected, "message", msg)
+		e.metrics.rejected.Add(float64(rejected))
+	}
+}
+
+// postHTTP posts one request over OTLP/HTTP and returns the response body.
+func (e *Exporter) postHTTP(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := e.newRequest(ctx, payload, "application/x-protobuf")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		// The body is a google.rpc.Status, binary: only its length is told.
+		return nil, fmt.Errorf("collector returned HTTP status %d (%d bytes of details)", resp.StatusCode, len(body))
+	}
+	return body, err
+}
+
+// callGRPC makes one unary gRPC call of MetricsService/Export and returns the
+// response message. The call is a POST carrying a single length-prefixed
+// message; its outcome is in the grpc-status trailer, or in the headers of a
+// response that carries nothing else.
+func (e *Exporter) callGRPC(ctx context.Context, payload []byte) ([]byte, error) {
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	req, err := e.newRequest(ctx, append(frame, payload...), "application/grpc")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("TE", "trailers")
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("collector returned HTTP status %d", resp.StatusCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	status, msg := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msg = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if msg, err := url.PathUnescape(msg); err == nil && msg != "" {
+			return nil, fmt.Errorf("collector returned gRPC status %s: %s", status, msg)
+		}
+		return nil, fmt.Errorf("collector returned gRPC status %q", status)
+	}
+	if len(body) < 5 {
+		return nil, nil
+	}
+	if body[0] != 0 {
+		// Compressed, which was not asked for: the partial success is lost,
+		// the export itself went through.
+		return nil, nil
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if int(n) > len(body)-5 {
+		return nil, errors.New("truncated gRPC response")
+	}
+	return body[5 : 5+n], nil
+}
+
+func (e *Exporter) newRequest(ctx context.Context, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.o.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "slurm_exporter/"+version.Version)
+	return req, nil
+}
+
+// ParseAttributes reads attributes written as OTEL_RESOURCE_ATTRIBUTES has
+// them: key=value pairs separated by commas, the values percent-encoded.
+func ParseAttributes(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for pair := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("attribute %q: want key=value", pair)
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", pair, err)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// otlpMetrics are the Exporter's own metrics.
+type otlpMetrics struct {
+	exports     *prometheus.CounterVec
+	rejected    prometheus.Counter
+	lastSuccess prometheus.Gauge
+}
+
+func newOTLPMetrics() otlpMetrics {
+	m := otlpMetrics{
+		exports: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_exporter_otlp_exports_total",
+			Help: "OTLP export requests sent, by result.",
+		}, []string{"result"}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "slurm_exporter_otlp_rejected_points_total",
+			Help: "Data points the OTLP collector reported as rejected in a partial success.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_otlp_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last OTLP export that succeeded.",
+		}),
+	}
+	for _, r := range []string{"success", "error"} {
+		m.exports.WithLabelValues(r)
+	}
+	return m
+}
+
+func (m otlpMetrics) register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{m.exports, m.rejected, m.lastSuccess} {
+		if err := reg.Register(c); err != nil {
+			return fmt.Errorf("registering OTLP metrics: %w", err)
+		}
+	}
+	return nil
+}
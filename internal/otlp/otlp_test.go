@@ -0,0 +1,265 @@
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// collector is an OTLP collector keeping the requests it receives, over
+// OTLP/HTTP or, when grpc is set, OTLP/gRPC.
+type collector struct {
+	grpc bool
+	// status is the HTTP status, or with grpc the gRPC status, to answer
+	// with; zero means success.
+	status int
+	// response is the ExportMetricsServiceResponse to answer with.
+	response []byte
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+	if !c.grpc {
+		if c.status != 0 {
+			w.WriteHeader(c.status)
+			return
+		}
+		c.bodies = append(c.bodies, body)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(c.response)
+		return
+	}
+	if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		w.Header().Set("Grpc-Status", "13")
+		w.Header().Set("Grpc-Message", "bad%20frame")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if c.status != 0 {
+		w.Header().Set("Grpc-Status", "3")
+		w.Header().Set("Grpc-Message", "invalid%20argument")
+		return
+	}
+	c.bodies = append(c.bodies, body[5:])
+	frame := make([]byte, 5, 5+len(c.response))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(c.response)))
+	_, _ = w.Write(append(frame, c.response...))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// received returns the value of slurm_up in each request accepted, in order.
+func (c *collector) received(t *testing.T) []float64 {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []float64
+	for _, body := range c.bodies {
+		for _, p := range decodeRequest(t, body).metrics["slurm_up"].points {
+			out = append(out, p.value)
+		}
+	}
+	return out
+}
+
+// newGRPCServer starts c on an HTTP/2 server without TLS, as a collector's
+// 4317 port usually is.
+func newGRPCServer(c *collector) *httptest.Server {
+	c.grpc = true
+	srv := httptest.NewUnstartedServer(c)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	return srv
+}
+
+func gatherUp(context.Context) ([]*dto.MetricFamily, error) {
+	reg := prometheus.NewRegistry()
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "slurm_up", Help: "Up."})
+	up.Set(1)
+	reg.MustRegister(up)
+	return reg.Gather()
+}
+
+func newTestExporter(t *testing.T, o Options) *Exporter {
+	t.Helper()
+	o.Gather = gatherUp
+	if o.Protocol == "" {
+		o.Protocol = HTTPProtobuf
+	}
+	e, err := New(logger.NewLogger("error"), o)
+	require.NoError(t, err)
+	return e
+}
+
+func TestNew_Errors(t *testing.T) {
+	client := &http.Client{}
+	for want, o := range map[string]Options{
+		"OTLP endpoint is required":     {Protocol: HTTPProtobuf, Gather: gatherUp},
+		"scheme must be http or https":  {Endpoint: "collector:4317", Protocol: GRPC, Gather: gatherUp},
+		`unknown OTLP protocol "http"`:  {Endpoint: "http://x", Protocol: "http", Gather: gatherUp},
+		"a gRPC endpoint takes no path": {Endpoint: "http://x:4317/v1/metrics", Protocol: GRPC, Gather: gatherUp},
+		"HTTP/2 transport without TLS":  {Endpoint: "http://x:4317", Protocol: GRPC, HTTPClient: client, Gather: gatherUp},
+		"nothing to gather":             {Endpoint: "http://x", Protocol: HTTPProtobuf},
+	} {
+		_, err := New(logger.NewLogger("error"), o)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestExporter_HTTP(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	e := newTestExporter(t, Options{
+		Endpoint:   srv.URL,
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		Resource:   map[string]string{"slurm.cluster.name": "a"},
+		Registerer: reg,
+	})
+	e.exportOnce(context.Background())
+
+	assert.Equal(t, []float64{1}, c.received(t))
+	req := c.requests[0]
+	assert.Equal(t, httpPath, req.URL.Path, "an endpoint with no path gets /v1/metrics")
+	assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+	assert.Contains(t, req.Header.Get("User-Agent"), "slurm_exporter/")
+
+	resource := decodeRequest(t, c.bodies[0]).resource
+	assert.Equal(t, "a", resource["slurm.cluster.name"])
+	assert.Equal(t, DefaultServiceName, resource["service.name"])
+	assert.Contains(t, resource, "service.version")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.exports.WithLabelValues("success")))
+	assert.Positive(t, testutil.ToFloat64(e.metrics.lastSuccess))
+	n, err := testutil.GatherAndCount(reg, "slurm_exporter_otlp_exports_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "every result is registered from the start")
+}
+
+func TestExporter_HTTPPath(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL + "/otlp/v1/metrics"})
+	e.exportOnce(context.Background())
+	require.Len(t, c.requests, 1)
+	assert.Equal(t, "/otlp/v1/metrics", c.requests[0].URL.Path, "a full URL is used as is")
+}
+
+func TestExporter_HTTPError(t *testing.T) {
+	c := &collector{status: http.StatusBadRequest}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL})
+	e.exportOnce(context.Background())
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.exports.WithLabelValues("error")))
+	assert.Zero(t, testutil.ToFloat64(e.metrics.lastSuccess))
+}
+
+func TestExporter_PartialSuccess(t *testing.T) {
+	// partial_success { rejected_data_points: 2 }
+	c := &collector{response: []byte{0x0a, 0x02, 0x08, 0x02}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL})
+	e.exportOnce(context.Background())
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.exports.WithLabelValues("success")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(e.metrics.rejected))
+}
+
+func TestExporter_GRPC(t *testing.T) {
+	c := &collector{response: []byte{0x0a, 0x02, 0x08, 0x01}}
+	srv := newGRPCServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL, Protocol: GRPC, Headers: map[string]string{"X-Scope-OrgID": "hpc"}})
+	e.exportOnce(context.Background())
+
+	assert.Equal(t, []float64{1}, c.received(t))
+	req := c.requests[0]
+	assert.Equal(t, 2, req.ProtoMajor, "gRPC runs over HTTP/2")
+	assert.Equal(t, grpcPath, req.URL.Path)
+	assert.Equal(t, "application/grpc", req.Header.Get("Content-Type"))
+	assert.Equal(t, "trailers", req.Header.Get("TE"))
+	assert.Equal(t, "hpc", req.Header.Get("X-Scope-OrgID"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.exports.WithLabelValues("success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.metrics.rejected), "the response message is read past its frame header")
+}
+
+func TestExporter_GRPCError(t *testing.T) {
+	c := &collector{status: 3}
+	srv := newGRPCServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL, Protocol: GRPC})
+	_, err := e.callGRPC(context.Background(), []byte("payload"))
+	assert.EqualError(t, err, "collector returned gRPC status 3: invalid argument")
+}
+
+// TestExporter_Run checks that Run exports at once and stops with its context.
+func TestExporter_Run(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	e := newTestExporter(t, Options{Endpoint: srv.URL, Interval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(c.received(t)) >= 3 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return once its context was cancelled")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got, err := ParseAttributes("slurm.cluster.name=hpc, deployment.environment=prod ,team=a%2Cb,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"slurm.cluster.name":     "hpc",
+		"deployment.environment": "prod",
+		"team":                   "a,b",
+	}, got)
+
+	got, err = ParseAttributes("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = ParseAttributes("novalue")
+	assert.ErrorContains(t, err, "want key=value")
+	_, err = ParseAttributes("k=%zz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,464 @@
+// Package push sends the exporter's metrics to Prometheus instead of waiting
+// to be scraped, for clusters behind a firewall Prometheus cannot reach
+// through.
+//
+// A Pusher collects on an interval, the same metrics /metrics serves, and
+// sends them over remote_write 1.0 (snappy-compressed protobuf) or to a
+// Pushgateway. A failed send is retried with backoff. With remote_write, what
+// still fails is kept in a bounded on-disk queue and sent, oldest first, once
+// the receiver is back; the Pushgateway only keeps the latest push, so there is
+// nothing to replay to it.
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promPush "github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Protocol is how the metrics are sent.
+type Protocol string
+
+const (
+	// RemoteWrite posts to a Prometheus remote_write receiver: Prometheus
+	// itself with --web.enable-remote-write-receiver, Mimir, Thanos Receive,
+	// VictoriaMetrics and the like.
+	RemoteWrite Protocol = "remote_write"
+	// Pushgateway replaces the pushed group on a Pushgateway, which Prometheus
+	// then scrapes.
+	Pushgateway Protocol = "pushgateway"
+)
+
+// Defaults applied to the zero value of the matching Options field.
+const (
+	DefaultInterval     = 30 * time.Second
+	DefaultTimeout      = 10 * time.Second
+	DefaultRetryBackoff = time.Second
+)
+
+// Options configures a Pusher.
+type Options struct {
+	// URL is the remote_write endpoint, for example
+	// https://prometheus:9090/api/v1/write, or the Pushgateway base address.
+	URL      string
+	Protocol Protocol
+	// Interval is the time between two collections. Empty means
+	// DefaultInterval.
+	Interval time.Duration
+	// Timeout bounds each HTTP request. Empty means DefaultTimeout.
+	Timeout time.Duration
+	// Labels are added to every series that does not carry them, as a scrape
+	// adds job and instance. With the Pushgateway they are the grouping key,
+	// and job is required.
+	Labels map[string]string
+	// HTTPClient carries the authentication and TLS settings. nil means
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Retries is how many times a failed request is tried again before the
+	// push is given up, or queued.
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled for each one
+	// after it up to Interval. Empty means DefaultRetryBackoff.
+	RetryBackoff time.Duration
+	// QueueDir keeps the remote_write payloads that could not be sent. Empty
+	// drops them.
+	QueueDir string
+	// QueueMaxBytes bounds QueueDir. Past it the oldest payloads are dropped.
+	QueueMaxBytes int64
+	// Gather collects the metrics to send. ctx ends when the Pusher stops.
+	Gather func(ctx context.Context) ([]*dto.MetricFamily, error)
+	// Registerer, when set, receives the Pusher's own metrics.
+	Registerer prometheus.Registerer
+}
+
+// Pusher sends the metrics Gather returns, on an interval.
+type Pusher struct {
+	log     *logger.Logger
+	o       Options
+	url     *url.URL
+	http    *http.Client
+	queue   *diskQueue
+	metrics pushMetrics
+	// now is time.Now, replaced in tests.
+	now func() time.Time
+	// sleep waits d or until ctx ends, replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New validates the options, opens the queue and registers the Pusher's
+// metrics. Nothing is sent before Run.
+func New(log *logger.Logger, o Options) (*Pusher, error) {
+	if o.URL == "" {
+		return nil, errors.New("push URL is required")
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing push URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("push URL %q: scheme must be http or https", o.URL)
+	}
+	switch o.Protocol {
+	case RemoteWrite:
+	case Pushgateway:
+		if o.Labels["job"] == "" {
+			return nil, errors.New("a job label is required to push to a Pushgateway")
+		}
+		if o.QueueDir != "" {
+			return nil, errors.New("the on-disk queue only applies to remote_write: a Pushgateway keeps the latest push alone")
+		}
+	default:
+		return nil, fmt.Errorf("unknown push protocol %q", o.Protocol)
+	}
+	if o.Gather == nil {
+		return nil, errors.New("nothing to gather")
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+	p := &Pusher{
+		log:     log,
+		o:       o,
+		url:     u,
+		http:    o.HTTPClient,
+		metrics: newPushMetrics(),
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+	if p.http == nil {
+		p.http = http.DefaultClient
+	}
+	if o.QueueDir != "" {
+		if p.queue, err = openQueue(o.QueueDir, o.QueueMaxBytes); err != nil {
+			return nil, fmt.Errorf("opening push queue: %w", err)
+		}
+		p.metrics.setQueue(p.queue)
+		if p.queue.len() > 0 {
+			log.Info("Resuming push queue left by the previous run", "payloads", p.queue.len(), "bytes", p.queue.size())
+		}
+	}
+	if o.Registerer != nil {
+		if err := p.metrics.register(o.Registerer); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Run pushes at once, then on every interval, until ctx ends.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.o.Interval)
+	defer ticker.Stop()
+	for {
+		p.pushOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushOnce collects and sends one set of metrics.
+func (p *Pusher) pushOnce(ctx context.Context) {
+	now := p.now()
+	mfs, err := p.o.Gather(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// As promhttp.ContinueOnError: what was gathered is still worth
+		// sending.
+		p.log.Warn("Gathering metrics to push returned an error", "err", err)
+	}
+	switch p.o.Protocol {
+	case Pushgateway:
+		p.pushGateway(ctx, mfs)
+	default:
+		p.remoteWrite(ctx, encodeWriteRequest(mfs, p.o.Labels, now.UnixMilli()))
+	}
+}
+
+// remoteWrite sends payload, behind whatever the queue holds: a receiver
+// refuses samples older than the ones it has, so the queue is sent first.
+func (p *Pusher) remoteWrite(ctx context.Context, payload []byte) {
+	if p.queue != nil && p.queue.len() > 0 {
+		p.enqueue(payload)
+		p.drain(ctx)
+		return
+	}
+	err := p.withRetries(ctx, func(ctx context.Context) error { return p.postWrite(ctx, payload) })
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		// Stopping: the next run sends it.
+		if p.queue != nil {
+			p.enqueue(payload)
+		}
+	case !retryable(err):
+		p.log.Error("Remote write receiver rejected the push, dropping it", "url", p.url.Redacted(), "err", err)
+		p.metrics.dropped.WithLabelValues("rejected").Inc()
+	case p.queue == nil:
+		p.log.Error("Push failed, dropping it: no queue is configured", "url", p.url.Redacted(), "err", err)
+		p.metrics.dropped.WithLabelValues("unsent").Inc()
+	default:
+		p.log.Warn("Push failed, queueing it", "url", p.url.Redacted(), "err", err)
+		p.enqueue(payload)
+	}
+}
+
+func (p *Pusher) enqueue(payload []byte) {
+	dropped, err := p.queue.push(payload)
+	if err != nil {
+		p.log.Error("Cannot queue the push, dropping it", "dir", p.o.QueueDir, "err", err)
+		p.metrics.dropped.WithLabelValues("unsent").Inc()
+	}
+	if dropped > 0 {
+		p.log.Warn("Push queue is full, dropped the oldest payloads", "dropped", dropped, "max_bytes", p.o.QueueMaxBytes)
+		p.metrics.dropped.WithLabelValues("queue_full").Add(float64(dropped))
+	}
+	p.metrics.setQueue(p.queue)
+}
+
+// drain sends the queue oldest first, one attempt each, and stops at the first
+// failure the receiver may recover from.
+func (p *Pusher) drain(ctx context.Context) {
+	defer p.metrics.setQueue(p.queue)
+	sent := 0
+	for p.queue.len() > 0 {
+		payload, err := p.queue.peek()
+		if err != nil {
+			p.log.Error("Cannot read the push queue, dropping the payload", "dir", p.o.QueueDir, "err", err)
+			p.metrics.dropped.WithLabelValues("unsent").Inc()
+			_ = p.queue.pop()
+			continue
+		}
+		err = p.attempt(ctx, func(ctx context.Context) error { return p.postWrite(ctx, payload) })
+		if err != nil && retryable(err) {
+			if ctx.Err() == nil {
+				p.log.Warn("Push failed, keeping the queue", "url", p.url.Redacted(), "payloads", p.queue.len(), "err", err)
+			}
+			return
+		}
+		if err != nil {
+			p.log.Error("Remote write receiver rejected a queued push, dropping it", "url", p.url.Redacted(), "err", err)
+			p.metrics.dropped.WithLabelValues("rejected").Inc()
+		} else {
+			sent++
+		}
+		if err := p.queue.pop(); err != nil {
+			p.log.Error("Cannot remove a sent payload from the push queue", "dir", p.o.QueueDir, "err", err)
+			return
+		}
+	}
+	p.log.Info("Push queue drained", "sent", sent)
+}
+
+// postWrite posts one remote_write payload.
+func (p *Pusher) postWrite(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "slurm_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &statusError{status: resp.StatusCode, msg: strings.TrimSpace(string(body))}
+}
+
+// pushGateway replaces the group of Labels on the Pushgateway with mfs.
+func (p *Pusher) pushGateway(ctx context.Context, mfs []*dto.MetricFamily) {
+	err := p.withRetries(ctx, func(ctx context.Context) error {
+		doer := &statusDoer{client: p.http}
+		pusher := promPush.New(p.url.String(), p.o.Labels["job"]).
+			Client(doer).
+			Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil }))
+		for name, value := range p.o.Labels {
+			if name != "job" {
+				pusher = pusher.Grouping(name, value)
+			}
+		}
+		err := pusher.PushContext(ctx)
+		if err != nil && doer.status != 0 {
+			return &statusError{status: doer.status, msg: err.Error()}
+		}
+		return err
+	})
+	switch {
+	case err == nil, ctx.Err() != nil:
+	case !retryable(err):
+		p.log.Error("Pushgateway rejected the push", "url", p.url.Redacted(), "err", err)
+		p.metrics.dropped.WithLabelValues("rejected").Inc()
+	default:
+		p.log.Error("Push to the Pushgateway failed", "url", p.url.Redacted(), "err", err)
+		p.metrics.dropped.WithLabelValues("unsent").Inc()
+	}
+}
+
+// withRetries runs send, and runs it again after a growing wait while it fails
+// in a way the receiver may recover from, up to Retries more times.
+func (p *Pusher) withRetries(ctx context.Context, send func(context.Context) error) error {
+	backoff := p.o.RetryBackoff
+	for try := 0; ; try++ {
+		err := p.attempt(ctx, send)
+		if err == nil || !retryable(err) || try == p.o.Retries || ctx.Err() != nil {
+			return err
+		}
+		p.log.Debug("Push failed, retrying", "url", p.url.Redacted(), "err", err, "backoff", backoff)
+		if err := p.sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(2*backoff, p.o.Interval)
+	}
+}
+
+// attempt runs send once under the request timeout, and counts it.
+func (p *Pusher) attempt(ctx context.Context, send func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, p.o.Timeout)
+	defer cancel()
+	if err := send(ctx); err != nil {
+		p.metrics.requests.WithLabelValues("error").Inc()
+		return err
+	}
+	p.metrics.requests.WithLabelValues("success").Inc()
+	p.metrics.lastSuccess.Set(float64(p.now().UnixNano()) / 1e9)
+	return nil
+}
+
+// statusError is a response the receiver answered with a non-2xx status.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("server returned HTTP status %d", e.status)
+	}
+	return fmt.Sprintf("server returned HTTP status %d: %s", e.status, e.msg)
+}
+
+// retryable reports whether err may go away by itself: a network error, a
+// server error, or 429 Too Many Requests. Any other 4xx means the receiver
+// will refuse the same payload again, as the remote_write specification has
+// it.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status == http.StatusTooManyRequests || se.status >= 500
+	}
+	return true
+}
+
+// statusDoer records the status of the last response, which the push
+// package only reports inside its error message.
+type statusDoer struct {
+	client *http.Client
+	status int
+}
+
+func (d *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if resp != nil {
+		d.status = resp.StatusCode
+	}
+	return resp, err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// pushMetrics are the Pusher's own metrics.
+type pushMetrics struct {
+	requests    *prometheus.CounterVec
+	dropped     *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+	queueLength prometheus.Gauge
+	queueBytes  prometheus.Gauge
+}
+
+func newPushMetrics() pushMetrics {
+	m := pushMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_exporter_push_requests_total",
+			Help: "Push requests sent, retries included, by result.",
+		}, []string{"result"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_exporter_push_dropped_total",
+			Help: "Pushes given up: rejected by the receiver, unsent with no queue to keep them, or dropped from a full queue.",
+		}, []string{"reason"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_push_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last push request that succeeded.",
+		}),
+		queueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_push_queue_payloads",
+			Help: "Remote write payloads waiting in the on-disk queue.",
+		}),
+		queueBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_exporter_push_queue_bytes",
+			Help: "Bytes the on-disk push queue takes.",
+		}),
+	}
+	// Every result and reason is reported from the start, so a rate over them
+	// works before the first failure.
+	for _, r := range []string{"success", "error"} {
+		m.requests.WithLabelValues(r)
+	}
+	for _, r := range []string{"rejected", "unsent", "queue_full"} {
+		m.dropped.WithLabelValues(r)
+	}
+	return m
+}
+
+func (m pushMetrics) register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{m.requests, m.dropped, m.lastSuccess, m.queueLength, m.queueBytes} {
+		if err := reg.Register(c); err != nil {
+			return fmt.Errorf("registering push metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m pushMetrics) setQueue(q *diskQueue) {
+	m.queueLength.Set(float64(q.len()))
+	m.queueBytes.Set(float64(q.size()))
+}
@@ -0,0 +1,270 @@
+package push
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// receiver is a remote_write receiver answering each request with the next of
+// its statuses, then 204 once they run out.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.headers = append(r.headers, req.Header.Clone())
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if status/100 == 2 {
+		r.bodies = append(r.bodies, body)
+	}
+	w.WriteHeader(status)
+}
+
+// received returns the value of slurm_up in each payload accepted, in order.
+func (r *receiver) received(t *testing.T) []float64 {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []float64
+	for _, body := range r.bodies {
+		got, _ := decodeWriteRequest(t, body)
+		for _, s := range got {
+			if s.labels == `slurm_up{job="slurm"}` {
+				out = append(out, s.value)
+			}
+		}
+	}
+	return out
+}
+
+// gauge is what each push gathers: slurm_up, set by the test between pushes.
+type gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *gauge) set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *gauge) gather(context.Context) ([]*dto.MetricFamily, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	reg := prometheus.NewRegistry()
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "slurm_up", Help: "Up."})
+	up.Set(g.value)
+	reg.MustRegister(up)
+	return reg.Gather()
+}
+
+func newTestPusher(t *testing.T, o Options, g *gauge) *Pusher {
+	t.Helper()
+	o.Gather = g.gather
+	if o.Protocol == "" {
+		o.Protocol = RemoteWrite
+	}
+	if o.Labels == nil {
+		o.Labels = map[string]string{"job": "slurm"}
+	}
+	p, err := New(logger.NewLogger("error"), o)
+	require.NoError(t, err)
+	p.sleep = func(context.Context, time.Duration) error { return nil }
+	return p
+}
+
+func TestNew_Errors(t *testing.T) {
+	gather := (&gauge{}).gather
+	for want, o := range map[string]Options{
+		"push URL is required":         {Protocol: RemoteWrite, Gather: gather},
+		"scheme must be http or https": {URL: "ftp://x", Protocol: RemoteWrite, Gather: gather},
+		`unknown push protocol "otlp"`: {URL: "http://x", Protocol: "otlp", Gather: gather},
+		"a job label is required":      {URL: "http://x", Protocol: Pushgateway, Gather: gather},
+		"only applies to remote_write": {URL: "http://x", Protocol: Pushgateway, Labels: map[string]string{"job": "s"}, QueueDir: t.TempDir(), Gather: gather},
+		"nothing to gather":            {URL: "http://x", Protocol: RemoteWrite},
+		"queue size must be positive":  {URL: "http://x", Protocol: RemoteWrite, QueueDir: t.TempDir(), Gather: gather},
+	} {
+		_, err := New(logger.NewLogger("error"), o)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestPusher_RemoteWrite(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	g := &gauge{value: 1}
+	reg := prometheus.NewRegistry()
+	p := newTestPusher(t, Options{URL: srv.URL + "/api/v1/write", Registerer: reg}, g)
+	p.pushOnce(context.Background())
+
+	assert.Equal(t, []float64{1}, rcv.received(t))
+	h := rcv.headers[0]
+	assert.Equal(t, "snappy", h.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", h.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", h.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Contains(t, h.Get("User-Agent"), "slurm_exporter/")
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.requests.WithLabelValues("success")))
+	assert.Positive(t, testutil.ToFloat64(p.metrics.lastSuccess))
+	n, err := testutil.GatherAndCount(reg, "slurm_exporter_push_requests_total", "slurm_exporter_push_dropped_total")
+	require.NoError(t, err)
+	assert.Equal(t, 5, n, "every result and reason is registered from the start")
+}
+
+func TestPusher_Retries(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{URL: srv.URL, Retries: 2}, &gauge{value: 1})
+	var waits []time.Duration
+	p.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	p.pushOnce(context.Background())
+	assert.Equal(t, []float64{1}, rcv.received(t), "the third attempt got through")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits, "the backoff doubles")
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.metrics.requests.WithLabelValues("error")))
+}
+
+func TestPusher_Rejected(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{URL: srv.URL, Retries: 3, QueueDir: t.TempDir(), QueueMaxBytes: 1 << 20}, &gauge{value: 1})
+	p.pushOnce(context.Background())
+	assert.Len(t, rcv.headers, 1, "a 4xx is not retried")
+	assert.Zero(t, p.queue.len(), "nor queued: the receiver would refuse it again")
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.dropped.WithLabelValues("rejected")))
+}
+
+// TestPusher_Queue takes the receiver down for two pushes, and checks that
+// they are kept on disk and sent in order, before the next one, once it is
+// back.
+func TestPusher_Queue(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+	dir := filepath.Join(t.TempDir(), "queue")
+
+	g := &gauge{}
+	p := newTestPusher(t, Options{URL: srv.URL, Retries: 1, QueueDir: dir, QueueMaxBytes: 1 << 20}, g)
+
+	// Two attempts for the first push; one for the second, queued behind it.
+	rcv.statuses = []int{500, 500, 502}
+	g.set(1)
+	p.pushOnce(context.Background())
+	g.set(2)
+	p.pushOnce(context.Background())
+	assert.Empty(t, rcv.received(t))
+	assert.Equal(t, 2, p.queue.len())
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.metrics.queueLength))
+
+	// A restart in the middle of the outage loses nothing.
+	p = newTestPusher(t, Options{URL: srv.URL, Retries: 1, QueueDir: dir, QueueMaxBytes: 1 << 20}, g)
+	assert.Equal(t, 2, p.queue.len())
+
+	g.set(3)
+	p.pushOnce(context.Background())
+	assert.Equal(t, []float64{1, 2, 3}, rcv.received(t))
+	assert.Zero(t, p.queue.len())
+	assert.Zero(t, testutil.ToFloat64(p.metrics.queueBytes))
+}
+
+func TestPusher_NoQueue(t *testing.T) {
+	srv := httptest.NewServer(&receiver{statuses: []int{500}})
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{URL: srv.URL}, &gauge{value: 1})
+	p.pushOnce(context.Background())
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.dropped.WithLabelValues("unsent")))
+}
+
+func TestPusher_Pushgateway(t *testing.T) {
+	var method, path string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{
+		URL:      srv.URL,
+		Protocol: Pushgateway,
+		Labels:   map[string]string{"job": "slurm", "instance": "head", "cluster": "a"},
+	}, &gauge{value: 1})
+	p.pushOnce(context.Background())
+	assert.Equal(t, http.MethodPut, method, "the group is replaced, not added to")
+	// The push package orders the grouping labels as it likes.
+	assert.True(t, strings.HasPrefix(path, "/metrics/job/slurm/"), path)
+	assert.Contains(t, path, "/cluster/a")
+	assert.Contains(t, path, "/instance/head")
+	assert.Contains(t, string(body), "slurm_up")
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.requests.WithLabelValues("success")))
+}
+
+func TestPusher_PushgatewayRejected(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		http.Error(w, "pushed metrics are invalid", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{URL: srv.URL, Protocol: Pushgateway, Retries: 3}, &gauge{value: 1})
+	p.pushOnce(context.Background())
+	assert.Equal(t, 1, calls, "a 4xx is not retried")
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.dropped.WithLabelValues("rejected")))
+}
+
+// TestPusher_Run checks that Run pushes at once and stops with its context.
+func TestPusher_Run(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	p := newTestPusher(t, Options{URL: srv.URL, Interval: 10 * time.Millisecond}, &gauge{value: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(rcv.received(t)) >= 3 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return once its context was cancelled")
+	}
+}
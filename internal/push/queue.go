@@ -0,0 +1,147 @@
+package push
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// queueSuffix names the payload files of a queue directory, and tempPrefix
+// the files being written.
+const (
+	queueSuffix = ".rw"
+	tempPrefix  = ".payload-"
+)
+
+// diskQueue holds the remote_write payloads that could not be sent, oldest
+// first, one file each, so an outage of the receiver or of the network loses
+// nothing up to maxBytes, and neither does a restart during it. Past maxBytes
+// the oldest payloads are dropped: the most recent state of the cluster is
+// worth more than the oldest.
+//
+// Only the push loop uses it, so it takes no lock.
+type diskQueue struct {
+	dir      string
+	maxBytes int64
+	// files are the queued payloads, oldest first. Their names are a
+	// sequence number, zero-padded so that they sort by age.
+	files []queuedFile
+	bytes int64
+	next  uint64
+}
+
+type queuedFile struct {
+	seq  uint64
+	size int64
+}
+
+// openQueue opens the queue in dir, creating it when needed, and picks up the
+// payloads a previous run left behind.
+func openQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("queue size must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &diskQueue{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			// Left by a write the previous run did not finish.
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		digits, ok := strings.CutSuffix(e.Name(), queueSuffix)
+		seq, err := strconv.ParseUint(digits, 10, 64)
+		if !ok || err != nil || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.files = append(q.files, queuedFile{seq: seq, size: info.Size()})
+		q.bytes += info.Size()
+		q.next = max(q.next, seq+1)
+	}
+	slices.SortFunc(q.files, func(a, b queuedFile) int { return cmp.Compare(a.seq, b.seq) })
+	return q, nil
+}
+
+func (q *diskQueue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueSuffix))
+}
+
+// len returns the number of queued payloads.
+func (q *diskQueue) len() int { return len(q.files) }
+
+// size returns the bytes the queued payloads take.
+func (q *diskQueue) size() int64 { return q.bytes }
+
+// push appends payload, then drops the oldest payloads until the queue fits in
+// maxBytes again. It returns how many were dropped; a payload larger than the
+// whole queue is dropped itself.
+func (q *diskQueue) push(payload []byte) (dropped int, err error) {
+	if int64(len(payload)) > q.maxBytes {
+		return 1, nil
+	}
+	seq := q.next
+	tmp, err := os.CreateTemp(q.dir, tempPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(payload); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), q.path(seq)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	q.next++
+	q.files = append(q.files, queuedFile{seq: seq, size: int64(len(payload))})
+	q.bytes += int64(len(payload))
+	for q.bytes > q.maxBytes {
+		if err := q.pop(); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// peek returns the oldest payload.
+func (q *diskQueue) peek() ([]byte, error) {
+	if len(q.files) == 0 {
+		return nil, errors.New("queue is empty")
+	}
+	return os.ReadFile(q.path(q.files[0].seq))
+}
+
+// pop removes the oldest payload.
+func (q *diskQueue) pop() error {
+	if len(q.files) == 0 {
+		return nil
+	}
+	f := q.files[0]
+	if err := os.Remove(q.path(f.seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	q.files = q.files[1:]
+	q.bytes -= f.size
+	return nil
+}
@@ -0,0 +1,61 @@
+package push
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+	q, err := openQueue(dir, 10)
+	require.NoError(t, err)
+
+	for _, p := range []string{"aaaa", "bbbb"} {
+		dropped, err := q.push([]byte(p))
+		require.NoError(t, err)
+		assert.Zero(t, dropped)
+	}
+	assert.Equal(t, 2, q.len())
+	assert.EqualValues(t, 8, q.size())
+
+	// A third payload does not fit beside both: the oldest goes.
+	dropped, err := q.push([]byte("cccc"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, 2, q.len())
+
+	// Larger than the whole queue: dropped itself, the queue untouched.
+	dropped, err = q.push([]byte("0123456789a"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, 2, q.len())
+
+	// A restart picks the queue up in order, and skips what is not a payload.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tempPrefix+"123"), []byte("partial"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not ours"), 0o600))
+	q, err = openQueue(dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.len())
+	assert.NoFileExists(t, filepath.Join(dir, tempPrefix+"123"), "an interrupted write is cleaned up")
+
+	_, err = q.push([]byte("dd"))
+	require.NoError(t, err)
+	var got []string
+	for q.len() > 0 {
+		p, err := q.peek()
+		require.NoError(t, err)
+		got = append(got, string(p))
+		require.NoError(t, q.pop())
+	}
+	assert.Equal(t, []string{"bbbb", "cccc", "dd"}, got)
+	assert.Zero(t, q.size())
+
+	_, err = q.peek()
+	assert.Error(t, err)
+	_, err = openQueue(dir, 0)
+	assert.ErrorContains(t, err, "queue size must be positive")
+}
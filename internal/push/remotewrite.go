@@ -0,0 +1,161 @@
+package push
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the remote_write 1.0 messages, from prompb/types.proto and
+// prompb/remote.proto in the Prometheus repository. The messages are small and
+// stable, so they are written by hand rather than pulling in Prometheus itself
+// for its generated code.
+const (
+	writeRequestTimeseries = 1
+	writeRequestMetadata   = 3
+
+	timeSeriesLabels  = 1
+	timeSeriesSamples = 2
+
+	labelName  = 1
+	labelValue = 2
+
+	sampleValue     = 1
+	sampleTimestamp = 2
+
+	metadataType       = 1
+	metadataFamilyName = 2
+	metadataHelp       = 4
+)
+
+// metadataTypes maps a family's type to MetricMetadata.MetricType.
+var metadataTypes = map[dto.MetricType]uint64{
+	dto.MetricType_COUNTER:         1,
+	dto.MetricType_GAUGE:           2,
+	dto.MetricType_HISTOGRAM:       3,
+	dto.MetricType_GAUGE_HISTOGRAM: 4,
+	dto.MetricType_SUMMARY:         5,
+	dto.MetricType_UNTYPED:         0,
+}
+
+type label struct{ name, value string }
+
+// encodeWriteRequest returns mfs as a snappy-compressed remote_write 1.0
+// WriteRequest. Histograms and summaries are split into the _bucket, _sum and
+// _count (or quantile) series a scrape would have produced. extra labels are
+// added to every series that does not carry them already, as a scrape adds job
+// and instance. A sample with no timestamp of its own is stamped nowMs.
+func encodeWriteRequest(mfs []*dto.MetricFamily, extra map[string]string, nowMs int64) []byte {
+	var b []byte
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			base := seriesLabels(m.GetLabel(), extra)
+			emit := func(suffix string, value float64, more ...label) {
+				b = protowire.AppendTag(b, writeRequestTimeseries, protowire.BytesType)
+				b = protowire.AppendBytes(b, encodeTimeSeries(name+suffix, base, more, value, ts))
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				emit("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				emit("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				emit("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					emit("", q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				emit("_sum", s.GetSampleSum())
+				emit("_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				inf := false
+				for _, bk := range h.GetBucket() {
+					inf = inf || math.IsInf(bk.GetUpperBound(), +1)
+					emit("_bucket", float64(bk.GetCumulativeCount()), label{"le", formatFloat(bk.GetUpperBound())})
+				}
+				if !inf {
+					emit("_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				}
+				emit("_sum", h.GetSampleSum())
+				emit("_count", float64(h.GetSampleCount()))
+			}
+		}
+		b = protowire.AppendTag(b, writeRequestMetadata, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeMetadata(mf))
+	}
+	return snappy.Encode(nil, b)
+}
+
+// seriesLabels merges a metric's labels with extra, the metric's winning.
+func seriesLabels(pairs []*dto.LabelPair, extra map[string]string) []label {
+	out := make([]label, 0, len(pairs)+len(extra))
+	for _, p := range pairs {
+		out = append(out, label{p.GetName(), p.GetValue()})
+	}
+	for name, value := range extra {
+		if !slices.ContainsFunc(out, func(l label) bool { return l.name == name }) {
+			out = append(out, label{name, value})
+		}
+	}
+	return out
+}
+
+// encodeTimeSeries writes one TimeSeries holding a single sample. Receivers
+// require the labels sorted by name, __name__ included.
+func encodeTimeSeries(name string, base, more []label, value float64, ts int64) []byte {
+	labels := append([]label{{"__name__", name}}, base...)
+	labels = append(labels, more...)
+	slices.SortFunc(labels, func(a, b label) int { return cmp.Compare(a.name, b.name) })
+
+	var b []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, labelName, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, labelValue, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		b = protowire.AppendTag(b, timeSeriesLabels, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	var sb []byte
+	sb = protowire.AppendTag(sb, sampleValue, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(value))
+	sb = protowire.AppendTag(sb, sampleTimestamp, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(ts))
+	b = protowire.AppendTag(b, timeSeriesSamples, protowire.BytesType)
+	return protowire.AppendBytes(b, sb)
+}
+
+func encodeMetadata(mf *dto.MetricFamily) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, metadataType, protowire.VarintType)
+	b = protowire.AppendVarint(b, metadataTypes[mf.GetType()])
+	b = protowire.AppendTag(b, metadataFamilyName, protowire.BytesType)
+	b = protowire.AppendString(b, mf.GetName())
+	b = protowire.AppendTag(b, metadataHelp, protowire.BytesType)
+	return protowire.AppendString(b, mf.GetHelp())
+}
+
+// formatFloat prints a bucket bound or a quantile as the text exposition
+// format does, so the le and quantile labels match a scrape's.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,181 @@
+package push
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// series is one decoded TimeSeries, its labels printed as a scrape would:
+// name{a="1",b="2"}, sorted.
+type series struct {
+	labels string
+	value  float64
+	ts     int64
+}
+
+type metadata struct {
+	typ        uint64
+	name, help string
+}
+
+// decodeWriteRequest reads a snappy-compressed WriteRequest the way a receiver
+// does, failing on anything that is not well-formed.
+func decodeWriteRequest(t *testing.T, body []byte) ([]series, []metadata) {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+
+	var out []series
+	var meta []metadata
+	fields(t, raw, func(num protowire.Number, b []byte, _ uint64) {
+		switch num {
+		case writeRequestTimeseries:
+			var s series
+			var names []string
+			var pairs []string
+			fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+				switch num {
+				case timeSeriesLabels:
+					var name, value string
+					fields(t, b, func(num protowire.Number, b []byte, _ uint64) {
+						if num == labelName {
+							name = string(b)
+						} else {
+							value = string(b)
+						}
+					})
+					names = append(names, name)
+					if name == "__name__" {
+						s.labels = value + s.labels
+					} else {
+						pairs = append(pairs, name+`="`+value+`"`)
+					}
+				case timeSeriesSamples:
+					fields(t, b, func(num protowire.Number, _ []byte, v uint64) {
+						if num == sampleValue {
+							s.value = math.Float64frombits(v)
+						} else {
+							s.ts = int64(v)
+						}
+					})
+				}
+			})
+			assert.IsNonDecreasing(t, names, "labels must be sorted by name")
+			s.labels += "{" + strings.Join(pairs, ",") + "}"
+			out = append(out, s)
+		case writeRequestMetadata:
+			var m metadata
+			fields(t, b, func(num protowire.Number, b []byte, v uint64) {
+				switch num {
+				case metadataType:
+					m.typ = v
+				case metadataFamilyName:
+					m.name = string(b)
+				case metadataHelp:
+					m.help = string(b)
+				}
+			})
+			meta = append(meta, m)
+		}
+	})
+	return out, meta
+}
+
+// fields calls fn for each field of a message: b for a length-delimited one,
+// v for a varint or a fixed64.
+func fields(t *testing.T, msg []byte, fn func(num protowire.Number, b []byte, v uint64)) {
+	t.Helper()
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		require.GreaterOrEqual(t, n, 0, "bad tag")
+		msg = msg[n:]
+		switch typ {
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, b, 0)
+			msg = msg[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, nil, v)
+			msg = msg[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, nil, v)
+			msg = msg[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "slurm_nodes_idle", Help: "Idle nodes."}, []string{"partition"})
+	gauge.WithLabelValues("cpu").Set(12)
+	gauge.WithLabelValues("gpu").Set(3)
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "slurm_scheduler_backfilled_jobs_total", Help: "Backfilled jobs."})
+	counter.Add(7)
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "slurm_wait_seconds", Help: "Waits.", Buckets: []float64{1, 10}})
+	hist.Observe(0.5)
+	hist.Observe(5)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "slurm_rpc_seconds", Help: "RPCs.", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(2)
+	// A series carrying instance keeps its own.
+	own := prometheus.NewGauge(prometheus.GaugeOpts{Name: "slurm_info", Help: "Info.", ConstLabels: prometheus.Labels{"instance": "ctl"}})
+	own.Set(1)
+	reg.MustRegister(gauge, counter, hist, summary, own)
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	got, meta := decodeWriteRequest(t, encodeWriteRequest(mfs, map[string]string{"job": "slurm", "instance": "head"}, 1700000000000))
+
+	byLabels := make(map[string]float64)
+	for _, s := range got {
+		assert.Equal(t, int64(1700000000000), s.ts)
+		byLabels[s.labels] = s.value
+	}
+	assert.Equal(t, map[string]float64{
+		`slurm_info{instance="ctl",job="slurm"}`:                             1,
+		`slurm_nodes_idle{instance="head",job="slurm",partition="cpu"}`:      12,
+		`slurm_nodes_idle{instance="head",job="slurm",partition="gpu"}`:      3,
+		`slurm_rpc_seconds{instance="head",job="slurm",quantile="0.5"}`:      2,
+		`slurm_rpc_seconds_count{instance="head",job="slurm"}`:               1,
+		`slurm_rpc_seconds_sum{instance="head",job="slurm"}`:                 2,
+		`slurm_scheduler_backfilled_jobs_total{instance="head",job="slurm"}`: 7,
+		`slurm_wait_seconds_bucket{instance="head",job="slurm",le="+Inf"}`:   2,
+		`slurm_wait_seconds_bucket{instance="head",job="slurm",le="1"}`:      1,
+		`slurm_wait_seconds_bucket{instance="head",job="slurm",le="10"}`:     2,
+		`slurm_wait_seconds_count{instance="head",job="slurm"}`:              2,
+		`slurm_wait_seconds_sum{instance="head",job="slurm"}`:                5.5,
+	}, byLabels)
+
+	assert.Contains(t, meta, metadata{typ: 2, name: "slurm_nodes_idle", help: "Idle nodes."})
+	assert.Contains(t, meta, metadata{typ: 1, name: "slurm_scheduler_backfilled_jobs_total", help: "Backfilled jobs."})
+	assert.Contains(t, meta, metadata{typ: 3, name: "slurm_wait_seconds", help: "Waits."})
+	assert.Contains(t, meta, metadata{typ: 5, name: "slurm_rpc_seconds", help: "RPCs."})
+}
+
+func TestEncodeWriteRequest_OwnTimestamp(t *testing.T) {
+	mfs := []*dto.MetricFamily{{
+		Name: new("slurm_account_fairshare"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Gauge:       &dto.Gauge{Value: new(0.5)},
+			TimestampMs: new(int64(1600000000000)),
+		}},
+	}}
+	got, _ := decodeWriteRequest(t, encodeWriteRequest(mfs, nil, 1700000000000))
+	require.Len(t, got, 1)
+	assert.Equal(t, series{labels: "slurm_account_fairshare{}", value: 0.5, ts: 1600000000000}, got[0])
+}
@@ -0,0 +1,424 @@
+// Package relabel rewrites the exporter's output at exposition time.
+//
+// Cardinality used to be controlled by one boolean flag per label
+// (collector.nodes.feature-set, collector.queue.user-label and so on), so a
+// site with a label to tame had to wait for a flag to be added. The rules here
+// run over every gathered metric family before it is encoded, whichever
+// collector produced it, and follow Prometheus metric_relabel_configs: a rule
+// joins the values of its source labels and matches the result against a
+// fully anchored regular expression.
+//
+// The metric name is readable as __name__ but cannot be rewritten: a series
+// belongs to its family, and moving it to another would need its type and
+// help text too.
+//
+// A rule that drops the only label telling two series apart makes them one:
+// their values are summed where they add up, and the collision is counted in
+// slurm_exporter_relabel_collisions_total either way.
+package relabel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Action is what a rule does with the series it matches.
+type Action string
+
+const (
+	// Drop removes the series whose source label values match.
+	Drop Action = "drop"
+	// Keep removes the series whose source label values do not match.
+	Keep Action = "keep"
+	// Replace sets the target label to the replacement, expanded with the
+	// regex's capture groups, when the source label values match. An empty
+	// result removes the target label.
+	Replace Action = "replace"
+	// Hash sets the target label to a hash of the source label values.
+	Hash Action = "hash"
+	// LabelDrop removes every label whose name matches.
+	LabelDrop Action = "labeldrop"
+	// LabelKeep removes every label whose name does not match.
+	LabelKeep Action = "labelkeep"
+)
+
+// nameLabel is the pseudo-label that holds the metric name.
+const nameLabel = "__name__"
+
+// Defaults applied to a rule that leaves the field empty, as in Prometheus.
+const (
+	DefaultSeparator   = ";"
+	DefaultRegex       = "(.*)"
+	DefaultReplacement = "$1"
+)
+
+// hashLength is how many hex digits of the SHA-256 a hashed label keeps: 64
+// bits, enough that two users colliding is not a practical concern.
+const hashLength = 16
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Rule is one relabeling rule, as written in the configuration file.
+type Rule struct {
+	Action       Action   `yaml:"action"`
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator"`
+	Regex        string   `yaml:"regex"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"`
+	// Salt is prepended to the value before hashing, so that a hashed user
+	// name cannot be recovered by hashing the site's user list.
+	Salt string `yaml:"salt"`
+}
+
+// rule is a Rule with its defaults applied and its regex compiled.
+type rule struct {
+	Rule
+	regex *regexp.Regexp
+}
+
+// Rules is a compiled, immutable list of rules, applied in order. A nil or
+// empty Rules leaves every metric untouched.
+type Rules struct {
+	rules []rule
+	// warned holds the collisions Relabeler has logged for these rules, by
+	// family and result, so that each is logged once rather than per scrape.
+	warned sync.Map
+}
+
+// Results of a collision, the result label of
+// slurm_exporter_relabel_collisions_total.
+const (
+	// Summed: the series' values were added into the first one.
+	Summed = "summed"
+	// Dropped: the values do not add up, the first series was kept alone.
+	Dropped = "dropped"
+)
+
+var (
+	metricsOnce sync.Once
+
+	collisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slurm_exporter_relabel_collisions_total",
+		Help: "Series that relabeling made identical to another of the same metric, by whether their values were summed into it or dropped.",
+	}, []string{"metric", "result"})
+)
+
+// RegisterMetrics registers the relabeling metrics with reg. Must be called
+// once at startup.
+func RegisterMetrics(reg prometheus.Registerer) {
+	metricsOnce.Do(func() {
+		reg.MustRegister(collisions)
+	})
+}
+
+// Compile validates rules and prepares them for Apply. Every invalid rule is
+// reported, identified by its position in the list.
+func Compile(rules []Rule) (*Rules, error) {
+	var errs []error
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("relabel[%d]: %w", i, err))
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &Rules{rules: compiled}, nil
+}
+
+func compile(r Rule) (rule, error) {
+	if r.Separator == "" {
+		r.Separator = DefaultSeparator
+	}
+	if r.Regex == "" {
+		r.Regex = DefaultRegex
+	}
+	if r.Replacement == nil {
+		replacement := DefaultReplacement
+		r.Replacement = &replacement
+	}
+	if r.Action == Hash && r.TargetLabel == "" && len(r.SourceLabels) == 1 {
+		r.TargetLabel = r.SourceLabels[0]
+	}
+
+	switch r.Action {
+	case Drop, Keep, Replace, Hash:
+		if len(r.SourceLabels) == 0 {
+			return rule{}, fmt.Errorf("action %s requires source_labels", r.Action)
+		}
+	case LabelDrop, LabelKeep:
+		if len(r.SourceLabels) > 0 || r.TargetLabel != "" {
+			return rule{}, fmt.Errorf("action %s matches label names and takes neither source_labels nor target_label", r.Action)
+		}
+	case "":
+		return rule{}, errors.New("action is required")
+	default:
+		return rule{}, fmt.Errorf("unknown action %q", r.Action)
+	}
+	for _, name := range r.SourceLabels {
+		if !labelNameRE.MatchString(name) {
+			return rule{}, fmt.Errorf("invalid source label %q", name)
+		}
+	}
+	if r.Action == Replace || r.Action == Hash {
+		switch {
+		case r.TargetLabel == "":
+			return rule{}, fmt.Errorf("action %s requires target_label", r.Action)
+		case r.TargetLabel == nameLabel:
+			return rule{}, errors.New("the metric name cannot be rewritten")
+		case !labelNameRE.MatchString(r.TargetLabel):
+			return rule{}, fmt.Errorf("invalid target label %q", r.TargetLabel)
+		}
+	}
+
+	re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	return rule{Rule: r, regex: re}, nil
+}
+
+// Apply runs the rules over mfs and returns the result. Families left without
+// a series are removed. When rewriting makes series of a family identical, as
+// an exposition with duplicate series is rejected by Prometheus, they become
+// one: the values of the others are added into the first, and where they do
+// not add up, see merge, the others are dropped.
+func (rs *Rules) Apply(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	out, _ := rs.apply(mfs)
+	return out
+}
+
+// collision is the series of one family that apply merged or dropped.
+type collision struct {
+	family, result string
+	series         int
+}
+
+// apply is Apply, also returning the collisions it counted.
+func (rs *Rules) apply(mfs []*dto.MetricFamily) ([]*dto.MetricFamily, []collision) {
+	if rs == nil || len(rs.rules) == 0 {
+		return mfs, nil
+	}
+	var found []collision
+	out := mfs[:0]
+	for _, mf := range mfs {
+		seen := make(map[string]*dto.Metric, len(mf.Metric))
+		metrics := mf.Metric[:0]
+		merged := map[string]int{}
+		for _, m := range mf.Metric {
+			labels := make(map[string]string, len(m.Label)+1)
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			labels[nameLabel] = mf.GetName()
+			if !rs.process(labels) {
+				continue
+			}
+			delete(labels, nameLabel)
+			m.Label = labelPairs(labels)
+			key := seriesKey(m.Label)
+			first, ok := seen[key]
+			if !ok {
+				seen[key] = m
+				metrics = append(metrics, m)
+				continue
+			}
+			if merge(mf.GetType(), first, m) {
+				merged[Summed]++
+			} else {
+				merged[Dropped]++
+			}
+		}
+		for _, result := range []string{Summed, Dropped} {
+			if n := merged[result]; n > 0 {
+				collisions.WithLabelValues(mf.GetName(), result).Add(float64(n))
+				found = append(found, collision{family: mf.GetName(), result: result, series: n})
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		mf.Metric = metrics
+		out = append(out, mf)
+	}
+	return out, found
+}
+
+// merge adds the value of m into into, a series of the same family with the
+// same labels, and reports whether it could. Counters, gauges and untyped
+// values add up, as do classic histograms with the same buckets. Summary
+// quantiles do not, nor do histograms bucketed differently. into's value is
+// replaced rather than written to, in case it is shared.
+func merge(typ dto.MetricType, into, m *dto.Metric) bool {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		into.Counter = &dto.Counter{Value: proto.Float64(into.GetCounter().GetValue() + m.GetCounter().GetValue())}
+	case dto.MetricType_GAUGE:
+		into.Gauge = &dto.Gauge{Value: proto.Float64(into.GetGauge().GetValue() + m.GetGauge().GetValue())}
+	case dto.MetricType_UNTYPED:
+		into.Untyped = &dto.Untyped{Value: proto.Float64(into.GetUntyped().GetValue() + m.GetUntyped().GetValue())}
+	case dto.MetricType_HISTOGRAM:
+		a, b := into.GetHistogram(), m.GetHistogram()
+		// A native histogram has a schema; merging one means merging spans.
+		if a.Schema != nil || b.Schema != nil || len(a.GetBucket()) != len(b.GetBucket()) {
+			return false
+		}
+		buckets := make([]*dto.Bucket, len(a.GetBucket()))
+		for i, ab := range a.GetBucket() {
+			bb := b.GetBucket()[i]
+			if ab.GetUpperBound() != bb.GetUpperBound() {
+				return false
+			}
+			buckets[i] = &dto.Bucket{
+				UpperBound:      proto.Float64(ab.GetUpperBound()),
+				CumulativeCount: proto.Uint64(ab.GetCumulativeCount() + bb.GetCumulativeCount()),
+			}
+		}
+		into.Histogram = &dto.Histogram{
+			SampleCount: proto.Uint64(a.GetSampleCount() + b.GetSampleCount()),
+			SampleSum:   proto.Float64(a.GetSampleSum() + b.GetSampleSum()),
+			Bucket:      buckets,
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// process applies every rule to labels in place, and reports whether the
+// series is kept.
+func (rs *Rules) process(labels map[string]string) bool {
+	for _, r := range rs.rules {
+		switch r.Action {
+		case LabelDrop, LabelKeep:
+			for name := range labels {
+				if name != nameLabel && r.regex.MatchString(name) == (r.Action == LabelDrop) {
+					delete(labels, name)
+				}
+			}
+			continue
+		}
+
+		values := make([]string, len(r.SourceLabels))
+		for i, name := range r.SourceLabels {
+			values[i] = labels[name]
+		}
+		joined := strings.Join(values, r.Separator)
+		match := r.regex.FindStringSubmatchIndex(joined)
+
+		switch r.Action {
+		case Drop:
+			if match != nil {
+				return false
+			}
+		case Keep:
+			if match == nil {
+				return false
+			}
+		case Replace:
+			if match == nil {
+				continue
+			}
+			if v := string(r.regex.ExpandString(nil, *r.Replacement, joined, match)); v != "" {
+				labels[r.TargetLabel] = v
+			} else {
+				delete(labels, r.TargetLabel)
+			}
+		case Hash:
+			// A series with none of the source labels has nothing to hash;
+			// giving it one would add a label it never had.
+			if match == nil || strings.Join(values, "") == "" {
+				continue
+			}
+			sum := sha256.Sum256([]byte(r.Salt + joined))
+			labels[r.TargetLabel] = hex.EncodeToString(sum[:])[:hashLength]
+		}
+	}
+	return true
+}
+
+// labelPairs turns labels back into the sorted pairs the encoder expects.
+// Empty values are left out: in Prometheus an empty label is no label.
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		if value == "" {
+			continue
+		}
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
+
+func seriesKey(pairs []*dto.LabelPair) string {
+	var b strings.Builder
+	for _, lp := range pairs {
+		b.WriteString(lp.GetName())
+		b.WriteByte(0xff)
+		b.WriteString(lp.GetValue())
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// Relabeler holds the rules in force and applies them to whatever it wraps.
+// The rules are swapped atomically, so a configuration reload takes effect on
+// the next scrape without any lock on the scrape path.
+type Relabeler struct {
+	rules atomic.Pointer[Rules]
+	// Log, when set, is told of the first collision of each metric under
+	// the rules in force.
+	Log *logger.Logger
+}
+
+// Set replaces the rules in force. nil removes them.
+func (r *Relabeler) Set(rules *Rules) {
+	r.rules.Store(rules)
+}
+
+// Wrap returns a Gatherer that relabels the output of g with the rules in
+// force at each Gather.
+func (r *Relabeler) Wrap(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		rules := r.rules.Load()
+		out, found := rules.apply(mfs)
+		for _, c := range found {
+			r.warn(rules, c)
+		}
+		return out, err
+	})
+}
+
+func (r *Relabeler) warn(rules *Rules, c collision) {
+	if r.Log == nil {
+		return
+	}
+	if _, done := rules.warned.LoadOrStore(c.family+"\xff"+c.result, true); done {
+		return
+	}
+	if c.result == Summed {
+		r.Log.Warn("Relabeling made series of a metric identical, their values are summed", "metric", c.family, "series", c.series)
+	} else {
+		r.Log.Warn("Relabeling made series of a metric identical that cannot be summed, only the first is kept", "metric", c.family, "series", c.series)
+	}
+}
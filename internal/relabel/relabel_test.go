@@ -0,0 +1,294 @@
+package relabel
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// gatherer builds a registry holding node and user gauges with the given
+// label values, the shapes the rules below are written for.
+func gatherer(t *testing.T) prometheus.Gatherer {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	nodes := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "slurm_node_cpu_alloc", Help: "h"}, []string{"node", "partition"})
+	nodes.WithLabelValues("cn01.cluster.example.org", "cpu").Set(4)
+	nodes.WithLabelValues("cn02.cluster.example.org", "cpu").Set(8)
+	nodes.WithLabelValues("gpu01.cluster.example.org", "gpu").Set(2)
+	users := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "slurm_user_jobs_running", Help: "h"}, []string{"user"})
+	users.WithLabelValues("alice").Set(3)
+	users.WithLabelValues("bob").Set(1)
+	reg.MustRegister(nodes, users)
+	return reg
+}
+
+func relabeled(t *testing.T, yamlRules []Rule) string {
+	t.Helper()
+	rules, err := Compile(yamlRules)
+	require.NoError(t, err)
+	var r Relabeler
+	r.Set(rules)
+	mfs, err := r.Wrap(gatherer(t)).Gather()
+	require.NoError(t, err)
+	var b strings.Builder
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			b.WriteString(mf.GetName())
+			for _, lp := range m.Label {
+				b.WriteString(" " + lp.GetName() + "=" + lp.GetValue())
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestRules_Apply(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  string
+	}{
+		{
+			name: "no rules",
+			want: `slurm_node_cpu_alloc node=cn01.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=cn02.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=gpu01.cluster.example.org partition=gpu
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+		{
+			name:  "drop by metric name",
+			rules: []Rule{{Action: Drop, SourceLabels: []string{"__name__"}, Regex: "slurm_user_.*"}},
+			want: `slurm_node_cpu_alloc node=cn01.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=cn02.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=gpu01.cluster.example.org partition=gpu
+`,
+		},
+		{
+			name:  "drop by label value",
+			rules: []Rule{{Action: Drop, SourceLabels: []string{"user"}, Regex: "bob"}},
+			want: `slurm_node_cpu_alloc node=cn01.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=cn02.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=gpu01.cluster.example.org partition=gpu
+slurm_user_jobs_running user=alice
+`,
+		},
+		{
+			name: "keep by label value, scoped to one metric",
+			rules: []Rule{{
+				Action:       Keep,
+				SourceLabels: []string{"__name__", "partition"},
+				Regex:        "slurm_node_cpu_alloc;gpu|slurm_user_.*;",
+			}},
+			want: `slurm_node_cpu_alloc node=gpu01.cluster.example.org partition=gpu
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+		{
+			name: "strip domain suffix",
+			rules: []Rule{{
+				Action:       Replace,
+				SourceLabels: []string{"node"},
+				Regex:        `([^.]+)\..*`,
+				TargetLabel:  "node",
+			}},
+			want: `slurm_node_cpu_alloc node=cn01 partition=cpu
+slurm_node_cpu_alloc node=cn02 partition=cpu
+slurm_node_cpu_alloc node=gpu01 partition=gpu
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+		{
+			name: "empty replacement removes the label",
+			rules: []Rule{{
+				Action:       Replace,
+				SourceLabels: []string{"partition"},
+				TargetLabel:  "partition",
+				Replacement:  strPtr(""),
+			}},
+			want: `slurm_node_cpu_alloc node=cn01.cluster.example.org
+slurm_node_cpu_alloc node=cn02.cluster.example.org
+slurm_node_cpu_alloc node=gpu01.cluster.example.org
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+		{
+			name:  "hash, only where the label exists",
+			rules: []Rule{{Action: Hash, SourceLabels: []string{"user"}}},
+			want: `slurm_node_cpu_alloc node=cn01.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=cn02.cluster.example.org partition=cpu
+slurm_node_cpu_alloc node=gpu01.cluster.example.org partition=gpu
+slurm_user_jobs_running user=2bd806c97f0e00af
+slurm_user_jobs_running user=81b637d8fcd2c6da
+`,
+		},
+		{
+			name:  "labeldrop collapses duplicates into the first series",
+			rules: []Rule{{Action: LabelDrop, Regex: "node"}},
+			want: `slurm_node_cpu_alloc partition=cpu
+slurm_node_cpu_alloc partition=gpu
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+		{
+			name:  "labelkeep never removes the metric name",
+			rules: []Rule{{Action: LabelKeep, Regex: "user"}},
+			want: `slurm_node_cpu_alloc
+slurm_user_jobs_running user=alice
+slurm_user_jobs_running user=bob
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, relabeled(t, tt.rules))
+		})
+	}
+}
+
+func TestRules_HashSalt(t *testing.T) {
+	plain := relabeled(t, []Rule{{Action: Hash, SourceLabels: []string{"user"}}})
+	salted := relabeled(t, []Rule{{Action: Hash, SourceLabels: []string{"user"}, Salt: "site-secret"}})
+	assert.NotEqual(t, plain, salted)
+}
+
+func TestCompile_Errors(t *testing.T) {
+	_, err := Compile([]Rule{
+		{Action: Drop, SourceLabels: []string{"user"}},
+		{SourceLabels: []string{"user"}},
+		{Action: "rename", SourceLabels: []string{"user"}},
+		{Action: Keep},
+		{Action: Replace, SourceLabels: []string{"node"}},
+		{Action: Replace, SourceLabels: []string{"node"}, TargetLabel: "__name__"},
+		{Action: Hash, SourceLabels: []string{"user", "account"}},
+		{Action: LabelDrop, SourceLabels: []string{"user"}},
+		{Action: Drop, SourceLabels: []string{"user"}, Regex: "("},
+		{Action: Drop, SourceLabels: []string{"bad-name"}},
+	})
+	require.Error(t, err)
+	for _, want := range []string{
+		"relabel[1]: action is required",
+		`relabel[2]: unknown action "rename"`,
+		"relabel[3]: action keep requires source_labels",
+		"relabel[4]: action replace requires target_label",
+		"relabel[5]: the metric name cannot be rewritten",
+		"relabel[6]: action hash requires target_label",
+		"relabel[7]: action labeldrop matches label names",
+		`relabel[8]: invalid regex "("`,
+		`relabel[9]: invalid source label "bad-name"`,
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+	assert.NotContains(t, err.Error(), "relabel[0]")
+}
+
+func TestRelabeler_Set(t *testing.T) {
+	var r Relabeler
+	g := r.Wrap(gatherer(t))
+	count := func() int {
+		mfs, err := g.Gather()
+		require.NoError(t, err)
+		n := 0
+		for _, mf := range mfs {
+			n += len(mf.Metric)
+		}
+		return n
+	}
+	assert.Equal(t, 5, count(), "no rules set: everything passes")
+
+	rules, err := Compile([]Rule{{Action: Drop, SourceLabels: []string{"__name__"}, Regex: "slurm_node_.*"}})
+	require.NoError(t, err)
+	r.Set(rules)
+	assert.Equal(t, 2, count(), "rules set after Wrap apply to the next Gather")
+
+	r.Set(nil)
+	assert.Equal(t, 5, count())
+}
+
+// TestRules_Exposition checks the relabeled output still encodes.
+func TestRules_Exposition(t *testing.T) {
+	rules, err := Compile([]Rule{{Action: Replace, SourceLabels: []string{"node"}, Regex: `([^.]+)\..*`, TargetLabel: "node"}})
+	require.NoError(t, err)
+	var r Relabeler
+	r.Set(rules)
+	expected := `
+# HELP slurm_node_cpu_alloc h
+# TYPE slurm_node_cpu_alloc gauge
+slurm_node_cpu_alloc{node="cn01",partition="cpu"} 4
+slurm_node_cpu_alloc{node="cn02",partition="cpu"} 8
+slurm_node_cpu_alloc{node="gpu01",partition="gpu"} 2
+`
+	require.NoError(t, testutil.GatherAndCompare(r.Wrap(gatherer(t)), strings.NewReader(expected), "slurm_node_cpu_alloc"))
+}
+
+// TestRules_Collisions checks that series a rule makes identical are summed
+// where their values add up, and counted either way.
+func TestRules_Collisions(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	running := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "slurm_partition_user_jobs", Help: "h"}, []string{"partition", "user"})
+	running.WithLabelValues("cpu", "alice").Set(3)
+	running.WithLabelValues("cpu", "bob").Set(1)
+	running.WithLabelValues("gpu", "bob").Set(2)
+	submitted := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "slurm_user_jobs_submitted_total", Help: "h"}, []string{"user"})
+	submitted.WithLabelValues("alice").Add(5)
+	submitted.WithLabelValues("bob").Add(7)
+	wait := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "slurm_user_wait_seconds", Help: "h", Buckets: []float64{60}}, []string{"user"})
+	wait.WithLabelValues("alice").Observe(30)
+	wait.WithLabelValues("bob").Observe(90)
+	latency := prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "slurm_user_latency_seconds", Help: "h"}, []string{"user"})
+	latency.WithLabelValues("alice").Observe(1)
+	latency.WithLabelValues("bob").Observe(2)
+	reg.MustRegister(running, submitted, wait, latency)
+
+	rules, err := Compile([]Rule{{Action: LabelDrop, Regex: "user"}})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	r := Relabeler{Log: &logger.Logger{Logger: slog.New(slog.NewTextHandler(&buf, nil))}}
+	r.Set(rules)
+	before := func(metric, result string) float64 {
+		return testutil.ToFloat64(collisions.WithLabelValues(metric, result))
+	}
+	gaugeSummed, summaryDropped := before("slurm_partition_user_jobs", Summed), before("slurm_user_latency_seconds", Dropped)
+
+	expected := `
+# HELP slurm_partition_user_jobs h
+# TYPE slurm_partition_user_jobs gauge
+slurm_partition_user_jobs{partition="cpu"} 4
+slurm_partition_user_jobs{partition="gpu"} 2
+# HELP slurm_user_jobs_submitted_total h
+# TYPE slurm_user_jobs_submitted_total counter
+slurm_user_jobs_submitted_total 12
+# HELP slurm_user_wait_seconds h
+# TYPE slurm_user_wait_seconds histogram
+slurm_user_wait_seconds_bucket{le="60"} 1
+slurm_user_wait_seconds_bucket{le="+Inf"} 2
+slurm_user_wait_seconds_sum 120
+slurm_user_wait_seconds_count 2
+`
+	require.NoError(t, testutil.GatherAndCompare(r.Wrap(reg), strings.NewReader(expected),
+		"slurm_partition_user_jobs", "slurm_user_jobs_submitted_total", "slurm_user_wait_seconds"))
+	assert.Equal(t, 1.0, before("slurm_partition_user_jobs", Summed)-gaugeSummed)
+	assert.Equal(t, 1.0, before("slurm_user_latency_seconds", Dropped)-summaryDropped,
+		"quantiles do not add up: bob's summary is dropped")
+
+	_, err = r.Wrap(reg).Gather()
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(buf.String(), "slurm_partition_user_jobs"), "logged once per rule set")
+	assert.Contains(t, buf.String(), "only the first is kept")
+}
@@ -0,0 +1,460 @@
+package simulator
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// accountingRetention is how long sacct can see a finished job. The
+// sacct_efficiency collector looks back an hour by default; a day leaves room
+// for a longer --collector.sacct.lookback.
+const accountingRetention = 24 * time.Hour
+
+// Job states, as Slurm names them.
+const (
+	statePending   = "PENDING"
+	stateRunning   = "RUNNING"
+	stateCompleted = "COMPLETED"
+	stateFailed    = "FAILED"
+	stateCancelled = "CANCELLED"
+	stateTimeout   = "TIMEOUT"
+)
+
+// Cluster is a simulated cluster. It is safe for concurrent use: the
+// collectors of one scrape read it in parallel.
+type Cluster struct {
+	mu    sync.Mutex
+	model *Model
+	rng   *rand.Rand
+	wall  func() time.Time
+
+	// origin is when the cluster was created; reservations are relative to it.
+	origin time.Time
+	// since is where the simulation began, Warmup before origin.
+	since time.Time
+	now   time.Time
+
+	nodes        []*node
+	accounts     []*account
+	users        map[string]*user
+	userNames    []string
+	licenses     []*license
+	reservations []reservation
+	// jobs holds the pending and running jobs in submission order, which is
+	// also the order the scheduler considers them in.
+	jobs []*job
+	// finished holds the jobs that ended within accountingRetention.
+	finished  []*job
+	nextJobID int64
+	stats     stats
+}
+
+type node struct {
+	name       string
+	cpus       int64
+	memoryMB   int64
+	gpus       []bool // in use, per GPU index
+	gpuModel   string
+	features   []string
+	partitions []string
+
+	allocCPUs int64
+	allocMem  int64
+
+	drained  bool
+	reason   string
+	reasonAt time.Time
+	resumeAt time.Time
+}
+
+func (n *node) allocGPUs() int64 {
+	var used int64
+	for _, u := range n.gpus {
+		if u {
+			used++
+		}
+	}
+	return used
+}
+
+type account struct {
+	name   string
+	shares int64
+	users  []*user
+}
+
+type user struct {
+	name    string
+	uid     int64
+	account *account
+	// usage is the decayed CPU-seconds used, sshare's RawUsage.
+	usage float64
+}
+
+type license struct {
+	name  string
+	total int64
+	used  int64
+}
+
+type reservation struct {
+	ReservationModel
+	start, end time.Time
+}
+
+func (r *reservation) active(t time.Time) bool {
+	return !t.Before(r.start) && t.Before(r.end)
+}
+
+type job struct {
+	id        int64
+	user      *user
+	partition string
+	cpus      int64
+	gpus      int64
+	memoryMB  int64
+	license   string
+	timeLimit time.Duration
+
+	state  string
+	reason string
+	node   *node
+	gpuIdx []int
+
+	submit, start, end time.Time
+	// runtime is how long the job runs once started, and outcome the state
+	// it ends in. Both are drawn at submission.
+	runtime    time.Duration
+	outcome    string
+	efficiency float64
+	memUsed    float64
+}
+
+// New builds a cluster from m and simulates its warmup, so that it is ready
+// to be read on the wall clock.
+func New(m *Model) *Cluster {
+	return newCluster(m, time.Now)
+}
+
+func newCluster(m *Model, wall func() time.Time) *Cluster {
+	origin := wall().Truncate(time.Second)
+	c := &Cluster{
+		model:     m,
+		rng:       rand.New(rand.NewPCG(m.Seed, m.Seed)), //nolint:gosec // G404: a reproducible simulation, not a secret
+		wall:      wall,
+		origin:    origin,
+		since:     origin.Add(-m.Warmup),
+		now:       origin.Add(-m.Warmup),
+		users:     make(map[string]*user),
+		nextJobID: 1000,
+	}
+	for _, g := range m.Nodes {
+		for i := range g.Count {
+			c.nodes = append(c.nodes, &node{
+				name:       nodeName(g.Prefix, i, g.Count),
+				cpus:       g.CPUs,
+				memoryMB:   g.MemoryMB,
+				gpus:       make([]bool, g.GPUs),
+				gpuModel:   g.GPUModel,
+				features:   g.Features,
+				partitions: g.Partitions,
+			})
+		}
+	}
+	uid := int64(1000)
+	for _, am := range m.Accounts {
+		a := &account{name: am.Name, shares: am.Shares}
+		for _, name := range am.Users {
+			u := &user{name: name, uid: uid, account: a}
+			uid++
+			a.users = append(a.users, u)
+			c.users[name] = u
+			c.userNames = append(c.userNames, name)
+		}
+		c.accounts = append(c.accounts, a)
+	}
+	for _, l := range m.Licenses {
+		c.licenses = append(c.licenses, &license{name: l.Name, total: l.Total})
+	}
+	for _, r := range m.Reservations {
+		start := origin.Add(r.Start)
+		c.reservations = append(c.reservations, reservation{ReservationModel: r, start: start, end: start.Add(r.Duration)})
+	}
+	for c.now.Before(origin) {
+		c.step()
+	}
+	return c
+}
+
+// Now returns the simulated time.
+func (c *Cluster) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sync advances the cluster to the wall clock, a tick at a time.
+func (c *Cluster) Sync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	target := c.wall()
+	for !c.now.Add(c.model.Tick).After(target) {
+		c.step()
+	}
+}
+
+// Step advances the cluster by n ticks, whatever the wall clock says.
+func (c *Cluster) Step(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for range n {
+		c.step()
+	}
+}
+
+// step is one tick: jobs end, nodes drain and resume, the workload submits,
+// the scheduler runs, and usage accrues and decays.
+func (c *Cluster) step() {
+	c.now = c.now.Add(c.model.Tick)
+	c.endJobs()
+	c.drainNodes()
+	c.submitJobs()
+	c.schedule()
+	c.accrueUsage()
+
+	cutoff := c.now.Add(-accountingRetention)
+	c.finished = slices.DeleteFunc(c.finished, func(j *job) bool { return j.end.Before(cutoff) })
+}
+
+// endJobs ends the running jobs whose time is up, and cancels the pending ones
+// that were going to be cancelled before they ever started.
+func (c *Cluster) endJobs() {
+	c.jobs = slices.DeleteFunc(c.jobs, func(j *job) bool {
+		switch {
+		case j.state == stateRunning && !j.start.Add(j.runtime).After(c.now):
+			c.release(j)
+			j.state, j.end = j.outcome, j.start.Add(j.runtime)
+		case j.state == statePending && j.outcome == stateCancelled && !j.submit.Add(j.runtime).After(c.now):
+			j.state, j.end = stateCancelled, c.now
+		default:
+			return false
+		}
+		j.reason = "None"
+		c.finished = append(c.finished, j)
+		switch j.state {
+		case stateCompleted:
+			c.stats.completed++
+		case stateCancelled:
+			c.stats.cancelled++
+		default:
+			c.stats.failed++
+		}
+		c.rpc("REQUEST_COMPLETE_BATCH_SCRIPT", nil)
+		return true
+	})
+}
+
+func (c *Cluster) release(j *job) {
+	n := j.node
+	n.allocCPUs -= j.cpus
+	n.allocMem -= j.memoryMB
+	for _, i := range j.gpuIdx {
+		n.gpus[i] = false
+	}
+	if j.license != "" {
+		c.license(j.license).used--
+	}
+}
+
+func (c *Cluster) license(name string) *license {
+	for _, l := range c.licenses {
+		if l.name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// drainNodes resumes the nodes whose drain is over, and drains each of the
+// others with the modelled daily probability.
+func (c *Cluster) drainNodes() {
+	d := c.model.Drains
+	p := d.PerNodePerDay * c.model.Tick.Hours() / 24
+	for _, n := range c.nodes {
+		if n.drained {
+			if !n.resumeAt.After(c.now) {
+				n.drained, n.reason, n.reasonAt = false, "", time.Time{}
+			}
+			continue
+		}
+		if p > 0 && c.rng.Float64() < p {
+			n.drained = true
+			n.reason = d.Reasons[c.rng.IntN(len(d.Reasons))]
+			n.reasonAt = c.now
+			n.resumeAt = c.now.Add(d.Duration)
+		}
+	}
+}
+
+// submitJobs submits each class's expected number of jobs for one tick. The
+// fractional part is submitted with that probability, so a rate of one per
+// hour still submits on a ten-second tick.
+func (c *Cluster) submitJobs() {
+	for i := range c.model.Workload {
+		cl := &c.model.Workload[i]
+		expected := cl.SubmitsPerHour * c.model.Tick.Hours()
+		n := int(expected)
+		if c.rng.Float64() < expected-float64(n) {
+			n++
+		}
+		for range n {
+			c.submit(cl)
+		}
+	}
+}
+
+func (c *Cluster) submit(cl *JobClass) {
+	users := cl.Users
+	if len(users) == 0 {
+		users = c.userNames
+	}
+	u := c.users[users[c.rng.IntN(len(users))]]
+	j := &job{
+		id:         c.nextJobID,
+		user:       u,
+		partition:  cl.Partition,
+		cpus:       drawInt(c.rng, cl.CPUs),
+		gpus:       drawInt(c.rng, cl.GPUs),
+		license:    cl.License,
+		timeLimit:  cl.TimeLimit,
+		state:      statePending,
+		reason:     "None",
+		submit:     c.now,
+		runtime:    drawDuration(c.rng, cl.Runtime),
+		outcome:    stateCompleted,
+		efficiency: float64(drawInt(c.rng, cl.Efficiency)) / 100,
+		memUsed:    0.2 + 0.7*c.rng.Float64(),
+	}
+	j.memoryMB = j.cpus * cl.MemoryPerCPUMB
+	switch o, r := cl.Outcomes, c.rng.Float64(); {
+	case r < o.Failed:
+		j.outcome = stateFailed
+		j.runtime = time.Duration(c.rng.Float64() * float64(j.runtime))
+	case r < o.Failed+o.Cancelled:
+		j.outcome = stateCancelled
+		j.runtime = time.Duration(c.rng.Float64() * float64(j.runtime))
+	case r < o.Failed+o.Cancelled+o.Timeout:
+		j.outcome = stateTimeout
+		j.runtime = j.timeLimit
+	}
+	j.runtime = max(j.runtime, c.model.Tick).Truncate(time.Second)
+	c.nextJobID++
+	c.jobs = append(c.jobs, j)
+	c.stats.submitted++
+	c.rpc("REQUEST_SUBMIT_BATCH_JOB", u)
+}
+
+// schedule starts the pending jobs that fit, in submission order. The first
+// job of a partition that does not fit waits for Resources and the ones
+// behind it for Priority; one of those that fits anyway is counted as
+// backfilled.
+func (c *Cluster) schedule() {
+	blocked := make(map[string]bool)
+	depth := 0
+	for _, j := range c.jobs {
+		if j.state != statePending {
+			continue
+		}
+		depth++
+		if j.license != "" {
+			if l := c.license(j.license); l.used >= l.total {
+				j.reason = "Licenses"
+				continue
+			}
+		}
+		n := c.fit(j)
+		if n == nil {
+			if blocked[j.partition] {
+				j.reason = "Priority"
+			} else {
+				j.reason = "Resources"
+				blocked[j.partition] = true
+			}
+			continue
+		}
+		c.place(j, n)
+		c.stats.started++
+		if blocked[j.partition] {
+			c.stats.backfilled++
+		}
+	}
+	c.stats.cycle(int64(depth), c.model.Tick)
+}
+
+// fit returns the first node of the job's partition with room for it.
+func (c *Cluster) fit(j *job) *node {
+	for _, n := range c.nodes {
+		if !slices.Contains(n.partitions, j.partition) || n.drained || c.reserved(n) != nil {
+			continue
+		}
+		if n.cpus-n.allocCPUs >= j.cpus && n.memoryMB-n.allocMem >= j.memoryMB && int64(len(n.gpus))-n.allocGPUs() >= j.gpus {
+			return n
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) place(j *job, n *node) {
+	j.state, j.reason, j.node, j.start = stateRunning, "None", n, c.now
+	n.allocCPUs += j.cpus
+	n.allocMem += j.memoryMB
+	for i := range n.gpus {
+		if int64(len(j.gpuIdx)) == j.gpus {
+			break
+		}
+		if !n.gpus[i] {
+			n.gpus[i] = true
+			j.gpuIdx = append(j.gpuIdx, i)
+		}
+	}
+	if j.license != "" {
+		c.license(j.license).used++
+	}
+}
+
+// reserved returns the reservation holding n now, if any. A reserved node
+// takes none of the modelled workload.
+func (c *Cluster) reserved(n *node) *reservation {
+	for i := range c.reservations {
+		r := &c.reservations[i]
+		if r.active(c.now) && slices.Contains(r.Nodes, n.name) {
+			return r
+		}
+	}
+	return nil
+}
+
+// accrueUsage charges each running job's CPU time to its user, after decaying
+// everyone's usage by one tick of the half-life.
+func (c *Cluster) accrueUsage() {
+	decay := math.Pow(0.5, c.model.Tick.Seconds()/c.model.FairshareHalfLife.Seconds())
+	for _, u := range c.users {
+		u.usage *= decay
+	}
+	for _, j := range c.jobs {
+		if j.state == stateRunning {
+			j.user.usage += float64(j.cpus) * c.model.Tick.Seconds()
+		}
+	}
+}
+
+func drawInt(rng *rand.Rand, r Range[int64]) int64 {
+	return r.Min + rng.Int64N(r.Max-r.Min+1)
+}
+
+func drawDuration(rng *rand.Rand, r Range[time.Duration]) time.Duration {
+	return r.Min + time.Duration(rng.Int64N(int64(r.Max-r.Min)+1))
+}
@@ -0,0 +1,267 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// start is the wall clock every test cluster is created at.
+var start = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// fixedWall returns a wall clock that reads *now.
+func fixedWall(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+func parse(t *testing.T, doc string) *Model {
+	t.Helper()
+	m, err := Parse([]byte(doc))
+	require.NoError(t, err)
+	return m
+}
+
+// oneNode is a single four-CPU node taking one four-CPU job per tick, each
+// running for three ticks.
+const oneNode = `
+seed: 1
+tick: 10s
+partitions: [{name: cpu}]
+nodes:
+  - {prefix: cn, count: 1, cpus: 4, partitions: [cpu]}
+accounts:
+  - {name: physics, users: [alice]}
+workload:
+  - {name: full, partition: cpu, submits_per_hour: 360, cpus: {min: 4}, runtime: {min: 30s}}
+`
+
+func states(jobs []slurmrest.Job) map[string]int {
+	out := make(map[string]int)
+	for _, j := range jobs {
+		key := j.JobState[0]
+		if key == "PENDING" {
+			key += "/" + j.StateReason
+		}
+		out[key]++
+	}
+	return out
+}
+
+func TestCluster_Lifecycle(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, oneNode), fixedWall(&now))
+	c.Step(4)
+
+	// Job 1000 started on the first tick and ends on the fourth, when 1001
+	// takes the node; 1002 and 1003 queue behind it.
+	assert.Equal(t, map[string]int{"COMPLETED": 1, "RUNNING": 1, "PENDING/Resources": 1, "PENDING/Priority": 1}, states(c.Jobs()))
+
+	nodes := c.Nodes()
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "cn01", nodes[0].Name)
+	assert.Equal(t, slurmrest.StringList{"ALLOCATED"}, nodes[0].State)
+	assert.EqualValues(t, 4, nodes[0].AllocCPUs)
+
+	s := c.Statistics()
+	assert.EqualValues(t, 4, s.JobsSubmitted)
+	assert.EqualValues(t, 2, s.JobsStarted)
+	assert.EqualValues(t, 1, s.JobsCompleted)
+	assert.EqualValues(t, 2, s.JobsPending)
+	assert.EqualValues(t, 1, s.JobsRunning)
+	assert.EqualValues(t, 4, s.ScheduleCycleTotal)
+
+	// A finished job leaves squeue after MinJobAge, but stays in accounting.
+	c.Step(30)
+	for _, j := range c.Jobs() {
+		assert.NotEqual(t, int64(1000), j.JobID)
+	}
+	acct := c.Accounting(start, c.Now())
+	require.NotEmpty(t, acct)
+	assert.Equal(t, AccountingRecord{
+		JobID: 1000, User: "alice", Account: "physics", State: "COMPLETED", CPUs: 4,
+		Elapsed: 30 * time.Second, TotalCPU: acct[0].TotalCPU, ReqMemMB: 4096, MaxRSSMB: acct[0].MaxRSSMB,
+	}, acct[0])
+	assert.LessOrEqual(t, acct[0].TotalCPU, 2*time.Minute)
+
+	started := c.Started(start, c.Now())
+	require.NotEmpty(t, started)
+	assert.Equal(t, StartRecord{
+		JobID: 1000, Partition: started[0].Partition, Account: "physics",
+		Submit: started[0].Submit, Start: started[0].Start,
+	}, started[0], "a job that ended is still reported started")
+	for _, r := range c.Started(c.Now(), c.Now()) {
+		assert.NotEqual(t, int64(1000), r.JobID, "a window after its end leaves it out")
+	}
+}
+
+// TestCluster_Deterministic checks that the same model stepped the same number
+// of ticks is the same cluster.
+func TestCluster_Deterministic(t *testing.T) {
+	m, err := Load("../../docs/simulate-cluster.yaml")
+	require.NoError(t, err)
+	now := start
+	a := newCluster(m, fixedWall(&now))
+	b := newCluster(m, fixedWall(&now))
+	a.Step(60)
+	b.Step(60)
+	assert.Equal(t, a.Jobs(), b.Jobs())
+	assert.Equal(t, a.Nodes(), b.Nodes())
+	assert.Equal(t, a.Associations(), b.Associations())
+	assert.NotEmpty(t, a.Jobs(), "the warmup leaves the example cluster busy")
+}
+
+func TestCluster_Sync(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, oneNode), fixedWall(&now))
+	assert.Equal(t, start, c.Now())
+
+	now = now.Add(65 * time.Second)
+	c.Sync()
+	assert.Equal(t, start.Add(60*time.Second), c.Now(), "Sync stops at the last whole tick")
+	assert.EqualValues(t, 6, c.Statistics().JobsSubmitted)
+}
+
+func TestCluster_Warmup(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, oneNode+"warmup: 1m\n"), fixedWall(&now))
+	assert.Equal(t, start, c.Now())
+	assert.EqualValues(t, 6, c.Statistics().JobsSubmitted, "the warmup ran before the cluster was handed out")
+}
+
+func TestCluster_Drain(t *testing.T) {
+	now := start
+	// One drain per node per tick.
+	c := newCluster(parse(t, oneNode+`
+drains: {per_node_per_day: 8640, duration: 20s, reasons: [ECC errors]}
+`), fixedWall(&now))
+	c.Step(1)
+	n := c.Nodes()[0]
+	assert.Equal(t, slurmrest.StringList{"IDLE", "DRAIN"}, n.State)
+	assert.Equal(t, "ECC errors", n.Reason)
+	assert.Equal(t, start.Add(10*time.Second).Unix(), n.ReasonChangedAt.Value())
+	assert.Equal(t, map[string]int{"PENDING/Resources": 1}, states(c.Jobs()), "a drained node takes no job")
+
+	// Resumed on the third tick, which starts a job on it, and drained again
+	// on the fourth.
+	c.Step(2)
+	n = c.Nodes()[0]
+	assert.Equal(t, slurmrest.StringList{"ALLOCATED"}, n.State)
+	assert.Empty(t, n.Reason)
+	c.Step(1)
+	assert.Equal(t, slurmrest.StringList{"ALLOCATED", "DRAIN"}, c.Nodes()[0].State)
+}
+
+func TestCluster_Reservation(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, oneNode+`
+reservations:
+  - {name: maint, nodes: [cn01], start: 20s, duration: 1m, users: [root], flags: [MAINT]}
+`), fixedWall(&now))
+	c.Step(1)
+	require.Len(t, c.Reservations(), 1)
+	assert.Equal(t, slurmrest.StringList{"ALLOCATED"}, c.Nodes()[0].State)
+
+	// The reservation starts while job 1000 runs; the node finishes it, then
+	// takes nothing more until the reservation ends.
+	c.Step(4)
+	n := c.Nodes()[0]
+	assert.Equal(t, slurmrest.StringList{"IDLE", "MAINTENANCE"}, n.State)
+	assert.Equal(t, "maint", n.Reservation)
+
+	c.Step(5)
+	assert.Empty(t, c.Reservations())
+	assert.Equal(t, slurmrest.StringList{"ALLOCATED"}, c.Nodes()[0].State)
+}
+
+func TestCluster_GRES(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, `
+partitions: [{name: gpu}]
+nodes:
+  - {prefix: g, count: 1, cpus: 8, gpus: 4, gpu_model: a100, partitions: [gpu]}
+accounts:
+  - {name: ml, users: [frank]}
+workload:
+  - {name: t, partition: gpu, submits_per_hour: 720, cpus: {min: 1}, gpus: {min: 1}, runtime: {min: 1h}}
+`), fixedWall(&now))
+	n := c.Nodes()[0]
+	assert.Equal(t, "gpu:a100:4", n.GRES)
+	assert.Equal(t, "gpu:a100:0(IDX:N/A)", n.GRESUsed)
+
+	c.Step(1)
+	assert.Equal(t, "gpu:a100:2(IDX:0-1)", c.Nodes()[0].GRESUsed)
+	c.Step(2)
+	assert.Equal(t, "gpu:a100:4(IDX:0-3)", c.Nodes()[0].GRESUsed)
+	assert.Equal(t, map[string]int{"RUNNING": 4, "PENDING/Resources": 1, "PENDING/Priority": 1}, states(c.Jobs()))
+}
+
+func TestCluster_Licenses(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, `
+partitions: [{name: cpu}]
+nodes:
+  - {prefix: cn, count: 1, cpus: 64, partitions: [cpu]}
+accounts:
+  - {name: physics, users: [alice]}
+licenses:
+  - {name: matlab, total: 2}
+workload:
+  - {name: m, partition: cpu, submits_per_hour: 360, runtime: {min: 1h}, license: matlab}
+`), fixedWall(&now))
+	c.Step(3)
+	assert.Equal(t, []slurmrest.License{{Name: "matlab", Total: 2, Used: 2}}, c.Licenses())
+	assert.Equal(t, map[string]int{"RUNNING": 2, "PENDING/Licenses": 1}, states(c.Jobs()))
+}
+
+func TestCluster_Associations(t *testing.T) {
+	now := start
+	c := newCluster(parse(t, oneNode), fixedWall(&now))
+	c.Step(3)
+	a := c.Associations()
+	require.Len(t, a, 3)
+	assert.Equal(t, "root", a[0].Account)
+	assert.Equal(t, "physics", a[1].Account)
+	assert.Empty(t, a[1].User)
+	assert.Equal(t, "alice", a[2].User)
+	assert.InDelta(t, 120, a[2].RawUsage, 1, "four CPUs for three ticks, barely decayed")
+	assert.InDelta(t, 1.0, a[2].NormUsage, 1e-9)
+	assert.InDelta(t, 0.5, a[2].FairShare, 1e-9, "all of the usage against all of the shares")
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := Parse([]byte(`
+tick: 100ms
+partitions: [{name: cpu}]
+nodes:
+  - {prefix: cn, count: 2, cpus: 4, partitions: [gpu]}
+accounts:
+  - {name: physics, users: [alice]}
+  - {name: chemistry, users: [alice]}
+reservations:
+  - {name: maint, nodes: [cn99], duration: 1h}
+workload:
+  - {partition: cpu, users: [zoe], cpus: {min: 8}, runtime: {min: 1h}, time_limit: 10m, license: matlab}
+  - {partition: cpu, runtime: {min: 1m}, outcomes: {failed: 0.8, timeout: 0.5}}
+`))
+	require.Error(t, err)
+	for _, want := range []string{
+		"tick must be at least 1s",
+		`nodes[0]: unknown partition "gpu"`,
+		`accounts[1]: user "alice" belongs to another account already`,
+		`reservations[0]: unknown node "cn99"`,
+		`workload[0]: user "zoe" is in no account`,
+		`workload[0]: no node of partition "cpu" is large enough for 8 CPUs`,
+		"workload[0]: time_limit 10m0s is shorter than runtime.max 1h0m0s",
+		`workload[0]: unknown license "matlab"`,
+		"workload[1]: outcomes must be between 0 and 1",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+
+	_, err = Parse([]byte("nodez: []\n"))
+	assert.ErrorContains(t, err, "field nodez not found")
+}
@@ -0,0 +1,379 @@
+// Package simulator runs a fake Slurm cluster in memory.
+//
+// Dashboards and alerts are written against a cluster that changes: jobs
+// queue and start, nodes drain and come back, a reservation begins. The
+// fixtures under test_data/ are single captures and cannot show any of that.
+// A Cluster is built from a YAML model of nodes, partitions, accounts and
+// workload, and advances on a fixed tick: jobs are submitted at the modelled
+// rates, scheduled onto free nodes, run and end, and nodes drain and resume.
+//
+// Every random draw comes from one generator seeded by the model, and the
+// state only moves a tick at a time, so the same model stepped the same number
+// of ticks is the same cluster. The package knows nothing about the command
+// formats: it hands out its state as the slurmrest types, and the collector
+// package prints them the way each Slurm command would.
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Model is a cluster definition, as written in the --slurm.simulate file.
+type Model struct {
+	// Seed makes two runs of the same model identical.
+	Seed uint64 `yaml:"seed"`
+	// Version is the Slurm release every binary reports.
+	Version string `yaml:"version"`
+	// Cluster is the cluster name slurmrestd would report.
+	Cluster string `yaml:"cluster"`
+	// Tick is how much simulated time one step covers.
+	Tick time.Duration `yaml:"tick"`
+	// Warmup is simulated before the first scrape, so the cluster starts
+	// busy rather than empty.
+	Warmup time.Duration `yaml:"warmup"`
+	// MinJobAge is how long a finished job stays visible to squeue, as
+	// MinJobAge in slurm.conf.
+	MinJobAge time.Duration `yaml:"min_job_age"`
+	// FairshareHalfLife is the usage decay half-life, as PriorityDecayHalfLife.
+	FairshareHalfLife time.Duration `yaml:"fairshare_half_life"`
+
+	Partitions   []PartitionModel   `yaml:"partitions"`
+	Nodes        []NodeGroup        `yaml:"nodes"`
+	Accounts     []AccountModel     `yaml:"accounts"`
+	Licenses     []LicenseModel     `yaml:"licenses"`
+	Reservations []ReservationModel `yaml:"reservations"`
+	Workload     []JobClass         `yaml:"workload"`
+	Drains       DrainModel         `yaml:"drains"`
+}
+
+// PartitionModel is one partition.
+type PartitionModel struct {
+	Name string `yaml:"name"`
+}
+
+// NodeGroup is a set of identical nodes named Prefix01, Prefix02 and so on.
+type NodeGroup struct {
+	Prefix string `yaml:"prefix"`
+	Count  int    `yaml:"count"`
+	CPUs   int64  `yaml:"cpus"`
+	// MemoryMB defaults to twice DefaultMemoryPerCPUMB per CPU.
+	MemoryMB   int64    `yaml:"memory_mb"`
+	GPUs       int64    `yaml:"gpus"`
+	GPUModel   string   `yaml:"gpu_model"`
+	Features   []string `yaml:"features"`
+	Partitions []string `yaml:"partitions"`
+}
+
+// AccountModel is one account and the users under it. Every user has one
+// share within the account.
+type AccountModel struct {
+	Name   string   `yaml:"name"`
+	Shares int64    `yaml:"shares"`
+	Users  []string `yaml:"users"`
+}
+
+// LicenseModel is one license pool.
+type LicenseModel struct {
+	Name  string `yaml:"name"`
+	Total int64  `yaml:"total"`
+}
+
+// ReservationModel is one reservation. Start is relative to the moment the
+// simulation is created, and may be negative for one already running.
+type ReservationModel struct {
+	Name     string        `yaml:"name"`
+	Nodes    []string      `yaml:"nodes"`
+	Start    time.Duration `yaml:"start"`
+	Duration time.Duration `yaml:"duration"`
+	Users    []string      `yaml:"users"`
+	Accounts []string      `yaml:"accounts"`
+	// Flags are printed as Slurm's. MAINT makes the nodes show as maint
+	// rather than reserved.
+	Flags []string `yaml:"flags"`
+}
+
+// Range is an inclusive range a value is drawn from uniformly.
+type Range[T int64 | time.Duration] struct {
+	Min T `yaml:"min"`
+	Max T `yaml:"max"`
+}
+
+// JobClass is one kind of job the workload submits.
+type JobClass struct {
+	Name      string `yaml:"name"`
+	Partition string `yaml:"partition"`
+	// Users submitting this class, drawn uniformly. Empty means every user.
+	Users          []string             `yaml:"users"`
+	SubmitsPerHour float64              `yaml:"submits_per_hour"`
+	CPUs           Range[int64]         `yaml:"cpus"`
+	GPUs           Range[int64]         `yaml:"gpus"`
+	MemoryPerCPUMB int64                `yaml:"memory_per_cpu_mb"`
+	Runtime        Range[time.Duration] `yaml:"runtime"`
+	TimeLimit      time.Duration        `yaml:"time_limit"`
+	License        string               `yaml:"license"`
+	Outcomes       OutcomeModel         `yaml:"outcomes"`
+	// Efficiency is the share of the allocated CPU time a job actually uses,
+	// in percent. It drives the sacct figures.
+	Efficiency Range[int64] `yaml:"efficiency"`
+}
+
+// OutcomeModel is the share of jobs, between 0 and 1, that do not complete.
+// A timed-out job runs to its time limit.
+type OutcomeModel struct {
+	Failed    float64 `yaml:"failed"`
+	Cancelled float64 `yaml:"cancelled"`
+	Timeout   float64 `yaml:"timeout"`
+}
+
+// DrainModel is how often a node drains and for how long.
+type DrainModel struct {
+	PerNodePerDay float64       `yaml:"per_node_per_day"`
+	Duration      time.Duration `yaml:"duration"`
+	Reasons       []string      `yaml:"reasons"`
+}
+
+// Defaults applied to a model that leaves the field empty.
+const (
+	DefaultVersion           = "24.11.0"
+	DefaultCluster           = "simulated"
+	DefaultTick              = 10 * time.Second
+	DefaultMinJobAge         = 300 * time.Second
+	DefaultFairshareHalfLife = 7 * 24 * time.Hour
+	DefaultDrainDuration     = 2 * time.Hour
+	DefaultMemoryPerCPUMB    = 1024
+)
+
+var defaultDrainReasons = []string{"Kill task failed", "Node unexpectedly rebooted", "ECC errors"}
+
+// Load reads and parses the model at path.
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: the path is the operator's own --slurm.simulate
+	if err != nil {
+		return nil, fmt.Errorf("reading cluster model: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates a model. Unknown keys are an error, as in the
+// configuration file.
+func Parse(data []byte) (*Model, error) {
+	m := &Model{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing cluster model: %w", err)
+	}
+	m.applyDefaults()
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Model) applyDefaults() {
+	if m.Version == "" {
+		m.Version = DefaultVersion
+	}
+	if m.Cluster == "" {
+		m.Cluster = DefaultCluster
+	}
+	if m.Tick == 0 {
+		m.Tick = DefaultTick
+	}
+	if m.MinJobAge == 0 {
+		m.MinJobAge = DefaultMinJobAge
+	}
+	if m.FairshareHalfLife == 0 {
+		m.FairshareHalfLife = DefaultFairshareHalfLife
+	}
+	if m.Drains.Duration == 0 {
+		m.Drains.Duration = DefaultDrainDuration
+	}
+	if len(m.Drains.Reasons) == 0 {
+		m.Drains.Reasons = defaultDrainReasons
+	}
+	for i := range m.Nodes {
+		if g := &m.Nodes[i]; g.MemoryMB == 0 {
+			g.MemoryMB = g.CPUs * DefaultMemoryPerCPUMB * 2
+		}
+	}
+	for i := range m.Accounts {
+		if m.Accounts[i].Shares == 0 {
+			m.Accounts[i].Shares = 1
+		}
+	}
+	for i := range m.Workload {
+		c := &m.Workload[i]
+		if c.CPUs.Min == 0 {
+			c.CPUs.Min = 1
+		}
+		if c.CPUs.Max < c.CPUs.Min {
+			c.CPUs.Max = c.CPUs.Min
+		}
+		if c.GPUs.Max < c.GPUs.Min {
+			c.GPUs.Max = c.GPUs.Min
+		}
+		if c.Runtime.Max < c.Runtime.Min {
+			c.Runtime.Max = c.Runtime.Min
+		}
+		if c.MemoryPerCPUMB == 0 {
+			c.MemoryPerCPUMB = DefaultMemoryPerCPUMB
+		}
+		if c.TimeLimit == 0 {
+			c.TimeLimit = c.Runtime.Max
+		}
+		if c.Efficiency.Min == 0 && c.Efficiency.Max == 0 {
+			c.Efficiency = Range[int64]{Min: 50, Max: 100}
+		}
+	}
+}
+
+// validate reports every problem at once, each prefixed with where it is.
+func (m *Model) validate() error {
+	var errs []error
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if m.Tick < time.Second {
+		fail("tick must be at least 1s, got %s", m.Tick)
+	}
+	if m.Warmup < 0 {
+		fail("warmup must not be negative, got %s", m.Warmup)
+	}
+
+	partitions := make([]string, 0, len(m.Partitions))
+	for i, p := range m.Partitions {
+		if p.Name == "" {
+			fail("partitions[%d]: name is required", i)
+		}
+		partitions = append(partitions, p.Name)
+	}
+	if len(m.Nodes) == 0 {
+		fail("nodes: at least one node group is required")
+	}
+	nodes := make(map[string]bool)
+	for i, g := range m.Nodes {
+		switch {
+		case g.Prefix == "":
+			fail("nodes[%d]: prefix is required", i)
+		case g.Count < 1:
+			fail("nodes[%d]: count must be positive", i)
+		case g.CPUs < 1:
+			fail("nodes[%d]: cpus must be positive", i)
+		case g.GPUs < 0:
+			fail("nodes[%d]: gpus must not be negative", i)
+		case len(g.Partitions) == 0:
+			fail("nodes[%d]: at least one partition is required", i)
+		}
+		for _, p := range g.Partitions {
+			if !slices.Contains(partitions, p) {
+				fail("nodes[%d]: unknown partition %q", i, p)
+			}
+		}
+		for n := range g.Count {
+			nodes[nodeName(g.Prefix, n, g.Count)] = true
+		}
+	}
+
+	users := make(map[string]bool)
+	for i, a := range m.Accounts {
+		if a.Name == "" {
+			fail("accounts[%d]: name is required", i)
+		}
+		if len(a.Users) == 0 {
+			fail("accounts[%d]: at least one user is required", i)
+		}
+		for _, u := range a.Users {
+			if users[u] {
+				fail("accounts[%d]: user %q belongs to another account already", i, u)
+			}
+			users[u] = true
+		}
+	}
+	if len(users) == 0 {
+		fail("accounts: at least one account with users is required")
+	}
+
+	licenses := make([]string, 0, len(m.Licenses))
+	for i, l := range m.Licenses {
+		if l.Name == "" || l.Total < 1 {
+			fail("licenses[%d]: name and a positive total are required", i)
+		}
+		licenses = append(licenses, l.Name)
+	}
+
+	for i, r := range m.Reservations {
+		if r.Name == "" || r.Duration <= 0 {
+			fail("reservations[%d]: name and a positive duration are required", i)
+		}
+		for _, n := range r.Nodes {
+			if !nodes[n] {
+				fail("reservations[%d]: unknown node %q", i, n)
+			}
+		}
+	}
+
+	for i, c := range m.Workload {
+		if !slices.Contains(partitions, c.Partition) {
+			fail("workload[%d]: unknown partition %q", i, c.Partition)
+		}
+		for _, u := range c.Users {
+			if !users[u] {
+				fail("workload[%d]: user %q is in no account", i, u)
+			}
+		}
+		if c.SubmitsPerHour < 0 {
+			fail("workload[%d]: submits_per_hour must not be negative", i)
+		}
+		if c.Runtime.Min <= 0 {
+			fail("workload[%d]: runtime.min must be positive", i)
+		}
+		if !m.fits(c) {
+			fail("workload[%d]: no node of partition %q is large enough for %d CPUs, %d GPUs and %d MB",
+				i, c.Partition, c.CPUs.Max, c.GPUs.Max, c.CPUs.Max*c.MemoryPerCPUMB)
+		}
+		if c.TimeLimit < c.Runtime.Max {
+			fail("workload[%d]: time_limit %s is shorter than runtime.max %s", i, c.TimeLimit, c.Runtime.Max)
+		}
+		if c.License != "" && !slices.Contains(licenses, c.License) {
+			fail("workload[%d]: unknown license %q", i, c.License)
+		}
+		if o := c.Outcomes; o.Failed < 0 || o.Cancelled < 0 || o.Timeout < 0 || o.Failed+o.Cancelled+o.Timeout > 1 {
+			fail("workload[%d]: outcomes must be between 0 and 1 and add up to at most 1", i)
+		}
+		if c.Efficiency.Min < 1 || c.Efficiency.Max > 100 || c.Efficiency.Min > c.Efficiency.Max {
+			fail("workload[%d]: efficiency must be a range within 1-100", i)
+		}
+	}
+
+	if m.Drains.PerNodePerDay < 0 {
+		fail("drains.per_node_per_day must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// fits reports whether the largest job of class c fits on some node of its
+// partition. One that does not would stay pending forever.
+func (m *Model) fits(c JobClass) bool {
+	for _, g := range m.Nodes {
+		if slices.Contains(g.Partitions, c.Partition) &&
+			g.CPUs >= c.CPUs.Max && g.GPUs >= c.GPUs.Max && g.MemoryMB >= c.CPUs.Max*c.MemoryPerCPUMB {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeName numbers a node with as many digits as the group's largest number,
+// and at least two: cn01 to cn32, gpu001 to gpu128.
+func nodeName(prefix string, i, count int) string {
+	width := max(2, len(fmt.Sprint(count)))
+	return fmt.Sprintf("%s%0*d", prefix, width, i+1)
+}
@@ -0,0 +1,453 @@
+package simulator
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
+)
+
+// The read side. Each method returns a copy of the state at the current
+// simulated time, in the types slurmrestd answers with, so that whatever
+// prints slurmrestd's answers as Slurm command output prints these too.
+
+func number(v int64) slurmrest.Number { return slurmrest.Number{Set: true, Number: v} }
+
+func unix(t time.Time) slurmrest.Number {
+	if t.IsZero() {
+		return slurmrest.Number{}
+	}
+	return number(t.Unix())
+}
+
+// Version returns the Slurm release the cluster reports.
+func (c *Cluster) Version() string { return c.model.Version }
+
+// Meta returns the meta block of a slurmrestd or --json answer.
+func (c *Cluster) Meta() slurmrest.Meta {
+	var m slurmrest.Meta
+	m.Slurm.Release = c.model.Version
+	m.Slurm.Cluster = c.model.Cluster
+	return m
+}
+
+// Nodes returns every node, in model order.
+func (c *Cluster) Nodes() []slurmrest.Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]slurmrest.Node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		out = append(out, slurmrest.Node{
+			Name:            n.name,
+			State:           c.nodeState(n),
+			CPUs:            n.cpus,
+			AllocCPUs:       n.allocCPUs,
+			AllocIdleCPUs:   n.cpus - n.allocCPUs,
+			RealMemory:      n.memoryMB,
+			AllocMemory:     n.allocMem,
+			FreeMem:         number(n.memoryMB - n.allocMem),
+			Partitions:      slices.Clone(n.partitions),
+			GRES:            n.gres(),
+			GRESUsed:        n.gresUsed(),
+			Features:        slices.Clone(n.features),
+			ActiveFeatures:  slices.Clone(n.features),
+			Reason:          n.reason,
+			ReasonChangedAt: unix(n.reasonAt),
+			Reservation:     c.reservationName(n),
+			Version:         c.model.Version,
+		})
+	}
+	return out
+}
+
+// nodeState is the base state followed by its flags, as slurmrestd gives it.
+func (c *Cluster) nodeState(n *node) []string {
+	state := []string{"IDLE"}
+	switch {
+	case n.allocCPUs == n.cpus:
+		state[0] = "ALLOCATED"
+	case n.allocCPUs > 0:
+		state[0] = "MIXED"
+	}
+	if n.drained {
+		state = append(state, "DRAIN")
+	}
+	if r := c.reserved(n); r != nil {
+		if slices.Contains(r.Flags, "MAINT") {
+			state = append(state, "MAINTENANCE")
+		} else {
+			state = append(state, "RESERVED")
+		}
+	}
+	return state
+}
+
+func (c *Cluster) reservationName(n *node) string {
+	if r := c.reserved(n); r != nil {
+		return r.Name
+	}
+	return ""
+}
+
+// gres prints the node's GRES as sinfo does: gpu:<model>:<count>, or
+// gpu:<count> without a model.
+func (n *node) gres() string {
+	if len(n.gpus) == 0 {
+		return ""
+	}
+	return n.gresType() + strconv.Itoa(len(n.gpus))
+}
+
+// gresUsed prints the GPUs in use with their indexes, gpu:a100:2(IDX:0-1).
+func (n *node) gresUsed() string {
+	if len(n.gpus) == 0 {
+		return ""
+	}
+	var idx []string
+	for i := 0; i < len(n.gpus); i++ {
+		if !n.gpus[i] {
+			continue
+		}
+		j := i
+		for j+1 < len(n.gpus) && n.gpus[j+1] {
+			j++
+		}
+		if j > i {
+			idx = append(idx, fmt.Sprintf("%d-%d", i, j))
+		} else {
+			idx = append(idx, strconv.Itoa(i))
+		}
+		i = j
+	}
+	list := "N/A"
+	if len(idx) > 0 {
+		list = strings.Join(idx, ",")
+	}
+	return fmt.Sprintf("%s%d(IDX:%s)", n.gresType(), n.allocGPUs(), list)
+}
+
+func (n *node) gresType() string {
+	if n.gpuModel == "" {
+		return "gpu:"
+	}
+	return "gpu:" + n.gpuModel + ":"
+}
+
+// Partitions returns every partition, in model order.
+func (c *Cluster) Partitions() []slurmrest.Partition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]slurmrest.Partition, 0, len(c.model.Partitions))
+	for _, pm := range c.model.Partitions {
+		var p slurmrest.Partition
+		p.Name = pm.Name
+		p.Partition.State = slurmrest.StringList{"UP"}
+		var names []string
+		for _, n := range c.nodes {
+			if slices.Contains(n.partitions, pm.Name) {
+				names = append(names, n.name)
+			}
+		}
+		p.Nodes.Configured = strings.Join(names, ",")
+		p.Nodes.Total = int64(len(names))
+		out = append(out, p)
+	}
+	return out
+}
+
+// Jobs returns the jobs slurmctld would still hold: pending, running, and
+// those that ended less than MinJobAge ago.
+func (c *Cluster) Jobs() []slurmrest.Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []slurmrest.Job
+	for _, j := range c.finished {
+		if c.now.Sub(j.end) < c.model.MinJobAge {
+			out = append(out, j.rest())
+		}
+	}
+	for _, j := range c.jobs {
+		out = append(out, j.rest())
+	}
+	slices.SortFunc(out, func(a, b slurmrest.Job) int { return cmp.Compare(a.JobID, b.JobID) })
+	return out
+}
+
+func (j *job) rest() slurmrest.Job {
+	tres := fmt.Sprintf("cpu=%d,mem=%dM,node=1,billing=%d", j.cpus, j.memoryMB, j.cpus)
+	if j.gpus > 0 {
+		tres += fmt.Sprintf(",gres/gpu=%d", j.gpus)
+	}
+	r := slurmrest.Job{
+		JobID:       j.id,
+		Name:        "job" + strconv.FormatInt(j.id, 10),
+		Account:     j.user.account.name,
+		UserName:    j.user.name,
+		Partition:   j.partition,
+		QOS:         "normal",
+		JobState:    slurmrest.StringList{j.state},
+		StateReason: j.reason,
+		CPUs:        number(j.cpus),
+		NodeCount:   number(1),
+		TRESReqStr:  tres,
+		SubmitTime:  unix(j.submit),
+		// Every job is eligible as soon as it is submitted: the model has no
+		// dependencies or begin times.
+		EligibleTime: unix(j.submit),
+		StartTime:    unix(j.start),
+		EndTime:      unix(j.end),
+		TimeLimit:    number(int64(j.timeLimit / time.Minute)),
+	}
+	if j.node != nil {
+		r.Nodes = j.node.name
+		r.TRESAllocStr = tres
+	}
+	return r
+}
+
+// Reservations returns the reservations that have not ended yet.
+func (c *Cluster) Reservations() []slurmrest.Reservation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []slurmrest.Reservation
+	for _, r := range c.reservations {
+		if !r.end.After(c.now) {
+			continue
+		}
+		var cores int64
+		for _, n := range c.nodes {
+			if slices.Contains(r.Nodes, n.name) {
+				cores += n.cpus
+			}
+		}
+		out = append(out, slurmrest.Reservation{
+			Name:      r.Name,
+			NodeList:  strings.Join(r.Nodes, ","),
+			NodeCount: int64(len(r.Nodes)),
+			CoreCount: cores,
+			Users:     strings.Join(r.Users, ","),
+			Accounts:  strings.Join(r.Accounts, ","),
+			Flags:     slices.Clone(r.Flags),
+			StartTime: unix(r.start),
+			EndTime:   unix(r.end),
+		})
+	}
+	return out
+}
+
+// Licenses returns every license pool and how much of it running jobs hold.
+func (c *Cluster) Licenses() []slurmrest.License {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]slurmrest.License, 0, len(c.licenses))
+	for _, l := range c.licenses {
+		out = append(out, slurmrest.License{Name: l.name, Total: l.total, Used: l.used, Free: l.total - l.used})
+	}
+	return out
+}
+
+// Statistics returns the sdiag report.
+func (c *Cluster) Statistics() slurmrest.Statistics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &c.stats
+	var pending, running int64
+	for _, j := range c.jobs {
+		if j.state == stateRunning {
+			running++
+		} else {
+			pending++
+		}
+	}
+	out := slurmrest.Statistics{
+		ReqTime:             unix(c.now),
+		ReqTimeStart:        unix(c.since),
+		ServerThreadCount:   3,
+		AgentCount:          0,
+		GettimeofdayLatency: 20,
+
+		JobsSubmitted: s.submitted,
+		JobsStarted:   s.started,
+		JobsCompleted: s.completed,
+		JobsCanceled:  s.cancelled,
+		JobsFailed:    s.failed,
+		JobsPending:   pending,
+		JobsRunning:   running,
+		JobStatesTime: unix(c.now),
+
+		ScheduleCycleLast:      s.cycleLast,
+		ScheduleCycleMax:       s.cycleMax,
+		ScheduleCycleTotal:     s.cycles,
+		ScheduleCyclePerMinute: s.perMinute,
+		ScheduleQueueLength:    pending,
+		// The queue is small enough for every cycle to reach its end.
+		ScheduleExit: slurmrest.ScheduleExit{EndJobQueue: s.cycles},
+
+		// The backfill scheduler runs on every tick alongside the main one,
+		// over the same queue.
+		BFBackfilledJobs:     s.backfilled,
+		BFLastBackfilledJobs: s.backfilled,
+		BFCycleCounter:       s.cycles,
+		BFCycleLast:          2 * s.cycleLast,
+		BFCycleMax:           2 * s.cycleMax,
+		BFLastDepth:          pending,
+		BFLastDepthTry:       pending,
+		BFQueueLen:           pending,
+		BFTableSize:          int64(len(c.nodes)),
+		BFWhenLastCycle:      unix(c.now),
+		BFActive:             false,
+		BFExit:               slurmrest.BFExit{EndJobQueue: s.cycles},
+	}
+	if s.cycles > 0 {
+		out.ScheduleCycleMean = s.cycleSum / s.cycles
+		out.ScheduleCycleMeanDepth = s.depthSum / s.cycles
+		out.BFCycleMean = 2 * out.ScheduleCycleMean
+		out.BFDepthMean = out.ScheduleCycleMeanDepth
+		out.BFDepthMeanTry = out.ScheduleCycleMeanDepth
+		out.BFQueueLenMean = out.ScheduleCycleMeanDepth
+		out.BFTableSizeMean = int64(len(c.nodes))
+	}
+	for _, r := range s.rpcTypes {
+		out.RPCsByMessageType = append(out.RPCsByMessageType, slurmrest.RPCStat{
+			MessageType: r.name, TypeID: r.id, Count: r.count, AverageTime: number(r.total / r.count), TotalTime: r.total,
+		})
+	}
+	for _, r := range s.rpcUsers {
+		out.RPCsByUser = append(out.RPCsByUser, slurmrest.UserRPCStat{
+			User: r.name, UserID: r.id, Count: r.count, AverageTime: number(r.total / r.count), TotalTime: r.total,
+		})
+	}
+	return out
+}
+
+// Association is one row of sshare: an account (User empty) or a user in it.
+type Association struct {
+	Account    string
+	User       string
+	RawShares  int64
+	NormShares float64
+	RawUsage   int64
+	NormUsage  float64
+	FairShare  float64
+}
+
+// Associations returns the account tree, each account followed by its users,
+// after a root row that holds the cluster's total usage and nothing else. The fairshare factor is
+// the classic 2^(-usage/shares) of each row, normalised against the cluster.
+func (c *Cluster) Associations() []Association {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var totalShares int64
+	var totalUsage float64
+	for _, a := range c.accounts {
+		totalShares += a.shares
+		for _, u := range a.users {
+			totalUsage += u.usage
+		}
+	}
+	norm := func(usage float64) float64 {
+		if totalUsage == 0 {
+			return 0
+		}
+		return usage / totalUsage
+	}
+	factor := func(normUsage, normShares float64) float64 {
+		return math.Pow(2, -normUsage/normShares)
+	}
+
+	out := []Association{{Account: "root", RawUsage: int64(totalUsage)}}
+	for _, a := range c.accounts {
+		var usage float64
+		for _, u := range a.users {
+			usage += u.usage
+		}
+		accShares := float64(a.shares) / float64(totalShares)
+		out = append(out, Association{
+			Account: a.name, RawShares: a.shares, NormShares: accShares,
+			RawUsage: int64(usage), NormUsage: norm(usage), FairShare: factor(norm(usage), accShares),
+		})
+		for _, u := range a.users {
+			userShares := 1 / float64(len(a.users))
+			out = append(out, Association{
+				Account: a.name, User: u.name, RawShares: 1, NormShares: userShares,
+				RawUsage: int64(u.usage), NormUsage: norm(u.usage), FairShare: factor(norm(u.usage), accShares*userShares),
+			})
+		}
+	}
+	return out
+}
+
+// StartRecord is one job that ran, as sacct -X reports its submission and
+// start.
+type StartRecord struct {
+	JobID     int64
+	Partition string
+	Account   string
+	Submit    time.Time
+	Start     time.Time
+}
+
+// Started returns the jobs that were running at some point in [from, to],
+// finished or not, in job ID order: what sacct --state RUNNING selects over
+// that window.
+func (c *Cluster) Started(from, to time.Time) []StartRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []StartRecord
+	for _, j := range slices.Concat(c.finished, c.jobs) {
+		if j.start.IsZero() || j.start.After(to) || (!j.end.IsZero() && j.end.Before(from)) {
+			continue
+		}
+		out = append(out, StartRecord{
+			JobID: j.id, Partition: j.partition, Account: j.user.account.name, Submit: j.submit, Start: j.start,
+		})
+	}
+	slices.SortFunc(out, func(a, b StartRecord) int { return cmp.Compare(a.JobID, b.JobID) })
+	return out
+}
+
+// AccountingRecord is one finished job, as sacct reports it.
+type AccountingRecord struct {
+	JobID    int64
+	User     string
+	Account  string
+	State    string
+	CPUs     int64
+	Elapsed  time.Duration
+	TotalCPU time.Duration
+	ReqMemMB int64
+	MaxRSSMB int64
+}
+
+// Accounting returns the jobs that ended in [from, to], in the states sacct
+// is asked for, in job ID order. A job cancelled before it started is left
+// out: it has no step to account.
+func (c *Cluster) Accounting(from, to time.Time) []AccountingRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []AccountingRecord
+	for _, j := range c.finished {
+		if j.end.Before(from) || j.end.After(to) || j.start.IsZero() {
+			continue
+		}
+		elapsed := j.end.Sub(j.start)
+		out = append(out, AccountingRecord{
+			JobID:    j.id,
+			User:     j.user.name,
+			Account:  j.user.account.name,
+			State:    j.state,
+			CPUs:     j.cpus,
+			Elapsed:  elapsed,
+			TotalCPU: time.Duration(float64(elapsed) * float64(j.cpus) * j.efficiency).Truncate(time.Second),
+			ReqMemMB: j.memoryMB,
+			MaxRSSMB: int64(float64(j.memoryMB) * j.memUsed),
+		})
+	}
+	slices.SortFunc(out, func(a, b AccountingRecord) int { return cmp.Compare(a.JobID, b.JobID) })
+	return out
+}
@@ -0,0 +1,85 @@
+package simulator
+
+import "time"
+
+// stats accumulates what sdiag reports.
+type stats struct {
+	submitted, started, completed, cancelled, failed int64
+	backfilled                                       int64
+
+	cycles, cycleLast, cycleMax, cycleSum, depthSum int64
+	perMinute                                       int64
+
+	rpcTypes []*rpcStat
+	rpcUsers []*rpcStat
+}
+
+// rpcStat is one row of either RPC table of sdiag.
+type rpcStat struct {
+	name  string
+	id    int64
+	count int64
+	total int64
+}
+
+// rpcTypes are the RPCs the simulation issues, with Slurm's message type ID
+// and a fixed cost in microseconds, so that the RPC tables move with the load
+// without drawing from the generator.
+var rpcTypes = map[string]struct{ id, cost int64 }{
+	"REQUEST_SUBMIT_BATCH_JOB":      {4003, 450},
+	"REQUEST_COMPLETE_BATCH_SCRIPT": {5018, 120},
+	"REQUEST_JOB_INFO":              {2003, 800},
+	"REQUEST_NODE_INFO":             {2007, 300},
+	"REQUEST_PARTITION_INFO":        {2009, 150},
+	"REQUEST_RESERVATION_INFO":      {2024, 60},
+	"REQUEST_LICENSE_INFO":          {1021, 40},
+	"REQUEST_STATS_INFO":            {2035, 90},
+	"REQUEST_SHARE_INFO":            {2022, 200},
+	"REQUEST_PING":                  {1008, 5},
+}
+
+// cycle records one main scheduling cycle over depth pending jobs. Its
+// duration grows with the depth, as a real one does.
+func (s *stats) cycle(depth int64, tick time.Duration) {
+	last := 100 + 20*depth
+	s.cycles++
+	s.cycleLast = last
+	s.cycleMax = max(s.cycleMax, last)
+	s.cycleSum += last
+	s.depthSum += depth
+	s.perMinute = int64(time.Minute / tick)
+}
+
+// rpc records one RPC of type name, issued by u, or by root (the controller's
+// own traffic and the exporter's queries) when u is nil.
+func (c *Cluster) rpc(name string, u *user) {
+	t := rpcTypes[name]
+	s := &c.stats
+	s.rpcTypes = addRPC(s.rpcTypes, name, t.id, t.cost)
+	if u == nil {
+		s.rpcUsers = addRPC(s.rpcUsers, "root", 0, t.cost)
+	} else {
+		s.rpcUsers = addRPC(s.rpcUsers, u.name, u.uid, t.cost)
+	}
+}
+
+func addRPC(rows []*rpcStat, name string, id, cost int64) []*rpcStat {
+	for _, r := range rows {
+		if r.name == name {
+			r.count++
+			r.total += cost
+			return rows
+		}
+	}
+	return append(rows, &rpcStat{name: name, id: id, count: 1, total: cost})
+}
+
+// Query records the RPC one exporter command costs the controller, so that
+// scraping shows up in the RPC tables as it does on a real cluster.
+func (c *Cluster) Query(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := rpcTypes[name]; ok {
+		c.rpc(name, nil)
+	}
+}
@@ -0,0 +1,182 @@
+// Package slurmrest is a minimal read-only client for slurmrestd, the Slurm
+// REST API daemon.
+//
+// It declares only the endpoints and fields the exporter reads. The types
+// follow the v0.0.41 OpenAPI schema (Slurm 24.05 and later), and tolerate the
+// places where neighbouring versions encode the same field differently, so
+// --slurm.rest.api-version can be moved one step either way without a code
+// change. Anything further away is untested.
+package slurmrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultVersion is the API version requested when none is configured.
+const DefaultVersion = "v0.0.41"
+
+// Options configures a Client.
+type Options struct {
+	// URL is the slurmrestd base address, for example http://slurmrestd:6820.
+	URL string
+	// Version is the API version path segment. Empty means DefaultVersion.
+	Version string
+	// User is sent as X-SLURM-USER-NAME. Required by slurmrestd when the
+	// token is an auth/jwt token issued to a different user than the one it
+	// names, and harmless otherwise.
+	User string
+	// TokenFile holds the JWT sent as X-SLURM-USER-TOKEN. It is read on every
+	// request, so a token rotated on disk (scontrol token lifespan=...) is
+	// picked up without a restart. Empty sends no token, for a slurmrestd
+	// behind an authenticating proxy.
+	TokenFile string
+	// HTTPClient overrides http.DefaultClient. Timeouts come from the request
+	// context, not from the client.
+	HTTPClient *http.Client
+}
+
+// Client queries one slurmrestd.
+type Client struct {
+	base      *url.URL
+	version   string
+	user      string
+	tokenFile string
+	http      *http.Client
+}
+
+// NewClient validates the options and returns a Client. Nothing is sent until
+// the first request.
+func NewClient(o Options) (*Client, error) {
+	if o.URL == "" {
+		return nil, errors.New("slurmrestd URL is required")
+	}
+	base, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing slurmrestd URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("slurmrestd URL %q: scheme must be http or https", o.URL)
+	}
+	if base.Path == "" {
+		base.Path = "/"
+	}
+	c := &Client{
+		base:      base,
+		version:   o.Version,
+		user:      o.User,
+		tokenFile: o.TokenFile,
+		http:      o.HTTPClient,
+	}
+	if c.version == "" {
+		c.version = DefaultVersion
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Version returns the API version the client requests.
+func (c *Client) Version() string { return c.version }
+
+// Jobs returns every job slurmctld still holds, terminal ones included until
+// MinJobAge expires them.
+func (c *Client) Jobs(ctx context.Context) (*JobsResponse, error) {
+	var r JobsResponse
+	return &r, c.get(ctx, "jobs", &r)
+}
+
+// Nodes returns every node.
+func (c *Client) Nodes(ctx context.Context) (*NodesResponse, error) {
+	var r NodesResponse
+	return &r, c.get(ctx, "nodes", &r)
+}
+
+// Partitions returns every partition, in slurm.conf order.
+func (c *Client) Partitions(ctx context.Context) (*PartitionsResponse, error) {
+	var r PartitionsResponse
+	return &r, c.get(ctx, "partitions", &r)
+}
+
+// Reservations returns every reservation.
+func (c *Client) Reservations(ctx context.Context) (*ReservationsResponse, error) {
+	var r ReservationsResponse
+	return &r, c.get(ctx, "reservations", &r)
+}
+
+// Licenses returns every license.
+func (c *Client) Licenses(ctx context.Context) (*LicensesResponse, error) {
+	var r LicensesResponse
+	return &r, c.get(ctx, "licenses", &r)
+}
+
+// Diag returns the scheduler statistics sdiag reports.
+func (c *Client) Diag(ctx context.Context) (*DiagResponse, error) {
+	var r DiagResponse
+	return &r, c.get(ctx, "diag", &r)
+}
+
+// Ping returns the reachability of every configured slurmctld.
+func (c *Client) Ping(ctx context.Context) (*PingResponse, error) {
+	var r PingResponse
+	return &r, c.get(ctx, "ping", &r)
+}
+
+// envelope is implemented by every response type through the embedded
+// Response.
+type envelope interface {
+	envelope() *Response
+}
+
+// get fetches /slurm/<version>/<endpoint> into out. A non-200 status, an
+// undecodable body, and a body whose errors array is non-empty are all errors;
+// slurmrestd reports most failures in that array with a 200 or a 500, so the
+// array is what carries the useful message.
+func (c *Client) get(ctx context.Context, endpoint string, out envelope) error {
+	u := c.base.JoinPath("slurm", c.version, endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.user != "" {
+		req.Header.Set("X-SLURM-USER-NAME", c.user)
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("reading slurmrestd token: %w", err)
+		}
+		req.Header.Set("X-SLURM-USER-TOKEN", strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	decodeErr := json.NewDecoder(resp.Body).Decode(out)
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr == nil {
+			if err := out.envelope().Err(); err != nil {
+				return fmt.Errorf("GET %s: %s: %w", u.Path, resp.Status, err)
+			}
+		}
+		return fmt.Errorf("GET %s: %s", u.Path, resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("decoding %s: %w", u.Path, decodeErr)
+	}
+	if err := out.envelope().Err(); err != nil {
+		return fmt.Errorf("GET %s: %w", u.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package slurmrest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient(Options{})
+	require.Error(t, err)
+
+	_, err = NewClient(Options{URL: "unix:///run/slurmrestd.sock"})
+	require.Error(t, err)
+
+	c, err := NewClient(Options{URL: "http://slurmrestd:6820"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultVersion, c.Version())
+
+	c, err = NewClient(Options{URL: "https://slurmrestd:6820", Version: "v0.0.42"})
+	require.NoError(t, err)
+	assert.Equal(t, "v0.0.42", c.Version())
+}
+
+// TestClientRequest checks the path and the auth headers, and that the token
+// file is read on every request so a rotated token is picked up.
+func TestClientRequest(t *testing.T) {
+	var gotPath, gotUser, gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser = r.Header.Get("X-SLURM-USER-NAME")
+		gotToken = r.Header.Get("X-SLURM-USER-TOKEN")
+		_, _ = w.Write([]byte(`{"meta": {"slurm": {"release": "24.11.7"}}, "pings": [{"hostname": "ctl", "pinged": "UP"}], "errors": []}`))
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("first\n"), 0o600))
+
+	c, err := NewClient(Options{URL: srv.URL + "/prefix", User: "slurm", TokenFile: tokenFile})
+	require.NoError(t, err)
+
+	r, err := c.Ping(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "/prefix/slurm/v0.0.41/ping", gotPath)
+	assert.Equal(t, "slurm", gotUser)
+	assert.Equal(t, "first", gotToken)
+	assert.Equal(t, "24.11.7", r.Meta.Slurm.Release)
+	require.Len(t, r.Pings, 1)
+	assert.Equal(t, "UP", r.Pings[0].Pinged)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("second"), 0o600))
+	_, err = c.Ping(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "second", gotToken)
+}
+
+func TestClientMissingTokenFile(t *testing.T) {
+	c, err := NewClient(Options{URL: "http://127.0.0.1:1", TokenFile: filepath.Join(t.TempDir(), "absent")})
+	require.NoError(t, err)
+	_, err = c.Nodes(context.Background())
+	require.ErrorContains(t, err, "reading slurmrestd token")
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"errors array with 200", http.StatusOK,
+			`{"errors": [{"error": "Unable to query nodes", "description": "slurmctld is down"}]}`,
+			"Unable to query nodes: slurmctld is down"},
+		{"errors array with 500", http.StatusInternalServerError,
+			`{"errors": [{"error": "Invalid authentication"}]}`,
+			"500 Internal Server Error: Invalid authentication"},
+		{"status without body", http.StatusUnauthorized, `Authentication failure`, "401 Unauthorized"},
+		{"undecodable body", http.StatusOK, `<html>`, "decoding /slurm/v0.0.41/nodes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c, err := NewClient(Options{URL: srv.URL})
+			require.NoError(t, err)
+			_, err = c.Nodes(context.Background())
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestNumberUnmarshal(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  Number
+		value int64
+	}{
+		{`{"set": true, "infinite": false, "number": 42}`, Number{Set: true, Number: 42}, 42},
+		{`{"set": false, "infinite": false, "number": 0}`, Number{}, 0},
+		{`{"set": true, "infinite": true, "number": 0}`, Number{Set: true, Infinite: true}, 0},
+		{`17`, Number{Set: true, Number: 17}, 17},
+		{`null`, Number{}, 0},
+	}
+	for _, tt := range tests {
+		var n Number
+		require.NoErrorf(t, json.Unmarshal([]byte(tt.in), &n), "%s", tt.in)
+		assert.Equalf(t, tt.want, n, "%s", tt.in)
+		assert.Equalf(t, tt.value, n.Value(), "%s", tt.in)
+	}
+}
+
+func TestNumberMarshal(t *testing.T) {
+	for _, n := range []Number{{Set: true, Number: 42}, {}, {Set: true, Infinite: true}} {
+		data, err := json.Marshal(n)
+		require.NoError(t, err)
+		var back Number
+		require.NoError(t, json.Unmarshal(data, &back))
+		assert.Equal(t, n, back)
+	}
+	data, err := json.Marshal(Number{Set: true, Number: 7})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"set": true, "infinite": false, "number": 7}`, string(data))
+}
+
+func TestStringListUnmarshal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want StringList
+	}{
+		{`["MIXED", "DRAIN"]`, StringList{"MIXED", "DRAIN"}},
+		{`"cpu,debug"`, StringList{"cpu", "debug"}},
+		{`""`, nil},
+		{`null`, nil},
+	}
+	for _, tt := range tests {
+		var l StringList
+		require.NoErrorf(t, json.Unmarshal([]byte(tt.in), &l), "%s", tt.in)
+		assert.Equalf(t, tt.want, l, "%s", tt.in)
+	}
+}
+
+// TestDecodeFixtures decodes every file of the JSON fixture, so a field whose
+// type drifts from the schema fails here rather than as a zero downstream.
+func TestDecodeFixtures(t *testing.T) {
+	dir := filepath.Join("..", "..", "test_data", "slurmrestd-"+DefaultVersion)
+	targets := map[string]envelope{
+		"jobs.json":         &JobsResponse{},
+		"nodes.json":        &NodesResponse{},
+		"partitions.json":   &PartitionsResponse{},
+		"reservations.json": &ReservationsResponse{},
+		"licenses.json":     &LicensesResponse{},
+		"diag.json":         &DiagResponse{},
+		"ping.json":         &PingResponse{},
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, len(targets))
+	for _, e := range entries {
+		out, ok := targets[e.Name()]
+		require.Truef(t, ok, "no response type for %s", e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		require.NoErrorf(t, json.Unmarshal(data, out), "%s", e.Name())
+		assert.Equalf(t, "24.11.7", out.envelope().Meta.Slurm.Release, "%s", e.Name())
+		assert.NoErrorf(t, out.envelope().Err(), "%s", e.Name())
+	}
+}
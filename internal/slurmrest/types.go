@@ -0,0 +1,412 @@
+package slurmrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Number is Slurm's optional integer, {"set": true, "infinite": false,
+// "number": 42}. "set": false means Slurm has no value, which is not the same
+// thing as zero: a job that has not started has no start time, not one in
+// 1970. Fields the schema later turned into this wrapper were bare integers in
+// older API versions, so a bare integer is accepted too.
+type Number struct {
+	Set      bool
+	Infinite bool
+	Number   int64
+}
+
+// UnmarshalJSON accepts the wrapper object, a bare integer and null.
+func (n *Number) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*n = Number{}
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		var v struct {
+			Set      bool  `json:"set"`
+			Infinite bool  `json:"infinite"`
+			Number   int64 `json:"number"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*n = Number(v)
+		return nil
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*n = Number{Set: true, Number: v}
+	return nil
+}
+
+// MarshalJSON writes the wrapper object, which every API version this package
+// reads accepts.
+func (n Number) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Set      bool  `json:"set"`
+		Infinite bool  `json:"infinite"`
+		Number   int64 `json:"number"`
+	}(n))
+}
+
+// Value returns the number, or 0 when Slurm reported none or infinity.
+func (n Number) Value() int64 {
+	if !n.Set || n.Infinite {
+		return 0
+	}
+	return n.Number
+}
+
+// StringList is a list Slurm sends either as a JSON array or, in the older
+// API versions and a few fields of the current ones, as one comma-separated
+// string.
+type StringList []string
+
+// UnmarshalJSON accepts an array of strings, a comma-separated string and null.
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*l = nil
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*l = nil
+			return nil
+		}
+		*l = strings.Split(s, ",")
+		return nil
+	}
+	var v []string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// Problem is one entry of the errors or warnings array every response carries.
+type Problem struct {
+	Description string `json:"description"`
+	ErrorNumber int    `json:"error_number"`
+	Error       string `json:"error"`
+	Source      string `json:"source"`
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Description != "" && p.Error != "":
+		return p.Error + ": " + p.Description
+	case p.Description != "":
+		return p.Description
+	default:
+		return p.Error
+	}
+}
+
+// Meta identifies the Slurm release that answered.
+type Meta struct {
+	Slurm struct {
+		Release string `json:"release"`
+		Cluster string `json:"cluster"`
+	} `json:"slurm"`
+}
+
+// Response is the envelope shared by every endpoint.
+type Response struct {
+	Meta     Meta      `json:"meta"`
+	Errors   []Problem `json:"errors"`
+	Warnings []Problem `json:"warnings"`
+}
+
+func (r *Response) envelope() *Response { return r }
+
+// Err folds the errors array into one error, or nil when it is empty.
+func (r *Response) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for _, p := range r.Errors {
+		errs = append(errs, errors.New(p.String()))
+	}
+	return errors.Join(errs...)
+}
+
+// ── /jobs ───────────────────────────────────────────────────────────────────
+
+// JobsResponse is GET /slurm/<version>/jobs.
+type JobsResponse struct {
+	Response
+	Jobs []Job `json:"jobs"`
+}
+
+// Job is one job record. Only the fields the exporter reads are declared.
+type Job struct {
+	JobID     int64  `json:"job_id"`
+	Name      string `json:"name"`
+	Account   string `json:"account"`
+	UserName  string `json:"user_name"`
+	Partition string `json:"partition"`
+	QOS       string `json:"qos"`
+	WCKey     string `json:"wckey"`
+	Comment   string `json:"comment"`
+	// JobState is the base state followed by its flags, for example
+	// ["RUNNING"] or ["COMPLETED", "COMPLETING"].
+	JobState        StringList `json:"job_state"`
+	StateReason     string     `json:"state_reason"`
+	CPUs            Number     `json:"cpus"`
+	NodeCount       Number     `json:"node_count"`
+	Nodes           string     `json:"nodes"`
+	TRESAllocStr    string     `json:"tres_alloc_str"`
+	TRESReqStr      string     `json:"tres_req_str"`
+	ArrayJobID      Number     `json:"array_job_id"`
+	ArrayTaskID     Number     `json:"array_task_id"`
+	ArrayTaskString string     `json:"array_task_string"`
+	SubmitTime      Number     `json:"submit_time"`
+	EligibleTime    Number     `json:"eligible_time"`
+	StartTime       Number     `json:"start_time"`
+	EndTime         Number     `json:"end_time"`
+	// TimeLimit is in minutes, Infinite for UNLIMITED.
+	TimeLimit Number `json:"time_limit"`
+}
+
+// ── /nodes ──────────────────────────────────────────────────────────────────
+
+// NodesResponse is GET /slurm/<version>/nodes.
+type NodesResponse struct {
+	Response
+	Nodes []Node `json:"nodes"`
+}
+
+// Node is one node record.
+type Node struct {
+	Name string `json:"name"`
+	// State is the base state followed by its flags, for example
+	// ["MIXED", "DRAIN"] or ["IDLE", "NOT_RESPONDING"]. Before v0.0.39 it
+	// was the base state alone, in lower case, with the flags in StateFlags.
+	// Read both through States.
+	State           StringList `json:"state"`
+	StateFlags      StringList `json:"state_flags"`
+	CPUs            int64      `json:"cpus"`
+	AllocCPUs       int64      `json:"alloc_cpus"`
+	AllocIdleCPUs   int64      `json:"alloc_idle_cpus"`
+	RealMemory      int64      `json:"real_memory"`
+	AllocMemory     int64      `json:"alloc_memory"`
+	FreeMem         Number     `json:"free_mem"`
+	Partitions      StringList `json:"partitions"`
+	GRES            string     `json:"gres"`
+	GRESUsed        string     `json:"gres_used"`
+	Features        StringList `json:"features"`
+	ActiveFeatures  StringList `json:"active_features"`
+	Reason          string     `json:"reason"`
+	ReasonSetByUser string     `json:"reason_set_by_user"`
+	ReasonChangedAt Number     `json:"reason_changed_at"`
+	Reservation     string     `json:"reservation"`
+	Version         string     `json:"version"`
+}
+
+// States returns the base state followed by its flags, whichever schema the
+// record came in.
+func (n *Node) States() []string {
+	if len(n.StateFlags) == 0 {
+		return n.State
+	}
+	states := make([]string, 0, len(n.State)+len(n.StateFlags))
+	for _, s := range n.State {
+		states = append(states, strings.ToUpper(s))
+	}
+	return append(states, n.StateFlags...)
+}
+
+// ── /partitions ─────────────────────────────────────────────────────────────
+
+// PartitionsResponse is GET /slurm/<version>/partitions.
+type PartitionsResponse struct {
+	Response
+	Partitions []Partition `json:"partitions"`
+}
+
+// Partition is one partition record.
+type Partition struct {
+	Name  string `json:"name"`
+	Nodes struct {
+		Configured string `json:"configured"`
+		Total      int64  `json:"total"`
+	} `json:"nodes"`
+	Partition struct {
+		State StringList `json:"state"`
+	} `json:"partition"`
+}
+
+// ── /reservations ───────────────────────────────────────────────────────────
+
+// ReservationsResponse is GET /slurm/<version>/reservations.
+type ReservationsResponse struct {
+	Response
+	Reservations []Reservation `json:"reservations"`
+}
+
+// Reservation is one reservation record.
+type Reservation struct {
+	Name      string     `json:"name"`
+	NodeList  string     `json:"node_list"`
+	NodeCount int64      `json:"node_count"`
+	CoreCount int64      `json:"core_count"`
+	Partition string     `json:"partition"`
+	Users     string     `json:"users"`
+	Accounts  string     `json:"accounts"`
+	Flags     StringList `json:"flags"`
+	StartTime Number     `json:"start_time"`
+	EndTime   Number     `json:"end_time"`
+}
+
+// ── /licenses ───────────────────────────────────────────────────────────────
+
+// LicensesResponse is GET /slurm/<version>/licenses.
+type LicensesResponse struct {
+	Response
+	Licenses []License `json:"licenses"`
+}
+
+// License is one license record. The capitalised keys are Slurm's own.
+type License struct {
+	Name     string `json:"LicenseName"`
+	Total    int64  `json:"Total"`
+	Used     int64  `json:"Used"`
+	Free     int64  `json:"Free"`
+	Reserved int64  `json:"Reserved"`
+	Remote   bool   `json:"Remote"`
+}
+
+// ── /diag ───────────────────────────────────────────────────────────────────
+
+// DiagResponse is GET /slurm/<version>/diag.
+type DiagResponse struct {
+	Response
+	Statistics Statistics `json:"statistics"`
+}
+
+// Statistics is the sdiag report.
+type Statistics struct {
+	ReqTime             Number `json:"req_time"`
+	ReqTimeStart        Number `json:"req_time_start"`
+	ServerThreadCount   int64  `json:"server_thread_count"`
+	AgentQueueSize      int64  `json:"agent_queue_size"`
+	AgentCount          int64  `json:"agent_count"`
+	AgentThreadCount    int64  `json:"agent_thread_count"`
+	DBDAgentQueueSize   int64  `json:"dbd_agent_queue_size"`
+	GettimeofdayLatency int64  `json:"gettimeofday_latency"`
+
+	JobsSubmitted int64 `json:"jobs_submitted"`
+	JobsStarted   int64 `json:"jobs_started"`
+	JobsCompleted int64 `json:"jobs_completed"`
+	JobsCanceled  int64 `json:"jobs_canceled"`
+	JobsFailed    int64 `json:"jobs_failed"`
+	JobsPending   int64 `json:"jobs_pending"`
+	JobsRunning   int64 `json:"jobs_running"`
+	// JobStatesTime is when slurmctld last counted the pending and running
+	// jobs: it does so on its own schedule, not on every sdiag.
+	JobStatesTime Number `json:"job_states_ts"`
+
+	ScheduleCycleLast      int64        `json:"schedule_cycle_last"`
+	ScheduleCycleMax       int64        `json:"schedule_cycle_max"`
+	ScheduleCycleTotal     int64        `json:"schedule_cycle_total"`
+	ScheduleCycleMean      int64        `json:"schedule_cycle_mean"`
+	ScheduleCycleMeanDepth int64        `json:"schedule_cycle_mean_depth"`
+	ScheduleCyclePerMinute int64        `json:"schedule_cycle_per_minute"`
+	ScheduleQueueLength    int64        `json:"schedule_queue_length"`
+	ScheduleExit           ScheduleExit `json:"schedule_exit"`
+
+	BFBackfilledJobs     int64  `json:"bf_backfilled_jobs"`
+	BFLastBackfilledJobs int64  `json:"bf_last_backfilled_jobs"`
+	BFBackfilledHetJobs  int64  `json:"bf_backfilled_het_jobs"`
+	BFCycleCounter       int64  `json:"bf_cycle_counter"`
+	BFCycleMean          int64  `json:"bf_cycle_mean"`
+	BFCycleLast          int64  `json:"bf_cycle_last"`
+	BFCycleMax           int64  `json:"bf_cycle_max"`
+	BFDepthMean          int64  `json:"bf_depth_mean"`
+	BFDepthMeanTry       int64  `json:"bf_depth_mean_try"`
+	BFLastDepth          int64  `json:"bf_last_depth"`
+	BFLastDepthTry       int64  `json:"bf_last_depth_try"`
+	BFQueueLen           int64  `json:"bf_queue_len"`
+	BFQueueLenMean       int64  `json:"bf_queue_len_mean"`
+	BFTableSize          int64  `json:"bf_table_size"`
+	BFTableSizeMean      int64  `json:"bf_table_size_mean"`
+	BFWhenLastCycle      Number `json:"bf_when_last_cycle"`
+	BFActive             bool   `json:"bf_active"`
+	BFExit               BFExit `json:"bf_exit"`
+
+	RPCsByMessageType []RPCStat     `json:"rpcs_by_message_type"`
+	RPCsByUser        []UserRPCStat `json:"rpcs_by_user"`
+	PendingRPCs       []PendingRPC  `json:"pending_rpcs"`
+}
+
+// ScheduleExit counts the main scheduler cycles by the reason they ended.
+type ScheduleExit struct {
+	EndJobQueue       int64 `json:"end_job_queue"`
+	DefaultQueueDepth int64 `json:"default_queue_depth"`
+	MaxJobStart       int64 `json:"max_job_start"`
+	MaxRPCCnt         int64 `json:"max_rpc_cnt"`
+	MaxSchedTime      int64 `json:"max_sched_time"`
+	Licenses          int64 `json:"licenses"`
+}
+
+// BFExit counts the backfill cycles by the reason they ended.
+type BFExit struct {
+	EndJobQueue     int64 `json:"end_job_queue"`
+	BFMaxJobStart   int64 `json:"bf_max_job_start"`
+	BFMaxJobTest    int64 `json:"bf_max_job_test"`
+	BFMaxTime       int64 `json:"bf_max_time"`
+	BFNodeSpaceSize int64 `json:"bf_node_space_size"`
+	StateChanged    int64 `json:"state_changed"`
+}
+
+// PendingRPC is one row of the pending RPC table: the RPCs of one type
+// slurmctld's agent has queued for the nodes and not sent yet.
+type PendingRPC struct {
+	MessageType string `json:"message_type"`
+	TypeID      int64  `json:"type_id"`
+	Count       int64  `json:"count"`
+}
+
+// RPCStat is one row of the per-message-type RPC table.
+type RPCStat struct {
+	MessageType string `json:"message_type"`
+	TypeID      int64  `json:"type_id"`
+	Count       int64  `json:"count"`
+	AverageTime Number `json:"average_time"`
+	TotalTime   int64  `json:"total_time"`
+}
+
+// UserRPCStat is one row of the per-user RPC table.
+type UserRPCStat struct {
+	User        string `json:"user"`
+	UserID      int64  `json:"user_id"`
+	Count       int64  `json:"count"`
+	AverageTime Number `json:"average_time"`
+	TotalTime   int64  `json:"total_time"`
+}
+
+// ── /ping ───────────────────────────────────────────────────────────────────
+
+// PingResponse is GET /slurm/<version>/ping.
+type PingResponse struct {
+	Response
+	Pings []Ping `json:"pings"`
+}
+
+// Ping is the reachability of one slurmctld.
+type Ping struct {
+	Hostname string `json:"hostname"`
+	Pinged   string `json:"pinged"`
+	Latency  int64  `json:"latency"`
+	Mode     string `json:"mode"`
+}
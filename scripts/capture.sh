@@ -197,12 +197,23 @@ ANONEOF
 # than aborting: a partial capture is still useful, as long as it says so.
 run_step() {
     name=$1; shift
+    capture "$name" "$name.txt" "$@"
+}
+
+# run_json_step is run_step for the --json forms read under --slurm.json.
+run_json_step() {
+    name=$1; shift
+    capture "$name --json" "$name.json" "$@"
+}
+
+capture() {
+    name=$1; file=$2; shift 2
     if "$@" > "$OUTDIR/.raw" 2>"$OUTDIR/.err"; then
         status=ok
     else
         status=FAILED
     fi
-    awk -v mapfile="$MAP" -f "$AWK" < "$OUTDIR/.raw" > "$OUTDIR/$name.txt"
+    awk -v mapfile="$MAP" -f "$AWK" < "$OUTDIR/.raw" > "$OUTDIR/$file"
     printf '%-22s %-8s %s\n' "$name" "$status" "$*" >> "$PROV"
     [ "$status" = ok ] || printf '    stderr: %s\n' "$(head -1 "$OUTDIR/.err")" >> "$PROV"
 }
@@ -221,6 +232,8 @@ build_map
 } > "$PROV"
 
 run_step squeue_jobs            squeue '-a' '-r' '-h' '-O' 'JobID:|,Account:|,UserName:|,Partition:|,State:|,NumNodes:|,NumCPUs:|,tres-alloc:'
+run_step running_jobs           squeue '-a' '-r' '-h' '--states=running' '-O' 'JobID:|,Account:|,UserName:|,Partition:|,NumNodes:|,NumCPUs:|,tres-alloc:|,StartTime:|,TimeLimit:|,NodeList:|,QOS:|,WCKey:|,Name:|,Comment:'
+run_step job_wait               squeue '-a' '-r' '-h' '--states=running' '-O' 'JobID:|,Partition:|,Account:|,SubmitTime:|,StartTime:'
 run_step queue_all_states       squeue '-h' '-o' '%P|%T|%C|%r|%u' '--states=all'
 run_step queue_default_states   squeue '-h' '-o' '%P|%T|%C|%r|%u'
 run_step cpus                   sinfo '-h' '-o' '%C'
@@ -235,8 +248,13 @@ run_step drain_reason           sinfo '-h' '-N' '-o' '%N|%E|%H|%T'
 run_step reservations           scontrol 'show' 'reservation'
 run_step licenses               scontrol 'show' 'licenses' '-o'
 run_step scheduler              sdiag
+run_step controller_ping        scontrol 'ping'
+run_json_step squeue            squeue '--json'
+run_json_step scontrol_nodes    scontrol 'show' 'nodes' '--json'
+run_json_step sdiag             sdiag '--json'
 
 if [ "$WITH_SACCT" = 1 ]; then
+    run_step job_wait_started       sacct '-a' '-X' '-P' '-n' '--starttime' "$(date -d "-1 minute" +%Y-%m-%dT%H:%M:%S)" '--endtime' "$(date +%Y-%m-%dT%H:%M:%S)" '--format' 'JobID,Partition,Account,Submit,Start' '--state' 'RUNNING'
     run_step sacct_efficiency       sacct '-P' '-n' '--starttime' "$(date -d "-1 hour" +%Y-%m-%dT%H:%M:%S)" '--endtime' "$(date +%Y-%m-%dT%H:%M:%S)" '--format' 'JobID,User,Account,AllocCPUS,Elapsed,TotalCPU,CPUTime,MaxRSS,ReqMem' '--state' 'COMPLETED,FAILED,TIMEOUT,CANCELLED'
 fi
 
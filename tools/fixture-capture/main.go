@@ -74,6 +74,8 @@ type captureStep struct {
 	Name   string
 	Binary string
 	Args   string // already shell-quoted, empty when the command takes none
+	// JSON marks a --json form, written to $Name.json rather than $Name.txt.
+	JSON bool
 	// Expensive marks a command that queries SlurmDBD. Not "has an opt-in
 	// flag": queue_default_states carries one too, but it is a *disable* flag
 	// on a cheap controller query, and grouping on the flag's presence put it
@@ -116,6 +118,21 @@ func steps() []captureStep {
 			Expensive: c.Binary == "sacct",
 		})
 	}
+
+	// The --json forms come last, once each: several commands share one. On a
+	// release older than 21.08 they fail, and the provenance file says so.
+	for _, f := range collector.JSONForms() {
+		parts := make([]string, 0, len(f.Args))
+		for _, a := range f.Args {
+			parts = append(parts, shQuote(a))
+		}
+		out = append(out, captureStep{
+			Name:   f.Name,
+			Binary: f.Binary,
+			Args:   strings.Join(parts, " "),
+			JSON:   true,
+		})
+	}
 	return out
 }
 
@@ -249,12 +266,23 @@ func render() []byte {
 		"# than aborting: a partial capture is still useful, as long as it says so.",
 		"run_step() {",
 		"    name=$1; shift",
+		"    capture \"$name\" \"$name.txt\" \"$@\"",
+		"}",
+		"",
+		"# run_json_step is run_step for the --json forms read under --slurm.json.",
+		"run_json_step() {",
+		"    name=$1; shift",
+		"    capture \"$name --json\" \"$name.json\" \"$@\"",
+		"}",
+		"",
+		"capture() {",
+		"    name=$1; file=$2; shift 2",
 		"    if \"$@\" > \"$OUTDIR/.raw\" 2>\"$OUTDIR/.err\"; then",
 		"        status=ok",
 		"    else",
 		"        status=FAILED",
 		"    fi",
-		"    awk -v mapfile=\"$MAP\" -f \"$AWK\" < \"$OUTDIR/.raw\" > \"$OUTDIR/$name.txt\"",
+		"    awk -v mapfile=\"$MAP\" -f \"$AWK\" < \"$OUTDIR/.raw\" > \"$OUTDIR/$file\"",
 		"    printf '%-22s %-8s %s\\n' \"$name\" \"$status\" \"$*\" >> \"$PROV\"",
 		"    [ \"$status\" = ok ] || printf '    stderr: %s\\n' \"$(head -1 \"$OUTDIR/.err\")\" >> \"$PROV\"",
 		"}",
@@ -275,6 +303,10 @@ func render() []byte {
 	)
 
 	for _, s := range always {
+		if s.JSON {
+			w(strings.TrimRight(fmt.Sprintf("run_json_step %-17s %s %s", s.Name, s.Binary, s.Args), " "))
+			continue
+		}
 		w(strings.TrimRight(fmt.Sprintf("run_step %-22s %s %s", s.Name, s.Binary, s.Args), " "))
 	}
 	w("")
@@ -158,22 +158,31 @@ func renderCommands(b *strings.Builder) {
 
 		if len(c.Fixtures) == 0 {
 			fmt.Fprintf(b, "\n**No fixture.** %s\n", c.NoFixtureReason)
-			continue
+		} else {
+			renderFixtures(b, c.Fixtures)
 		}
 
-		b.WriteString("\n| Fixture | Slurm | What it protects |\n")
-		b.WriteString("|---|---|---|\n")
-		for _, f := range c.Fixtures {
-			version := f.Slurm
-			if version == "" {
-				version = "unrecorded"
-			}
-			fmt.Fprintf(b, "| `%s` | %s | %s |\n", f.File, version, f.Why)
+		if j := c.JSON; j != nil {
+			fmt.Fprintf(b, "\nUnder `--slurm.json=%s`, read from:\n\n", c.Name)
+			fmt.Fprintf(b, "```sh\n%s %s\n```\n", j.Binary, strings.Join(j.Args, " "))
+			renderFixtures(b, j.Fixtures)
 		}
 	}
 	b.WriteString("\n")
 }
 
+func renderFixtures(b *strings.Builder, fixtures []collector.Fixture) {
+	b.WriteString("\n| Fixture | Slurm | What it protects |\n")
+	b.WriteString("|---|---|---|\n")
+	for _, f := range fixtures {
+		version := f.Slurm
+		if version == "" {
+			version = "unrecorded"
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %s |\n", f.File, version, f.Why)
+	}
+}
+
 // renderCoverage names the commands running against no captured output. Left
 // implicit, a gap reads as coverage, which is the habit #177 broke for the GPU
 // matrix.